@@ -88,18 +88,29 @@ type HelmAsset struct {
 	// Local is an escape hatch, most impls will use github or some sort of ChartMuseum thing
 	Local      *LocalHelmOpts `json:"local,omitempty" yaml:"local,omitempty" hcl:"local,omitempty"`
 	ValuesFrom *ValuesFrom    `json:"values_from,omitempty" yaml:"values_from,omitempty" hcl:"values_from,omitempty"`
+	// HooksDest is where resources annotated with helm.sh/hook are written instead of dest, a directory per hook event.
+	// It defaults to hooks/, or hooks/<name> for a chart rendered to base/<name>
+	HooksDest string `json:"hooks_dest,omitempty" yaml:"hooks_dest,omitempty" hcl:"hooks_dest,omitempty"`
+	// DropTestHooks leaves out the chart's helm test hooks
+	DropTestHooks bool `json:"drop_test_hooks,omitempty" yaml:"drop_test_hooks,omitempty" hcl:"drop_test_hooks,omitempty"`
 }
 
 type ValuesFrom struct {
 	Lifecycle *ValuesFromLifecycle `json:"lifecycle,omitempty" yaml:"lifecycle,omitempty" hcl:"lifecycle,omitempty"`
 }
 
-type ValuesFromLifecycle struct{}
+type ValuesFromLifecycle struct {
+	// Upstream is the named upstream whose helm values are used, when the application is composed of several
+	Upstream string `json:"upstream,omitempty" yaml:"upstream,omitempty" hcl:"upstream,omitempty"`
+}
 
 // LocalHelmOpts specifies a helm chart that should be templated
 // using other assets that are already present at `ChartRoot`
 type LocalHelmOpts struct {
 	ChartRoot string `json:"chart_root" yaml:"chart_root" hcl:"chart_root"`
+	// ChartAPIVersion is the apiVersion of the chart, v1 or v2, as detected when it was fetched.
+	// It's read from the chart's Chart.yaml if it isn't set.
+	ChartAPIVersion string `json:"chart_api_version,omitempty" yaml:"chart_api_version,omitempty" hcl:"chart_api_version,omitempty"`
 }
 
 type HelmFetch struct {
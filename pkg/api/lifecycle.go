@@ -2,8 +2,12 @@ package api
 
 import (
 	"fmt"
+	"path"
+	"strings"
 
+	"github.com/pkg/errors"
 	"github.com/replicatedhq/ship/pkg/constants"
+	"k8s.io/apimachinery/pkg/util/validation"
 )
 
 // A Lifecycle  is the top-level lifecycle object
@@ -109,6 +113,24 @@ type Kustomize struct {
 	Base       string `json:"base,omitempty" yaml:"base,omitempty" hcl:"base,omitempty"`
 	Dest       string `json:"dest,omitempty" yaml:"dest,omitempty" hcl:"dest,omitempty"`
 	Overlay    string `json:"overlay,omitempty" yaml:"overlay,omitempty" hcl:"overlay,omitempty"`
+	// Hooks is the tree helm hooks were rendered to. The hooks for each event are written next to Dest, in the order they run
+	Hooks string `json:"hooks,omitempty" yaml:"hooks,omitempty" hcl:"hooks,omitempty"`
+}
+
+// HelmHookEvents are the helm.sh/hook events rendered hooks are grouped by, one directory each
+var HelmHookEvents = []string{
+	"crd-install",
+	"pre-install",
+	"post-install",
+	"pre-upgrade",
+	"post-upgrade",
+	"pre-rollback",
+	"post-rollback",
+	"pre-delete",
+	"post-delete",
+	"test",
+	"test-success",
+	"test-failure",
 }
 
 func (k *Kustomize) OverlayPath() string {
@@ -118,6 +140,39 @@ func (k *Kustomize) OverlayPath() string {
 	return k.Overlay
 }
 
+// EnvironmentOverlayPath is the path of a named environment overlay,
+// a sibling of the ship overlay that uses it as a base
+func (k *Kustomize) EnvironmentOverlayPath(name string) (string, error) {
+	if err := ValidateOverlayName(name); err != nil {
+		return "", err
+	}
+	return path.Join(path.Dir(k.OverlayPath()), name), nil
+}
+
+// ValidateOverlayName checks that an overlay name is a DNS label, so the overlay's directory
+// is always a single path segment next to the ship overlay
+func ValidateOverlayName(name string) error {
+	if errs := validation.IsDNS1123Label(name); len(errs) > 0 {
+		return errors.Errorf("invalid overlay name %q: %s", name, strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// EnvironmentDest is the path the built yaml for a named environment overlay is written to,
+// e.g. rendered.yaml -> rendered-prod.yaml
+func (k *Kustomize) EnvironmentDest(name string) string {
+	if k.Dest == "" {
+		return ""
+	}
+	ext := path.Ext(k.Dest)
+	return fmt.Sprintf("%s-%s%s", strings.TrimSuffix(k.Dest, ext), name, ext)
+}
+
+// HookDest is the path the hooks for a helm hook event are written to, e.g. rendered.yaml -> rendered-pre-install.yaml
+func (k *Kustomize) HookDest(event string) string {
+	return k.EnvironmentDest(event)
+}
+
 func (k *Kustomize) Shared() *StepShared { return &k.StepShared }
 func (k *Kustomize) ShortName() string   { return "kustomize" }
 
@@ -163,6 +218,10 @@ type KubectlApply struct {
 	StepShared `json:",inline" yaml:",inline" hcl:",inline"`
 	Path       string `json:"path,omitempty" yaml:"path,omitempty" hcl:"path,omitempty"`
 	Kubeconfig string `json:"kubeconfig,omitempty" yaml:"kubeconfig,omitempty" hcl:"kubeconfig,omitempty"`
+	// Hooks is the tree helm hooks were rendered to. The pre hooks for HookEvent are applied before path, and the post hooks after
+	Hooks string `json:"hooks,omitempty" yaml:"hooks,omitempty" hcl:"hooks,omitempty"`
+	// HookEvent is install or upgrade, defaulting to install
+	HookEvent string `json:"hook_event,omitempty" yaml:"hook_event,omitempty" hcl:"hook_event,omitempty"`
 }
 
 func (k *KubectlApply) Shared() *StepShared { return &k.StepShared }
@@ -150,3 +150,61 @@ lifecycle:
 		})
 	}
 }
+
+func TestEnvironmentOverlayPath(t *testing.T) {
+	tests := []struct {
+		name      string
+		overlay   string
+		expect    string
+		expectErr bool
+	}{
+		{
+			name:    "environment",
+			overlay: "prod",
+			expect:  "overlays/prod",
+		},
+		{
+			name:    "with a dash",
+			overlay: "us-east-1",
+			expect:  "overlays/us-east-1",
+		},
+		{
+			name:      "parent dir",
+			overlay:   "../../base",
+			expectErr: true,
+		},
+		{
+			name:      "nested",
+			overlay:   "prod/east",
+			expectErr: true,
+		},
+		{
+			name:      "dot",
+			overlay:   ".",
+			expectErr: true,
+		},
+		{
+			name:      "uppercase",
+			overlay:   "Prod",
+			expectErr: true,
+		},
+		{
+			name:      "empty",
+			expectErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := require.New(t)
+			step := Kustomize{Overlay: "overlays/ship"}
+
+			overlayPath, err := step.EnvironmentOverlayPath(test.overlay)
+			if test.expectErr {
+				req.Error(err)
+				return
+			}
+			req.NoError(err)
+			req.Equal(test.expect, overlayPath)
+		})
+	}
+}
@@ -43,6 +43,7 @@ type GithubFile struct {
 type ShipAppMetadata struct {
 	Description  string `json:"description" yaml:"description" hcl:"description" meta:"description"`
 	Version      string `json:"version" yaml:"version" hcl:"version" meta:"version"`
+	AppVersion   string `json:"appVersion,omitempty" yaml:"appVersion,omitempty" hcl:"appVersion,omitempty" meta:"app-version"`
 	Icon         string `json:"icon" yaml:"icon" hcl:"icon" meta:"icon"`
 	Name         string `json:"name" yaml:"name" hcl:"name" meta:"name"`
 	Readme       string `json:"readme" yaml:"readme" hcl:"readme" meta:"readme"`
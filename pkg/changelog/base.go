@@ -0,0 +1,165 @@
+package changelog
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+var documentSeparator = regexp.MustCompile(`(?m)^---\s*$`)
+
+// resource is a rendered kubernetes resource, just the parts a changelog needs
+type resource struct {
+	Kind     string `yaml:"kind"`
+	Metadata struct {
+		Name      string `yaml:"name"`
+		Namespace string `yaml:"namespace"`
+	} `yaml:"metadata"`
+	// containers are the images of each container in the resource's pod spec, by container name
+	containers map[string]string
+}
+
+// id is how the resource is shown to users, e.g. Deployment/web/nginx
+func (r resource) id() string {
+	if r.Metadata.Namespace == "" {
+		return fmt.Sprintf("%s/%s", r.Kind, r.Metadata.Name)
+	}
+	return fmt.Sprintf("%s/%s/%s", r.Kind, r.Metadata.Namespace, r.Metadata.Name)
+}
+
+// readBase reads every resource in the yaml files under base, keyed by id. A base that doesn't exist has no resources.
+func (b *Builder) readBase(base string) (map[string]resource, error) {
+	resources := map[string]resource{}
+	if base == "" {
+		return resources, nil
+	}
+	if exists, err := b.FS.Exists(base); err != nil || !exists {
+		return resources, err
+	}
+
+	err := b.FS.Walk(base, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || info.Name() == "kustomization.yaml" {
+			return nil
+		}
+		if ext := filepath.Ext(path); ext != ".yaml" && ext != ".yml" {
+			return nil
+		}
+
+		contents, err := b.FS.ReadFile(path)
+		if err != nil {
+			return errors.Wrapf(err, "read %s", path)
+		}
+		for _, document := range documentSeparator.Split(string(contents), -1) {
+			if strings.TrimSpace(document) == "" {
+				continue
+			}
+			parsed, err := parseResource([]byte(document))
+			if err != nil {
+				return errors.Wrapf(err, "parse %s", path)
+			}
+			if parsed.Kind == "" {
+				continue
+			}
+			resources[parsed.id()] = parsed
+		}
+		return nil
+	})
+	return resources, err
+}
+
+func parseResource(document []byte) (resource, error) {
+	var parsed resource
+	if err := yaml.Unmarshal(document, &parsed); err != nil {
+		return parsed, err
+	}
+	var contents interface{}
+	if err := yaml.Unmarshal(document, &contents); err != nil {
+		return parsed, err
+	}
+	parsed.containers = map[string]string{}
+	findContainers(contents, parsed.containers)
+	return parsed, nil
+}
+
+// findContainers walks a resource for containers and initContainers lists, wherever the pod spec is nested
+func findContainers(value interface{}, containers map[string]string) {
+	switch typed := value.(type) {
+	case map[interface{}]interface{}:
+		for key, child := range typed {
+			if key == "containers" || key == "initContainers" {
+				if list, ok := child.([]interface{}); ok {
+					for _, item := range list {
+						container, ok := item.(map[interface{}]interface{})
+						if !ok {
+							continue
+						}
+						name, _ := container["name"].(string)
+						image, _ := container["image"].(string)
+						if name != "" && image != "" {
+							containers[name] = image
+						}
+					}
+					continue
+				}
+			}
+			findContainers(child, containers)
+		}
+	case []interface{}:
+		for _, child := range typed {
+			findContainers(child, containers)
+		}
+	}
+}
+
+// imageChanges finds containers that are in both versions of a resource, with different images
+func imageChanges(from, to map[string]resource) []ImageChange {
+	changes := []ImageChange{}
+	for id, toResource := range to {
+		fromResource, ok := from[id]
+		if !ok {
+			continue
+		}
+		for name, toImage := range toResource.containers {
+			fromImage, ok := fromResource.containers[name]
+			if !ok || fromImage == toImage {
+				continue
+			}
+
+			change := ImageChange{Resource: id, Container: name, From: fromImage, To: toImage}
+			fromRepo, fromTag := splitImage(fromImage)
+			toRepo, toTag := splitImage(toImage)
+			if fromRepo == toRepo {
+				change.Repository, change.From, change.To = toRepo, fromTag, toTag
+			}
+			changes = append(changes, change)
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].Resource != changes[j].Resource {
+			return changes[i].Resource < changes[j].Resource
+		}
+		return changes[i].Container < changes[j].Container
+	})
+	return changes
+}
+
+// splitImage splits an image into its repository and its tag or digest, which is latest if there's neither
+func splitImage(image string) (string, string) {
+	if at := strings.Index(image, "@"); at != -1 {
+		return image[:at], image[at+1:]
+	}
+	// a colon before the last slash is a registry port, not a tag
+	if colon := strings.LastIndex(image, ":"); colon > strings.LastIndex(image, "/") {
+		return image[:colon], image[colon+1:]
+	}
+	return image, "latest"
+}
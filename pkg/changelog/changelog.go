@@ -0,0 +1,320 @@
+package changelog
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/spf13/afero"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	ValueAdded   = "added"
+	ValueRemoved = "removed"
+	ValueChanged = "changed"
+)
+
+// Snapshot is one side of a changelog: the base an upstream was rendered to, and what's known about the version it was rendered from
+type Snapshot struct {
+	// Base is the directory the upstream was rendered to
+	Base         string
+	ContentSHA   string
+	ChartVersion string
+	AppVersion   string
+	// Values is the default values.yaml shipped with the chart
+	Values string
+}
+
+// Change is a version that was bumped
+type Change struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// ImageChange is a container whose image changed, usually just its tag
+type ImageChange struct {
+	// Resource is the resource the container is in, like Deployment/web/nginx
+	Resource  string `json:"resource"`
+	Container string `json:"container"`
+	// Repository is set when only the tag or digest changed
+	Repository string `json:"repository,omitempty"`
+	From       string `json:"from"`
+	To         string `json:"to"`
+}
+
+// ValueChange is a default value in the chart's values.yaml that was added, removed or changed
+type ValueChange struct {
+	// Key is the path to the value, like image.tag
+	Key    string      `json:"key"`
+	Change string      `json:"change"`
+	From   interface{} `json:"from,omitempty"`
+	To     interface{} `json:"to,omitempty"`
+}
+
+// Changelog is what changed in an upstream between two of its versions
+type Changelog struct {
+	// Name is the name of the upstream, if the app has several named upstreams
+	Name             string        `json:"name,omitempty"`
+	ContentSHA       *Change       `json:"contentSHA,omitempty"`
+	ChartVersion     *Change       `json:"chartVersion,omitempty"`
+	AppVersion       *Change       `json:"appVersion,omitempty"`
+	Images           []ImageChange `json:"images"`
+	AddedResources   []string      `json:"addedResources"`
+	RemovedResources []string      `json:"removedResources"`
+	Values           []ValueChange `json:"values"`
+}
+
+// Builder builds changelogs from base trees on the filesystem
+type Builder struct {
+	Logger log.Logger
+	FS     afero.Afero
+}
+
+// NewBuilder gets a changelog builder
+func NewBuilder(logger log.Logger, fs afero.Afero) *Builder {
+	return &Builder{Logger: logger, FS: fs}
+}
+
+// Build compares two snapshots of an upstream. A base that doesn't exist is treated as empty.
+func (b *Builder) Build(from, to Snapshot) (*Changelog, error) {
+	debug := level.Debug(log.With(b.Logger, "struct", "changelog.builder", "method", "build"))
+
+	changelog := &Changelog{
+		ContentSHA:       change(from.ContentSHA, to.ContentSHA),
+		ChartVersion:     change(from.ChartVersion, to.ChartVersion),
+		AppVersion:       change(from.AppVersion, to.AppVersion),
+		Images:           []ImageChange{},
+		AddedResources:   []string{},
+		RemovedResources: []string{},
+		Values:           []ValueChange{},
+	}
+
+	debug.Log("event", "base.read", "from", from.Base, "to", to.Base)
+	fromResources, err := b.readBase(from.Base)
+	if err != nil {
+		return nil, errors.Wrapf(err, "read %s", from.Base)
+	}
+	toResources, err := b.readBase(to.Base)
+	if err != nil {
+		return nil, errors.Wrapf(err, "read %s", to.Base)
+	}
+
+	for id := range toResources {
+		if _, ok := fromResources[id]; !ok {
+			changelog.AddedResources = append(changelog.AddedResources, id)
+		}
+	}
+	for id := range fromResources {
+		if _, ok := toResources[id]; !ok {
+			changelog.RemovedResources = append(changelog.RemovedResources, id)
+		}
+	}
+	sort.Strings(changelog.AddedResources)
+	sort.Strings(changelog.RemovedResources)
+
+	changelog.Images = imageChanges(fromResources, toResources)
+
+	// without both versions of values.yaml, every value would look added or removed
+	if strings.TrimSpace(from.Values) != "" && strings.TrimSpace(to.Values) != "" {
+		changelog.Values, err = valueChanges(from.Values, to.Values)
+		if err != nil {
+			return nil, errors.Wrap(err, "compare default values")
+		}
+	}
+	return changelog, nil
+}
+
+// Empty is true if nothing but the content SHA changed
+func (c *Changelog) Empty() bool {
+	return c.ChartVersion == nil && c.AppVersion == nil && len(c.Images) == 0 &&
+		len(c.AddedResources) == 0 && len(c.RemovedResources) == 0 && len(c.Values) == 0
+}
+
+// String is the changelog as plain text, a section for each kind of change
+func (c *Changelog) String() string {
+	var lines []string
+	if c.ChartVersion != nil {
+		lines = append(lines, fmt.Sprintf("Chart version: %s", c.ChartVersion))
+	}
+	if c.AppVersion != nil {
+		lines = append(lines, fmt.Sprintf("App version: %s", c.AppVersion))
+	}
+	if len(c.Images) > 0 {
+		lines = append(lines, "Images:")
+		for _, image := range c.Images {
+			if image.Repository != "" {
+				lines = append(lines, fmt.Sprintf("  %s %s: %s %s -> %s", image.Resource, image.Container, image.Repository, image.From, image.To))
+			} else {
+				lines = append(lines, fmt.Sprintf("  %s %s: %s -> %s", image.Resource, image.Container, image.From, image.To))
+			}
+		}
+	}
+	if len(c.AddedResources) > 0 {
+		lines = append(lines, "Added resources:")
+		for _, resource := range c.AddedResources {
+			lines = append(lines, "  "+resource)
+		}
+	}
+	if len(c.RemovedResources) > 0 {
+		lines = append(lines, "Removed resources:")
+		for _, resource := range c.RemovedResources {
+			lines = append(lines, "  "+resource)
+		}
+	}
+	if len(c.Values) > 0 {
+		lines = append(lines, "Default values:")
+		for _, value := range c.Values {
+			switch value.Change {
+			case ValueAdded:
+				lines = append(lines, fmt.Sprintf("  %s: added %s", value.Key, formatValue(value.To)))
+			case ValueRemoved:
+				lines = append(lines, fmt.Sprintf("  %s: removed, was %s", value.Key, formatValue(value.From)))
+			default:
+				lines = append(lines, fmt.Sprintf("  %s: %s -> %s", value.Key, formatValue(value.From), formatValue(value.To)))
+			}
+		}
+	}
+	if len(lines) == 0 {
+		return "No changes\n"
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+func (c Change) String() string {
+	if c.From == "" {
+		return c.To
+	}
+	return fmt.Sprintf("%s -> %s", c.From, c.To)
+}
+
+func change(from, to string) *Change {
+	if from == to || to == "" {
+		return nil
+	}
+	return &Change{From: from, To: to}
+}
+
+// valueChanges compares the leaf values of two values.yaml files, lists are compared as a whole
+func valueChanges(from, to string) ([]ValueChange, error) {
+	fromValues, err := flattenValues(from)
+	if err != nil {
+		return nil, errors.Wrap(err, "read previous values")
+	}
+	toValues, err := flattenValues(to)
+	if err != nil {
+		return nil, errors.Wrap(err, "read values")
+	}
+
+	changes := []ValueChange{}
+	for key, value := range fromValues {
+		other, ok := toValues[key]
+		switch {
+		case !ok:
+			changes = append(changes, ValueChange{Key: key, Change: ValueRemoved, From: value})
+		case !reflect.DeepEqual(value, other):
+			changes = append(changes, ValueChange{Key: key, Change: ValueChanged, From: value, To: other})
+		}
+	}
+	for key, value := range toValues {
+		if _, ok := fromValues[key]; !ok {
+			changes = append(changes, ValueChange{Key: key, Change: ValueAdded, To: value})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Key < changes[j].Key })
+	return changes, nil
+}
+
+func flattenValues(contents string) (map[string]interface{}, error) {
+	values := map[string]interface{}{}
+	var parsed map[string]interface{}
+	if err := yaml.Unmarshal([]byte(contents), &parsed); err != nil {
+		return nil, err
+	}
+	flatten("", parsed, values)
+	return values, nil
+}
+
+func flatten(prefix string, value interface{}, values map[string]interface{}) {
+	var children map[string]interface{}
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		children = typed
+	case map[interface{}]interface{}:
+		children = map[string]interface{}{}
+		for key, child := range typed {
+			children[fmt.Sprintf("%v", key)] = child
+		}
+	default:
+		values[prefix] = jsonCompatible(value)
+		return
+	}
+
+	if len(children) == 0 && prefix != "" {
+		values[prefix] = map[string]interface{}{}
+	}
+	for key, child := range children {
+		if prefix == "" {
+			flatten(key, child, values)
+		} else {
+			flatten(prefix+"."+key, child, values)
+		}
+	}
+}
+
+// jsonCompatible converts the maps yaml.v2 unmarshals lists of objects into, so values can be written as JSON
+func jsonCompatible(value interface{}) interface{} {
+	switch typed := value.(type) {
+	case map[interface{}]interface{}:
+		converted := map[string]interface{}{}
+		for key, child := range typed {
+			converted[fmt.Sprintf("%v", key)] = jsonCompatible(child)
+		}
+		return converted
+	case []interface{}:
+		converted := make([]interface{}, 0, len(typed))
+		for _, child := range typed {
+			converted = append(converted, jsonCompatible(child))
+		}
+		return converted
+	default:
+		return value
+	}
+}
+
+func formatValue(value interface{}) string {
+	if str, ok := value.(string); ok {
+		return fmt.Sprintf("%q", str)
+	}
+	serialized, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	return string(serialized)
+}
+
+// Format is the changelog of each upstream as plain text, headed by the upstream's name if it has one
+func Format(changelogs []*Changelog) string {
+	var sections []string
+	for _, changelog := range changelogs {
+		if changelog.Name == "" {
+			sections = append(sections, changelog.String())
+			continue
+		}
+		sections = append(sections, changelog.Name+":\n"+indent(changelog.String()))
+	}
+	return strings.Join(sections, "\n")
+}
+
+func indent(text string) string {
+	lines := strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = "  " + line
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
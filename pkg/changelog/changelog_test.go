@@ -0,0 +1,191 @@
+package changelog
+
+import (
+	"testing"
+
+	"github.com/replicatedhq/ship/pkg/state"
+	"github.com/replicatedhq/ship/pkg/testing/logger"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/require"
+)
+
+const previousDeployment = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: nginx
+  namespace: web
+spec:
+  template:
+    spec:
+      initContainers:
+      - name: migrate
+        image: registry.example.com:5000/migrate:1.0
+      containers:
+      - name: nginx
+        image: nginx:1.14
+      - name: exporter
+        image: prom/nginx-exporter
+`
+
+const updatedDeployment = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: nginx
+  namespace: web
+spec:
+  template:
+    spec:
+      initContainers:
+      - name: migrate
+        image: registry.example.com:5000/migrate:1.1
+      containers:
+      - name: nginx
+        image: nginx:1.15
+      - name: exporter
+        image: quay.io/nginx-exporter:0.4
+`
+
+const previousValues = `replicaCount: 1
+image:
+  repository: nginx
+  tag: "1.14"
+service:
+  type: ClusterIP
+  annotations: {}
+rbac:
+  create: true
+`
+
+const updatedValues = `replicaCount: 1
+image:
+  repository: nginx
+  tag: "1.15"
+  pullPolicy: IfNotPresent
+service:
+  type: ClusterIP
+  annotations: {}
+  ports: [80, 443]
+`
+
+func TestBuild(t *testing.T) {
+	req := require.New(t)
+	mockFs := afero.Afero{Fs: afero.NewMemMapFs()}
+	req.NoError(mockFs.WriteFile("previous/deployment.yaml", []byte(previousDeployment), 0644))
+	req.NoError(mockFs.WriteFile("previous/configmap.yaml", []byte("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: nginx-config\n"), 0644))
+	req.NoError(mockFs.WriteFile("previous/kustomization.yaml", []byte("kind: Kustomization\nresources:\n- deployment.yaml\n"), 0644))
+	req.NoError(mockFs.WriteFile("base/deployment.yaml", []byte(updatedDeployment), 0644))
+	req.NoError(mockFs.WriteFile("base/rbac/rbac.yaml", []byte(`apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: nginx
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: Role
+metadata:
+  name: nginx
+`), 0644))
+	req.NoError(mockFs.WriteFile("base/NOTES.txt", []byte("kind: NotAResource\n"), 0644))
+
+	builder := NewBuilder(&logger.TestLogger{T: t}, mockFs)
+	changelog, err := builder.Build(
+		Snapshot{Base: "previous", ContentSHA: "abc", ChartVersion: "1.0.0", AppVersion: "1.14", Values: previousValues},
+		Snapshot{Base: "base", ContentSHA: "def", ChartVersion: "1.1.0", AppVersion: "1.15", Values: updatedValues},
+	)
+	req.NoError(err)
+
+	req.Equal(&Change{From: "abc", To: "def"}, changelog.ContentSHA)
+	req.Equal(&Change{From: "1.0.0", To: "1.1.0"}, changelog.ChartVersion)
+	req.Equal(&Change{From: "1.14", To: "1.15"}, changelog.AppVersion)
+	req.Equal([]ImageChange{
+		{Resource: "Deployment/web/nginx", Container: "exporter", From: "prom/nginx-exporter", To: "quay.io/nginx-exporter:0.4"},
+		{Resource: "Deployment/web/nginx", Container: "migrate", Repository: "registry.example.com:5000/migrate", From: "1.0", To: "1.1"},
+		{Resource: "Deployment/web/nginx", Container: "nginx", Repository: "nginx", From: "1.14", To: "1.15"},
+	}, changelog.Images)
+	req.Equal([]string{"Role/nginx", "ServiceAccount/nginx"}, changelog.AddedResources)
+	req.Equal([]string{"ConfigMap/nginx-config"}, changelog.RemovedResources)
+	req.Equal([]ValueChange{
+		{Key: "image.pullPolicy", Change: ValueAdded, To: "IfNotPresent"},
+		{Key: "image.tag", Change: ValueChanged, From: "1.14", To: "1.15"},
+		{Key: "rbac.create", Change: ValueRemoved, From: true},
+		{Key: "service.ports", Change: ValueAdded, To: []interface{}{80, 443}},
+	}, changelog.Values)
+	req.False(changelog.Empty())
+
+	req.Equal(`Chart version: 1.0.0 -> 1.1.0
+App version: 1.14 -> 1.15
+Images:
+  Deployment/web/nginx exporter: prom/nginx-exporter -> quay.io/nginx-exporter:0.4
+  Deployment/web/nginx migrate: registry.example.com:5000/migrate 1.0 -> 1.1
+  Deployment/web/nginx nginx: nginx 1.14 -> 1.15
+Added resources:
+  Role/nginx
+  ServiceAccount/nginx
+Removed resources:
+  ConfigMap/nginx-config
+Default values:
+  image.pullPolicy: added "IfNotPresent"
+  image.tag: "1.14" -> "1.15"
+  rbac.create: removed, was true
+  service.ports: added [80,443]
+`, changelog.String())
+}
+
+func TestBuildUnchanged(t *testing.T) {
+	req := require.New(t)
+	mockFs := afero.Afero{Fs: afero.NewMemMapFs()}
+	req.NoError(mockFs.WriteFile("base/deployment.yaml", []byte(previousDeployment), 0644))
+
+	builder := NewBuilder(&logger.TestLogger{T: t}, mockFs)
+
+	// the previous base is gone, so everything in the base is new
+	changelog, err := builder.Build(Snapshot{Base: "missing"}, Snapshot{Base: "base", Values: previousValues})
+	req.NoError(err)
+	req.Equal([]string{"Deployment/web/nginx"}, changelog.AddedResources)
+	req.Empty(changelog.Values)
+
+	changelog, err = builder.Build(
+		Snapshot{Base: "base", ContentSHA: "abc", ChartVersion: "1.0.0", Values: previousValues},
+		Snapshot{Base: "base", ContentSHA: "def", ChartVersion: "1.0.0", Values: previousValues},
+	)
+	req.NoError(err)
+	req.True(changelog.Empty())
+	req.Equal("No changes\n", changelog.String())
+}
+
+func TestFromStateNamedUpstreams(t *testing.T) {
+	req := require.New(t)
+	mockFs := afero.Afero{Fs: afero.NewMemMapFs()}
+	req.NoError(mockFs.WriteFile("previous/web/deployment.yaml", []byte(previousDeployment), 0644))
+	req.NoError(mockFs.WriteFile("base/web/deployment.yaml", []byte(updatedDeployment), 0644))
+	req.NoError(mockFs.WriteFile("base/db/service.yaml", []byte("kind: Service\nmetadata:\n  name: db\n"), 0644))
+
+	before := state.VersionedState{V2: &state.V2{Upstreams: []state.NamedUpstream{
+		{Name: "web", ContentSHA: "abc", Metadata: &state.Metadata{Version: "1.0.0"}},
+	}}}
+	after := state.VersionedState{V2: &state.V2{Upstreams: []state.NamedUpstream{
+		{Name: "web", ContentSHA: "def", Metadata: &state.Metadata{Version: "1.1.0"}},
+		{Name: "db", ContentSHA: "123"},
+	}}}
+
+	builder := NewBuilder(&logger.TestLogger{T: t}, mockFs)
+	changelogs, err := builder.FromState(before, "previous", after, "base")
+	req.NoError(err)
+	req.Len(changelogs, 2)
+	req.Equal("web", changelogs[0].Name)
+	req.Equal(&Change{From: "1.0.0", To: "1.1.0"}, changelogs[0].ChartVersion)
+	req.Len(changelogs[0].Images, 3)
+	req.Equal("db", changelogs[1].Name)
+	req.Equal([]string{"Service/db"}, changelogs[1].AddedResources)
+
+	req.Equal(`web:
+  Chart version: 1.0.0 -> 1.1.0
+  Images:
+    Deployment/web/nginx exporter: prom/nginx-exporter -> quay.io/nginx-exporter:0.4
+    Deployment/web/nginx migrate: registry.example.com:5000/migrate 1.0 -> 1.1
+    Deployment/web/nginx nginx: nginx 1.14 -> 1.15
+
+db:
+  Added resources:
+    Service/db
+`, Format(changelogs))
+}
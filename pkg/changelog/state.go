@@ -0,0 +1,48 @@
+package changelog
+
+import (
+	"path/filepath"
+
+	"github.com/replicatedhq/ship/pkg/state"
+)
+
+// FromState builds a changelog for each upstream of an app, comparing state and the base before an update
+// with state and the base after it. Named upstreams are matched by name, and are rendered to <base>/<name>.
+func (b *Builder) FromState(before state.State, beforeBase string, after state.State, afterBase string) ([]*Changelog, error) {
+	beforeV2, afterV2 := before.Versioned().V2, after.Versioned().V2
+
+	if len(afterV2.Upstreams) == 0 {
+		changelog, err := b.Build(snapshot(beforeBase, beforeV2.ContentSHA, beforeV2.HelmValuesDefaults, beforeV2.Metadata),
+			snapshot(afterBase, afterV2.ContentSHA, afterV2.HelmValuesDefaults, afterV2.Metadata))
+		if err != nil {
+			return nil, err
+		}
+		return []*Changelog{changelog}, nil
+	}
+
+	var changelogs []*Changelog
+	for _, upstream := range afterV2.Upstreams {
+		from := Snapshot{Base: filepath.Join(beforeBase, upstream.Name)}
+		if previous, ok := beforeV2.UpstreamNamed(upstream.Name); ok {
+			from = snapshot(from.Base, previous.ContentSHA, previous.HelmValuesDefaults, previous.Metadata)
+		}
+		to := snapshot(filepath.Join(afterBase, upstream.Name), upstream.ContentSHA, upstream.HelmValuesDefaults, upstream.Metadata)
+
+		changelog, err := b.Build(from, to)
+		if err != nil {
+			return nil, err
+		}
+		changelog.Name = upstream.Name
+		changelogs = append(changelogs, changelog)
+	}
+	return changelogs, nil
+}
+
+func snapshot(base, contentSHA, values string, metadata *state.Metadata) Snapshot {
+	snapshot := Snapshot{Base: base, ContentSHA: contentSHA, Values: values}
+	if metadata != nil {
+		snapshot.ChartVersion = metadata.Version
+		snapshot.AppVersion = metadata.AppVersion
+	}
+	return snapshot
+}
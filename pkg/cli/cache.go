@@ -0,0 +1,54 @@
+package cli
+
+import (
+	"context"
+	"time"
+
+	"github.com/replicatedhq/ship/pkg/ship"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func Cache() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "cache",
+		Short: "Manage the upstream fetch cache",
+		Long: `Manage the cache of fetched upstreams in --cache-dir.
+
+Ship caches every upstream it fetches, keyed by the commit or chart version it
+resolved to, so unchanged upstreams aren't downloaded again. Pass --offline to
+any command to use only what's already cached.`,
+	}
+
+	cmd.AddCommand(CachePrune())
+	return cmd
+}
+
+func CachePrune() *cobra.Command {
+	v := viper.GetViper()
+	cmd := &cobra.Command{
+		Use:   "prune",
+		Short: "Remove cached upstreams that haven't been used recently",
+		Long: `Remove cached upstream versions that haven't been used within --older-than,
+or everything in the cache with --all.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := ship.Get(v)
+			if err != nil {
+				return err
+			}
+
+			olderThan := v.GetDuration("older-than")
+			if v.GetBool("all") {
+				olderThan = 0
+			}
+			return s.PruneCache(context.Background(), olderThan)
+		},
+	}
+
+	cmd.Flags().Duration("older-than", 30*24*time.Hour, "remove cached upstream versions that haven't been used for this long")
+	cmd.Flags().Bool("all", false, "remove everything in the cache")
+
+	v.BindPFlags(cmd.Flags())
+	return cmd
+}
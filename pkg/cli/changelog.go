@@ -0,0 +1,54 @@
+package cli
+
+import (
+	"context"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/ship/pkg/ship"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func Changelog() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "changelog",
+		Short: "Show what changed upstream since the last update",
+		Long: `Show what changed between the upstream version in the working tree and the
+latest one, without changing anything.
+
+Like ship update --dry-run, the update is resolved and rendered in a scratch
+directory, against a scratch copy of state. The base in the working tree and
+the one rendered in the scratch directory are then compared, and for each
+upstream the changelog lists:
+
+- chart version and appVersion bumps
+- container images whose tags changed in the rendered manifests
+- resources added to or removed from the base
+- default values added, removed or changed in the chart's values.yaml
+
+Pass --output json to print the changelog as JSON. The same changelog is
+included in the commit message of ship update --git-commit, and served to the
+UI of ship update --headed.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if output := viper.GetString("output"); output != "" && output != "json" {
+				return errors.Errorf("unsupported output %q, only json is supported", output)
+			}
+			viper.Set("headless", true)
+
+			s, err := ship.Get(viper.GetViper())
+			if err != nil {
+				return err
+			}
+			return s.ChangelogAndMaybeExit(context.Background())
+		},
+	}
+
+	cmd.Flags().AddFlag(sharedFlags.Lookup("output"))
+
+	viper.BindPFlags(cmd.Flags())
+	viper.AutomaticEnv()
+	viper.SetEnvKeyReplacer(strings.NewReplacer("-", "_"))
+	return cmd
+}
@@ -6,13 +6,14 @@ import (
 
 	"github.com/pkg/errors"
 	"github.com/replicatedhq/ship/pkg/ship"
+	"github.com/replicatedhq/ship/pkg/specs"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
 
 func Init() *cobra.Command {
 	cmd := &cobra.Command{
-		Use:   "init UPSTREAM",
+		Use:   "init UPSTREAM | NAME=UPSTREAM...",
 		Short: "Build and deploy kubernetes applications with kustomize.",
 		Long: `
 Build and deploy applications to be integrated
@@ -25,8 +26,20 @@ Upstream can be one of:
 - A path to a helm chart in a github repo         [github.com/helm/charts/stable/anchore-engine]
 - A path to a specific "ref" to a helm chart or
   Kubernetes manifests in a github repo           [github.com/helm/charts/tree/abcdef123456/stable/anchore-engine]
+- A path to a helm chart or Kubernetes manifests
+  in a GitLab or Bitbucket repo                   [gitlab.com/myorg/charts/-/tree/master/nginx, bitbucket.org/myorg/charts/src/master/nginx]
 - A go-getter compatible URL
   (github.com/hashicorp/go-getter)              [git::gitlab.com/myrepo/mychart, ./local-charts/nginx-ingress, github.com/myrepo/mychart?ref=abcdef123456//my/path]
+
+To compose an application from several upstreams, name each one. Each is
+rendered into base/<name>, and all of them are kustomized together:
+
+  ship init ingress=github.com/helm/charts/stable/nginx-ingress app=github.com/myrepo/app-manifests
+
+When developing a chart locally, --watch-local renders it again each time
+a file in it changes, and the web console shows the new base:
+
+  ship init --watch-local ./my-chart
 `,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			v := viper.GetViper()
@@ -35,7 +48,11 @@ Upstream can be one of:
 				return errors.New("Error: please supply an upstream")
 			}
 
-			v.Set("upstream", args[0])
+			if len(args) > 1 || specs.IsNamedUpstream(args[0]) {
+				v.Set("upstreams", args)
+			} else {
+				v.Set("upstream", args[0])
+			}
 			s, err := ship.Get(v)
 			if err != nil {
 				return err
@@ -49,6 +66,9 @@ Upstream can be one of:
 
 	cmd.Flags().Bool("rm-asset-dest", false, "Always remove asset destinations if already present")
 	cmd.Flags().Int("retries", 3, "Number of times to retry retrieving upstream")
+	cmd.Flags().String("adopt-overlay", "", "path to an existing kustomize overlay directory to import into the --overlay overlay, its patches must apply to the rendered upstream")
+	cmd.Flags().Bool("watch-local", false, "when the upstream is a local directory, render it again each time a file in it changes, until ship exits")
+	cmd.Flags().AddFlag(sharedFlags.Lookup("overlay"))
 
 	viper.BindPFlags(cmd.Flags())
 	viper.BindPFlags(cmd.PersistentFlags())
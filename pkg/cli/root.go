@@ -9,11 +9,21 @@ import (
 	"github.com/replicatedhq/ship/pkg/constants"
 	"github.com/replicatedhq/ship/pkg/version"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 )
 
 var cfgFile string
 
+// sharedFlags are flags several commands have, meaning the same in each. Each command adds the same flag,
+// so the viper key is bound to one flag whichever command runs.
+var sharedFlags = func() *pflag.FlagSet {
+	flags := pflag.NewFlagSet("shared", pflag.ContinueOnError)
+	flags.StringP("output", "o", "", "format of the output, set to json for JSON output")
+	flags.String("overlay", "ship", "name of the kustomize overlay to edit. Overlays other than \"ship\" are layered on top of the ship overlay and rendered to rendered-<overlay>.yaml")
+	return flags
+}()
+
 // RootCmd represents the base command when called without any subcommands
 func RootCmd() *cobra.Command {
 	cmd := &cobra.Command{
@@ -30,6 +40,8 @@ func RootCmd() *cobra.Command {
 		// since I think cobra lives outside the scope of dig injection/unit testing.
 		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
 			version.Init()
+			// recorded alongside state history so it's clear which run changed state
+			viper.Set("command", cmd.CommandPath())
 			var multiErr *multierror.Error
 			multiErr = multierror.Append(multiErr, os.RemoveAll(constants.ShipPathInternalTmp))
 			multiErr = multierror.Append(multiErr, os.MkdirAll(constants.ShipPathInternalTmp, 0755))
@@ -56,11 +68,23 @@ func RootCmd() *cobra.Command {
 	// TODO remove me, just always set this to true
 	cmd.PersistentFlags().BoolP("navcycle", "", true, "set to false to run ship in v1/non-navigable mode (deprecated)")
 
-	cmd.PersistentFlags().String("state-from", "file", "type of resource to use when loading/saving state (currently supported values: 'file', 'secret'")
+	cmd.PersistentFlags().String("state-from", "file", "type of resource to use when loading/saving state (currently supported values: 'file', 'secret', 'configmap', 's3')")
 	cmd.PersistentFlags().String("state-file", "", fmt.Sprintf("path to the state file to read from, defaults to %s", constants.StatePath))
 	cmd.PersistentFlags().String("secret-namespace", "default", "namespace containing the state secret")
 	cmd.PersistentFlags().String("secret-name", "", "name of the secret to laod state from")
 	cmd.PersistentFlags().String("secret-key", "", "name of the key in the secret containing state")
+	cmd.PersistentFlags().String("configmap-namespace", "default", "namespace containing the state configmap")
+	cmd.PersistentFlags().String("configmap-name", "", "name of the configmap to load state from")
+	cmd.PersistentFlags().String("configmap-key", "", "name of the key in the configmap containing state")
+	cmd.PersistentFlags().String("kubeconfig", "", "path to the kubeconfig used to reach the state secret or configmap, defaults to in-cluster config or $KUBECONFIG")
+	cmd.PersistentFlags().String("kube-context", "", "kubeconfig context used to reach the state secret or configmap")
+	cmd.PersistentFlags().String("s3-bucket", "", "bucket to load state from when --state-from is s3")
+	cmd.PersistentFlags().String("s3-key", "ship/state.json", "key of the state object in the s3 bucket")
+	cmd.PersistentFlags().String("s3-region", "us-east-1", "region of the s3 bucket")
+	cmd.PersistentFlags().String("s3-endpoint", "", "endpoint of an S3-compatible object store, such as minio")
+	cmd.PersistentFlags().Int("state-history-limit", 10, "number of previous versions of state to keep for rollback, -1 for no limit")
+	cmd.PersistentFlags().Duration("lock-timeout", 0, "how long to wait for another ship run to release the state lock before giving up")
+	cmd.PersistentFlags().String("state-key-file", "", "path to a file containing the key used to encrypt password config values in state, SHIP_STATE_KEY can be used instead")
 
 	cmd.PersistentFlags().String("upload-assets-to", "", "URL to upload assets to via HTTP PUT request. NOTE: this will cause the entire working directory to be uploaded to the specified URL, use with caution.")
 
@@ -69,14 +93,33 @@ func RootCmd() *cobra.Command {
 
 	cmd.PersistentFlags().String("resource-type", "", "upstream application resource type")
 	cmd.PersistentFlags().BoolP("prefer-git", "", false, "prefer the git protocol instead of using http apis")
+	cmd.PersistentFlags().String("github-token", "", "token used to fetch private upstreams from GitHub, GITHUB_TOKEN can be used instead")
+	cmd.PersistentFlags().String("github-base-url", "", "API URL of a GitHub Enterprise instance to fetch upstreams from, like https://github.example.com/api/v3/")
+	cmd.PersistentFlags().String("gitlab-token", "", "token used to fetch private upstreams from GitLab, GITLAB_TOKEN can be used instead")
+	cmd.PersistentFlags().String("gitlab-base-url", "", "URL of a self-hosted GitLab instance to fetch upstreams from, like https://gitlab.example.com")
+	cmd.PersistentFlags().String("bitbucket-token", "", "access token used to fetch private upstreams from Bitbucket, BITBUCKET_TOKEN can be used instead")
+	cmd.PersistentFlags().String("helm-repo-username", "", "username for basic auth to helm repository upstreams, HELM_REPO_USERNAME can be used instead")
+	cmd.PersistentFlags().String("helm-repo-password", "", "password for basic auth to helm repository upstreams, HELM_REPO_PASSWORD can be used instead")
+	cmd.PersistentFlags().String("ssh-key", "", "path to the private key used to fetch git upstreams over ssh with --prefer-git")
+	cmd.PersistentFlags().String("ssh-known-hosts", "", "path to the known_hosts file used to verify git upstreams fetched over ssh with --prefer-git")
+	cmd.PersistentFlags().Bool("drop-test-hooks", false, "leave helm test hooks out of the hooks rendered from helm charts")
+	cmd.PersistentFlags().Bool("offline", false, "only use upstreams that have already been fetched into the cache, without any network requests")
+	cmd.PersistentFlags().String("cache-dir", "", "directory fetched upstreams are cached in, defaults to ~/.ship/cache")
+	cmd.PersistentFlags().Bool("verify-provenance", false, "require helm repository charts to have a provenance file signed by a key in --keyring")
+	cmd.PersistentFlags().Bool("verify-signatures", false, "require GitHub upstreams to be at a tag or commit signed by a key in --keyring")
+	cmd.PersistentFlags().String("upstream-sha256", "", "sha256 digest the upstream chart or archive must match")
+	cmd.PersistentFlags().String("keyring", "", "public keyring to verify upstream signatures against, defaults to ~/.gnupg/pubring.gpg")
 
 	cmd.PersistentFlags().Bool("no-outro", false, "skip outro step in Ship UI")
 
 	cmd.AddCommand(Init())
 	cmd.AddCommand(Watch())
 	cmd.AddCommand(Update())
+	cmd.AddCommand(Changelog())
 	cmd.AddCommand(App())
 	cmd.AddCommand(Version())
+	cmd.AddCommand(State())
+	cmd.AddCommand(Cache())
 	viper.BindPFlags(cmd.Flags())
 	viper.BindPFlags(cmd.PersistentFlags())
 	viper.AutomaticEnv()
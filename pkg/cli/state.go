@@ -0,0 +1,337 @@
+package cli
+
+import (
+	"context"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/ship/pkg/ship"
+	"github.com/replicatedhq/ship/pkg/state"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func State() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "state",
+		Short: "Inspect and manage ship state",
+		Long:  `Inspect and manage the state ship saves between runs, wherever --state-from says it lives.`,
+	}
+
+	cmd.AddCommand(StateRekey())
+	cmd.AddCommand(StateHistory())
+	cmd.AddCommand(StateDiff())
+	cmd.AddCommand(StateRollback())
+	cmd.AddCommand(StateUnlock())
+	cmd.AddCommand(StateGet())
+	cmd.AddCommand(StateSet())
+	cmd.AddCommand(StateUnset())
+	cmd.AddCommand(StateExportValues())
+	cmd.AddCommand(StateImportValues())
+	cmd.AddCommand(StateMigrate())
+	return cmd
+}
+
+func StateRekey() *cobra.Command {
+	v := viper.GetViper()
+	cmd := &cobra.Command{
+		Use:   "rekey",
+		Short: "Re-encrypt sensitive config values with a new key",
+		Long: `Re-encrypt the password values in state and its history with a new key.
+
+The current key is read from --state-key-file or SHIP_STATE_KEY, and
+the new key from --new-key-file. After a rekey, use the new key for all
+future ship runs.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := ship.Get(v)
+			if err != nil {
+				return err
+			}
+
+			return s.RekeyState(context.Background())
+		},
+	}
+
+	cmd.Flags().String("new-key-file", "", "path to a file containing the new state key")
+
+	v.BindPFlags(cmd.Flags())
+	v.AutomaticEnv()
+	v.SetEnvKeyReplacer(strings.NewReplacer("-", "_"))
+	return cmd
+}
+
+func StateHistory() *cobra.Command {
+	v := viper.GetViper()
+	cmd := &cobra.Command{
+		Use:   "history",
+		Short: "List previous versions of state",
+		Long: `List the previous versions of state that ship has kept, most recent first.
+
+Entry numbers can be passed to ship state diff and ship state rollback.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := ship.Get(v)
+			if err != nil {
+				return err
+			}
+
+			return s.StateHistory(context.Background())
+		},
+	}
+	return cmd
+}
+
+func StateDiff() *cobra.Command {
+	v := viper.GetViper()
+	cmd := &cobra.Command{
+		Use:   "diff <from> <to>",
+		Short: "Show the difference between two versions of state",
+		Long: `Show the difference between two versions of state, by their number in ship state history.
+
+Use 0 for the current state.`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			from, err := historyEntryArg(args[0])
+			if err != nil {
+				return err
+			}
+			to, err := historyEntryArg(args[1])
+			if err != nil {
+				return err
+			}
+
+			s, err := ship.Get(v)
+			if err != nil {
+				return err
+			}
+
+			return s.StateDiff(context.Background(), from, to)
+		},
+	}
+	return cmd
+}
+
+func StateRollback() *cobra.Command {
+	v := viper.GetViper()
+	cmd := &cobra.Command{
+		Use:   "rollback <n>",
+		Short: "Restore a previous version of state",
+		Long: `Restore a previous version of state, by its number in ship state history.
+
+The state being replaced is kept in history, so a rollback can itself be rolled back.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			n, err := historyEntryArg(args[0])
+			if err != nil {
+				return err
+			}
+
+			s, err := ship.Get(v)
+			if err != nil {
+				return err
+			}
+
+			return s.RollbackState(context.Background(), n)
+		},
+	}
+	return cmd
+}
+
+func StateUnlock() *cobra.Command {
+	v := viper.GetViper()
+	cmd := &cobra.Command{
+		Use:   "unlock",
+		Short: "Remove a stale state lock",
+		Long: `Remove the state lock left behind by a ship run that crashed or was killed.
+
+Without --force, this only reports which run holds the lock. Removing the lock
+of a run that is still active can cause it to overwrite changes to state.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := ship.Get(v)
+			if err != nil {
+				return err
+			}
+
+			return s.UnlockState(context.Background(), v.GetBool("force"))
+		},
+	}
+
+	cmd.Flags().Bool("force", false, "remove the lock even though another run may hold it")
+
+	v.BindPFlags(cmd.Flags())
+	return cmd
+}
+
+func StateGet() *cobra.Command {
+	v := viper.GetViper()
+	cmd := &cobra.Command{
+		Use:   "get <path>",
+		Short: "Print a value from state",
+		Long: `Print a value from state.
+
+Supported paths are ` + state.EditablePaths + `.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := ship.Get(v)
+			if err != nil {
+				return err
+			}
+
+			return s.GetStateValue(context.Background(), args[0])
+		},
+	}
+	return cmd
+}
+
+func StateSet() *cobra.Command {
+	v := viper.GetViper()
+	cmd := &cobra.Command{
+		Use:   "set <path> [value]",
+		Short: "Set a value in state",
+		Long: `Set a value in state, either from the command line or from a file with --from-file.
+
+Supported paths are ` + state.EditablePaths + `.
+
+Config items are checked against the config of the release fetched by the last ship run.`,
+		Args: cobra.RangeArgs(1, 2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var value string
+			fromFile := v.GetString("from-file")
+			switch {
+			case len(args) == 2 && fromFile != "":
+				return errors.New("pass either a value or --from-file, not both")
+			case len(args) == 2:
+				value = args[1]
+			case fromFile != "":
+				contents, err := ioutil.ReadFile(fromFile)
+				if err != nil {
+					return errors.Wrapf(err, "read %s", fromFile)
+				}
+				value = string(contents)
+			default:
+				return errors.New("please provide a value, or a file to read it from with --from-file")
+			}
+
+			s, err := ship.Get(v)
+			if err != nil {
+				return err
+			}
+
+			return s.SetStateValue(context.Background(), args[0], value, v.GetBool("skip-validation"))
+		},
+	}
+
+	cmd.Flags().String("from-file", "", "read the value from a file, for helm values and overlay patches")
+	cmd.Flags().Bool("skip-validation", false, "set config items even if they aren't in the release's config")
+
+	v.BindPFlags(cmd.Flags())
+	return cmd
+}
+
+func StateUnset() *cobra.Command {
+	v := viper.GetViper()
+	cmd := &cobra.Command{
+		Use:   "unset <path>",
+		Short: "Remove a value from state",
+		Long: `Remove a value from state.
+
+Supported paths are ` + state.EditablePaths + `.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := ship.Get(v)
+			if err != nil {
+				return err
+			}
+
+			return s.UnsetStateValue(context.Background(), args[0])
+		},
+	}
+	return cmd
+}
+
+func StateExportValues() *cobra.Command {
+	v := viper.GetViper()
+	cmd := &cobra.Command{
+		Use:   "export-values",
+		Short: "Write the helm values from state to a file",
+		Long:  `Write the helm values from state to stdout, or to a file with --out. If values have never been customized, the chart's defaults are written.`,
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := ship.Get(v)
+			if err != nil {
+				return err
+			}
+
+			return s.ExportHelmValues(context.Background(), v.GetString("state-export-upstream-name"), v.GetString("out"))
+		},
+	}
+
+	cmd.Flags().String("out", "", "file to write the helm values to, defaults to stdout")
+	cmd.Flags().String("upstream-name", "", "export the values of this named upstream, for applications composed of several")
+
+	v.BindPFlags(cmd.Flags())
+	v.BindPFlag("state-export-upstream-name", cmd.Flags().Lookup("upstream-name"))
+	return cmd
+}
+
+func StateImportValues() *cobra.Command {
+	v := viper.GetViper()
+	cmd := &cobra.Command{
+		Use:   "import-values <file>",
+		Short: "Replace the helm values in state with a values file",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := ship.Get(v)
+			if err != nil {
+				return err
+			}
+
+			return s.ImportHelmValues(context.Background(), v.GetString("state-import-upstream-name"), args[0])
+		},
+	}
+
+	cmd.Flags().String("upstream-name", "", "replace the values of this named upstream, for applications composed of several")
+
+	v.BindPFlags(cmd.Flags())
+	v.BindPFlag("state-import-upstream-name", cmd.Flags().Lookup("upstream-name"))
+	return cmd
+}
+
+func StateMigrate() *cobra.Command {
+	v := viper.GetViper()
+	cmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "Rewrite state in the current schema version",
+		Long: `Rewrite state written by an older version of ship in the current schema version.
+
+State is migrated in memory every time it's loaded, and rewritten the next time
+it's saved. Use this to upgrade it ahead of time, or with --dry-run to see what
+will change.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := ship.Get(v)
+			if err != nil {
+				return err
+			}
+
+			return s.MigrateState(context.Background(), v.GetBool("state-migrate-dry-run"))
+		},
+	}
+
+	cmd.Flags().Bool("dry-run", false, "show the migrations that would be applied and a diff of the result, without writing state")
+
+	v.BindPFlags(cmd.Flags())
+	v.BindPFlag("state-migrate-dry-run", cmd.Flags().Lookup("dry-run"))
+	return cmd
+}
+
+func historyEntryArg(arg string) (int, error) {
+	n, err := strconv.Atoi(arg)
+	if err != nil || n < 0 {
+		return 0, errors.Errorf("%q is not a state history entry number", arg)
+	}
+	return n, nil
+}
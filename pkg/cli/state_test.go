@@ -0,0 +1,91 @@
+package cli
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const namedUpstreamsState = `{"v2": {
+  "helmValues": "replicas: 1\n",
+  "upstreams": [
+    {"name": "web", "upstream": "https://example.com/web.tgz", "helmValues": "replicas: 3\n"}
+  ]
+}}`
+
+func TestStateValuesUpstreamName(t *testing.T) {
+	tests := []struct {
+		name       string
+		args       []string
+		wantErr    string
+		wantOut    string
+		wantValues string
+	}{
+		{
+			name:    "export a named upstream",
+			args:    []string{"state", "export-values", "--upstream-name", "web", "--out", "out.yaml"},
+			wantOut: "replicas: 3\n",
+		},
+		{
+			name:    "export top level values",
+			args:    []string{"state", "export-values", "--out", "out.yaml"},
+			wantOut: "replicas: 1\n",
+		},
+		{
+			name:    "export an unknown upstream",
+			args:    []string{"state", "export-values", "--upstream-name", "nosuch", "--out", "out.yaml"},
+			wantErr: `there is no upstream named "nosuch"`,
+		},
+		{
+			name:       "import a named upstream",
+			args:       []string{"state", "import-values", "--upstream-name", "web", "in.yaml"},
+			wantValues: `"helmValues": "replicas: 5\n"`,
+		},
+		{
+			name:    "import an unknown upstream",
+			args:    []string{"state", "import-values", "--upstream-name", "nosuch", "in.yaml"},
+			wantErr: `"nosuch"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := require.New(t)
+
+			dir, err := ioutil.TempDir("", "ship-cli-state")
+			req.NoError(err)
+			defer os.RemoveAll(dir)
+			wd, err := os.Getwd()
+			req.NoError(err)
+			defer os.Chdir(wd)
+			req.NoError(os.Chdir(dir))
+
+			req.NoError(os.MkdirAll(".ship", 0755))
+			req.NoError(ioutil.WriteFile(filepath.Join(".ship", "state.json"), []byte(namedUpstreamsState), 0644))
+			req.NoError(ioutil.WriteFile("in.yaml", []byte("replicas: 5\n"), 0644))
+
+			cmd := RootCmd()
+			cmd.SetArgs(tt.args)
+			err = cmd.Execute()
+			if tt.wantErr != "" {
+				req.Error(err)
+				req.Contains(err.Error(), tt.wantErr)
+				return
+			}
+			req.NoError(err)
+
+			if tt.wantOut != "" {
+				out, err := ioutil.ReadFile("out.yaml")
+				req.NoError(err)
+				req.Equal(tt.wantOut, string(out))
+			}
+			if tt.wantValues != "" {
+				stored, err := ioutil.ReadFile(filepath.Join(".ship", "state.json"))
+				req.NoError(err)
+				req.Contains(string(stored), tt.wantValues)
+			}
+		})
+	}
+}
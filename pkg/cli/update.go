@@ -4,6 +4,7 @@ import (
 	"context"
 	"strings"
 
+	"github.com/pkg/errors"
 	"github.com/replicatedhq/ship/pkg/ship"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -13,8 +14,23 @@ func Update() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "update",
 		Short: "Pull an updated helm chart",
-		Long:  `Pull an updated helm chart to be integrated into current application configuration`,
+		Long: `Pull an updated helm chart to be integrated into current application configuration.
+With --dry-run, print a diff of the update without changing anything. With
+--git-commit, commit the update to a new branch.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
+			if viper.GetBool("update-dry-run") && viper.GetBool("headed") {
+				return errors.New("--dry-run can't be used with --headed")
+			}
+			if viper.GetBool("update-dry-run") && viper.GetBool("git-commit") {
+				return errors.New("--dry-run can't be used with --git-commit")
+			}
+			if viper.GetBool("git-push") && !viper.GetBool("git-commit") {
+				return errors.New("--git-push can only be used with --git-commit")
+			}
+			if output := viper.GetString("output"); output != "" && output != "json" {
+				return errors.Errorf("unsupported output %q, only json is supported", output)
+			}
+
 			// update should run in headless mode by default
 			if !viper.GetBool("headed") {
 				viper.Set("headless", true)
@@ -25,13 +41,25 @@ func Update() *cobra.Command {
 				return err
 			}
 
+			if viper.GetBool("update-dry-run") {
+				return s.UpdateDryRunAndMaybeExit(context.Background())
+			}
 			return s.UpdateAndMaybeExit(context.Background())
 		},
 	}
 
 	cmd.Flags().BoolP("headed", "", false, "run ship update in headed mode")
+	cmd.Flags().Bool("fail-on-orphans", false, "fail if an overlay patch targets a resource that's no longer in the updated base")
+	cmd.Flags().Bool("dry-run", false, "render the update in a scratch directory and print a diff of the kustomize output, without changing state or the working tree")
+	cmd.Flags().AddFlag(sharedFlags.Lookup("output"))
+	cmd.Flags().Bool("git-commit", false, "commit the changed state, base and rendered output to a new branch named for the upstream version")
+	cmd.Flags().String("git-branch", "", "name of the branch to create with --git-commit, instead of one named for the upstream version")
+	cmd.Flags().Bool("git-push", false, "push the branch created with --git-commit")
+	cmd.Flags().String("git-remote", "origin", "remote to push to with --git-push")
+	cmd.Flags().AddFlag(sharedFlags.Lookup("overlay"))
 
 	viper.BindPFlags(cmd.Flags())
+	viper.BindPFlag("update-dry-run", cmd.Flags().Lookup("dry-run"))
 	viper.AutomaticEnv()
 	viper.SetEnvKeyReplacer(strings.NewReplacer("-", "_"))
 	return cmd
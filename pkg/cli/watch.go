@@ -16,7 +16,9 @@ func Watch() *cobra.Command {
 		Short: "Watch an upstream for updates",
 		Long: `Watch will poll the upstream source for changes, and block until a
 change has been published. The watch command will return with an exit code
-of 0 when there's an update available.`,
+of 0 when there's an update available, 1 if watching fails, and 130 if it's
+interrupted. With --fleet, every app under a glob is watched, and an update
+is reported as a line of JSON instead of exiting.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			s, err := ship.Get(v)
 			if err != nil {
@@ -28,6 +30,16 @@ of 0 when there's an update available.`,
 	}
 
 	cmd.Flags().DurationP("interval", "", time.Duration(time.Minute*15), "interval to wait between cycles polling for updates")
+	cmd.Flags().Float64("interval-jitter", 0.1, "fraction of the interval to randomly add or take away from each wait between polls")
+	cmd.Flags().Int("retry-budget", 5, "number of failed polls in a row to retry before giving up")
+	cmd.Flags().Duration("retry-backoff", 10*time.Second, "wait before retrying the first failed poll, doubled after each failure in a row")
+	cmd.Flags().String("metrics-addr", "", "address to serve Prometheus metrics on /metrics from, e.g. :9090")
+	cmd.Flags().String("fleet", "", "glob of directories to search for apps' .ship/state.json files, and watch all of them")
+	cmd.Flags().Int("fleet-workers", 8, "number of upstreams to poll at once with --fleet")
+	cmd.Flags().StringSlice("notify-webhook", []string{}, "URL to POST a JSON payload to when there's an update, can be repeated")
+	cmd.Flags().String("notify-webhook-secret", "", "secret used to sign webhook payloads, NOTIFY_WEBHOOK_SECRET can be used instead")
+	cmd.Flags().String("notify-exec", "", "shell command to run with a JSON payload on stdin when there's an update")
+	cmd.Flags().Bool("keep-watching", false, "keep watching after finding an update, instead of exiting")
 
 	v.BindPFlags(cmd.PersistentFlags())
 	v.BindPFlags(cmd.Flags())
@@ -9,6 +9,8 @@ const (
 	ShipPathInternal = ".ship"
 	// KustomizeBasePath is the path to which assets to be kustomized are written
 	KustomizeBasePath = "base"
+	// HelmHooksPath is the path to which helm hooks are written, a directory per hook event
+	HelmHooksPath = "hooks"
 )
 
 var (
@@ -20,6 +22,10 @@ var (
 	InternalTempHelmHome = path.Join(ShipPathInternalTmp, ".helm")
 	// StatePath is the default state file path
 	StatePath = path.Join(ShipPathInternal, "state.json")
+	// StateHistoryPath is where prior versions of the state file are kept
+	StateHistoryPath = path.Join(ShipPathInternal, "history.json")
+	// StateLockPath is the lockfile held while a ship run may write state
+	StateLockPath = path.Join(ShipPathInternal, "state.lock")
 	// ReleasePath is the default place to write a pulled release to the filesystem
 	ReleasePath = path.Join(ShipPathInternal, "release.yml")
 	// TempHelmValuesPath is the folder path used to store the updated values.yaml
@@ -28,6 +34,12 @@ var (
 	TempApplyOverlayPath = path.Join("overlays", "tmp-apply")
 	// HelmChartPath is the path used to store Helm chart contents
 	HelmChartPath = path.Join(ShipPathInternalTmp, "chart")
+	// HelmChartsPath is where the charts of an application composed of named upstreams are kept, one directory per upstream
+	HelmChartsPath = path.Join(ShipPathInternalTmp, "charts")
+	// KustomizeBuildPath is where a kustomization upstream is built before it's used as a base
+	KustomizeBuildPath = path.Join(ShipPathInternalTmp, "kustomize-build")
+	// PreviousBasePath is where ship update moves the base it's replacing, so overlay patches can be checked against both
+	PreviousBasePath = path.Join(ShipPathInternalTmp, "previous-base")
 	// RepoSavePath is the path that upstreams are initially fetched to
 	RepoSavePath = path.Join(ShipPathInternalTmp, "tmp-repo")
 )
@@ -26,7 +26,7 @@ const (
 // A Loader returns a struct representation
 // of a filesystem directory tree
 type Loader interface {
-	LoadTree(root string) (*Node, error)
+	LoadTree(root string, overlay string) (*Node, error)
 	// someday this should return an overlay too
 	LoadFile(root string, path string) ([]byte, error)
 }
@@ -52,7 +52,7 @@ type aferoLoader struct {
 	resources    map[string]string
 }
 
-func (a *aferoLoader) loadShipOverlay() error {
+func (a *aferoLoader) loadOverlay(name string) error {
 	currentState, err := a.StateManager.TryLoad()
 	if err != nil {
 		return errors.Wrap(err, "failed to load state")
@@ -63,14 +63,15 @@ func (a *aferoLoader) loadShipOverlay() error {
 		kustomize = &state.Kustomize{}
 	}
 
-	shipOverlay := kustomize.Ship()
-	a.patches = shipOverlay.Patches
-	a.resources = shipOverlay.Resources
+	overlay := kustomize.Overlay(name)
+	a.patches = overlay.Patches
+	a.resources = overlay.Resources
 	return nil
 }
 
-func (a *aferoLoader) LoadTree(root string) (*Node, error) {
-	if err := a.loadShipOverlay(); err != nil {
+// LoadTree loads the base at root, along with the patches and resources of the named overlay
+func (a *aferoLoader) LoadTree(root string, overlay string) (*Node, error) {
+	if err := a.loadOverlay(overlay); err != nil {
 		return nil, errors.Wrapf(err, "load overlays")
 	}
 
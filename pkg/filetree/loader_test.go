@@ -77,7 +77,7 @@ func TestAferoLoader(t *testing.T) {
 			}
 
 			mockState.EXPECT().TryLoad().Return(state.VersionedState{
-				V1: &state.V1{
+				V2: &state.V2{
 					Kustomize: &state.Kustomize{
 						Overlays: map[string]state.Overlay{
 							"ship": {
@@ -89,7 +89,7 @@ func TestAferoLoader(t *testing.T) {
 				},
 			}, nil)
 
-			tree, err := loader.LoadTree(toRead)
+			tree, err := loader.LoadTree(toRead, state.ShipOverlay)
 			if test.ExpectErr == "" {
 				req.NoError(err)
 			} else {
@@ -149,3 +149,8 @@ func (f *fetchCmd) run() error {
 func defaultKeyring() string {
 	return os.ExpandEnv("$HOME/.gnupg/pubring.gpg")
 }
+
+// DefaultKeyring returns the expanded path to the keyring helm verifies charts against by default.
+func DefaultKeyring() string {
+	return defaultKeyring()
+}
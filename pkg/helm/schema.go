@@ -0,0 +1,119 @@
+/*
+Copyright The Helm Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*This file was ported by Replicated from Helm 3's pkg/chartutil/jsonschema.go to
+  - validate values against a chart's values.schema.json with Helm 2 chart types
+*/
+
+package helm
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/xeipuuv/gojsonschema"
+	"k8s.io/helm/pkg/chartutil"
+	"k8s.io/helm/pkg/proto/hapi/chart"
+)
+
+const valuesSchemaFile = "values.schema.json"
+
+// validateValuesSchemas checks the values the chart at chartPath would be rendered with against its
+// values.schema.json, and those of its enabled subcharts. The chart is loaded again so that removing
+// disabled subcharts here doesn't change the chart that's rendered.
+func validateValuesSchemas(chartPath string, config *chart.Config) error {
+	c, err := chartutil.Load(chartPath)
+	if err != nil {
+		return err
+	}
+	if err := chartutil.ProcessRequirementsEnabled(c, config); err != nil {
+		return err
+	}
+	values, err := chartutil.CoalesceValues(c, config)
+	if err != nil {
+		return err
+	}
+
+	if err := validateAgainstSchema(c, values); err != nil {
+		return fmt.Errorf("values don't meet the specifications of the schema(s) in the following chart(s):\n%s", err.Error())
+	}
+	return nil
+}
+
+// validateAgainstSchema checks values against the schema of c, and the values scoped to each subchart against its schema
+func validateAgainstSchema(c *chart.Chart, values map[string]interface{}) error {
+	var errs bytes.Buffer
+	if schema := valuesSchema(c); schema != nil {
+		if err := validateAgainstSingleSchema(values, schema); err != nil {
+			errs.WriteString(fmt.Sprintf("%s:\n", c.Metadata.Name))
+			errs.WriteString(err.Error())
+		}
+	}
+
+	for _, subchart := range c.Dependencies {
+		var subchartValues map[string]interface{}
+		switch typed := values[subchart.Metadata.Name].(type) {
+		case chartutil.Values:
+			subchartValues = typed
+		case map[string]interface{}:
+			subchartValues = typed
+		}
+		if err := validateAgainstSchema(subchart, subchartValues); err != nil {
+			errs.WriteString(err.Error())
+		}
+	}
+
+	if errs.Len() > 0 {
+		return errors.New(errs.String())
+	}
+	return nil
+}
+
+func validateAgainstSingleSchema(values map[string]interface{}, schema []byte) error {
+	if values == nil {
+		values = map[string]interface{}{}
+	}
+	valuesJSON, err := json.Marshal(values)
+	if err != nil {
+		return err
+	}
+
+	result, err := gojsonschema.Validate(gojsonschema.NewBytesLoader(schema), gojsonschema.NewBytesLoader(valuesJSON))
+	if err != nil {
+		return err
+	}
+	if result.Valid() {
+		return nil
+	}
+
+	var errs bytes.Buffer
+	for _, desc := range result.Errors() {
+		errs.WriteString(fmt.Sprintf("- %s\n", desc))
+	}
+	return errors.New(errs.String())
+}
+
+// valuesSchema is the contents of the chart's values.schema.json, which chartutil.Load keeps with the chart's other files
+func valuesSchema(c *chart.Chart) []byte {
+	for _, file := range c.Files {
+		if file.TypeUrl == valuesSchemaFile {
+			return file.Value
+		}
+	}
+	return nil
+}
@@ -17,6 +17,7 @@ limitations under the License.
 /*This file was edited by Replicated in 2018 to
   - expose `helm template` as a function
   - silence the error output from the cobra command.
+  - validate values against the charts' values.schema.json, as Helm 3 does.
 */
 
 package helm
@@ -160,6 +161,10 @@ func (t *templateCmd) run(cmd *cobra.Command, args []string) error {
 		return prettyError(err)
 	}
 
+	if err := validateValuesSchemas(t.chartPath, config); err != nil {
+		return err
+	}
+
 	renderOpts := renderutil.Options{
 		ReleaseOptions: chartutil.ReleaseOptions{
 			Name:      t.releaseName,
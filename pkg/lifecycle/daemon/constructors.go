@@ -4,6 +4,7 @@ import (
 	"github.com/go-kit/kit/log"
 	"github.com/mitchellh/cli"
 	"github.com/replicatedhq/ship/pkg/api"
+	"github.com/replicatedhq/ship/pkg/changelog"
 	"github.com/replicatedhq/ship/pkg/filetree"
 	"github.com/replicatedhq/ship/pkg/lifecycle"
 	"github.com/replicatedhq/ship/pkg/lifecycle/daemon/daemontypes"
@@ -40,6 +41,7 @@ func NewHeadedDaemon(
 
 func NewV2Router(
 	logger log.Logger,
+	v *viper.Viper,
 	stateManager state.Manager,
 	messenger lifecycle.Messenger,
 	helmIntro lifecycle.HelmIntro,
@@ -54,6 +56,7 @@ func NewV2Router(
 	renderer lifecycle.Renderer,
 	treeLoader filetree.Loader,
 	fs afero.Afero,
+	changelogs *changelog.Builder,
 ) *NavcycleRoutes {
 	return &NavcycleRoutes{
 		Logger:             logger,
@@ -73,12 +76,14 @@ func NewV2Router(
 		ConfigRenderer: configRenderer,
 		Patcher:        patcher,
 		Renderer:       renderer,
+		Changelogs:     changelogs,
 		StepExecutor: func(d *NavcycleRoutes, step api.Step) error {
 			return d.execute(step)
 		},
-		TreeLoader:   treeLoader,
-		StepProgress: &daemontypes.ProgressMap{},
-		Fs:           fs,
+		TreeLoader:     treeLoader,
+		StepProgress:   &daemontypes.ProgressMap{},
+		Fs:             fs,
+		DefaultOverlay: v.GetString("overlay"),
 	}
 }
 
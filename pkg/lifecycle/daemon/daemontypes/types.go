@@ -39,6 +39,14 @@ type Daemon interface {
 	AwaitShutdown() error
 }
 
+// Refresher re-runs the steps whose output depends on the upstream after it changes,
+// for ship init --watch-local
+type Refresher interface {
+	// Refresh calls fetch, then re-executes each completed render and kustomize step.
+	// A failure is shown in the UI as the progress of the step it affects.
+	Refresh(ctx context.Context, fetch func() error) error
+}
+
 const StepNameMessage = "message"
 const StepNameConfig = "render.config"
 const StepNameHelmIntro = "helm.intro"
@@ -136,6 +144,7 @@ type HelmValues struct {
 
 type Kustomize struct {
 	BasePath string        `json:"basePath,omitempty"`
+	Overlay  string        `json:"overlay,omitempty"`
 	Tree     filetree.Node `json:"tree,omitempty"`
 }
 
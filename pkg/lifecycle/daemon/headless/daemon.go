@@ -2,7 +2,6 @@ package headless
 
 import (
 	"context"
-	"path"
 	"strings"
 
 	"github.com/go-kit/kit/log"
@@ -13,6 +12,7 @@ import (
 	"github.com/replicatedhq/ship/pkg/constants"
 	"github.com/replicatedhq/ship/pkg/lifecycle/daemon/daemontypes"
 	"github.com/replicatedhq/ship/pkg/lifecycle/render/config/resolve"
+	"github.com/replicatedhq/ship/pkg/lifecycle/render/helm"
 	"github.com/replicatedhq/ship/pkg/state"
 	"github.com/spf13/afero"
 	"github.com/spf13/viper"
@@ -72,11 +72,11 @@ func (d *HeadlessDaemon) PushHelmValuesStep(ctx context.Context, helmValues daem
 
 	defaultValues := helmValues.DefaultValues
 	if defaultValues == "" {
-		v, err := d.FS.ReadFile(path.Join(constants.HelmChartPath, "values.yaml"))
+		v, err := helm.ChartValues(d.FS, constants.HelmChartPath)
 		if err != nil {
 			warn.Log("event", "push helm values fail while reading defaults", "err", err)
 		} else {
-			defaultValues = string(v)
+			defaultValues = v
 		}
 	}
 
@@ -192,7 +192,7 @@ func (d *HeadlessDaemon) HeadlessResolve(ctx context.Context, release *api.Relea
 	}
 
 	d.ResolvedConfig = templateContext
-	if err := d.StateManager.SerializeConfig(nil, api.ReleaseMetadata{}, templateContext); err != nil {
+	if err := d.StateManager.SerializeConfig(nil, api.ReleaseMetadata{}, resolved, templateContext); err != nil {
 		warn.Log("msg", "serialize state failed", "err", err)
 		return err
 	}
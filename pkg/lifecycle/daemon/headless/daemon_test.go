@@ -39,7 +39,7 @@ func TestHeadlessDaemon(t *testing.T) {
 					},
 				},
 			},
-			ExpectedValue: []byte(`{"v1":{"config":{},"metadata":null}}`),
+			ExpectedValue: []byte(`{"v2":{"config":{},"metadata":null}}`),
 			ExpectedError: false,
 		},
 		{
@@ -63,7 +63,7 @@ func TestHeadlessDaemon(t *testing.T) {
 					},
 				},
 			},
-			ExpectedValue: []byte(`{"v1":{"config":{"alpha":""},"metadata":null}}`),
+			ExpectedValue: []byte(`{"v2":{"config":{"alpha":""},"metadata":null}}`),
 			ExpectedError: false,
 		},
 		{
@@ -87,7 +87,7 @@ func TestHeadlessDaemon(t *testing.T) {
 					},
 				},
 			},
-			ExpectedValue: []byte(`{"v1":{"config":{},"metadata":null}}`),
+			ExpectedValue: []byte(`{"v2":{"config":{},"metadata":null}}`),
 			ExpectedError: true,
 		},
 		{
@@ -111,7 +111,7 @@ func TestHeadlessDaemon(t *testing.T) {
 					},
 				},
 			},
-			ExpectedValue: []byte(`{"v1":{"config":{"alpha":"100"},"metadata":null}}`),
+			ExpectedValue: []byte(`{"v2":{"config":{"alpha":"100"},"metadata":null}}`),
 			ExpectedError: false,
 		},
 		{
@@ -135,7 +135,7 @@ func TestHeadlessDaemon(t *testing.T) {
 					},
 				},
 			},
-			ExpectedValue: []byte(`{"v1":{"config":{"alpha":"100"},"metadata":null}}`),
+			ExpectedValue: []byte(`{"v2":{"config":{"alpha":"100"},"metadata":null}}`),
 			ExpectedError: false,
 		},
 		{
@@ -159,7 +159,7 @@ func TestHeadlessDaemon(t *testing.T) {
 					},
 				},
 			},
-			ExpectedValue: []byte(`{"v1":{"config":{"alpha":""},"metadata":null}}`),
+			ExpectedValue: []byte(`{"v2":{"config":{"alpha":""},"metadata":null}}`),
 			ExpectedError: false,
 		},
 		{
@@ -183,7 +183,7 @@ func TestHeadlessDaemon(t *testing.T) {
 					},
 				},
 			},
-			ExpectedValue: []byte(`{"v1":{"config":{"alpha":""},"metadata":null}}`),
+			ExpectedValue: []byte(`{"v2":{"config":{"alpha":""},"metadata":null}}`),
 			ExpectedError: false,
 		},
 		{
@@ -207,7 +207,7 @@ func TestHeadlessDaemon(t *testing.T) {
 					},
 				},
 			},
-			ExpectedValue: []byte(`{"v1":{"config":{"alpha":"100"},"metadata":null}}`),
+			ExpectedValue: []byte(`{"v2":{"config":{"alpha":"100"},"metadata":null}}`),
 			ExpectedError: false,
 		},
 		{
@@ -231,7 +231,7 @@ func TestHeadlessDaemon(t *testing.T) {
 					},
 				},
 			},
-			ExpectedValue: []byte(`{"v1":{"config":{"alpha":""},"metadata":null}}`),
+			ExpectedValue: []byte(`{"v2":{"config":{"alpha":""},"metadata":null}}`),
 			ExpectedError: false,
 		},
 		{
@@ -255,7 +255,7 @@ func TestHeadlessDaemon(t *testing.T) {
 					},
 				},
 			},
-			ExpectedValue: []byte(`{"v1":{"config":{"alpha":"100"},"metadata":null}}`),
+			ExpectedValue: []byte(`{"v2":{"config":{"alpha":"100"},"metadata":null}}`),
 			ExpectedError: false,
 		},
 		{
@@ -286,7 +286,7 @@ func TestHeadlessDaemon(t *testing.T) {
 					},
 				},
 			},
-			ExpectedValue: []byte(`{"v1":{"config":{"alpha":"","beta":""},"metadata":null}}`),
+			ExpectedValue: []byte(`{"v2":{"config":{"alpha":"","beta":""},"metadata":null}}`),
 			ExpectedError: false,
 		},
 		{
@@ -317,7 +317,7 @@ func TestHeadlessDaemon(t *testing.T) {
 					},
 				},
 			},
-			ExpectedValue: []byte(`{"v1":{"config":{},"metadata":null}}`),
+			ExpectedValue: []byte(`{"v2":{"config":{},"metadata":null}}`),
 			ExpectedError: true,
 		},
 		{
@@ -348,7 +348,7 @@ func TestHeadlessDaemon(t *testing.T) {
 					},
 				},
 			},
-			ExpectedValue: []byte(`{"v1":{"config":{"alpha":"","beta":""},"metadata":null}}`),
+			ExpectedValue: []byte(`{"v2":{"config":{"alpha":"","beta":""},"metadata":null}}`),
 			ExpectedError: true,
 		},
 		{
@@ -379,7 +379,7 @@ func TestHeadlessDaemon(t *testing.T) {
 					},
 				},
 			},
-			ExpectedValue: []byte(`{"v1":{"config":{"alpha":"100","beta":"200"},"metadata":null}}`),
+			ExpectedValue: []byte(`{"v2":{"config":{"alpha":"100","beta":"200"},"metadata":null}}`),
 			ExpectedError: false,
 		},
 		{
@@ -410,7 +410,7 @@ func TestHeadlessDaemon(t *testing.T) {
 					},
 				},
 			},
-			ExpectedValue: []byte(`{"v1":{"config":{"alpha":"101","beta":"101"},"metadata":null}}`),
+			ExpectedValue: []byte(`{"v2":{"config":{"alpha":"101","beta":"101"},"metadata":null}}`),
 			ExpectedError: false,
 		},
 		{
@@ -441,7 +441,7 @@ func TestHeadlessDaemon(t *testing.T) {
 					},
 				},
 			},
-			ExpectedValue: []byte(`{"v1":{"config":{"alpha":"101","beta":"101"},"metadata":null}}`),
+			ExpectedValue: []byte(`{"v2":{"config":{"alpha":"101","beta":"101"},"metadata":null}}`),
 			ExpectedError: false,
 		},
 		{
@@ -479,7 +479,7 @@ func TestHeadlessDaemon(t *testing.T) {
 					},
 				},
 			},
-			ExpectedValue: []byte(`{"v1":{"config":{"alpha":"100","beta":"100","charlie":"100"},"metadata":null}}`),
+			ExpectedValue: []byte(`{"v2":{"config":{"alpha":"100","beta":"100","charlie":"100"},"metadata":null}}`),
 			ExpectedError: false,
 		},
 		{
@@ -552,7 +552,7 @@ func TestHeadlessDaemon(t *testing.T) {
 					},
 				},
 			},
-			ExpectedValue: []byte(`{"v1":{"config":{"alpha":"100","beta":"100","charlie":"100"},"metadata":null}}`),
+			ExpectedValue: []byte(`{"v2":{"config":{"alpha":"100","beta":"100","charlie":"100"},"metadata":null}}`),
 			ExpectedError: true,
 		},
 	}
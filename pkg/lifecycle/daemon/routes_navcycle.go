@@ -3,12 +3,14 @@ package daemon
 import (
 	"fmt"
 	"net/http"
+	"sync"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
 	"github.com/pkg/errors"
 	"github.com/replicatedhq/ship/pkg/api"
+	"github.com/replicatedhq/ship/pkg/changelog"
 	"github.com/replicatedhq/ship/pkg/filetree"
 	"github.com/replicatedhq/ship/pkg/lifecycle"
 	"github.com/replicatedhq/ship/pkg/lifecycle/daemon/daemontypes"
@@ -29,6 +31,8 @@ type NavcycleRoutes struct {
 	Shutdown     chan interface{}
 
 	StepProgress *daemontypes.ProgressMap
+	// stepMu is held while a step executes, so steps run from the UI and by Refresh don't write the same files at once
+	stepMu sync.Mutex
 
 	Messenger      lifecycle.Messenger
 	HelmIntro      lifecycle.HelmIntro
@@ -41,6 +45,7 @@ type NavcycleRoutes struct {
 	Patcher        patch.Patcher
 	ConfigRenderer *resolve.APIConfigRenderer
 	KubectlApply   lifecycle.KubectlApply
+	Changelogs     *changelog.Builder
 
 	ConfigSaved        chan interface{}
 	TerraformConfirmed chan bool
@@ -48,6 +53,9 @@ type NavcycleRoutes struct {
 
 	KubectlConfirmed chan bool
 
+	// DefaultOverlay is the kustomize overlay edited when a request doesn't name one
+	DefaultOverlay string
+
 	// This isn't known at injection time, so we have to set in Register
 	Release *api.Release
 }
@@ -60,6 +68,7 @@ func (d *NavcycleRoutes) Register(group *gin.RouterGroup, release *api.Release)
 	v1.GET("/navcycle/step/:step", d.getStep)
 	v1.POST("/navcycle/step/:step", d.completeStep)
 	v1.POST("/shutdown", d.shutdown)
+	v1.GET("/changelog", d.getChangelog)
 
 	kustom := v1.Group("/kustomize")
 	kustom.POST("file", d.kustomizeGetFile)
@@ -83,6 +92,37 @@ func (d *NavcycleRoutes) Register(group *gin.RouterGroup, release *api.Release)
 	kube.POST("confirm", d.kubectlConfirm)
 }
 
+// overlayName returns the kustomize overlay a request should operate on
+func (d *NavcycleRoutes) overlayName(requested string) (string, error) {
+	name := requested
+	if name == "" {
+		name = d.DefaultOverlay
+	}
+	if name == "" {
+		name = state.ShipOverlay
+	}
+	if err := api.ValidateOverlayName(name); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// overlayNameOrAbort returns the kustomize overlay a request should operate on, or responds with a 400 if it isn't a valid overlay name
+func (d *NavcycleRoutes) overlayNameOrAbort(requested string, c *gin.Context) (string, bool) {
+	name, err := d.overlayName(requested)
+	if err != nil {
+		c.JSON(
+			http.StatusBadRequest,
+			map[string]string{
+				"error":  "bad_request",
+				"detail": err.Error(),
+			},
+		)
+		return "", false
+	}
+	return name, true
+}
+
 func (d *NavcycleRoutes) shutdown(c *gin.Context) {
 	debug := level.Debug(log.With(d.Logger, "method", "shutdown"))
 
@@ -113,22 +153,21 @@ func (d *NavcycleRoutes) maybeAbortDueToMissingRequirement(requires []string, c
 func (d *NavcycleRoutes) getRequiredButIncompleteStepFor(requires []string) (string, error) {
 	debug := level.Debug(log.With(d.Logger, "method", "getRequiredButIncompleteStepFor"))
 
-	stepsCompleted := map[string]interface{}{}
 	currentState, err := d.StateManager.TryLoad()
 	if err != nil {
 		return "", errors.Wrap(err, "load state")
 	}
-	if currentState.Versioned().V1.Lifecycle != nil &&
-		currentState.Versioned().V1.Lifecycle.StepsCompleted != nil {
-		stepsCompleted = currentState.Versioned().V1.Lifecycle.StepsCompleted
+	lifecycle := currentState.Versioned().V2.Lifecycle
+	stepsCompleted := lifecycle.CompletedSteps()
+	if len(stepsCompleted) > 0 {
 		debug.Log("event", "steps.notEmpty", "completed", fmt.Sprintf("%v", stepsCompleted))
 	}
 
 	for _, requiredStep := range requires {
-		if _, ok := stepsCompleted[requiredStep]; ok {
+		if lifecycle.IsCompleted(requiredStep) {
 			continue
 		}
-		debug.Log("event", "requiredStep.incomplete", "completed", stepsCompleted, "required", requiredStep)
+		debug.Log("event", "requiredStep.incomplete", "completed", fmt.Sprintf("%v", stepsCompleted), "required", requiredStep)
 		return requiredStep, nil
 	}
 
@@ -136,6 +175,13 @@ func (d *NavcycleRoutes) getRequiredButIncompleteStepFor(requires []string) (str
 }
 
 func (d *NavcycleRoutes) hydrateAndSend(step daemontypes.Step, c *gin.Context) {
+	if step.Kustomize != nil {
+		overlayName, ok := d.overlayNameOrAbort(c.Query("overlay"), c)
+		if !ok {
+			return
+		}
+		step.Kustomize.Overlay = overlayName
+	}
 	result, err := d.hydrateStep(step)
 	if err != nil {
 		c.AbortWithError(500, err)
@@ -0,0 +1,58 @@
+package daemon
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/ship/pkg/constants"
+	"github.com/replicatedhq/ship/pkg/state"
+)
+
+// getChangelog compares the base ship update replaced with the one it rendered, so the UI can show what changed
+// upstream while the update is reviewed. Outside of an update there's no previous base, and nothing to compare.
+func (d *NavcycleRoutes) getChangelog(c *gin.Context) {
+	debug := level.Debug(log.With(d.Logger, "method", "getChangelog"))
+
+	exists, err := d.Fs.Exists(constants.PreviousBasePath)
+	if err != nil {
+		c.AbortWithError(500, errors.Wrapf(err, "check for %s", constants.PreviousBasePath))
+		return
+	}
+	if !exists {
+		debug.Log("event", "previousBase.missing")
+		c.JSON(http.StatusNotFound, map[string]interface{}{
+			"error": "no update in progress",
+		})
+		return
+	}
+
+	// the update's first write to state saved the state it started from to history
+	serialized, err := d.StateManager.Snapshot(1)
+	if err != nil {
+		c.AbortWithError(500, errors.Wrap(err, "load previous state"))
+		return
+	}
+	var previousState state.VersionedState
+	if err := json.Unmarshal(serialized, &previousState); err != nil {
+		c.AbortWithError(500, errors.Wrap(err, "unmarshal previous state"))
+		return
+	}
+	currentState, err := d.StateManager.TryLoad()
+	if err != nil {
+		c.AbortWithError(500, errors.Wrap(err, "load state"))
+		return
+	}
+
+	changelogs, err := d.Changelogs.FromState(previousState, constants.PreviousBasePath, currentState, constants.KustomizeBasePath)
+	if err != nil {
+		c.AbortWithError(500, errors.Wrap(err, "build changelog"))
+		return
+	}
+	c.JSON(http.StatusOK, map[string]interface{}{
+		"changelogs": changelogs,
+	})
+}
@@ -0,0 +1,93 @@
+package daemon
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/replicatedhq/ship/pkg/api"
+	"github.com/replicatedhq/ship/pkg/changelog"
+	"github.com/replicatedhq/ship/pkg/constants"
+	"github.com/replicatedhq/ship/pkg/lifecycle/daemon/daemontypes"
+	state2 "github.com/replicatedhq/ship/pkg/state"
+	"github.com/replicatedhq/ship/pkg/test-mocks/state"
+	"github.com/replicatedhq/ship/pkg/testing/logger"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetChangelog(t *testing.T) {
+	tests := []struct {
+		name         string
+		previousBase map[string]string
+		expectStatus int
+		expectImages []changelog.ImageChange
+	}{
+		{
+			name:         "no update in progress",
+			expectStatus: 404,
+		},
+		{
+			name: "image bumped",
+			previousBase: map[string]string{
+				"deployment.yaml": "kind: Deployment\nmetadata:\n  name: web\nspec:\n  containers:\n  - name: web\n    image: nginx:1.14\n",
+			},
+			expectStatus: 200,
+			expectImages: []changelog.ImageChange{
+				{Resource: "Deployment/web", Container: "web", Repository: "nginx", From: "1.14", To: "1.15"},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := require.New(t)
+			mc := gomock.NewController(t)
+			defer mc.Finish()
+			testLogger := &logger.TestLogger{T: t}
+			mockFs := afero.Afero{Fs: afero.NewMemMapFs()}
+			mockState := state.NewMockManager(mc)
+
+			req.NoError(mockFs.WriteFile(filepath.Join(constants.KustomizeBasePath, "deployment.yaml"),
+				[]byte("kind: Deployment\nmetadata:\n  name: web\nspec:\n  containers:\n  - name: web\n    image: nginx:1.15\n"), 0644))
+			for name, contents := range test.previousBase {
+				req.NoError(mockFs.WriteFile(filepath.Join(constants.PreviousBasePath, name), []byte(contents), 0644))
+			}
+			if test.previousBase != nil {
+				mockState.EXPECT().Snapshot(1).Return([]byte(`{"v2": {"contentSHA": "abc"}}`), nil)
+				mockState.EXPECT().TryLoad().Return(state2.VersionedState{V2: &state2.V2{ContentSHA: "def"}}, nil)
+			}
+
+			routes := &NavcycleRoutes{
+				Logger:       testLogger,
+				Fs:           mockFs,
+				StateManager: mockState,
+				StepProgress: &daemontypes.ProgressMap{},
+				Changelogs:   changelog.NewBuilder(testLogger, mockFs),
+			}
+			_, port, cancelFunc, err := initTestDaemon(t, &api.Release{}, routes)
+			defer cancelFunc()
+			req.NoError(err)
+
+			resp, err := http.Get(fmt.Sprintf("http://localhost:%d/api/v1/changelog", port))
+			req.NoError(err)
+			req.Equal(test.expectStatus, resp.StatusCode)
+			if test.expectStatus != 200 {
+				return
+			}
+
+			body, err := ioutil.ReadAll(resp.Body)
+			req.NoError(err)
+			var response struct {
+				Changelogs []changelog.Changelog `json:"changelogs"`
+			}
+			req.NoError(json.Unmarshal(body, &response))
+			req.Len(response.Changelogs, 1)
+			req.Equal(&changelog.Change{From: "abc", To: "def"}, response.Changelogs[0].ContentSHA)
+			req.Equal(test.expectImages, response.Changelogs[0].Images)
+		})
+	}
+}
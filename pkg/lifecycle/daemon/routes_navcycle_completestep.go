@@ -44,13 +44,7 @@ func (d *NavcycleRoutes) completeStep(c *gin.Context) {
 		}
 
 		debug.Log("event", "check.stepAlreadyComplete")
-		lifecycle := currentState.Versioned().V1.Lifecycle
-		if lifecycle == nil {
-			lifecycle = &state.Lifeycle{
-				StepsCompleted: make(map[string]interface{}),
-			}
-		}
-		_, stepAlreadyComplete := lifecycle.StepsCompleted[step.Shared().ID]
+		stepAlreadyComplete := currentState.Versioned().V2.Lifecycle.IsCompleted(step.Shared().ID)
 
 		progress, ok := d.StepProgress.Load(step.Shared().ID)
 		shouldExecute := !ok || progress.Detail == `{"status":"success"}` && !stepAlreadyComplete
@@ -63,7 +57,7 @@ func (d *NavcycleRoutes) completeStep(c *gin.Context) {
 				"message": "working",
 			}))
 			go func() {
-				errChan <- d.StepExecutor(d, step)
+				errChan <- d.executeStep(step)
 			}()
 			// hack, give it 10 ms in case its an instant step. Hydrate and send will read progress from the syncMap
 			time.Sleep(10 * time.Millisecond)
@@ -79,6 +73,13 @@ func (d *NavcycleRoutes) completeStep(c *gin.Context) {
 	d.errNotFound(c)
 }
 
+// executeStep runs step once no other step is executing
+func (d *NavcycleRoutes) executeStep(step api.Step) error {
+	d.stepMu.Lock()
+	defer d.stepMu.Unlock()
+	return d.StepExecutor(d, step)
+}
+
 func (d *NavcycleRoutes) handleAsync(errChan chan error, debug log.Logger, step api.Step, stepID string, state state.State) {
 	err := d.awaitAsyncStep(errChan, debug, step)
 	if err != nil {
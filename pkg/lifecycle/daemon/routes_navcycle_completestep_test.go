@@ -28,7 +28,7 @@ type completestepTestCase struct {
 	POST           string
 	ExpectStatus   int
 	ExpectBody     map[string]interface{}
-	State          *state2.Lifeycle
+	State          *state2.Lifecycle
 	ExpectState    *matchers.Is
 	OnExecute      func(d *NavcycleRoutes, step api.Step) error
 	WaitForCleanup func() <-chan time.Time
@@ -101,8 +101,7 @@ func TestV2CompleteStep(t *testing.T) {
 				Describe: "saved state has step foo completed",
 				Test: func(v interface{}) bool {
 					if versioned, ok := v.(state2.VersionedState); ok {
-						_, ok := versioned.V1.Lifecycle.StepsCompleted["foo"]
-						return ok
+						return versioned.V2.Lifecycle.IsCompleted("foo")
 					}
 					return false
 				},
@@ -165,8 +164,7 @@ func TestV2CompleteStep(t *testing.T) {
 				Describe: "saved state has step make-the-things completed",
 				Test: func(v interface{}) bool {
 					if versioned, ok := v.(state2.VersionedState); ok {
-						_, ok := versioned.V1.Lifecycle.StepsCompleted["make-the-things"]
-						return ok
+						return versioned.V2.Lifecycle.IsCompleted("make-the-things")
 					}
 					return false
 				},
@@ -215,9 +213,9 @@ func TestV2CompleteStep(t *testing.T) {
 			}
 
 			fakeState.EXPECT().TryLoad().Return(state2.VersionedState{
-				V1: &state2.V1{
-					Lifecycle: &state2.Lifeycle{
-						StepsCompleted: make(map[string]interface{}),
+				V2: &state2.V2{
+					Lifecycle: &state2.Lifecycle{
+						Steps: make(map[string]state2.StepProgress),
 					},
 				},
 			}, nil).AnyTimes()
@@ -126,7 +126,7 @@ func (d *NavcycleRoutes) putAppConfig(release *api.Release) gin.HandlerFunc {
 		}
 
 		debug.Log("event", "state.serialize")
-		if err := d.StateManager.SerializeConfig(nil, api.ReleaseMetadata{}, templateContext); err != nil {
+		if err := d.StateManager.SerializeConfig(nil, api.ReleaseMetadata{}, resolvedConfig, templateContext); err != nil {
 			level.Error(d.Logger).Log("msg", "serialize state failed", "err", err)
 			c.AbortWithStatus(500)
 		}
@@ -2,7 +2,6 @@ package daemon
 
 import (
 	"fmt"
-	"path"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-kit/kit/log"
@@ -38,7 +37,12 @@ func (d *NavcycleRoutes) hydrateStep(step daemontypes.Step) (*daemontypes.StepRe
 	debug := level.Debug(log.With(d.Logger, "method", "hydrateStep"))
 
 	if step.Kustomize != nil {
-		tree, err := d.TreeLoader.LoadTree(step.Kustomize.BasePath)
+		overlayName, err := d.overlayName(step.Kustomize.Overlay)
+		if err != nil {
+			return nil, err
+		}
+		step.Kustomize.Overlay = overlayName
+		tree, err := d.TreeLoader.LoadTree(step.Kustomize.BasePath, step.Kustomize.Overlay)
 		if err != nil {
 			level.Error(d.Logger).Log("event", "loadTree.fail", "err", err)
 			return nil, errors.Wrap(err, "load kustomize tree")
@@ -57,11 +61,10 @@ func (d *NavcycleRoutes) hydrateStep(step daemontypes.Step) (*daemontypes.StepRe
 		defaultValues := currentState.CurrentHelmValuesDefaults()
 		releaseName := currentState.CurrentReleaseName()
 
-		valuesFileContents, err := d.Fs.ReadFile(path.Join(constants.HelmChartPath, "values.yaml"))
+		vendorValues, err := helm.ChartValues(d.Fs, constants.HelmChartPath)
 		if err != nil {
-			return nil, errors.Wrap(err, "read file values.yaml")
+			return nil, errors.Wrap(err, "read chart values")
 		}
-		vendorValues := string(valuesFileContents)
 
 		mergedValues, err := helm.MergeHelmValues(defaultValues, userValues, vendorValues)
 		if err != nil {
@@ -25,7 +25,7 @@ type getstepTestCase struct {
 	ExpectStatus int
 	ExpectBody   map[string]interface{}
 	StepProgress map[string]daemontypes.Progress
-	State        *state2.Lifeycle
+	State        *state2.Lifecycle
 }
 
 func TestV2GetStep(t *testing.T) {
@@ -136,9 +136,9 @@ func TestV2GetStep(t *testing.T) {
 					},
 				},
 			},
-			State: &state2.Lifeycle{
-				StepsCompleted: map[string]interface{}{
-					"foo": nil,
+			State: &state2.Lifecycle{
+				Steps: map[string]state2.StepProgress{
+					"foo": {Status: state2.StepCompleted},
 				},
 			},
 			GET:          "/api/v1/navcycle/step/bar",
@@ -223,7 +223,7 @@ func TestV2GetStep(t *testing.T) {
 			}
 
 			fakeState.EXPECT().TryLoad().Return(state2.VersionedState{
-				V1: &state2.V1{
+				V2: &state2.V2{
 					Lifecycle: test.State,
 				},
 			}, nil).AnyTimes()
@@ -417,7 +417,7 @@ func TestHydrateStep(t *testing.T) {
 					},
 				},
 			}),
-			state: state2.V0{},
+			state: state2.VersionedState{V2: &state2.V2{}},
 			want: &daemontypes.StepResponse{
 				CurrentStep: daemontypes.Step{
 					Source: api.Step{
@@ -3,6 +3,7 @@ package daemon
 import (
 	"bytes"
 	"net/http"
+	"path"
 	"strconv"
 
 	"github.com/ghodss/yaml"
@@ -18,6 +19,7 @@ import (
 )
 
 type SaveOverlayRequest struct {
+	Overlay    string `json:"overlay"`
 	Path       string `json:"path"`
 	Contents   string `json:"contents"`
 	IsResource bool   `json:"isResource"`
@@ -43,6 +45,10 @@ func (d *NavcycleRoutes) kustomizeSaveOverlay(c *gin.Context) {
 		return
 	}
 
+	if _, ok := d.overlayNameOrAbort(request.Overlay, c); !ok {
+		return
+	}
+
 	step, ok := d.getKustomizeStepOrAbort(c)
 	if !ok {
 		return
@@ -79,7 +85,11 @@ func (d *NavcycleRoutes) kustomizeDoSaveOverlay(request SaveOverlayRequest) erro
 		kustomize.Overlays = map[string]state.Overlay{}
 	}
 
-	overlay := kustomize.Ship()
+	overlayName, err := d.overlayName(request.Overlay)
+	if err != nil {
+		return err
+	}
+	overlay := kustomize.Overlay(overlayName)
 
 	if request.IsResource {
 		if overlay.Resources == nil {
@@ -93,9 +103,9 @@ func (d *NavcycleRoutes) kustomizeDoSaveOverlay(request SaveOverlayRequest) erro
 		overlay.Patches[request.Path] = request.Contents
 	}
 
-	kustomize.Overlays["ship"] = overlay
+	kustomize.Overlays[overlayName] = overlay
 
-	debug.Log("event", "newstate.save")
+	debug.Log("event", "newstate.save", "overlay", overlayName)
 	err = d.StateManager.SaveKustomize(kustomize)
 	if err != nil {
 		return errors.Wrap(err, "save new state")
@@ -131,7 +141,8 @@ func (d *NavcycleRoutes) kustomizeGetFile(c *gin.Context) {
 	debug.Log()
 
 	type Request struct {
-		Path string `json:"path"`
+		Overlay string `json:"overlay"`
+		Path    string `json:"path"`
 	}
 
 	var request Request
@@ -140,6 +151,10 @@ func (d *NavcycleRoutes) kustomizeGetFile(c *gin.Context) {
 		c.AbortWithError(500, err)
 		return
 	}
+	overlayName, ok := d.overlayNameOrAbort(request.Overlay, c)
+	if !ok {
+		return
+	}
 
 	type Response struct {
 		Base        string `json:"base"`
@@ -160,7 +175,7 @@ func (d *NavcycleRoutes) kustomizeGetFile(c *gin.Context) {
 		return
 	}
 
-	overlay, isResource := savedState.CurrentKustomizeOverlay(request.Path)
+	overlay, isResource := savedState.CurrentKustomizeOverlay(overlayName, request.Path)
 
 	var base []byte
 	if !isResource {
@@ -170,6 +185,17 @@ func (d *NavcycleRoutes) kustomizeGetFile(c *gin.Context) {
 			c.AbortWithError(500, err)
 			return
 		}
+
+		// environment overlays are layered on top of the ship overlay, so that's what they should be editing
+		shipPatch, _ := savedState.CurrentKustomizeOverlay(state.ShipOverlay, request.Path)
+		if overlayName != state.ShipOverlay && shipPatch != "" {
+			base, err = d.Patcher.ApplyPatch([]byte(shipPatch), *step.Kustomize, path.Join(step.Kustomize.Base, request.Path))
+			if err != nil {
+				level.Warn(d.Logger).Log("event", "apply ship patch failed", "err", err)
+				c.AbortWithError(500, err)
+				return
+			}
+		}
 	}
 
 	c.JSON(200, Response{
@@ -306,8 +332,13 @@ func (d *NavcycleRoutes) deleteResource(c *gin.Context) {
 		return
 	}
 
+	overlayName, ok := d.overlayNameOrAbort(c.Query("overlay"), c)
+	if !ok {
+		return
+	}
+
 	debug.Log("event", "resource.delete", "path", pathQueryParam)
-	err := d.deleteFile(pathQueryParam, func(overlay state.Overlay) map[string]string {
+	err := d.deleteFile(overlayName, pathQueryParam, func(overlay state.Overlay) map[string]string {
 		return overlay.Resources
 	})
 
@@ -326,8 +357,13 @@ func (d *NavcycleRoutes) deletePatch(c *gin.Context) {
 		return
 	}
 
+	overlayName, ok := d.overlayNameOrAbort(c.Query("overlay"), c)
+	if !ok {
+		return
+	}
+
 	debug.Log("event", "resource.delete", "path", pathQueryParam)
-	err := d.deleteFile(pathQueryParam, func(overlay state.Overlay) map[string]string {
+	err := d.deleteFile(overlayName, pathQueryParam, func(overlay state.Overlay) map[string]string {
 		return overlay.Patches
 	})
 
@@ -339,7 +375,7 @@ func (d *NavcycleRoutes) deletePatch(c *gin.Context) {
 	c.JSON(200, map[string]string{"status": "success"})
 }
 
-func (d *NavcycleRoutes) deleteFile(pathQueryParam string, getFiles func(overlay state.Overlay) map[string]string) error {
+func (d *NavcycleRoutes) deleteFile(overlayName string, pathQueryParam string, getFiles func(overlay state.Overlay) map[string]string) error {
 	debug := level.Debug(log.With(d.Logger, "struct", "daemon", "handler", "deleteFile"))
 	debug.Log("event", "state.load")
 	currentState, err := d.StateManager.TryLoad()
@@ -352,8 +388,8 @@ func (d *NavcycleRoutes) deleteFile(pathQueryParam string, getFiles func(overlay
 		return errors.New("current kustomize empty")
 	}
 
-	shipOverlay := kustomize.Ship()
-	files := getFiles(shipOverlay)
+	overlay := kustomize.Overlay(overlayName)
+	files := getFiles(overlay)
 
 	if len(files) == 0 {
 		return errors.New("no files to delete")
@@ -367,8 +403,8 @@ func (d *NavcycleRoutes) deleteFile(pathQueryParam string, getFiles func(overlay
 	debug.Log("event", "deletePatch", "path", pathQueryParam)
 	delete(files, pathQueryParam)
 
-	if shipOverlay.Patches == nil && shipOverlay.Resources == nil {
-		kustomize.Overlays["ship"] = state.NewOverlay()
+	if overlay.Patches == nil && overlay.Resources == nil {
+		kustomize.Overlays[overlayName] = state.NewOverlay()
 	}
 
 	if err := d.StateManager.SaveKustomize(kustomize); err != nil {
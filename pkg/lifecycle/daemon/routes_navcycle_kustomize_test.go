@@ -2,9 +2,12 @@ package daemon
 
 import (
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
 
+	"github.com/gin-gonic/gin"
 	"github.com/go-test/deep"
 	"github.com/golang/mock/gomock"
 	"github.com/replicatedhq/ship/pkg/lifecycle/daemon/daemontypes"
@@ -17,7 +20,7 @@ import (
 
 type kustomizeSaveFileTestCase struct {
 	Name        string
-	InState     state.V1
+	InState     state.V2
 	Body        SaveOverlayRequest
 	ExpectState state.Kustomize
 }
@@ -66,7 +69,7 @@ func TestV2KustomizeSaveFile(t *testing.T) {
 				Path:       "service.yaml",
 				IsResource: true,
 			},
-			InState: state.V1{
+			InState: state.V2{
 				Kustomize: &state.Kustomize{
 					Overlays: map[string]state.Overlay{
 						"ship": {
@@ -97,7 +100,7 @@ func TestV2KustomizeSaveFile(t *testing.T) {
 				Path:       "service.yaml",
 				IsResource: true,
 			},
-			InState: state.V1{
+			InState: state.V2{
 				Kustomize: &state.Kustomize{
 					Overlays: map[string]state.Overlay{
 						"ship": {
@@ -125,6 +128,40 @@ func TestV2KustomizeSaveFile(t *testing.T) {
 				},
 			},
 		},
+		{
+			Name: "add patch to environment overlay",
+			Body: SaveOverlayRequest{
+				Overlay:  "prod",
+				Contents: "replicas: 5",
+				Path:     "deployment.yaml",
+			},
+			InState: state.V2{
+				Kustomize: &state.Kustomize{
+					Overlays: map[string]state.Overlay{
+						"ship": {
+							Patches: map[string]string{
+								"deployment.yaml": "foo/bar/baz",
+							},
+						},
+					},
+				},
+			},
+			ExpectState: state.Kustomize{
+				Overlays: map[string]state.Overlay{
+					"ship": {
+						Patches: map[string]string{
+							"deployment.yaml": "foo/bar/baz",
+						},
+					},
+					"prod": {
+						Patches: map[string]string{
+							"deployment.yaml": "replicas: 5",
+						},
+						Resources: map[string]string{},
+					},
+				},
+			},
+		},
 	}
 	for _, test := range tests {
 		t.Run(test.Name, func(t *testing.T) {
@@ -142,7 +179,7 @@ func TestV2KustomizeSaveFile(t *testing.T) {
 			}
 
 			fakeState.EXPECT().TryLoad().Return(state.VersionedState{
-				V1: &test.InState,
+				V2: &test.InState,
 			}, nil).AnyTimes()
 
 			fakeState.EXPECT().SaveKustomize(&matchers.Is{
@@ -158,7 +195,7 @@ func TestV2KustomizeSaveFile(t *testing.T) {
 					}
 					return true
 				},
-				Describe: fmt.Sprintf("expect state equal to %s", test.ExpectState),
+				Describe: fmt.Sprintf("expect state equal to %v", test.ExpectState),
 			}).Return(nil).AnyTimes()
 
 			err := v2.kustomizeDoSaveOverlay(test.Body)
@@ -170,7 +207,7 @@ func TestV2KustomizeSaveFile(t *testing.T) {
 
 type kustomizeDeleteFileTestCase struct {
 	Name             string
-	InState          state.V1
+	InState          state.V2
 	DeleteFileParams deleteFileParams
 	ExpectState      state.Kustomize
 }
@@ -190,7 +227,7 @@ func TestV2KustomizeDeleteFile(t *testing.T) {
 					return overlay.Patches
 				},
 			},
-			InState: state.V1{
+			InState: state.V2{
 				Kustomize: &state.Kustomize{
 					Overlays: map[string]state.Overlay{
 						"ship": {
@@ -223,7 +260,7 @@ func TestV2KustomizeDeleteFile(t *testing.T) {
 					return overlay.Resources
 				},
 			},
-			InState: state.V1{
+			InState: state.V2{
 				Kustomize: &state.Kustomize{
 					Overlays: map[string]state.Overlay{
 						"ship": {
@@ -264,7 +301,7 @@ func TestV2KustomizeDeleteFile(t *testing.T) {
 			}
 
 			fakeState.EXPECT().TryLoad().Return(state.VersionedState{
-				V1: &test.InState,
+				V2: &test.InState,
 			}, nil).AnyTimes()
 
 			fakeState.EXPECT().SaveKustomize(&matchers.Is{
@@ -280,12 +317,71 @@ func TestV2KustomizeDeleteFile(t *testing.T) {
 					}
 					return true
 				},
-				Describe: fmt.Sprintf("expect state equal to %s", test.ExpectState),
+				Describe: fmt.Sprintf("expect state equal to %v", test.ExpectState),
 			}).Return(nil).AnyTimes()
 
-			err := v2.deleteFile(test.DeleteFileParams.pathQueryParam, test.DeleteFileParams.getFiles)
+			err := v2.deleteFile(state.ShipOverlay, test.DeleteFileParams.pathQueryParam, test.DeleteFileParams.getFiles)
 			req.NoError(err)
 			mc.Finish()
 		})
 	}
 }
+
+func TestKustomizeInvalidOverlayName(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+	}{
+		{
+			name:   "save",
+			method: "POST",
+			path:   "/kustomize/save",
+			body:   `{"overlay": "../../base", "path": "deployment.yaml", "contents": "kind: Deployment"}`,
+		},
+		{
+			name:   "file",
+			method: "POST",
+			path:   "/kustomize/file",
+			body:   `{"overlay": "prod/east", "path": "deployment.yaml"}`,
+		},
+		{
+			name:   "delete patch",
+			method: "DELETE",
+			path:   "/kustomize/patch?path=deployment.yaml&overlay=..%2Fbase",
+		},
+		{
+			name:   "delete resource",
+			method: "DELETE",
+			path:   "/kustomize/resource?path=deployment.yaml&overlay=..",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := require.New(t)
+			mc := gomock.NewController(t)
+			defer mc.Finish()
+
+			// state is never loaded or saved for an invalid overlay
+			v2 := &NavcycleRoutes{
+				Logger:       &logger.TestLogger{T: t},
+				StateManager: mockstate.NewMockManager(mc),
+				StepProgress: &daemontypes.ProgressMap{},
+			}
+			gin.SetMode(gin.ReleaseMode)
+			g := gin.New()
+			kustom := g.Group("/kustomize")
+			kustom.POST("file", v2.kustomizeGetFile)
+			kustom.POST("save", v2.kustomizeSaveOverlay)
+			kustom.DELETE("patch", v2.deletePatch)
+			kustom.DELETE("resource", v2.deleteResource)
+
+			recorder := httptest.NewRecorder()
+			g.ServeHTTP(recorder, httptest.NewRequest(test.method, test.path, strings.NewReader(test.body)))
+
+			req.Equal(http.StatusBadRequest, recorder.Code)
+			req.Contains(recorder.Body.String(), "invalid overlay name")
+		})
+	}
+}
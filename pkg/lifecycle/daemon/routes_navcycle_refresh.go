@@ -0,0 +1,93 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/ship/pkg/api"
+	"github.com/replicatedhq/ship/pkg/lifecycle/daemon/daemontypes"
+	"github.com/replicatedhq/ship/pkg/util/warnings"
+)
+
+var _ daemontypes.Refresher = &NavcycleRoutes{}
+
+// Refresh re-fetches the upstream and re-executes the render and kustomize steps that have already
+// been completed, so the tree the UI loads for the kustomize step reflects the change. Steps that haven't
+// been completed yet will pick the change up when they're run.
+//
+// If fetch fails, the error is shown on the first render or kustomize step. If a step fails,
+// the error is shown on that step and the steps after it are left as they were.
+//
+// No step started from the UI executes until the refresh is done, since fetch replaces the files steps read.
+func (d *NavcycleRoutes) Refresh(ctx context.Context, fetch func() error) error {
+	debug := level.Debug(log.With(d.Logger, "method", "Refresh"))
+
+	d.stepMu.Lock()
+	defer d.stepMu.Unlock()
+
+	if d.Release == nil {
+		debug.Log("event", "refresh.skip", "reason", "routes not registered")
+		return fetch()
+	}
+
+	var steps []api.Step
+	for _, step := range d.Release.Spec.Lifecycle.V1 {
+		if step.Render != nil || step.Kustomize != nil {
+			steps = append(steps, step)
+		}
+	}
+	if len(steps) == 0 {
+		debug.Log("event", "refresh.skip", "reason", "no render or kustomize steps")
+		return fetch()
+	}
+
+	if err := fetch(); err != nil {
+		d.refreshFailed(steps[0], err)
+		return errors.Wrap(err, "fetch upstream")
+	}
+
+	currentState, err := d.StateManager.TryLoad()
+	if err != nil {
+		return errors.Wrap(err, "load state")
+	}
+	lifecycle := currentState.Versioned().V2.Lifecycle
+
+	for _, step := range steps {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		stepID := step.Shared().ID
+		if !lifecycle.IsCompleted(stepID) {
+			debug.Log("event", "step.skip", "step", stepID, "reason", "not completed")
+			continue
+		}
+
+		debug.Log("event", "step.execute", "step", stepID)
+		d.StepProgress.Store(stepID, daemontypes.JSONProgress("v2router", map[string]interface{}{
+			"status":  "working",
+			"message": "Upstream changed, rendering again",
+		}))
+		if err := d.StepExecutor(d, step); err != nil {
+			d.refreshFailed(step, err)
+			return errors.Wrapf(err, "execute step %s", stepID)
+		}
+		d.StepProgress.Store(stepID, daemontypes.JSONProgress("v2router", map[string]interface{}{
+			"status":  "success",
+			"message": "Step completed successfully.",
+		}))
+	}
+
+	return nil
+}
+
+func (d *NavcycleRoutes) refreshFailed(step api.Step, err error) {
+	level.Error(d.Logger).Log("event", "refresh.fail", "step", step.Shared().ID, "err", err)
+	d.StepProgress.Store(step.Shared().ID, daemontypes.JSONProgress("v2router", map[string]interface{}{
+		"status":  "error",
+		"message": fmt.Sprintf(`%v`, warnings.StripStackIfWarning(err)),
+	}))
+}
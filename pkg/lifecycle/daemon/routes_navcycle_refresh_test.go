@@ -0,0 +1,155 @@
+package daemon
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/ship/pkg/api"
+	"github.com/replicatedhq/ship/pkg/lifecycle/daemon/daemontypes"
+	state2 "github.com/replicatedhq/ship/pkg/state"
+	"github.com/replicatedhq/ship/pkg/test-mocks/state"
+	"github.com/replicatedhq/ship/pkg/testing/logger"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNavcycleRefresh(t *testing.T) {
+	render := api.Step{Render: &api.Render{StepShared: api.StepShared{ID: "render"}}}
+	kustomize := api.Step{Kustomize: &api.Kustomize{StepShared: api.StepShared{ID: "kustomize"}}}
+	message := api.Step{Message: &api.Message{StepShared: api.StepShared{ID: "intro"}}}
+
+	tests := []struct {
+		name         string
+		completed    []api.Step
+		fetchErr     error
+		stepErr      map[string]error
+		expectErr    bool
+		expectRun    []string
+		expectStatus map[string]string
+	}{
+		{
+			name:         "reruns completed steps",
+			completed:    []api.Step{message, render, kustomize},
+			expectRun:    []string{"render", "kustomize"},
+			expectStatus: map[string]string{"render": "success", "kustomize": "success"},
+		},
+		{
+			name:         "skips steps that haven't been completed",
+			completed:    []api.Step{message, render},
+			expectRun:    []string{"render"},
+			expectStatus: map[string]string{"render": "success"},
+		},
+		{
+			name:         "fetch error is shown on the render step",
+			completed:    []api.Step{message, render, kustomize},
+			fetchErr:     errors.New("read Chart.yaml: no such file or directory"),
+			expectErr:    true,
+			expectStatus: map[string]string{"render": "error"},
+		},
+		{
+			name:         "render error stops the refresh",
+			completed:    []api.Step{message, render, kustomize},
+			stepErr:      map[string]error{"render": errors.New("parse templates/deployment.yaml")},
+			expectErr:    true,
+			expectRun:    []string{"render"},
+			expectStatus: map[string]string{"render": "error"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := require.New(t)
+			mc := gomock.NewController(t)
+			defer mc.Finish()
+			mockState := state.NewMockManager(mc)
+
+			versioned := state2.VersionedState{V2: &state2.V2{}}
+			for _, step := range test.completed {
+				versioned = versioned.WithCompletedStep(step)
+			}
+			mockState.EXPECT().TryLoad().Return(versioned, nil).AnyTimes()
+
+			var ran []string
+			routes := &NavcycleRoutes{
+				Logger:       &logger.TestLogger{T: t},
+				StateManager: mockState,
+				StepProgress: &daemontypes.ProgressMap{},
+				Release: &api.Release{Spec: api.Spec{Lifecycle: api.Lifecycle{V1: []api.Step{
+					message, render, kustomize,
+				}}}},
+				StepExecutor: func(d *NavcycleRoutes, step api.Step) error {
+					ran = append(ran, step.Shared().ID)
+					return test.stepErr[step.Shared().ID]
+				},
+			}
+
+			err := routes.Refresh(context.Background(), func() error { return test.fetchErr })
+			if test.expectErr {
+				req.Error(err)
+			} else {
+				req.NoError(err)
+			}
+			req.Equal(test.expectRun, ran)
+
+			for _, stepID := range []string{"intro", "render", "kustomize"} {
+				progress, ok := routes.StepProgress.Load(stepID)
+				if status, expected := test.expectStatus[stepID]; expected {
+					req.True(ok, stepID)
+					req.Equal(status, progress.Status(), stepID)
+				} else {
+					req.False(ok, stepID)
+				}
+			}
+		})
+	}
+}
+
+func TestNavcycleRefreshWaitsForRunningStep(t *testing.T) {
+	req := require.New(t)
+	mc := gomock.NewController(t)
+	defer mc.Finish()
+	mockState := state.NewMockManager(mc)
+
+	render := api.Step{Render: &api.Render{StepShared: api.StepShared{ID: "render"}}}
+	mockState.EXPECT().TryLoad().Return(state2.VersionedState{V2: &state2.V2{}}, nil).AnyTimes()
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	routes := &NavcycleRoutes{
+		Logger:       &logger.TestLogger{T: t},
+		StateManager: mockState,
+		StepProgress: &daemontypes.ProgressMap{},
+		Release:      &api.Release{Spec: api.Spec{Lifecycle: api.Lifecycle{V1: []api.Step{render}}}},
+		StepExecutor: func(d *NavcycleRoutes, step api.Step) error {
+			close(started)
+			<-release
+			return nil
+		},
+	}
+
+	// a step run from the UI is still executing when the upstream changes
+	stepDone := make(chan error)
+	go func() { stepDone <- routes.executeStep(render) }()
+	<-started
+
+	fetched := make(chan struct{})
+	refreshDone := make(chan error)
+	go func() {
+		refreshDone <- routes.Refresh(context.Background(), func() error {
+			close(fetched)
+			return nil
+		})
+	}()
+
+	select {
+	case <-fetched:
+		t.Fatal("upstream was fetched while a step was executing")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	req.NoError(<-stepDone)
+	req.NoError(<-refreshDone)
+	<-fetched
+}
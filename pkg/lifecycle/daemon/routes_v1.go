@@ -3,7 +3,6 @@ package daemon
 import (
 	"fmt"
 	"net/http"
-	"path"
 	"sync"
 
 	"github.com/gin-gonic/gin"
@@ -16,6 +15,7 @@ import (
 	"github.com/replicatedhq/ship/pkg/filetree"
 	"github.com/replicatedhq/ship/pkg/lifecycle/daemon/daemontypes"
 	"github.com/replicatedhq/ship/pkg/lifecycle/render/config/resolve"
+	"github.com/replicatedhq/ship/pkg/lifecycle/render/helm"
 	"github.com/replicatedhq/ship/pkg/patch"
 	"github.com/replicatedhq/ship/pkg/state"
 	"github.com/spf13/afero"
@@ -116,15 +116,15 @@ func (d *V1Routes) saveHelmValues(c *gin.Context) {
 		return
 	}
 
-	chartDefaultValues, err := d.Fs.ReadFile(path.Join(constants.HelmChartPath, "values.yaml"))
+	chartDefaultValues, err := helm.ChartValues(d.Fs, constants.HelmChartPath)
 	if err != nil {
 
 		level.Error(d.Logger).Log("event", "values.readDefault.fail")
-		c.AbortWithError(http.StatusInternalServerError, errors.Wrap(err, "read file values.yaml"))
+		c.AbortWithError(http.StatusInternalServerError, errors.Wrap(err, "read chart values"))
 	}
 
 	debug.Log("event", "serialize.helmValues")
-	if err := d.StateManager.SerializeHelmValues(request.Values, string(chartDefaultValues)); err != nil {
+	if err := d.StateManager.SerializeHelmValues(request.Values, chartDefaultValues); err != nil {
 		debug.Log("event", "seralize.helmValues.fail", "err", err)
 		c.AbortWithError(http.StatusInternalServerError, errors.New("internal_server_error"))
 	}
@@ -3,7 +3,6 @@ package helmValues
 import (
 	"context"
 	"path"
-	"path/filepath"
 	"time"
 
 	"github.com/go-kit/kit/log"
@@ -14,6 +13,7 @@ import (
 	"github.com/replicatedhq/ship/pkg/lifecycle"
 	"github.com/replicatedhq/ship/pkg/lifecycle/daemon"
 	"github.com/replicatedhq/ship/pkg/lifecycle/daemon/daemontypes"
+	"github.com/replicatedhq/ship/pkg/lifecycle/render/helm"
 	"github.com/replicatedhq/ship/pkg/state"
 	"github.com/spf13/afero"
 )
@@ -109,12 +109,10 @@ func resolveStateHelmValues(logger log.Logger, manager state.Manager, fs afero.A
 	}
 	helmValues := editState.CurrentHelmValues()
 	if helmValues == "" {
-		path := filepath.Join(constants.HelmChartPath, "values.yaml")
-		bytes, err := fs.ReadFile(path)
+		helmValues, err = helm.ChartValues(fs, constants.HelmChartPath)
 		if err != nil {
-			return errors.Wrapf(err, "read helm values from %s", constants.TempHelmValuesPath)
+			return errors.Wrapf(err, "read helm values from %s", constants.HelmChartPath)
 		}
-		helmValues = string(bytes)
 	}
 
 	err = fs.MkdirAll(constants.TempHelmValuesPath, 0700)
@@ -4,7 +4,7 @@ import (
 	"bytes"
 	"context"
 	"fmt"
-	"os/exec"
+	"strings"
 	"sync"
 	"time"
 
@@ -12,25 +12,28 @@ import (
 	"github.com/go-kit/kit/log/level"
 	"github.com/pkg/errors"
 	"github.com/replicatedhq/ship/pkg/api"
-	"github.com/replicatedhq/ship/pkg/constants"
 	"github.com/replicatedhq/ship/pkg/lifecycle"
 	"github.com/replicatedhq/ship/pkg/lifecycle/daemon/daemontypes"
 	"github.com/replicatedhq/ship/pkg/templates"
+	"github.com/spf13/afero"
 )
 
 type DaemonlessKubectl struct {
 	Logger         log.Logger
 	Status         daemontypes.StatusReceiver
 	BuilderBuilder *templates.BuilderBuilder
+	FS             afero.Afero
 }
 
 func NewDaemonlessKubectl(
 	logger log.Logger,
 	builderBuilder *templates.BuilderBuilder,
+	fs afero.Afero,
 ) lifecycle.KubectlApply {
 	return &DaemonlessKubectl{
 		Logger:         logger,
 		BuilderBuilder: builderBuilder,
+		FS:             fs,
 	}
 }
 
@@ -38,6 +41,7 @@ func (d *DaemonlessKubectl) WithStatusReceiver(statusReceiver daemontypes.Status
 	return &DaemonlessKubectl{
 		Logger:         d.Logger,
 		BuilderBuilder: d.BuilderBuilder,
+		FS:             d.FS,
 		Status:         statusReceiver,
 	}
 }
@@ -50,6 +54,7 @@ func (d *DaemonlessKubectl) Execute(ctx context.Context, release api.Release, st
 
 	builtPath, _ := builder.String(step.Path)
 	builtKubePath, _ := builder.String(step.Kubeconfig)
+	builtHooksPath, _ := builder.String(step.Hooks)
 
 	debug := level.Debug(log.With(d.Logger, "step.type", "kubectl"))
 
@@ -57,17 +62,17 @@ func (d *DaemonlessKubectl) Execute(ctx context.Context, release api.Release, st
 		return errors.New("A path to apply is required")
 	}
 
-	cmd := exec.Command("kubectl")
-	cmd.Dir = constants.InstallerPrefixPath
-	cmd.Args = append(cmd.Args, "apply", "-f", step.Path)
+	kubeconfig := ""
 	if step.Kubeconfig != "" {
-		cmd.Args = append(cmd.Args, "--kubeconfig", builtKubePath)
+		kubeconfig = builtKubePath
+	}
+	cmds, err := applyCommands(d.FS, step, builtHooksPath, kubeconfig)
+	if err != nil {
+		return errors.Wrap(err, "list hooks to apply")
 	}
 
 	var stderr bytes.Buffer
-	cmd.Stderr = &stderr
 	var stdout bytes.Buffer
-	cmd.Stdout = &stdout
 
 	d.Status.SetProgress(daemontypes.StringProgress("kubectl", "applying kubernetes yaml with kubectl"))
 	doneCh := make(chan struct{})
@@ -105,7 +110,14 @@ func (d *DaemonlessKubectl) Execute(ctx context.Context, release api.Release, st
 		}
 	}()
 
-	err = cmd.Run()
+	for _, cmd := range cmds {
+		cmd.Stderr = &stderr
+		cmd.Stdout = &stdout
+		debug.Log("event", "kubectl.run", "args", strings.Join(cmd.Args[1:], " "))
+		if err = cmd.Run(); err != nil {
+			break
+		}
+	}
 
 	doneCh <- struct{}{}
 	wg.Wait()
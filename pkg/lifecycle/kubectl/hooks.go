@@ -0,0 +1,108 @@
+package kubectl
+
+import (
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/ship/pkg/api"
+	"github.com/replicatedhq/ship/pkg/constants"
+	"github.com/replicatedhq/ship/pkg/util"
+	"github.com/spf13/afero"
+	yaml "gopkg.in/yaml.v2"
+)
+
+const (
+	// hookJobTimeout is how long kubectl waits for a hook Job to complete, the same as helm's default timeout
+	hookJobTimeout = "5m"
+
+	hookDeletePolicyAnnotation = "helm.sh/hook-delete-policy"
+)
+
+// applyCommands are the kubectl commands for a step, run from the installer directory: the pre hooks for the step's
+// hook event in the order they were rendered, waiting for each hook Job to complete, then path, then the post hooks
+func applyCommands(fs afero.Afero, step api.KubectlApply, hooksPath string, kubeconfig string) ([]*exec.Cmd, error) {
+	event := step.HookEvent
+	if event == "" {
+		event = "install"
+	}
+	if event != "install" && event != "upgrade" {
+		return nil, errors.Errorf("unsupported hook event %q, expected install or upgrade", event)
+	}
+
+	preHooks, err := hookCommands(fs, hooksPath, "pre-"+event, kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+	postHooks, err := hookCommands(fs, hooksPath, "post-"+event, kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+
+	cmds := append(preHooks, kubectlCommand(kubeconfig, "apply", "-f", step.Path))
+	return append(cmds, postHooks...), nil
+}
+
+// hookCommands apply each of the hooks for an event, for each chart if there are several, waiting for any Job to complete before the next hook is applied.
+// Like helm, a hook with the before-hook-creation delete policy is deleted before it's applied, so a Job from an earlier run doesn't block applying its
+// immutable spec again, and one with the hook-succeeded policy is deleted once it has completed.
+func hookCommands(fs afero.Afero, hooksPath string, event string, kubeconfig string) ([]*exec.Cmd, error) {
+	if hooksPath == "" {
+		return nil, nil
+	}
+	installerHooksPath := path.Join(constants.InstallerPrefixPath, hooksPath)
+	hookFiles, err := util.HelmHookFiles(fs, installerHooksPath, event)
+	if err != nil {
+		return nil, errors.Wrapf(err, "find %s hooks", event)
+	}
+
+	var cmds []*exec.Cmd
+	for _, hookFile := range hookFiles {
+		contents, err := fs.ReadFile(hookFile)
+		if err != nil {
+			return nil, errors.Wrapf(err, "read %s", hookFile)
+		}
+		var resource struct {
+			Kind     string `yaml:"kind"`
+			Metadata struct {
+				Annotations map[string]string `yaml:"annotations"`
+			} `yaml:"metadata"`
+		}
+		if err := yaml.Unmarshal(contents, &resource); err != nil {
+			return nil, errors.Wrapf(err, "parse %s", hookFile)
+		}
+
+		hookPath, err := filepath.Rel(constants.InstallerPrefixPath, hookFile)
+		if err != nil {
+			return nil, errors.Wrapf(err, "relative path to %s", hookFile)
+		}
+		deletePolicies := map[string]bool{}
+		for _, policy := range strings.Split(resource.Metadata.Annotations[hookDeletePolicyAnnotation], ",") {
+			deletePolicies[strings.TrimSpace(policy)] = true
+		}
+
+		if deletePolicies["before-hook-creation"] {
+			cmds = append(cmds, kubectlCommand(kubeconfig, "delete", "--ignore-not-found", "-f", hookPath))
+		}
+		cmds = append(cmds, kubectlCommand(kubeconfig, "apply", "-f", hookPath))
+		if resource.Kind == "Job" {
+			cmds = append(cmds, kubectlCommand(kubeconfig, "wait", "--for=condition=complete", "--timeout="+hookJobTimeout, "-f", hookPath))
+		}
+		if deletePolicies["hook-succeeded"] {
+			cmds = append(cmds, kubectlCommand(kubeconfig, "delete", "--ignore-not-found", "-f", hookPath))
+		}
+	}
+	return cmds, nil
+}
+
+func kubectlCommand(kubeconfig string, args ...string) *exec.Cmd {
+	cmd := exec.Command("kubectl")
+	cmd.Dir = constants.InstallerPrefixPath
+	cmd.Args = append(cmd.Args, args...)
+	if kubeconfig != "" {
+		cmd.Args = append(cmd.Args, "--kubeconfig", kubeconfig)
+	}
+	return cmd
+}
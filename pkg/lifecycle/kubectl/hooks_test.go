@@ -0,0 +1,145 @@
+package kubectl
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/replicatedhq/ship/pkg/api"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/require"
+)
+
+const migrateJobHook = `apiVersion: batch/v1
+kind: Job
+metadata:
+  name: migrate
+  annotations:
+    "helm.sh/hook": pre-upgrade
+    "helm.sh/hook-delete-policy": %s
+`
+
+// fakeKubectl stands in for kubectl. Like the API server, it refuses to apply a Job hook that exists already, as a Job's
+// spec.template can't be changed.
+const fakeKubectl = `#!/bin/sh
+dir=$(dirname "$0")
+verb=$1
+while [ "$1" != "-f" ]; do shift; done
+object="$dir/objects/$(echo "$2" | tr / _)"
+case "$verb" in
+apply)
+  case "$2" in
+  *job*)
+    if [ -e "$object" ]; then
+      echo "The Job \"migrate\" is invalid: spec.template: field is immutable" >&2
+      exit 1
+    fi
+    ;;
+  esac
+  touch "$object"
+  ;;
+delete)
+  rm -f "$object"
+  ;;
+esac
+`
+
+func TestApplyCommandsReappliedJobHook(t *testing.T) {
+	tests := []struct {
+		name          string
+		deletePolicy  string
+		expectCmds    []string
+		expectReapply string
+	}{
+		{
+			name:         "before hook creation",
+			deletePolicy: "before-hook-creation",
+			expectCmds: []string{
+				"delete --ignore-not-found -f hooks/pre-upgrade/00-job-migrate.yaml",
+				"apply -f hooks/pre-upgrade/00-job-migrate.yaml",
+				"wait --for=condition=complete --timeout=5m -f hooks/pre-upgrade/00-job-migrate.yaml",
+				"apply -f rendered.yaml",
+			},
+		},
+		{
+			name:         "hook succeeded",
+			deletePolicy: "hook-succeeded",
+			expectCmds: []string{
+				"apply -f hooks/pre-upgrade/00-job-migrate.yaml",
+				"wait --for=condition=complete --timeout=5m -f hooks/pre-upgrade/00-job-migrate.yaml",
+				"delete --ignore-not-found -f hooks/pre-upgrade/00-job-migrate.yaml",
+				"apply -f rendered.yaml",
+			},
+		},
+		{
+			name:         "both",
+			deletePolicy: `"before-hook-creation, hook-succeeded"`,
+			expectCmds: []string{
+				"delete --ignore-not-found -f hooks/pre-upgrade/00-job-migrate.yaml",
+				"apply -f hooks/pre-upgrade/00-job-migrate.yaml",
+				"wait --for=condition=complete --timeout=5m -f hooks/pre-upgrade/00-job-migrate.yaml",
+				"delete --ignore-not-found -f hooks/pre-upgrade/00-job-migrate.yaml",
+				"apply -f rendered.yaml",
+			},
+		},
+		{
+			name:         "kept",
+			deletePolicy: "hook-failed",
+			expectCmds: []string{
+				"apply -f hooks/pre-upgrade/00-job-migrate.yaml",
+				"wait --for=condition=complete --timeout=5m -f hooks/pre-upgrade/00-job-migrate.yaml",
+				"apply -f rendered.yaml",
+			},
+			expectReapply: "field is immutable",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := require.New(t)
+
+			binDir, err := ioutil.TempDir("", "ship-kubectl-hooks")
+			req.NoError(err)
+			defer os.RemoveAll(binDir)
+			req.NoError(os.Mkdir(filepath.Join(binDir, "objects"), 0755))
+			req.NoError(ioutil.WriteFile(filepath.Join(binDir, "kubectl"), []byte(fakeKubectl), 0755))
+			defer os.Setenv("PATH", os.Getenv("PATH"))
+			req.NoError(os.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH")))
+
+			fs := afero.Afero{Fs: afero.NewMemMapFs()}
+			hook := strings.Replace(migrateJobHook, "%s", tt.deletePolicy, 1)
+			req.NoError(fs.WriteFile("installer/hooks/pre-upgrade/00-job-migrate.yaml", []byte(hook), 0644))
+			step := api.KubectlApply{Path: "rendered.yaml", Hooks: "hooks", HookEvent: "upgrade"}
+
+			// the first upgrade creates the Job, the second applies it again
+			var reapplyErr error
+			for run := 0; run < 2; run++ {
+				cmds, err := applyCommands(fs, step, "hooks", "")
+				req.NoError(err)
+
+				var args []string
+				for _, cmd := range cmds {
+					args = append(args, strings.Join(cmd.Args[1:], " "))
+					cmd.Dir = binDir
+				}
+				req.Equal(tt.expectCmds, args)
+
+				for _, cmd := range cmds {
+					if output, err := cmd.CombinedOutput(); err != nil {
+						req.Equal(1, run, "the first upgrade failed: %s", output)
+						reapplyErr = err
+						req.Contains(string(output), tt.expectReapply)
+						break
+					}
+				}
+			}
+
+			if tt.expectReapply == "" {
+				req.NoError(reapplyErr)
+			} else {
+				req.Error(reapplyErr)
+			}
+		})
+	}
+}
@@ -4,7 +4,7 @@ import (
 	"bytes"
 	"context"
 	"fmt"
-	"os/exec"
+	"strings"
 	"sync"
 	"time"
 
@@ -13,28 +13,31 @@ import (
 	"github.com/go-kit/kit/log/level"
 	"github.com/pkg/errors"
 	"github.com/replicatedhq/ship/pkg/api"
-	"github.com/replicatedhq/ship/pkg/constants"
 	"github.com/replicatedhq/ship/pkg/lifecycle"
 	"github.com/replicatedhq/ship/pkg/lifecycle/daemon"
 	"github.com/replicatedhq/ship/pkg/lifecycle/daemon/daemontypes"
 	"github.com/replicatedhq/ship/pkg/templates"
+	"github.com/spf13/afero"
 )
 
 type ForkKubectl struct {
 	Logger         log.Logger
 	Daemon         daemontypes.Daemon
 	BuilderBuilder *templates.BuilderBuilder
+	FS             afero.Afero
 }
 
 func NewKubectl(
 	logger log.Logger,
 	daemon daemontypes.Daemon,
 	builderBuilder *templates.BuilderBuilder,
+	fs afero.Afero,
 ) lifecycle.KubectlApply {
 	return &ForkKubectl{
 		Logger:         logger,
 		Daemon:         daemon,
 		BuilderBuilder: builderBuilder,
+		FS:             fs,
 	}
 }
 
@@ -44,6 +47,7 @@ func (k *ForkKubectl) WithStatusReceiver(status daemontypes.StatusReceiver) life
 		Logger:         k.Logger,
 		Daemon:         k.Daemon,
 		BuilderBuilder: k.BuilderBuilder,
+		FS:             k.FS,
 	}
 }
 
@@ -55,6 +59,7 @@ func (k *ForkKubectl) Execute(ctx context.Context, release api.Release, step api
 
 	builtPath, _ := builder.String(step.Path)
 	builtKubePath, _ := builder.String(step.Kubeconfig)
+	builtHooksPath, _ := builder.String(step.Hooks)
 
 	debug := level.Debug(log.With(k.Logger, "step.type", "kubectl"))
 
@@ -62,17 +67,17 @@ func (k *ForkKubectl) Execute(ctx context.Context, release api.Release, step api
 		return errors.New("A path to apply is required")
 	}
 
-	cmd := exec.Command("kubectl")
-	cmd.Dir = constants.InstallerPrefixPath
-	cmd.Args = append(cmd.Args, "apply", "-f", step.Path)
+	kubeconfig := ""
 	if step.Kubeconfig != "" {
-		cmd.Args = append(cmd.Args, "--kubeconfig", builtKubePath)
+		kubeconfig = builtKubePath
+	}
+	cmds, err := applyCommands(k.FS, step, builtHooksPath, kubeconfig)
+	if err != nil {
+		return errors.Wrap(err, "list hooks to apply")
 	}
 
 	var stderr bytes.Buffer
-	cmd.Stderr = &stderr
 	var stdout bytes.Buffer
-	cmd.Stdout = &stdout
 
 	k.Daemon.SetProgress(daemontypes.StringProgress("kubectl", "applying kubernetes yaml with kubectl"))
 	doneCh := make(chan struct{})
@@ -110,7 +115,14 @@ func (k *ForkKubectl) Execute(ctx context.Context, release api.Release, step api
 		}
 	}()
 
-	err = cmd.Run()
+	for _, cmd := range cmds {
+		cmd.Stderr = &stderr
+		cmd.Stdout = &stdout
+		debug.Log("event", "kubectl.run", "args", strings.Join(cmd.Args[1:], " "))
+		if err = cmd.Run(); err != nil {
+			break
+		}
+	}
 
 	doneCh <- struct{}{}
 	wg.Wait()
@@ -0,0 +1,208 @@
+package kustomize
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/ship/pkg/api"
+	"github.com/replicatedhq/ship/pkg/state"
+	"github.com/spf13/afero"
+	"gopkg.in/yaml.v2"
+	ktypes "sigs.k8s.io/kustomize/pkg/types"
+)
+
+// ReadOverlayDir reads a hand-maintained kustomize overlay into a state.Overlay, so that
+// `ship init --adopt-overlay` can take it over. The kustomization.yaml is kept as the overlay's
+// KustomizationYAML, so settings ship doesn't manage itself, like commonLabels, are preserved.
+func ReadOverlayDir(fs afero.Afero, dir string) (state.Overlay, error) {
+	overlay := state.NewOverlay()
+
+	kustomizationPath, err := findKustomization(fs, dir)
+	if err != nil {
+		return overlay, err
+	}
+
+	kustomizationYAML, err := fs.ReadFile(kustomizationPath)
+	if err != nil {
+		return overlay, errors.Wrapf(err, "read %s", kustomizationPath)
+	}
+
+	var kustomization ktypes.Kustomization
+	if err := yaml.Unmarshal(kustomizationYAML, &kustomization); err != nil {
+		return overlay, errors.Wrapf(err, "unmarshal %s", kustomizationPath)
+	}
+
+	if len(kustomization.PatchesJson6902) > 0 {
+		return overlay, errors.Errorf("%s uses patchesJson6902, only patchesStrategicMerge patches can be adopted", kustomizationPath)
+	}
+	if err := checkGeneratorSources(kustomization); err != nil {
+		return overlay, errors.Wrapf(err, "adopt %s", kustomizationPath)
+	}
+
+	var patches []string
+	for _, patch := range kustomization.PatchesStrategicMerge {
+		patches = append(patches, string(patch))
+	}
+	// patches is the deprecated name for patchesStrategicMerge
+	patches = append(patches, kustomization.Patches...)
+
+	if err := readOverlayFiles(fs, dir, patches, overlay.Patches); err != nil {
+		return overlay, errors.Wrap(err, "read patches")
+	}
+	if err := readOverlayFiles(fs, dir, kustomization.Resources, overlay.Resources); err != nil {
+		return overlay, errors.Wrap(err, "read resources")
+	}
+
+	overlay.KustomizationYAML = string(kustomizationYAML)
+	return overlay, nil
+}
+
+func findKustomization(fs afero.Afero, dir string) (string, error) {
+	for _, name := range []string{"kustomization.yaml", "kustomization.yml"} {
+		kustomizationPath := filepath.Join(dir, name)
+		if exists, err := fs.Exists(kustomizationPath); err != nil {
+			return "", errors.Wrapf(err, "check for %s", kustomizationPath)
+		} else if exists {
+			return kustomizationPath, nil
+		}
+	}
+	return "", errors.Errorf("no kustomization.yaml found in %s", dir)
+}
+
+// readOverlayFiles reads files listed in a kustomization into files, keyed the way ship saves
+// overlay files, by their path from the overlay root with a leading slash
+func readOverlayFiles(fs afero.Afero, dir string, relativePaths []string, files map[string]string) error {
+	for _, relativePath := range relativePaths {
+		relativePath = path.Clean(filepath.ToSlash(relativePath))
+		if relativePath == ".." || strings.HasPrefix(relativePath, "../") || path.IsAbs(relativePath) {
+			return errors.Errorf("%s is outside of %s, only files inside the overlay can be adopted", relativePath, dir)
+		}
+
+		if isDir, err := fs.IsDir(filepath.Join(dir, relativePath)); err != nil {
+			return errors.Wrapf(err, "stat %s", relativePath)
+		} else if isDir {
+			return errors.Errorf("%s is a directory, only files can be adopted", relativePath)
+		}
+
+		contents, err := fs.ReadFile(filepath.Join(dir, relativePath))
+		if err != nil {
+			return errors.Wrapf(err, "read %s", relativePath)
+		}
+		files["/"+relativePath] = string(contents)
+	}
+	return nil
+}
+
+// checkGeneratorSources rejects generators that read files, since an adopted overlay only keeps its patches and
+// resources and kustomize build would fail without them. Generators from literals or commands are kept as they are.
+func checkGeneratorSources(kustomization ktypes.Kustomization) error {
+	for _, generator := range kustomization.ConfigMapGenerator {
+		if len(generator.FileSources) > 0 || generator.EnvSource != "" {
+			return errors.Errorf("configMapGenerator %s reads files, only generators from literals can be adopted", generator.Name)
+		}
+	}
+	return nil
+}
+
+// validateAdoptedOverlay checks that every patch in an adopted overlay applies cleanly to a resource in the
+// rendered base, so a hand-written overlay that doesn't match this upstream fails before anything is written
+func (l *Kustomizer) validateAdoptedOverlay(step api.Kustomize) error {
+	debug := level.Debug(log.With(l.Logger, "struct", "kustomizer", "method", "validateAdoptedOverlay"))
+
+	if l.Viper == nil || l.Viper.GetString("adopt-overlay") == "" || l.adoptedOverlayValidated {
+		return nil
+	}
+
+	overlayName := l.Viper.GetString("overlay")
+	if overlayName == "" {
+		overlayName = state.ShipOverlay
+	}
+
+	current, err := l.State.TryLoad()
+	if err != nil {
+		return errors.Wrap(err, "load state")
+	}
+	overlay := state.NewOverlay()
+	if kustomizeState := current.CurrentKustomize(); kustomizeState != nil {
+		overlay = kustomizeState.Overlay(overlayName)
+	}
+
+	baseResources, err := l.baseResourcesByName(step)
+	if err != nil {
+		return errors.Wrap(err, "read base resources")
+	}
+
+	for patchPath, patch := range overlay.Patches {
+		name, err := resourceName([]byte(patch))
+		if err != nil {
+			return errors.Wrapf(err, "read patch %s", patchPath)
+		}
+
+		resource, ok := baseResources[name]
+		if !ok {
+			return errors.Errorf("patch %s targets %s, which is not in the rendered base", patchPath, name)
+		}
+
+		debug.Log("event", "patch.validate", "patch", patchPath, "resource", resource)
+		if _, err := l.Patcher.ApplyPatch([]byte(patch), step, resource); err != nil {
+			return errors.Wrapf(err, "apply patch %s to %s", patchPath, resource)
+		}
+	}
+
+	l.adoptedOverlayValidated = true
+	return nil
+}
+
+// baseResourcesByName maps "kind/name" to the path of each resource in the base
+func (l *Kustomizer) baseResourcesByName(step api.Kustomize) (map[string]string, error) {
+	return l.resourcesByName(step.Base)
+}
+
+// resourcesByName maps "kind/name" to the path of each resource in dir
+func (l *Kustomizer) resourcesByName(dir string) (map[string]string, error) {
+	resources := map[string]string{}
+	err := l.FS.Walk(dir, func(targetPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return errors.Wrap(err, "failed to walk path")
+		}
+		if info.IsDir() || !l.shouldAddFileToBase(targetPath) {
+			return nil
+		}
+
+		contents, err := l.FS.ReadFile(targetPath)
+		if err != nil {
+			return errors.Wrapf(err, "read %s", targetPath)
+		}
+
+		name, err := resourceName(contents)
+		if err != nil {
+			// not every yaml file in the base is necessarily a kubernetes resource
+			return nil
+		}
+		resources[name] = targetPath
+		return nil
+	})
+	return resources, err
+}
+
+func resourceName(contents []byte) (string, error) {
+	var resource struct {
+		Kind     string `yaml:"kind"`
+		Metadata struct {
+			Name string `yaml:"name"`
+		} `yaml:"metadata"`
+	}
+	if err := yaml.Unmarshal(contents, &resource); err != nil {
+		return "", errors.Wrap(err, "unmarshal resource")
+	}
+	if resource.Kind == "" || resource.Metadata.Name == "" {
+		return "", errors.New("resource has no kind or metadata.name")
+	}
+	return fmt.Sprintf("%s/%s", resource.Kind, resource.Metadata.Name), nil
+}
@@ -0,0 +1,140 @@
+package kustomize
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadOverlayDir(t *testing.T) {
+	tests := []struct {
+		name          string
+		files         map[string]string
+		wantPatches   map[string]string
+		wantResources map[string]string
+		wantErr       string
+	}{
+		{
+			name: "patches and resources",
+			files: map[string]string{
+				"kustomization.yaml": `bases:
+- ../../base
+commonLabels:
+  team: platform
+patchesStrategicMerge:
+- deployment.yaml
+- patches/service.yaml
+resources:
+- limitrange.yaml
+`,
+				"deployment.yaml":       "kind: Deployment\n",
+				"patches/service.yaml":  "kind: Service\n",
+				"limitrange.yaml":       "kind: LimitRange\n",
+				"not-in-kustomize.yaml": "kind: Secret\n",
+			},
+			wantPatches: map[string]string{
+				"/deployment.yaml":      "kind: Deployment\n",
+				"/patches/service.yaml": "kind: Service\n",
+			},
+			wantResources: map[string]string{
+				"/limitrange.yaml": "kind: LimitRange\n",
+			},
+		},
+		{
+			name: "deprecated patches field",
+			files: map[string]string{
+				"kustomization.yml": "patches:\n- deployment.yaml\n",
+				"deployment.yaml":   "kind: Deployment\n",
+			},
+			wantPatches: map[string]string{
+				"/deployment.yaml": "kind: Deployment\n",
+			},
+			wantResources: map[string]string{},
+		},
+		{
+			name:    "no kustomization",
+			files:   map[string]string{"deployment.yaml": "kind: Deployment\n"},
+			wantErr: "no kustomization.yaml found",
+		},
+		{
+			name: "patch outside the overlay",
+			files: map[string]string{
+				"kustomization.yaml": "patchesStrategicMerge:\n- ../shared/deployment.yaml\n",
+			},
+			wantErr: "only files inside the overlay can be adopted",
+		},
+		{
+			name: "json patches",
+			files: map[string]string{
+				"kustomization.yaml": `patchesJson6902:
+- target:
+    kind: Deployment
+    name: my-deploy
+  path: replicas.yaml
+`,
+			},
+			wantErr: "only patchesStrategicMerge patches can be adopted",
+		},
+		{
+			name: "directory resource",
+			files: map[string]string{
+				"kustomization.yaml":   "resources:\n- monitoring\n",
+				"monitoring/rule.yaml": "kind: PrometheusRule\n",
+			},
+			wantErr: "monitoring is a directory, only files can be adopted",
+		},
+		{
+			name: "generator from files",
+			files: map[string]string{
+				"kustomization.yaml": `configMapGenerator:
+- name: nginx-config
+  files:
+  - nginx.conf
+`,
+				"nginx.conf": "worker_processes 1;\n",
+			},
+			wantErr: "configMapGenerator nginx-config reads files",
+		},
+		{
+			name: "generator from literals",
+			files: map[string]string{
+				"kustomization.yaml": `configMapGenerator:
+- name: settings
+  literals:
+  - LOG_LEVEL=debug
+`,
+			},
+			wantPatches:   map[string]string{},
+			wantResources: map[string]string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := require.New(t)
+			fs := afero.Afero{Fs: afero.NewMemMapFs()}
+			dir := "overlays/production"
+			for name, contents := range tt.files {
+				req.NoError(fs.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0755))
+				req.NoError(fs.WriteFile(filepath.Join(dir, name), []byte(contents), 0644))
+			}
+
+			overlay, err := ReadOverlayDir(fs, dir)
+			if tt.wantErr != "" {
+				req.Error(err)
+				req.Contains(err.Error(), tt.wantErr)
+				return
+			}
+			req.NoError(err)
+
+			req.Equal(tt.wantPatches, overlay.Patches)
+			req.Equal(tt.wantResources, overlay.Resources)
+			for name, contents := range tt.files {
+				if filepath.Base(name) == "kustomization.yaml" || filepath.Base(name) == "kustomization.yml" {
+					req.Equal(contents, overlay.KustomizationYAML)
+				}
+			}
+		})
+	}
+}
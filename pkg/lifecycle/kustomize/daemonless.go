@@ -5,36 +5,55 @@ import (
 
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
+	"github.com/mitchellh/cli"
 	"github.com/pkg/errors"
 	"github.com/replicatedhq/ship/pkg/api"
 	"github.com/replicatedhq/ship/pkg/lifecycle"
 	"github.com/replicatedhq/ship/pkg/patch"
 	"github.com/replicatedhq/ship/pkg/state"
 	"github.com/spf13/afero"
+	"github.com/spf13/viper"
 )
 
 type Kustomizer struct {
 	Logger  log.Logger
+	UI      cli.Ui
 	FS      afero.Afero
 	State   state.Manager
 	Patcher patch.ShipPatcher
+	Viper   *viper.Viper
+
+	adoptedOverlayValidated bool
 }
 
 func NewDaemonlessKustomizer(
 	logger log.Logger,
+	ui cli.Ui,
 	fs afero.Afero,
 	state state.Manager,
+	v *viper.Viper,
 ) lifecycle.Kustomizer {
 	return &Kustomizer{
-		Logger: logger,
-		FS:     fs,
-		State:  state,
+		Logger:  logger,
+		UI:      ui,
+		FS:      fs,
+		State:   state,
+		Patcher: patch.ShipPatcher{Logger: logger, FS: fs},
+		Viper:   v,
 	}
 }
 
 func (l *Kustomizer) Execute(ctx context.Context, release *api.Release, step api.Kustomize) error {
 	debug := level.Debug(log.With(l.Logger, "struct", "daemonless.kustomizer", "method", "execute"))
 
+	if err := l.validateAdoptedOverlay(step); err != nil {
+		return errors.Wrap(err, "validate adopted overlay")
+	}
+
+	if err := l.checkPatches(step); err != nil {
+		return err
+	}
+
 	debug.Log("event", "write.base.kustomization.yaml")
 	err := l.writeBase(step)
 	if err != nil {
@@ -79,27 +98,55 @@ func (l *Kustomizer) Execute(ctx context.Context, release *api.Release, step api
 		return err
 	}
 
-	err = l.writeOverlay(fs, step, relativePatchPaths, relativeResourcePaths)
+	err = l.writeOverlay(fs, step, relativePatchPaths, relativeResourcePaths, shipOverlay.KustomizationYAML)
 	if err != nil {
 		return errors.Wrap(err, "write overlay")
 	}
 
 	if step.Dest != "" {
 		debug.Log("event", "kustomize.build", "dest", step.Dest)
-		err = l.kustomizeBuild(fs, step)
+		err = l.kustomizeBuild(fs, step.OverlayPath(), step.Dest)
 		if err != nil {
 			return errors.Wrap(err, "build overlay")
 		}
 	}
 
+	for _, name := range kustomizeState.EnvironmentOverlays() {
+		debug.Log("event", "write.environment.overlay", "overlay", name)
+		err = l.writeEnvironmentOverlay(fs, step, name, kustomizeState.Overlay(name))
+		if err != nil {
+			return errors.Wrapf(err, "write overlay %s", name)
+		}
+
+		if dest := step.EnvironmentDest(name); dest != "" {
+			debug.Log("event", "kustomize.build", "overlay", name, "dest", dest)
+			overlayPath, err := step.EnvironmentOverlayPath(name)
+			if err != nil {
+				return err
+			}
+			err = l.kustomizeBuild(fs, overlayPath, dest)
+			if err != nil {
+				return errors.Wrapf(err, "build overlay %s", name)
+			}
+		}
+	}
+
+	if step.Hooks != "" && step.Dest != "" {
+		debug.Log("event", "write.hooks", "hooks", step.Hooks)
+		if err := l.writeHooks(fs, step); err != nil {
+			return errors.Wrap(err, "write helm hooks")
+		}
+	}
+
 	return nil
 }
-func (l *Kustomizer) kustomizeBuild(fs afero.Afero, kustomize api.Kustomize) error {
-	builtYAML, err := l.Patcher.RunKustomize(kustomize.OverlayPath())
+
+func (l *Kustomizer) kustomizeBuild(fs afero.Afero, overlayPath string, dest string) error {
+	builtYAML, err := l.Patcher.RunKustomize(overlayPath)
 	if err != nil {
 		return errors.Wrap(err, "run kustomize")
 	}
 
-	fs.WriteFile(kustomize.Dest, builtYAML, 0644)
+	fs.WriteFile(dest, builtYAML, 0644)
 	return nil
 }
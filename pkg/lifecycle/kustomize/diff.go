@@ -0,0 +1,143 @@
+package kustomize
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/pmezard/go-difflib/difflib"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	ResourceAdded   = "added"
+	ResourceRemoved = "removed"
+	ResourceChanged = "changed"
+)
+
+var documentSeparator = regexp.MustCompile(`(?m)^---\s*$`)
+
+// ResourceChange is a resource that was added to, removed from or changed in built kustomize output
+type ResourceChange struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+	Change    string `json:"change"`
+	// Diff is a unified diff of the resource's yaml
+	Diff string `json:"diff"`
+}
+
+// ID is how the resource is shown to users, e.g. Deployment/default/nginx
+func (r ResourceChange) ID() string {
+	if r.Namespace == "" {
+		return fmt.Sprintf("%s/%s", r.Kind, r.Name)
+	}
+	return fmt.Sprintf("%s/%s/%s", r.Kind, r.Namespace, r.Name)
+}
+
+// OutputDiff is the per-resource difference between two builds of the same kustomize output
+type OutputDiff struct {
+	Dest      string           `json:"dest"`
+	Added     int              `json:"added"`
+	Removed   int              `json:"removed"`
+	Changed   int              `json:"changed"`
+	Resources []ResourceChange `json:"resources"`
+}
+
+type resourceKey struct {
+	kind, namespace, name string
+}
+
+// DiffOutput compares the resources in two builds of the kustomize output written to dest,
+// returning the changed resources sorted by kind, namespace and name
+func DiffOutput(dest string, before []byte, after []byte) (*OutputDiff, error) {
+	beforeResources, err := splitResources(before)
+	if err != nil {
+		return nil, errors.Wrapf(err, "split current %s", dest)
+	}
+	afterResources, err := splitResources(after)
+	if err != nil {
+		return nil, errors.Wrapf(err, "split updated %s", dest)
+	}
+
+	keys := map[resourceKey]bool{}
+	for key := range beforeResources {
+		keys[key] = true
+	}
+	for key := range afterResources {
+		keys[key] = true
+	}
+
+	diff := &OutputDiff{Dest: dest, Resources: []ResourceChange{}}
+	for key := range keys {
+		from, existed := beforeResources[key]
+		to, exists := afterResources[key]
+		if from == to {
+			continue
+		}
+
+		change := ResourceChange{Kind: key.kind, Namespace: key.namespace, Name: key.name}
+		switch {
+		case !existed:
+			change.Change = ResourceAdded
+			diff.Added++
+		case !exists:
+			change.Change = ResourceRemoved
+			diff.Removed++
+		default:
+			change.Change = ResourceChanged
+			diff.Changed++
+		}
+
+		change.Diff, err = difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+			A:        difflib.SplitLines(from),
+			B:        difflib.SplitLines(to),
+			FromFile: "current/" + change.ID(),
+			ToFile:   "updated/" + change.ID(),
+			Context:  3,
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "diff %s", change.ID())
+		}
+		diff.Resources = append(diff.Resources, change)
+	}
+
+	sort.Slice(diff.Resources, func(i, j int) bool {
+		a, b := diff.Resources[i], diff.Resources[j]
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		return a.Name < b.Name
+	})
+	return diff, nil
+}
+
+// splitResources splits a multi-document yaml stream into its resources, keyed by kind, namespace and name
+func splitResources(contents []byte) (map[resourceKey]string, error) {
+	resources := map[resourceKey]string{}
+	for _, document := range documentSeparator.Split(string(contents), -1) {
+		if strings.TrimSpace(document) == "" {
+			continue
+		}
+
+		var resource struct {
+			Kind     string `yaml:"kind"`
+			Metadata struct {
+				Name      string `yaml:"name"`
+				Namespace string `yaml:"namespace"`
+			} `yaml:"metadata"`
+		}
+		if err := yaml.Unmarshal([]byte(document), &resource); err != nil {
+			return nil, errors.Wrap(err, "unmarshal resource")
+		}
+
+		key := resourceKey{kind: resource.Kind, namespace: resource.Metadata.Namespace, name: resource.Metadata.Name}
+		resources[key] = strings.TrimSpace(document) + "\n"
+	}
+	return resources, nil
+}
@@ -0,0 +1,80 @@
+package kustomize
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffOutput(t *testing.T) {
+	req := require.New(t)
+	before := `apiVersion: v1
+kind: Service
+metadata:
+  name: nginx
+  namespace: web
+spec:
+  ports:
+  - port: 80
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: nginx
+  namespace: web
+spec:
+  replicas: 1
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: legacy
+`
+	after := `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: nginx
+  namespace: web
+spec:
+  replicas: 2
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: nginx
+  namespace: web
+spec:
+  ports:
+  - port: 80
+---
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: nginx
+  namespace: web
+`
+
+	diff, err := DiffOutput("rendered.yaml", []byte(before), []byte(after))
+	req.NoError(err)
+	req.Equal("rendered.yaml", diff.Dest)
+	req.Equal(1, diff.Added)
+	req.Equal(1, diff.Removed)
+	req.Equal(1, diff.Changed)
+
+	var ids, changes []string
+	for _, resource := range diff.Resources {
+		ids = append(ids, resource.ID())
+		changes = append(changes, resource.Change)
+	}
+	req.Equal([]string{"ConfigMap/legacy", "Deployment/web/nginx", "ServiceAccount/web/nginx"}, ids)
+	req.Equal([]string{ResourceRemoved, ResourceChanged, ResourceAdded}, changes)
+	req.Contains(diff.Resources[1].Diff, "--- current/Deployment/web/nginx\n+++ updated/Deployment/web/nginx\n")
+	req.Contains(diff.Resources[1].Diff, "-  replicas: 1\n+  replicas: 2\n")
+
+	unchanged, err := DiffOutput("rendered.yaml", []byte(before), []byte(before))
+	req.NoError(err)
+	req.Empty(unchanged.Resources)
+
+	_, err = DiffOutput("rendered.yaml", []byte("kind: [\n"), nil)
+	req.Error(err)
+}
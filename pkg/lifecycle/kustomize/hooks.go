@@ -0,0 +1,55 @@
+package kustomize
+
+import (
+	"strings"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/ship/pkg/api"
+	"github.com/replicatedhq/ship/pkg/util"
+	"github.com/spf13/afero"
+)
+
+// writeHooks writes the helm hooks rendered to step.Hooks, for each chart if there are several, next to step.Dest, a file per hook event with the event's
+// hooks in the order they run. The file for an event that no longer has any hooks is removed.
+func (l *Kustomizer) writeHooks(fs afero.Afero, step api.Kustomize) error {
+	debug := level.Debug(log.With(l.Logger, "struct", "kustomizer", "method", "writeHooks"))
+
+	for _, event := range api.HelmHookEvents {
+		dest := step.HookDest(event)
+
+		hookFiles, err := util.HelmHookFiles(fs, step.Hooks, event)
+		if err != nil {
+			return errors.Wrapf(err, "find %s hooks", event)
+		}
+		var hooks []string
+		for _, hookFile := range hookFiles {
+			contents, err := fs.ReadFile(hookFile)
+			if err != nil {
+				return errors.Wrapf(err, "read %s", hookFile)
+			}
+			hooks = append(hooks, strings.TrimSuffix(string(contents), "\n")+"\n")
+		}
+
+		if len(hooks) == 0 {
+			exists, err := fs.Exists(dest)
+			if err != nil {
+				return errors.Wrapf(err, "check for %s", dest)
+			}
+			if exists {
+				debug.Log("event", "hooks.remove", "hookEvent", event, "dest", dest)
+				if err := fs.Remove(dest); err != nil {
+					return errors.Wrapf(err, "remove %s", dest)
+				}
+			}
+			continue
+		}
+
+		debug.Log("event", "hooks.write", "hookEvent", event, "dest", dest, "hooks", len(hooks))
+		if err := fs.WriteFile(dest, []byte("---\n"+strings.Join(hooks, "---\n")), 0644); err != nil {
+			return errors.Wrapf(err, "write %s", dest)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package kustomize
+
+import (
+	"testing"
+
+	"github.com/replicatedhq/ship/pkg/api"
+	"github.com/replicatedhq/ship/pkg/testing/logger"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKustomizerWriteHooks(t *testing.T) {
+	tests := []struct {
+		name        string
+		hookFiles   map[string]string
+		expectFiles map[string]string
+		expectGone  []string
+	}{
+		{
+			name: "hooks in order",
+			hookFiles: map[string]string{
+				"hooks/pre-install/00-configmap-config.yaml": "kind: ConfigMap\n",
+				"hooks/pre-install/01-job-migrate.yaml":      "kind: Job\n",
+				"hooks/post-upgrade/00-job-notify.yaml":      "kind: Job",
+			},
+			expectFiles: map[string]string{
+				"rendered-pre-install.yaml":  "---\nkind: ConfigMap\n---\nkind: Job\n",
+				"rendered-post-upgrade.yaml": "---\nkind: Job\n",
+			},
+			expectGone: []string{"rendered-pre-upgrade.yaml"},
+		},
+		{
+			name: "hooks for each chart",
+			hookFiles: map[string]string{
+				"hooks/db/pre-install/00-job-migrate.yaml": "kind: Job\n",
+				"hooks/web/pre-install/00-secret-tls.yaml": "kind: Secret\n",
+			},
+			expectFiles: map[string]string{
+				"rendered-pre-install.yaml": "---\nkind: Job\n---\nkind: Secret\n",
+			},
+		},
+		{
+			name: "stale hooks removed",
+			hookFiles: map[string]string{
+				"rendered-pre-delete.yaml": "---\nkind: Job\n",
+			},
+			expectGone: []string{"rendered-pre-delete.yaml"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := require.New(t)
+			mockFs := afero.Afero{Fs: afero.NewMemMapFs()}
+			for name, contents := range tt.hookFiles {
+				req.NoError(mockFs.WriteFile(name, []byte(contents), 0644))
+			}
+
+			l := &Kustomizer{Logger: &logger.TestLogger{T: t}}
+			err := l.writeHooks(mockFs, api.Kustomize{Base: "base", Dest: "rendered.yaml", Hooks: "hooks"})
+			req.NoError(err)
+
+			for name, contents := range tt.expectFiles {
+				actual, err := mockFs.ReadFile(name)
+				req.NoError(err, name)
+				req.Equal(contents, string(actual), name)
+			}
+			for _, name := range tt.expectGone {
+				exists, err := mockFs.Exists(name)
+				req.NoError(err)
+				req.False(exists, name)
+			}
+		})
+	}
+}
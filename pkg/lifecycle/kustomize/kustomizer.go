@@ -10,13 +10,16 @@ import (
 
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
+	"github.com/mitchellh/cli"
 	"github.com/pkg/errors"
 	"github.com/replicatedhq/ship/pkg/api"
 	"github.com/replicatedhq/ship/pkg/constants"
 	"github.com/replicatedhq/ship/pkg/lifecycle"
 	"github.com/replicatedhq/ship/pkg/lifecycle/daemon/daemontypes"
+	shippatch "github.com/replicatedhq/ship/pkg/patch"
 	"github.com/replicatedhq/ship/pkg/state"
 	"github.com/spf13/afero"
+	"github.com/spf13/viper"
 	"gopkg.in/yaml.v2"
 	"sigs.k8s.io/kustomize/pkg/patch"
 	ktypes "sigs.k8s.io/kustomize/pkg/types"
@@ -24,15 +27,20 @@ import (
 
 func NewDaemonKustomizer(
 	logger log.Logger,
+	ui cli.Ui,
 	daemon daemontypes.Daemon,
 	fs afero.Afero,
 	stateManager state.Manager,
+	v *viper.Viper,
 ) lifecycle.Kustomizer {
 	return &daemonkustomizer{
 		Kustomizer: Kustomizer{
-			Logger: logger,
-			FS:     fs,
-			State:  stateManager,
+			Logger:  logger,
+			UI:      ui,
+			FS:      fs,
+			State:   stateManager,
+			Patcher: shippatch.ShipPatcher{Logger: logger, FS: fs},
+			Viper:   v,
 		},
 		Daemon: daemon,
 	}
@@ -46,6 +54,11 @@ type daemonkustomizer struct {
 }
 
 func (l *daemonkustomizer) Execute(ctx context.Context, release *api.Release, step api.Kustomize) error {
+	// validate before showing the UI, so the adopted patches aren't presented for editing if they don't apply
+	if err := l.validateAdoptedOverlay(step); err != nil {
+		return errors.Wrap(err, "validate adopted overlay")
+	}
+
 	daemonExitedChan := l.Daemon.EnsureStarted(ctx, release)
 	err := l.awaitKustomizeSaved(ctx, daemonExitedChan)
 	if err != nil {
@@ -162,22 +175,76 @@ func (l *Kustomizer) writeOverlay(
 	step api.Kustomize,
 	relativePatchPaths []patch.PatchStrategicMerge,
 	relativeResourcePaths []string,
+	customKustomization string,
 ) error {
-	// just always make a new kustomization.yaml for now
-	kustomization := ktypes.Kustomization{
-		Bases: []string{
-			filepath.Join("../../", step.Base),
-		},
-		PatchesStrategicMerge: relativePatchPaths,
-		Resources:             relativeResourcePaths,
+	return l.writeKustomization(
+		fs,
+		step.OverlayPath(),
+		[]string{filepath.Join("../../", step.Base)},
+		relativePatchPaths,
+		relativeResourcePaths,
+		customKustomization,
+	)
+}
+
+// writeEnvironmentOverlay writes a named environment overlay as a sibling of the ship overlay,
+// using the ship overlay as its only base
+func (l *Kustomizer) writeEnvironmentOverlay(fs afero.Afero, step api.Kustomize, name string, overlay state.Overlay) error {
+	overlayPath, err := step.EnvironmentOverlayPath(name)
+	if err != nil {
+		return err
+	}
+
+	err = fs.MkdirAll(overlayPath, 0777)
+	if err != nil {
+		return errors.Wrapf(err, "make dir %s", overlayPath)
+	}
+
+	relativePatchPaths, err := l.writePatches(fs, overlay, overlayPath)
+	if err != nil {
+		return err
+	}
+
+	relativeResourcePaths, err := l.writeResources(fs, overlay, overlayPath)
+	if err != nil {
+		return err
+	}
+
+	relativeShipPath, err := filepath.Rel(overlayPath, step.OverlayPath())
+	if err != nil {
+		return errors.Wrap(err, "unable to determine relative path")
+	}
+
+	return l.writeKustomization(fs, overlayPath, []string{relativeShipPath}, relativePatchPaths, relativeResourcePaths, overlay.KustomizationYAML)
+}
+
+func (l *Kustomizer) writeKustomization(
+	fs afero.Afero,
+	overlayPath string,
+	bases []string,
+	relativePatchPaths []patch.PatchStrategicMerge,
+	relativeResourcePaths []string,
+	customKustomization string,
+) error {
+	// start from an adopted kustomization.yaml if there is one, so settings like commonLabels carry over,
+	// but ship always owns the bases, patches and resources
+	var kustomization ktypes.Kustomization
+	if customKustomization != "" {
+		if err := yaml.Unmarshal([]byte(customKustomization), &kustomization); err != nil {
+			return errors.Wrapf(err, "unmarshal kustomization.yaml for %s", overlayPath)
+		}
 	}
+	kustomization.Bases = bases
+	kustomization.PatchesStrategicMerge = relativePatchPaths
+	kustomization.Resources = relativeResourcePaths
+	kustomization.Patches = nil
 
 	marshalled, err := yaml.Marshal(kustomization)
 	if err != nil {
 		return errors.Wrap(err, "marshal kustomization.yaml")
 	}
 
-	name := path.Join(step.OverlayPath(), "kustomization.yaml")
+	name := path.Join(overlayPath, "kustomization.yaml")
 	err = fs.WriteFile(name, []byte(marshalled), 0666)
 	if err != nil {
 		return errors.Wrapf(err, "write file %s", name)
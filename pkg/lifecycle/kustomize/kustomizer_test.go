@@ -161,7 +161,7 @@ patchesStrategicMerge:
 				},
 				Daemon: mockDaemon,
 			}
-			if err := l.writeOverlay(mockFs, mockStep, tt.relativePatchPaths, nil); (err != nil) != tt.wantErr {
+			if err := l.writeOverlay(mockFs, mockStep, tt.relativePatchPaths, nil, ""); (err != nil) != tt.wantErr {
 				t.Errorf("kustomizer.writeOverlay() error = %v, wantErr %v", err, tt.wantErr)
 			}
 
@@ -416,6 +416,86 @@ resources:
 apiversion: ""
 resources:
 - deployment.yaml
+`,
+			},
+		},
+		{
+			name: "environment overlay",
+			kustomize: &state.Kustomize{
+				Overlays: map[string]state.Overlay{
+					"ship": {
+						Patches: map[string]string{
+							"/deployment.yaml": `---
+metadata:
+  name: my-deploy
+spec:
+  replicas: 100`,
+						},
+					},
+					"prod": {
+						Patches: map[string]string{
+							"/deployment.yaml": `---
+metadata:
+  name: my-deploy
+spec:
+  replicas: 500`,
+						},
+					},
+				},
+			},
+			expectFiles: map[string]string{
+				"overlays/ship/kustomization.yaml": `kind: ""
+apiversion: ""
+bases:
+- ../../base
+patchesStrategicMerge:
+- deployment.yaml
+`,
+				"overlays/prod/deployment.yaml": `---
+metadata:
+  name: my-deploy
+spec:
+  replicas: 500`,
+				"overlays/prod/kustomization.yaml": `kind: ""
+apiversion: ""
+bases:
+- ../ship
+patchesStrategicMerge:
+- deployment.yaml
+`,
+			},
+		},
+		{
+			name: "adopted kustomization",
+			kustomize: &state.Kustomize{
+				Overlays: map[string]state.Overlay{
+					"ship": {
+						Patches: map[string]string{
+							"/deployment.yaml": `---
+metadata:
+  name: my-deploy
+spec:
+  replicas: 100`,
+						},
+						KustomizationYAML: `bases:
+- ../../some/other/base
+commonLabels:
+  team: platform
+patchesStrategicMerge:
+- deployment.yaml
+`,
+					},
+				},
+			},
+			expectFiles: map[string]string{
+				"overlays/ship/kustomization.yaml": `kind: ""
+apiversion: ""
+commonLabels:
+  team: platform
+bases:
+- ../../base
+patchesStrategicMerge:
+- deployment.yaml
 `,
 			},
 		},
@@ -450,7 +530,7 @@ resources:
 				BasePath: constants.KustomizeBasePath,
 			})
 			mockDaemon.EXPECT().KustomizeSavedChan().Return(saveChan)
-			mockState.EXPECT().TryLoad().Return(state.VersionedState{V1: &state.V1{
+			mockState.EXPECT().TryLoad().Return(state.VersionedState{V2: &state.V2{
 				Kustomize: test.kustomize,
 			}}, nil)
 
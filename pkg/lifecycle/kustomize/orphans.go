@@ -0,0 +1,336 @@
+package kustomize
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/ship/pkg/api"
+	"github.com/replicatedhq/ship/pkg/state"
+)
+
+const (
+	// PatchOrphaned is a patch whose target is no longer in the base
+	PatchOrphaned = "orphaned"
+	// PatchNoop is a patch that no longer changes its target, because upstream now matches it
+	PatchNoop = "no-op"
+	// PatchConflict is a patch that changes fields of its target that upstream changed too
+	PatchConflict = "conflict"
+	// PatchFailed is a patch that no longer applies to its target
+	PatchFailed = "failed"
+)
+
+// PatchIssue is a problem with an overlay patch found after the base it patches was updated
+type PatchIssue struct {
+	Overlay string
+	Patch   string
+	Target  string
+	Problem string
+	// Fields are the fields of a conflicting patch that upstream changed too
+	Fields []string
+	// Err is why a failed patch didn't apply
+	Err error
+}
+
+func (i PatchIssue) String() string {
+	switch i.Problem {
+	case PatchOrphaned:
+		return fmt.Sprintf("patch %s in overlay %s targets %s, which is no longer in the base", i.Patch, i.Overlay, i.Target)
+	case PatchNoop:
+		return fmt.Sprintf("patch %s in overlay %s no longer changes %s, upstream now matches it", i.Patch, i.Overlay, i.Target)
+	case PatchConflict:
+		return fmt.Sprintf("patch %s in overlay %s changes fields of %s that upstream changed too: %s", i.Patch, i.Overlay, i.Target, strings.Join(i.Fields, ", "))
+	default:
+		return fmt.Sprintf("patch %s in overlay %s no longer applies to %s: %s", i.Patch, i.Overlay, i.Target, i.Err)
+	}
+}
+
+// checkPatches checks the patches of every overlay against the updated base, when ship update has left the base
+// it replaced at previous-base. Issues are shown as warnings, and orphaned patches fail the step with --fail-on-orphans.
+// It must run before the base kustomization.yaml is written, since applying a patch replaces it.
+func (l *Kustomizer) checkPatches(step api.Kustomize) error {
+	if l.Viper == nil || l.Viper.GetString("previous-base") == "" {
+		return nil
+	}
+
+	current, err := l.State.TryLoad()
+	if err != nil {
+		return errors.Wrap(err, "load state")
+	}
+	kustomizeState := current.CurrentKustomize()
+	if kustomizeState == nil {
+		return nil
+	}
+
+	issues, err := l.findPatchIssues(step, kustomizeState, l.Viper.GetString("previous-base"))
+	if err != nil {
+		return errors.Wrap(err, "check overlay patches")
+	}
+
+	var orphans []string
+	for _, issue := range issues {
+		if l.UI != nil {
+			l.UI.Warn(issue.String())
+		}
+		if issue.Problem == PatchOrphaned {
+			orphans = append(orphans, issue.Patch)
+		}
+	}
+
+	if len(orphans) > 0 && l.Viper.GetBool("fail-on-orphans") {
+		return errors.Errorf("%d orphaned patches: %s", len(orphans), strings.Join(orphans, ", "))
+	}
+	return nil
+}
+
+// findPatchIssues applies each overlay patch to its target in the base, comparing the target
+// in previousBase to find the fields upstream changed
+func (l *Kustomizer) findPatchIssues(step api.Kustomize, kustomizeState *state.Kustomize, previousBase string) ([]PatchIssue, error) {
+	debug := level.Debug(log.With(l.Logger, "struct", "kustomizer", "method", "findPatchIssues"))
+
+	baseResources, err := l.baseResourcesByName(step)
+	if err != nil {
+		return nil, errors.Wrap(err, "read base resources")
+	}
+
+	previousResources := map[string]string{}
+	if exists, err := l.FS.Exists(previousBase); err != nil {
+		return nil, errors.Wrapf(err, "check for %s", previousBase)
+	} else if exists {
+		previousResources, err = l.resourcesByName(previousBase)
+		if err != nil {
+			return nil, errors.Wrap(err, "read previous base resources")
+		}
+	}
+
+	// resources an overlay adds can be patched by that overlay or the ones layered on it, so they're not orphans
+	overlayResources := map[string]bool{}
+	var overlayNames []string
+	for name, overlay := range kustomizeState.Overlays {
+		overlayNames = append(overlayNames, name)
+		for _, contents := range overlay.Resources {
+			if resource, err := resourceName([]byte(contents)); err == nil {
+				overlayResources[resource] = true
+			}
+		}
+	}
+	sort.Strings(overlayNames)
+
+	var issues []PatchIssue
+	for _, overlayName := range overlayNames {
+		overlay := kustomizeState.Overlays[overlayName]
+		var patchPaths []string
+		for patchPath := range overlay.Patches {
+			patchPaths = append(patchPaths, patchPath)
+		}
+		sort.Strings(patchPaths)
+
+		for _, patchPath := range patchPaths {
+			patch := []byte(overlay.Patches[patchPath])
+			target, err := resourceName(patch)
+			if err != nil {
+				debug.Log("event", "patch.skip", "overlay", overlayName, "patch", patchPath, "err", err)
+				continue
+			}
+			if overlayResources[target] {
+				continue
+			}
+
+			issue := PatchIssue{Overlay: overlayName, Patch: patchPath, Target: target}
+			resource, ok := baseResources[target]
+			if !ok {
+				issue.Problem = PatchOrphaned
+				issues = append(issues, issue)
+				continue
+			}
+
+			debug.Log("event", "patch.check", "overlay", overlayName, "patch", patchPath, "resource", resource)
+			problem, fields, err := l.checkPatch(step, patch, resource, previousResources[target])
+			if err != nil {
+				issue.Problem = PatchFailed
+				issue.Err = err
+				issues = append(issues, issue)
+				continue
+			}
+			if problem != "" {
+				issue.Problem = problem
+				issue.Fields = fields
+				issues = append(issues, issue)
+			}
+		}
+	}
+	return issues, nil
+}
+
+// checkPatch applies patch to the base resource, returning PatchNoop if it changes nothing or PatchConflict
+// and the fields in question if it changes fields that differ between the previous and current base
+func (l *Kustomizer) checkPatch(step api.Kustomize, patch []byte, resource string, previousResource string) (string, []string, error) {
+	patched, err := l.Patcher.ApplyPatch(patch, step, resource)
+	if err != nil {
+		return "", nil, err
+	}
+
+	// a patch of just the header applies no changes, so the target goes through kustomize the same way
+	header, err := patchHeader(patch)
+	if err != nil {
+		return "", nil, err
+	}
+	unpatched, err := l.Patcher.ApplyPatch(header, step, resource)
+	if err != nil {
+		return "", nil, err
+	}
+
+	patchedFields, err := leafFields(patched)
+	if err != nil {
+		return "", nil, errors.Wrap(err, "read patched resource")
+	}
+	unpatchedFields, err := leafFields(unpatched)
+	if err != nil {
+		return "", nil, errors.Wrap(err, "read base resource")
+	}
+	if reflect.DeepEqual(patchedFields, unpatchedFields) {
+		return PatchNoop, nil, nil
+	}
+
+	if previousResource == "" {
+		return "", nil, nil
+	}
+	previous, err := l.FS.ReadFile(previousResource)
+	if err != nil {
+		return "", nil, errors.Wrapf(err, "read %s", previousResource)
+	}
+	previousFields, err := leafFields(previous)
+	if err != nil {
+		return "", nil, errors.Wrap(err, "read previous base resource")
+	}
+	current, err := l.FS.ReadFile(resource)
+	if err != nil {
+		return "", nil, errors.Wrapf(err, "read %s", resource)
+	}
+	currentFields, err := leafFields(current)
+	if err != nil {
+		return "", nil, errors.Wrap(err, "read base resource")
+	}
+	patchFields, err := leafFields(patch)
+	if err != nil {
+		return "", nil, errors.Wrap(err, "read patch")
+	}
+
+	upstreamChanged := changedFields(previousFields, currentFields)
+	var conflicts []string
+	for field := range patchFields {
+		if isHeaderField(field) {
+			continue
+		}
+		for _, changed := range upstreamChanged {
+			if overlaps(field, changed) {
+				conflicts = append(conflicts, field)
+				break
+			}
+		}
+	}
+	if len(conflicts) == 0 {
+		return "", nil, nil
+	}
+	sort.Strings(conflicts)
+	return PatchConflict, conflicts, nil
+}
+
+// patchHeader is the part of a patch that identifies its target
+func patchHeader(patch []byte) ([]byte, error) {
+	var resource struct {
+		APIVersion string `json:"apiVersion"`
+		Kind       string `json:"kind"`
+		Metadata   struct {
+			Name      string `json:"name"`
+			Namespace string `json:"namespace,omitempty"`
+		} `json:"metadata"`
+	}
+	if err := yaml.Unmarshal(patch, &resource); err != nil {
+		return nil, errors.Wrap(err, "unmarshal patch")
+	}
+	return yaml.Marshal(resource)
+}
+
+func isHeaderField(field string) bool {
+	return field == "apiVersion" || field == "kind" || field == "metadata.name" || field == "metadata.namespace"
+}
+
+// overlaps is whether either field is, or contains, the other
+func overlaps(a, b string) bool {
+	if len(a) > len(b) {
+		a, b = b, a
+	}
+	return a == b || strings.HasPrefix(b, a+".") || strings.HasPrefix(b, a+"[")
+}
+
+// leafFields flattens a yaml resource into its leaf values, keyed by their path, like spec.template.spec.containers[nginx].image.
+// List items are keyed by name where they have one, the way strategic merge patches match them.
+func leafFields(contents []byte) (map[string]interface{}, error) {
+	asJSON, err := yaml.YAMLToJSON(contents)
+	if err != nil {
+		return nil, errors.Wrap(err, "convert to json")
+	}
+	var value interface{}
+	if err := json.Unmarshal(asJSON, &value); err != nil {
+		return nil, errors.Wrap(err, "unmarshal")
+	}
+
+	fields := map[string]interface{}{}
+	flatten("", value, fields)
+	return fields, nil
+}
+
+func flatten(prefix string, value interface{}, fields map[string]interface{}) {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		if len(typed) == 0 {
+			fields[prefix] = typed
+		}
+		for key, child := range typed {
+			if prefix == "" {
+				flatten(key, child, fields)
+			} else {
+				flatten(prefix+"."+key, child, fields)
+			}
+		}
+	case []interface{}:
+		if len(typed) == 0 {
+			fields[prefix] = typed
+		}
+		for i, child := range typed {
+			key := fmt.Sprintf("%d", i)
+			if item, ok := child.(map[string]interface{}); ok {
+				if name, ok := item["name"].(string); ok {
+					key = name
+				}
+			}
+			flatten(fmt.Sprintf("%s[%s]", prefix, key), child, fields)
+		}
+	default:
+		fields[prefix] = typed
+	}
+}
+
+// changedFields returns the sorted fields that were added, removed or changed between before and after
+func changedFields(before, after map[string]interface{}) []string {
+	var changed []string
+	for field, value := range before {
+		if other, ok := after[field]; !ok || !reflect.DeepEqual(value, other) {
+			changed = append(changed, field)
+		}
+	}
+	for field := range after {
+		if _, ok := before[field]; !ok {
+			changed = append(changed, field)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
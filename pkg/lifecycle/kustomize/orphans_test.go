@@ -0,0 +1,206 @@
+package kustomize
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/mitchellh/cli"
+	"github.com/replicatedhq/ship/pkg/api"
+	"github.com/replicatedhq/ship/pkg/constants"
+	"github.com/replicatedhq/ship/pkg/patch"
+	"github.com/replicatedhq/ship/pkg/state"
+	state2 "github.com/replicatedhq/ship/pkg/test-mocks/state"
+	"github.com/replicatedhq/ship/pkg/testing/logger"
+	"github.com/spf13/afero"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+)
+
+const previousDeployment = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: nginx
+spec:
+  replicas: 1
+  template:
+    spec:
+      containers:
+      - name: nginx
+        image: nginx:1.14
+`
+
+const updatedDeployment = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: nginx
+spec:
+  replicas: 2
+  template:
+    spec:
+      containers:
+      - name: nginx
+        image: nginx:1.15
+`
+
+const service = `apiVersion: v1
+kind: Service
+metadata:
+  name: nginx
+spec:
+  type: ClusterIP
+`
+
+const configMap = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: legacy
+data:
+  a: b
+`
+
+var overlayPatches = &state.Kustomize{
+	Overlays: map[string]state.Overlay{
+		"ship": {
+			Patches: map[string]string{
+				"/replicas.yaml": `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: nginx
+spec:
+  replicas: 3
+`,
+				"/image.yaml": `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: nginx
+spec:
+  template:
+    spec:
+      containers:
+      - name: nginx
+        image: nginx:1.15
+`,
+				"/service.yaml": `apiVersion: v1
+kind: Service
+metadata:
+  name: nginx
+spec:
+  type: NodePort
+`,
+				"/configmap.yaml": `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: legacy
+data:
+  a: c
+`,
+			},
+		},
+		"prod": {
+			Patches: map[string]string{
+				"/extra.yaml": `apiVersion: v1
+kind: Secret
+metadata:
+  name: extra
+type: Opaque
+`,
+			},
+			Resources: map[string]string{
+				"/extra.yaml": `apiVersion: v1
+kind: Secret
+metadata:
+  name: extra
+`,
+			},
+		},
+	},
+}
+
+// inTempDir runs test from a temp dir, since patches are applied with kustomize against the real filesystem
+func inTempDir(t *testing.T, test func(fs afero.Afero)) {
+	req := require.New(t)
+	dir, err := ioutil.TempDir("", "ship-orphans")
+	req.NoError(err)
+	defer os.RemoveAll(dir)
+
+	wd, err := os.Getwd()
+	req.NoError(err)
+	req.NoError(os.Chdir(dir))
+	defer os.Chdir(wd)
+
+	fs := afero.Afero{Fs: afero.NewOsFs()}
+	files := map[string]string{
+		"base/deployment.yaml":                   updatedDeployment,
+		"base/service.yaml":                      service,
+		constants.PreviousBasePath + "/dep.yaml": previousDeployment,
+		constants.PreviousBasePath + "/cm.yaml":  configMap,
+	}
+	for name, contents := range files {
+		req.NoError(fs.MkdirAll(filepath.Dir(name), 0755))
+		req.NoError(fs.WriteFile(name, []byte(contents), 0644))
+	}
+	test(fs)
+}
+
+func TestFindPatchIssues(t *testing.T) {
+	inTempDir(t, func(fs afero.Afero) {
+		req := require.New(t)
+		l := &Kustomizer{
+			Logger:  &logger.TestLogger{T: t},
+			FS:      fs,
+			Patcher: patch.ShipPatcher{Logger: &logger.TestLogger{T: t}, FS: fs},
+		}
+
+		issues, err := l.findPatchIssues(api.Kustomize{Base: constants.KustomizeBasePath}, overlayPatches, constants.PreviousBasePath)
+		req.NoError(err)
+		req.Equal([]PatchIssue{
+			{Overlay: "ship", Patch: "/configmap.yaml", Target: "ConfigMap/legacy", Problem: PatchOrphaned},
+			{Overlay: "ship", Patch: "/image.yaml", Target: "Deployment/nginx", Problem: PatchNoop},
+			{Overlay: "ship", Patch: "/replicas.yaml", Target: "Deployment/nginx", Problem: PatchConflict, Fields: []string{"spec.replicas"}},
+		}, issues)
+
+		// without the previous base, only orphaned and no-op patches are found
+		issues, err = l.findPatchIssues(api.Kustomize{Base: constants.KustomizeBasePath}, overlayPatches, "missing")
+		req.NoError(err)
+		req.Len(issues, 2)
+	})
+}
+
+func TestCheckPatches(t *testing.T) {
+	inTempDir(t, func(fs afero.Afero) {
+		req := require.New(t)
+		mc := gomock.NewController(t)
+		defer mc.Finish()
+		mockState := state2.NewMockManager(mc)
+		mockState.EXPECT().TryLoad().Return(state.VersionedState{V2: &state.V2{Kustomize: overlayPatches}}, nil).AnyTimes()
+
+		ui := cli.NewMockUi()
+		v := viper.New()
+		l := &Kustomizer{
+			Logger:  &logger.TestLogger{T: t},
+			UI:      ui,
+			FS:      fs,
+			State:   mockState,
+			Patcher: patch.ShipPatcher{Logger: &logger.TestLogger{T: t}, FS: fs},
+			Viper:   v,
+		}
+		step := api.Kustomize{Base: constants.KustomizeBasePath}
+
+		// only checked during ship update
+		req.NoError(l.checkPatches(step))
+		req.Empty(ui.ErrorWriter.String())
+
+		v.Set("previous-base", constants.PreviousBasePath)
+		req.NoError(l.checkPatches(step))
+		req.Contains(ui.ErrorWriter.String(), "patch /configmap.yaml in overlay ship targets ConfigMap/legacy, which is no longer in the base")
+		req.Contains(ui.ErrorWriter.String(), "patch /replicas.yaml in overlay ship changes fields of Deployment/nginx that upstream changed too: spec.replicas")
+
+		v.Set("fail-on-orphans", true)
+		err := l.checkPatches(step)
+		req.Error(err)
+		req.Contains(err.Error(), "1 orphaned patches: /configmap.yaml")
+	})
+}
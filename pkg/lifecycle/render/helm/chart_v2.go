@@ -0,0 +1,241 @@
+package helm
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/ship/pkg/constants"
+	"github.com/replicatedhq/ship/pkg/lifecycle/render/root"
+	"github.com/spf13/afero"
+	"k8s.io/helm/pkg/chartutil"
+)
+
+const libraryChartType = "library"
+
+// chartfileV2 is the part of a Chart.yaml ship reads itself, including the Helm 3 fields Helm 2 templating doesn't understand
+type chartfileV2 struct {
+	Name         string                  `json:"name"`
+	Version      string                  `json:"version"`
+	Type         string                  `json:"type"`
+	Dependencies []*chartutil.Dependency `json:"dependencies"`
+}
+
+// prepareV2Chart lets the Helm 2 templating render a Helm 3 chart, and returns the chart root to render it from.
+// Dependencies listed in Chart.yaml are written to the requirements.yaml of a copy of the chart, where helm dependency
+// update and the requirements conditions, tags and import-values look for them, so the chart itself is left as it was.
+// Library charts only provide templates to other charts, so can't be rendered.
+func (f *LocalTemplater) prepareV2Chart(chartRoot string) (string, error) {
+	debug := level.Debug(log.With(f.Logger, "method", "prepareV2Chart", "chartRoot", chartRoot))
+
+	chartfile, err := f.readChartfileV2(path.Join(chartRoot, "Chart.yaml"))
+	if err != nil {
+		return "", err
+	}
+	if chartfile.Type == libraryChartType {
+		return "", errors.Errorf("%s is a library chart, which can only be used as a dependency of another chart", chartfile.Name)
+	}
+	if len(chartfile.Dependencies) == 0 {
+		return chartRoot, nil
+	}
+
+	requirementsPath := path.Join(chartRoot, "requirements.yaml")
+	if exists, err := f.FS.Exists(requirementsPath); err != nil || exists {
+		debug.Log("event", "requirements.exists", "path", requirementsPath)
+		return chartRoot, errors.Wrapf(err, "check for %s", requirementsPath)
+	}
+
+	preparedRoot := path.Join(constants.ShipPathInternalTmp, "chartv2", path.Base(chartRoot))
+	debug.Log("event", "chart.copy", "path", preparedRoot)
+	if err := f.FS.RemoveAll(preparedRoot); err != nil {
+		return "", errors.Wrapf(err, "remove %s", preparedRoot)
+	}
+	if err := copyChartDir(f.FS, chartRoot, preparedRoot); err != nil {
+		return "", errors.Wrapf(err, "copy %s to %s", chartRoot, preparedRoot)
+	}
+
+	dependencies := make([]*chartutil.Dependency, 0, len(chartfile.Dependencies))
+	for _, dependency := range chartfile.Dependencies {
+		// file:// dependencies are relative to the chart, so point the copy's at the same place
+		if strings.HasPrefix(dependency.Repository, "file://") {
+			sourcePath := localDependencyPath(chartRoot, dependency)
+			if !filepath.IsAbs(sourcePath) {
+				sourcePath, err = filepath.Rel(preparedRoot, sourcePath)
+				if err != nil {
+					return "", errors.Wrapf(err, "find %s from %s", sourcePath, preparedRoot)
+				}
+			}
+			moved := *dependency
+			moved.Repository = "file://" + filepath.ToSlash(sourcePath)
+			dependency = &moved
+		}
+		dependencies = append(dependencies, dependency)
+	}
+
+	requirements, err := yaml.Marshal(chartutil.Requirements{Dependencies: dependencies})
+	if err != nil {
+		return "", errors.Wrap(err, "marshal requirements")
+	}
+	preparedRequirementsPath := path.Join(preparedRoot, "requirements.yaml")
+	debug.Log("event", "requirements.write", "path", preparedRequirementsPath, "dependencies", len(dependencies))
+	if err := f.FS.WriteFile(preparedRequirementsPath, requirements, 0644); err != nil {
+		return "", errors.Wrapf(err, "write %s", preparedRequirementsPath)
+	}
+	return preparedRoot, nil
+}
+
+// writeCRDs writes the custom resource definitions in a Helm 3 chart's crds/ directory to crds/ in dest.
+// Helm 3 installs them as they are before anything else in the chart, and Helm 2 templating doesn't render them.
+func (f *LocalTemplater) writeCRDs(rootFs root.Fs, chartRoot string, dest string) error {
+	debug := level.Debug(log.With(f.Logger, "method", "writeCRDs", "chartRoot", chartRoot))
+
+	crdsDir := path.Join(chartRoot, "crds")
+	if exists, err := f.FS.DirExists(crdsDir); err != nil || !exists {
+		return errors.Wrapf(err, "check for %s", crdsDir)
+	}
+
+	return f.FS.Walk(crdsDir, func(crdPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		switch path.Ext(crdPath) {
+		case ".yaml", ".yml", ".json":
+		default:
+			return nil
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(crdsDir, crdPath)
+		if err != nil {
+			return errors.Wrapf(err, "find %s in %s", crdPath, crdsDir)
+		}
+		target := path.Join(dest, "crds", filepath.ToSlash(rel))
+		contents, err := f.FS.ReadFile(crdPath)
+		if err != nil {
+			return errors.Wrapf(err, "read %s", crdPath)
+		}
+		if err := rootFs.MkdirAll(path.Dir(target), 0755); err != nil {
+			return errors.Wrapf(err, "mkdir %s", path.Dir(target))
+		}
+		debug.Log("event", "crd.write", "path", target)
+		return errors.Wrapf(rootFs.WriteFile(target, contents, 0644), "write %s", target)
+	})
+}
+
+// librarySubcharts are the names the library charts in chartRoot/charts are rendered under,
+// including any aliases they're given in Chart.yaml. It's called once the dependencies are in charts/.
+func (f *LocalTemplater) librarySubcharts(chartRoot string) ([]string, error) {
+	subcharts, err := vendoredSubcharts(f.FS, chartRoot)
+	if err != nil {
+		return nil, err
+	}
+	if len(subcharts) == 0 {
+		return nil, nil
+	}
+
+	libraries := map[string]bool{}
+	for _, subchart := range subcharts {
+		if subchart.Chartfile.Type == libraryChartType {
+			libraries[subchart.Chartfile.Name] = true
+		}
+	}
+
+	dependencies, err := chartDependencies(f.FS, chartRoot)
+	if err != nil {
+		return nil, err
+	}
+	for _, dependency := range dependencies {
+		// helm dependency update packages file:// dependencies itself, dropping the chart type, so check their source
+		if strings.HasPrefix(dependency.Repository, "file://") {
+			source, err := f.readChartfileV2(path.Join(localDependencyPath(chartRoot, dependency), "Chart.yaml"))
+			if err != nil {
+				return nil, err
+			}
+			if source.Type == libraryChartType {
+				libraries[source.Name] = true
+			}
+		}
+		if libraries[dependency.Name] && dependency.Alias != "" {
+			libraries[dependency.Alias] = true
+		}
+	}
+
+	var names []string
+	for name := range libraries {
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// removeLibrarySubcharts removes anything rendered from library charts' templates, which Helm 3 doesn't render
+func (f *LocalTemplater) removeLibrarySubcharts(tempRenderedChartDir string, libraries []string) error {
+	for _, library := range libraries {
+		rendered := path.Join(tempRenderedChartDir, "charts", library)
+		level.Debug(f.Logger).Log("event", "librarySubchart.remove", "path", rendered)
+		if err := f.FS.RemoveAll(rendered); err != nil {
+			return errors.Wrapf(err, "remove %s", rendered)
+		}
+	}
+	return nil
+}
+
+func (f *LocalTemplater) readChartfileV2(chartfilePath string) (*chartfileV2, error) {
+	contents, err := f.FS.ReadFile(chartfilePath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "read %s", chartfilePath)
+	}
+	return unmarshalChartfileV2(contents, chartfilePath)
+}
+
+// readArchivedChartFile reads a file at the top level of a packaged chart, which is nil if the chart doesn't have it
+func readArchivedChartFile(fs afero.Afero, archivePath string, name string) ([]byte, error) {
+	archive, err := fs.Open(archivePath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "open %s", archivePath)
+	}
+	defer archive.Close()
+
+	gzipReader, err := gzip.NewReader(archive)
+	if err != nil {
+		return nil, errors.Wrapf(err, "decompress %s", archivePath)
+	}
+	tarReader := tar.NewReader(gzipReader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "read %s", archivePath)
+		}
+
+		parts := strings.Split(filepath.ToSlash(header.Name), "/")
+		if len(parts) != 2 || parts[1] != name {
+			continue
+		}
+		contents, err := ioutil.ReadAll(tarReader)
+		if err != nil {
+			return nil, errors.Wrapf(err, "read %s in %s", header.Name, archivePath)
+		}
+		return contents, nil
+	}
+}
+
+func unmarshalChartfileV2(contents []byte, source string) (*chartfileV2, error) {
+	var chartfile chartfileV2
+	if err := yaml.Unmarshal(contents, &chartfile); err != nil {
+		return nil, errors.Wrapf(err, "unmarshal Chart.yaml from %s", source)
+	}
+	return &chartfile, nil
+}
@@ -0,0 +1,259 @@
+package helm
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"path"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/replicatedhq/libyaml"
+	"github.com/replicatedhq/ship/pkg/api"
+	"github.com/replicatedhq/ship/pkg/constants"
+	"github.com/replicatedhq/ship/pkg/lifecycle/render/root"
+	"github.com/replicatedhq/ship/pkg/process"
+	state2 "github.com/replicatedhq/ship/pkg/state"
+	"github.com/replicatedhq/ship/pkg/templates"
+	"github.com/replicatedhq/ship/pkg/test-mocks/helm"
+	"github.com/replicatedhq/ship/pkg/test-mocks/state"
+	"github.com/replicatedhq/ship/pkg/testing/logger"
+	"github.com/spf13/afero"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+)
+
+const chartfileV2WithDependencies = `apiVersion: v2
+name: web
+version: 0.2.0
+dependencies:
+- name: common
+  version: 0.1.0
+  repository: file://libs/common
+- name: helpers
+  version: 1.0.0
+  repository: https://charts.example.com
+  alias: shared
+- name: redis
+  version: 3.0.0
+  repository: https://charts.example.com
+  condition: redis.enabled
+`
+
+func TestLocalTemplaterV2Chart(t *testing.T) {
+	req := require.New(t)
+	mc := gomock.NewController(t)
+	defer mc.Finish()
+
+	testLogger := &logger.TestLogger{T: t}
+	mockState := state.NewMockManager(mc)
+	mockCommands := helm.NewMockCommands(mc)
+	mockFs := afero.Afero{Fs: afero.NewMemMapFs()}
+	tpl := &LocalTemplater{
+		Commands:       mockCommands,
+		Logger:         testLogger,
+		FS:             mockFs,
+		BuilderBuilder: templates.NewBuilderBuilder(testLogger, viper.New()),
+		Viper:          viper.New(),
+		StateManager:   mockState,
+		process:        process.Process{Logger: testLogger},
+	}
+
+	chartRoot := constants.HelmChartPath
+	req.NoError(mockFs.WriteFile(path.Join(chartRoot, "Chart.yaml"), []byte(chartfileV2WithDependencies), 0644))
+	req.NoError(mockFs.WriteFile(path.Join(chartRoot, "libs", "common", "Chart.yaml"), []byte("apiVersion: v2\nname: common\nversion: 0.1.0\ntype: library\n"), 0644))
+
+	mockState.EXPECT().TryLoad().Return(state2.VersionedState{V2: &state2.V2{ReleaseName: "web"}}, nil)
+
+	// the requirements.yaml is written to a copy of the chart, with file:// dependencies still pointing at their source
+	preparedRoot := path.Join(constants.ShipPathInternalTmp, "chartv2", "chart")
+	renderDest := path.Join(constants.ShipPathInternalTmp, "chartrendered")
+	mockCommands.EXPECT().Init().Return(nil)
+	mockCommands.EXPECT().DependencyUpdate(preparedRoot).DoAndReturn(func(chartRoot string) error {
+		requirements, err := mockFs.ReadFile(path.Join(chartRoot, "requirements.yaml"))
+		req.NoError(err)
+		req.Equal(`dependencies:
+- name: common
+  repository: file://../../chart/libs/common
+  version: 0.1.0
+- alias: shared
+  name: helpers
+  repository: https://charts.example.com
+  version: 1.0.0
+- condition: redis.enabled
+  name: redis
+  repository: https://charts.example.com
+  version: 3.0.0
+`, string(requirements))
+
+		// helm packages file:// dependencies without their type, and downloads the others as they were published
+		req.NoError(mockFs.WriteFile(path.Join(chartRoot, "charts", "common-0.1.0.tgz"),
+			chartArchive(req, "common", "apiVersion: v2\nname: common\nversion: 0.1.0\n"), 0644))
+		req.NoError(mockFs.WriteFile(path.Join(chartRoot, "charts", "helpers-1.0.0.tgz"),
+			chartArchive(req, "helpers", "apiVersion: v2\nname: helpers\nversion: 1.0.0\ntype: library\n"), 0644))
+		return mockFs.WriteFile(path.Join(chartRoot, "charts", "redis-3.0.0.tgz"),
+			chartArchive(req, "redis", "apiVersion: v1\nname: redis\nversion: 3.0.0\n"), 0644)
+	})
+	mockCommands.EXPECT().Template(preparedRoot, []string{
+		"--output-dir", renderDest,
+		"--name", "web",
+		"--namespace", "default",
+	}).DoAndReturn(func(chartRoot string, args []string) error {
+		for _, rendered := range []string{
+			"web/templates/deployment.yaml",
+			"web/charts/common/templates/configmap.yaml",
+			"web/charts/shared/templates/configmap.yaml",
+			"web/charts/redis/templates/service.yaml",
+		} {
+			req.NoError(mockFs.WriteFile(path.Join(renderDest, rendered), []byte("kind: Test\n"), 0644))
+		}
+		return nil
+	})
+
+	err := tpl.Template(
+		chartRoot,
+		root.Fs{Afero: mockFs},
+		api.HelmAsset{AssetShared: api.AssetShared{Dest: constants.KustomizeBasePath}},
+		api.ReleaseMetadata{},
+		[]libyaml.ConfigGroup{},
+		map[string]interface{}{},
+	)
+	req.NoError(err)
+
+	exists, err := mockFs.Exists(path.Join(constants.KustomizeBasePath, "deployment.yaml"))
+	req.NoError(err)
+	req.True(exists)
+	exists, err = mockFs.Exists(path.Join(chartRoot, "requirements.yaml"))
+	req.NoError(err)
+	req.False(exists)
+
+	// the memory filesystem doesn't move a directory's contents with it, so subcharts are checked where they were rendered
+	renderedCharts := path.Join(renderDest, "web", "charts")
+	exists, err = mockFs.Exists(path.Join(renderedCharts, "redis", "templates", "service.yaml"))
+	req.NoError(err)
+	req.True(exists)
+	for _, library := range []string{"common", "shared"} {
+		exists, err := mockFs.Exists(path.Join(renderedCharts, library, "templates", "configmap.yaml"))
+		req.NoError(err)
+		req.False(exists, library)
+	}
+}
+
+func TestLocalTemplaterV2LibraryChart(t *testing.T) {
+	req := require.New(t)
+	mc := gomock.NewController(t)
+	defer mc.Finish()
+
+	testLogger := &logger.TestLogger{T: t}
+	mockState := state.NewMockManager(mc)
+	mockCommands := helm.NewMockCommands(mc)
+	mockFs := afero.Afero{Fs: afero.NewMemMapFs()}
+	tpl := &LocalTemplater{
+		Commands:     mockCommands,
+		Logger:       testLogger,
+		FS:           mockFs,
+		Viper:        viper.New(),
+		StateManager: mockState,
+	}
+
+	chartRoot := constants.HelmChartPath
+	req.NoError(mockFs.WriteFile(path.Join(chartRoot, "Chart.yaml"), []byte("apiVersion: v2\nname: common\nversion: 0.1.0\ntype: library\n"), 0644))
+
+	mockState.EXPECT().TryLoad().Return(state2.VersionedState{V2: &state2.V2{}}, nil)
+
+	err := tpl.Template(
+		chartRoot,
+		root.Fs{Afero: mockFs},
+		api.HelmAsset{AssetShared: api.AssetShared{Dest: constants.KustomizeBasePath}},
+		api.ReleaseMetadata{},
+		[]libyaml.ConfigGroup{},
+		map[string]interface{}{},
+	)
+	req.Error(err)
+	req.Contains(err.Error(), "common is a library chart, which can only be used as a dependency of another chart")
+}
+
+func TestLocalTemplaterV2ChartCRDs(t *testing.T) {
+	req := require.New(t)
+	mc := gomock.NewController(t)
+	defer mc.Finish()
+
+	testLogger := &logger.TestLogger{T: t}
+	mockState := state.NewMockManager(mc)
+	mockCommands := helm.NewMockCommands(mc)
+	mockFs := afero.Afero{Fs: afero.NewMemMapFs()}
+	tpl := &LocalTemplater{
+		Commands:       mockCommands,
+		Logger:         testLogger,
+		FS:             mockFs,
+		BuilderBuilder: templates.NewBuilderBuilder(testLogger, viper.New()),
+		Viper:          viper.New(),
+		StateManager:   mockState,
+		process:        process.Process{Logger: testLogger},
+	}
+
+	chartRoot := constants.HelmChartPath
+	req.NoError(mockFs.WriteFile(path.Join(chartRoot, "Chart.yaml"), []byte("apiVersion: v2\nname: operator\nversion: 0.1.0\n"), 0644))
+	req.NoError(mockFs.WriteFile(path.Join(chartRoot, "crds", "widgets.yaml"), []byte("kind: CustomResourceDefinition\n"), 0644))
+	req.NoError(mockFs.WriteFile(path.Join(chartRoot, "crds", "gadgets", "gadgets.json"), []byte(`{"kind": "CustomResourceDefinition"}`), 0644))
+	req.NoError(mockFs.WriteFile(path.Join(chartRoot, "crds", "README.md"), []byte("# CRDs\n"), 0644))
+
+	mockState.EXPECT().TryLoad().Return(state2.VersionedState{V2: &state2.V2{ReleaseName: "operator"}}, nil)
+
+	renderDest := path.Join(constants.ShipPathInternalTmp, "chartrendered")
+	mockCommands.EXPECT().Template(chartRoot, []string{
+		"--output-dir", renderDest,
+		"--name", "operator",
+		"--namespace", "default",
+	}).DoAndReturn(func(chartRoot string, args []string) error {
+		return mockFs.WriteFile(path.Join(renderDest, "operator/templates/deployment.yaml"), []byte("kind: Deployment\n"), 0644)
+	})
+
+	err := tpl.Template(
+		chartRoot,
+		root.Fs{Afero: mockFs},
+		api.HelmAsset{
+			AssetShared: api.AssetShared{Dest: constants.KustomizeBasePath},
+			Local:       &api.LocalHelmOpts{ChartRoot: chartRoot, ChartAPIVersion: "v2"},
+		},
+		api.ReleaseMetadata{},
+		[]libyaml.ConfigGroup{},
+		map[string]interface{}{},
+	)
+	req.NoError(err)
+
+	for crd, contents := range map[string]string{
+		"widgets.yaml":         "kind: CustomResourceDefinition\n",
+		"gadgets/gadgets.json": `{"kind": "CustomResourceDefinition"}`,
+	} {
+		written, err := mockFs.ReadFile(path.Join(constants.KustomizeBasePath, "crds", crd))
+		req.NoError(err)
+		req.Equal(contents, string(written))
+	}
+	exists, err := mockFs.Exists(path.Join(constants.KustomizeBasePath, "crds", "README.md"))
+	req.NoError(err)
+	req.False(exists)
+	exists, err = mockFs.Exists(path.Join(constants.KustomizeBasePath, "deployment.yaml"))
+	req.NoError(err)
+	req.True(exists)
+}
+
+// chartArchive packages a chart with just a Chart.yaml, the way helm dependency update saves it to charts/
+func chartArchive(req *require.Assertions, name string, chartfile string) []byte {
+	return packagedChart(req, name, map[string]string{"Chart.yaml": chartfile})
+}
+
+// packagedChart packages a chart with the files given, by path relative to the chart
+func packagedChart(req *require.Assertions, name string, files map[string]string) []byte {
+	var archive bytes.Buffer
+	gzipWriter := gzip.NewWriter(&archive)
+	tarWriter := tar.NewWriter(gzipWriter)
+	for filename, contents := range files {
+		req.NoError(tarWriter.WriteHeader(&tar.Header{Name: name + "/" + filename, Mode: 0644, Size: int64(len(contents))}))
+		_, err := tarWriter.Write([]byte(contents))
+		req.NoError(err)
+	}
+	req.NoError(tarWriter.Close())
+	req.NoError(gzipWriter.Close())
+	return archive.Bytes()
+}
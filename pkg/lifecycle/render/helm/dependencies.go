@@ -0,0 +1,220 @@
+package helm
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/Masterminds/semver"
+	"github.com/ghodss/yaml"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/spf13/afero"
+	"k8s.io/helm/pkg/chartutil"
+)
+
+// vendoredChart is a subchart in a chart's charts/ directory, either unpacked or packaged
+type vendoredChart struct {
+	Path      string
+	Archived  bool
+	Chartfile *chartfileV2
+}
+
+// vendoredSubcharts reads the Chart.yaml of each subchart in chartRoot/charts, in the order helm loads them
+func vendoredSubcharts(fs afero.Afero, chartRoot string) ([]vendoredChart, error) {
+	chartsDir := path.Join(chartRoot, "charts")
+	if exists, err := fs.DirExists(chartsDir); err != nil || !exists {
+		return nil, errors.Wrapf(err, "check for %s", chartsDir)
+	}
+	entries, err := fs.ReadDir(chartsDir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "read %s", chartsDir)
+	}
+
+	var subcharts []vendoredChart
+	for _, entry := range entries {
+		subchart := vendoredChart{Path: path.Join(chartsDir, entry.Name())}
+		switch {
+		case entry.IsDir():
+			chartfilePath := path.Join(subchart.Path, "Chart.yaml")
+			if exists, err := fs.Exists(chartfilePath); err != nil || !exists {
+				continue
+			}
+			contents, err := fs.ReadFile(chartfilePath)
+			if err != nil {
+				return nil, errors.Wrapf(err, "read %s", chartfilePath)
+			}
+			subchart.Chartfile, err = unmarshalChartfileV2(contents, chartfilePath)
+			if err != nil {
+				return nil, err
+			}
+		case strings.HasSuffix(entry.Name(), ".tgz"):
+			contents, err := readArchivedChartFile(fs, subchart.Path, "Chart.yaml")
+			if err != nil {
+				return nil, err
+			}
+			if contents == nil {
+				return nil, errors.Errorf("no Chart.yaml in %s", subchart.Path)
+			}
+			subchart.Archived = true
+			subchart.Chartfile, err = unmarshalChartfileV2(contents, subchart.Path)
+			if err != nil {
+				return nil, err
+			}
+		default:
+			continue
+		}
+		subcharts = append(subcharts, subchart)
+	}
+	return subcharts, nil
+}
+
+// chartDependencies are the dependencies in chartRoot's requirements.yaml or, for a Helm 3 chart without one, its Chart.yaml
+func chartDependencies(fs afero.Afero, chartRoot string) ([]*chartutil.Dependency, error) {
+	requirementsPath := path.Join(chartRoot, "requirements.yaml")
+	if exists, err := fs.Exists(requirementsPath); err != nil {
+		return nil, errors.Wrapf(err, "check for %s", requirementsPath)
+	} else if exists {
+		contents, err := fs.ReadFile(requirementsPath)
+		if err != nil {
+			return nil, errors.Wrapf(err, "read %s", requirementsPath)
+		}
+		var requirements chartutil.Requirements
+		if err := yaml.Unmarshal(contents, &requirements); err != nil {
+			return nil, errors.Wrapf(err, "unmarshal %s", requirementsPath)
+		}
+		return requirements.Dependencies, nil
+	}
+
+	chartfilePath := path.Join(chartRoot, "Chart.yaml")
+	if exists, err := fs.Exists(chartfilePath); err != nil || !exists {
+		return nil, errors.Wrapf(err, "check for %s", chartfilePath)
+	}
+	contents, err := fs.ReadFile(chartfilePath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "read %s", chartfilePath)
+	}
+	chartfile, err := unmarshalChartfileV2(contents, chartfilePath)
+	if err != nil {
+		return nil, err
+	}
+	return chartfile.Dependencies, nil
+}
+
+// missingDependencies are the dependencies of the chart at chartRoot that aren't vendored in its charts/ directory at
+// an acceptable version, so have to be fetched with helm dependency update. If nothing else is missing, file://
+// dependencies that aren't vendored are copied into charts/ from their source, which doesn't need the network.
+func (f *LocalTemplater) missingDependencies(chartRoot string) ([]string, error) {
+	debug := level.Debug(log.With(f.Logger, "method", "missingDependencies", "chartRoot", chartRoot))
+
+	dependencies, err := chartDependencies(f.FS, chartRoot)
+	if err != nil {
+		return nil, err
+	}
+	if len(dependencies) == 0 {
+		return nil, nil
+	}
+	vendored, err := vendoredSubcharts(f.FS, chartRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	var missing []string
+	var local []*chartutil.Dependency
+	for _, dependency := range dependencies {
+		if subchart, ok := vendoredDependency(dependency, vendored); ok {
+			debug.Log("event", "dependency.vendored", "name", dependency.Name, "path", subchart.Path)
+			continue
+		}
+
+		if strings.HasPrefix(dependency.Repository, "file://") {
+			sourcePath := localDependencyPath(chartRoot, dependency)
+			if exists, err := f.FS.Exists(path.Join(sourcePath, "Chart.yaml")); err != nil {
+				return nil, errors.Wrapf(err, "check for chart in %s", sourcePath)
+			} else if exists {
+				local = append(local, dependency)
+				continue
+			}
+		}
+
+		debug.Log("event", "dependency.missing", "name", dependency.Name, "version", dependency.Version, "repository", dependency.Repository)
+		missing = append(missing, fmt.Sprintf("%s %s", dependency.Name, dependency.Version))
+	}
+	if len(missing) > 0 {
+		// helm dependency update packages file:// dependencies along with the rest
+		sort.Strings(missing)
+		return missing, nil
+	}
+
+	for _, dependency := range local {
+		sourcePath := localDependencyPath(chartRoot, dependency)
+		dest := path.Join(chartRoot, "charts", dependency.Name)
+		debug.Log("event", "dependency.copy", "name", dependency.Name, "from", sourcePath, "to", dest)
+		if err := copyChartDir(f.FS, sourcePath, dest); err != nil {
+			return nil, errors.Wrapf(err, "copy %s to %s", sourcePath, dest)
+		}
+	}
+	return nil, nil
+}
+
+// vendoredDependency finds the subchart that satisfies a dependency, the way helm dependency list checks them
+func vendoredDependency(dependency *chartutil.Dependency, vendored []vendoredChart) (vendoredChart, bool) {
+	for _, subchart := range vendored {
+		if subchart.Chartfile.Name != dependency.Name {
+			continue
+		}
+		if dependency.Version == "" || subchart.Chartfile.Version == dependency.Version {
+			return subchart, true
+		}
+		constraint, err := semver.NewConstraint(dependency.Version)
+		if err != nil {
+			continue
+		}
+		version, err := semver.NewVersion(subchart.Chartfile.Version)
+		if err != nil {
+			continue
+		}
+		if constraint.Check(version) {
+			return subchart, true
+		}
+	}
+	return vendoredChart{}, false
+}
+
+// localDependencyPath is the source of a file:// dependency, which is relative to the chart if it isn't absolute
+func localDependencyPath(chartRoot string, dependency *chartutil.Dependency) string {
+	sourcePath := strings.TrimPrefix(dependency.Repository, "file://")
+	if !filepath.IsAbs(sourcePath) {
+		sourcePath = path.Join(chartRoot, sourcePath)
+	}
+	return sourcePath
+}
+
+func copyChartDir(fs afero.Afero, src, dest string) error {
+	return fs.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dest, rel)
+
+		if info.IsDir() {
+			return fs.MkdirAll(target, 0755)
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		contents, err := fs.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return fs.WriteFile(target, contents, info.Mode().Perm())
+	})
+}
@@ -0,0 +1,145 @@
+package helm
+
+import (
+	"path"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/replicatedhq/libyaml"
+	"github.com/replicatedhq/ship/pkg/api"
+	"github.com/replicatedhq/ship/pkg/constants"
+	"github.com/replicatedhq/ship/pkg/lifecycle/render/root"
+	state2 "github.com/replicatedhq/ship/pkg/state"
+	"github.com/replicatedhq/ship/pkg/test-mocks/helm"
+	"github.com/replicatedhq/ship/pkg/test-mocks/state"
+	"github.com/replicatedhq/ship/pkg/testing/logger"
+	"github.com/spf13/afero"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+)
+
+const requirementsWithVendoredDependencies = `dependencies:
+- name: redis
+  version: ~3.0.0
+  repository: https://charts.example.com
+- name: metrics
+  version: 1.x
+  repository: https://charts.example.com
+- name: common
+  version: 0.1.0
+  repository: file://../common
+`
+
+func TestLocalTemplaterVendoredDependencies(t *testing.T) {
+	tests := []struct {
+		name    string
+		vendor  map[string][]byte
+		offline bool
+		// fetch is true if helm dependency update should be run
+		fetch       bool
+		expectError string
+	}{
+		{
+			name: "all vendored",
+			vendor: map[string][]byte{
+				"redis-3.0.2.tgz":       packagedChart(require.New(t), "redis", map[string]string{"Chart.yaml": "name: redis\nversion: 3.0.2\n"}),
+				"metrics/Chart.yaml":    []byte("name: metrics\nversion: 1.4.0\n"),
+				"metrics/values.yaml":   []byte("port: 9090\n"),
+				"common-0.1.0.tgz":      packagedChart(require.New(t), "common", map[string]string{"Chart.yaml": "name: common\nversion: 0.1.0\n"}),
+				"not-a-chart/README.md": []byte("nothing to see here\n"),
+			},
+			offline: true,
+		},
+		{
+			name: "file dependency copied from source",
+			vendor: map[string][]byte{
+				"redis-3.0.2.tgz":    packagedChart(require.New(t), "redis", map[string]string{"Chart.yaml": "name: redis\nversion: 3.0.2\n"}),
+				"metrics/Chart.yaml": []byte("name: metrics\nversion: 1.4.0\n"),
+			},
+			offline: true,
+		},
+		{
+			name: "wrong version fetched",
+			vendor: map[string][]byte{
+				"redis-3.1.0.tgz":    packagedChart(require.New(t), "redis", map[string]string{"Chart.yaml": "name: redis\nversion: 3.1.0\n"}),
+				"metrics/Chart.yaml": []byte("name: metrics\nversion: 1.4.0\n"),
+			},
+			fetch: true,
+		},
+		{
+			name: "missing offline",
+			vendor: map[string][]byte{
+				"metrics/Chart.yaml": []byte("name: metrics\nversion: 2.0.0\n"),
+			},
+			offline:     true,
+			expectError: "dependencies metrics 1.x, redis ~3.0.0 are not vendored in the chart's charts/ directory, run without --offline to fetch them",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := require.New(t)
+			mc := gomock.NewController(t)
+			defer mc.Finish()
+
+			testLogger := &logger.TestLogger{T: t}
+			mockState := state.NewMockManager(mc)
+			mockCommands := helm.NewMockCommands(mc)
+			mockFs := afero.Afero{Fs: afero.NewMemMapFs()}
+			v := viper.New()
+			v.Set("offline", test.offline)
+			tpl := &LocalTemplater{
+				Commands:     mockCommands,
+				Logger:       testLogger,
+				FS:           mockFs,
+				Viper:        v,
+				StateManager: mockState,
+			}
+
+			chartRoot := constants.HelmChartPath
+			req.NoError(mockFs.WriteFile(path.Join(chartRoot, "Chart.yaml"), []byte("name: web\nversion: 0.2.0\n"), 0644))
+			req.NoError(mockFs.WriteFile(path.Join(chartRoot, "requirements.yaml"), []byte(requirementsWithVendoredDependencies), 0644))
+			req.NoError(mockFs.WriteFile(path.Join(constants.ShipPathInternalTmp, "common", "Chart.yaml"), []byte("name: common\nversion: 0.1.0\n"), 0644))
+			req.NoError(mockFs.WriteFile(path.Join(constants.ShipPathInternalTmp, "common", "templates", "_helpers.tpl"), []byte("{{- define \"common.name\" -}}web{{- end -}}\n"), 0644))
+			for filename, contents := range test.vendor {
+				req.NoError(mockFs.WriteFile(path.Join(chartRoot, "charts", filename), contents, 0644))
+			}
+
+			mockState.EXPECT().TryLoad().Return(state2.VersionedState{V2: &state2.V2{ReleaseName: "web"}}, nil)
+			if test.fetch {
+				mockCommands.EXPECT().Init().Return(nil)
+				mockCommands.EXPECT().DependencyUpdate(chartRoot).Return(nil)
+			}
+			renderDest := path.Join(constants.ShipPathInternalTmp, "chartrendered")
+			if test.expectError == "" {
+				mockCommands.EXPECT().Template(chartRoot, []string{
+					"--output-dir", renderDest,
+					"--name", "web",
+					"--namespace", "default",
+				}).DoAndReturn(func(chartRoot string, args []string) error {
+					return mockFs.WriteFile(path.Join(renderDest, "web", "templates", "deployment.yaml"), []byte("kind: Deployment\n"), 0644)
+				})
+			}
+
+			err := tpl.Template(
+				chartRoot,
+				root.Fs{Afero: mockFs},
+				api.HelmAsset{AssetShared: api.AssetShared{Dest: constants.KustomizeBasePath}},
+				api.ReleaseMetadata{},
+				[]libyaml.ConfigGroup{},
+				map[string]interface{}{},
+			)
+			if test.expectError != "" {
+				req.Error(err)
+				req.Equal(test.expectError, err.Error())
+				return
+			}
+			req.NoError(err)
+
+			// file:// dependencies are only copied when helm dependency update won't package them
+			_, vendoredCommon := test.vendor["common-0.1.0.tgz"]
+			exists, err := mockFs.Exists(path.Join(chartRoot, "charts", "common", "templates", "_helpers.tpl"))
+			req.NoError(err)
+			req.Equal(!test.fetch && !vendoredCommon, exists)
+		})
+	}
+}
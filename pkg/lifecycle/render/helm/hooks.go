@@ -0,0 +1,194 @@
+package helm
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/ship/pkg/api"
+	"github.com/replicatedhq/ship/pkg/constants"
+	"github.com/replicatedhq/ship/pkg/lifecycle/render/root"
+	yaml "gopkg.in/yaml.v2"
+)
+
+const (
+	hookAnnotation       = "helm.sh/hook"
+	hookWeightAnnotation = "helm.sh/hook-weight"
+)
+
+var documentSeparator = regexp.MustCompile(`(?m)^---\s*$`)
+
+// hook is a rendered resource annotated with helm.sh/hook
+type hook struct {
+	Kind     string
+	Name     string
+	Events   []string
+	Weight   int
+	Contents string
+}
+
+// hookResource is the part of a rendered resource needed to tell if it's a hook
+type hookResource struct {
+	Kind     string `yaml:"kind"`
+	Metadata struct {
+		Name        string            `yaml:"name"`
+		Annotations map[string]string `yaml:"annotations"`
+	} `yaml:"metadata"`
+}
+
+// hooksDest is where an asset's hooks are written, see api.HelmAsset.HooksDest
+func hooksDest(asset api.HelmAsset) string {
+	if asset.HooksDest != "" {
+		return asset.HooksDest
+	}
+	rel, err := filepath.Rel(constants.KustomizeBasePath, asset.Dest)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		rel = asset.Dest
+	}
+	return path.Join(constants.HelmHooksPath, rel)
+}
+
+func isTestHookEvent(event string) bool {
+	return event == "test" || strings.HasPrefix(event, "test-")
+}
+
+// extractHooks removes the resources annotated with helm.sh/hook from the files in renderedChartDir, and returns them.
+// Files that only held hooks are removed. If dropTests is set, test hooks are removed without being returned.
+func (f *LocalTemplater) extractHooks(renderedChartDir string, dropTests bool) ([]hook, error) {
+	debug := level.Debug(log.With(f.Logger, "method", "extractHooks", "dir", renderedChartDir))
+
+	var files []string
+	err := f.FS.Walk(renderedChartDir, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if ext := filepath.Ext(filePath); !info.IsDir() && (ext == ".yaml" || ext == ".yml") {
+			files = append(files, filePath)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "walk %s", renderedChartDir)
+	}
+
+	var hooks []hook
+	for _, file := range files {
+		contents, err := f.FS.ReadFile(file)
+		if err != nil {
+			return nil, errors.Wrapf(err, "read %s", file)
+		}
+
+		var kept []string
+		found := false
+		for _, document := range documentSeparator.Split(string(contents), -1) {
+			if strings.TrimSpace(document) == "" {
+				continue
+			}
+			var resource hookResource
+			if err := yaml.Unmarshal([]byte(document), &resource); err != nil {
+				return nil, errors.Wrapf(err, "parse %s", file)
+			}
+			annotation, ok := resource.Metadata.Annotations[hookAnnotation]
+			if !ok {
+				kept = append(kept, document)
+				continue
+			}
+			found = true
+
+			parsed := hook{
+				Kind:     resource.Kind,
+				Name:     resource.Metadata.Name,
+				Contents: strings.TrimLeft(document, "\n"),
+			}
+			if weight, ok := resource.Metadata.Annotations[hookWeightAnnotation]; ok {
+				parsed.Weight, err = strconv.Atoi(strings.TrimSpace(weight))
+				if err != nil {
+					return nil, errors.Wrapf(err, "parse %s of %s %s", hookWeightAnnotation, resource.Kind, resource.Metadata.Name)
+				}
+			}
+			for _, event := range strings.Split(annotation, ",") {
+				event = strings.TrimSpace(event)
+				if event == "" || (dropTests && isTestHookEvent(event)) {
+					continue
+				}
+				parsed.Events = append(parsed.Events, event)
+			}
+			debug.Log("event", "hook.found", "kind", parsed.Kind, "name", parsed.Name, "events", strings.Join(parsed.Events, ","), "file", file)
+			if len(parsed.Events) > 0 {
+				hooks = append(hooks, parsed)
+			}
+		}
+		if !found {
+			continue
+		}
+
+		if len(kept) == 0 {
+			if err := f.FS.Remove(file); err != nil {
+				return nil, errors.Wrapf(err, "remove %s", file)
+			}
+			continue
+		}
+		var rewritten string
+		for _, document := range kept {
+			if !strings.HasPrefix(document, "\n") {
+				document = "\n" + document
+			}
+			rewritten += "---" + document
+		}
+		if err := f.FS.WriteFile(file, []byte(rewritten), 0644); err != nil {
+			return nil, errors.Wrapf(err, "write %s", file)
+		}
+	}
+	return hooks, nil
+}
+
+// writeHooks writes each hook to dest/<event>/ for each of its events, prefixed with its place in the order helm
+// runs that event's hooks: by weight, then kind and name
+func writeHooks(rootFs root.Fs, dest string, hooks []hook) error {
+	byEvent := map[string][]hook{}
+	for _, h := range hooks {
+		for _, event := range h.Events {
+			byEvent[event] = append(byEvent[event], h)
+		}
+	}
+
+	for event, eventHooks := range byEvent {
+		sort.SliceStable(eventHooks, func(i, j int) bool {
+			if eventHooks[i].Weight != eventHooks[j].Weight {
+				return eventHooks[i].Weight < eventHooks[j].Weight
+			}
+			if eventHooks[i].Kind != eventHooks[j].Kind {
+				return eventHooks[i].Kind < eventHooks[j].Kind
+			}
+			return eventHooks[i].Name < eventHooks[j].Name
+		})
+
+		eventDir := path.Join(dest, event)
+		if err := rootFs.MkdirAll(eventDir, 0755); err != nil {
+			return errors.Wrapf(err, "create %s", eventDir)
+		}
+		width := len(strconv.Itoa(len(eventHooks) - 1))
+		if width < 2 {
+			width = 2
+		}
+		for i, h := range eventHooks {
+			filename := fmt.Sprintf("%0*d-%s-%s.yaml", width, i, strings.ToLower(h.Kind), h.Name)
+			contents := h.Contents
+			if !strings.HasSuffix(contents, "\n") {
+				contents += "\n"
+			}
+			if err := rootFs.WriteFile(path.Join(eventDir, filename), []byte(contents), 0644); err != nil {
+				return errors.Wrapf(err, "write %s", path.Join(eventDir, filename))
+			}
+		}
+	}
+	return nil
+}
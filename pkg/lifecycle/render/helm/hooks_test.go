@@ -0,0 +1,162 @@
+package helm
+
+import (
+	"path"
+	"testing"
+
+	"github.com/replicatedhq/ship/pkg/api"
+	"github.com/replicatedhq/ship/pkg/lifecycle/render/root"
+	"github.com/replicatedhq/ship/pkg/testing/logger"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/require"
+)
+
+const renderedDeploymentAndHook = `---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+---
+apiVersion: batch/v1
+kind: Job
+metadata:
+  name: migrate
+  annotations:
+    "helm.sh/hook": pre-install,pre-upgrade
+    "helm.sh/hook-weight": "5"
+`
+
+const renderedHooks = `---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: migrate-config
+  annotations:
+    "helm.sh/hook": pre-install
+    "helm.sh/hook-weight": "-5"
+---
+apiVersion: v1
+kind: Pod
+metadata:
+  name: web-test
+  annotations:
+    "helm.sh/hook": test-success
+`
+
+func TestLocalTemplaterExtractHooks(t *testing.T) {
+	tests := []struct {
+		name        string
+		dropTests   bool
+		expectFiles map[string]string
+		expectGone  []string
+	}{
+		{
+			name: "hooks by event and weight",
+			expectFiles: map[string]string{
+				"base/deployment.yaml": `---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+`,
+				"hooks/pre-install/00-configmap-migrate-config.yaml": `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: migrate-config
+  annotations:
+    "helm.sh/hook": pre-install
+    "helm.sh/hook-weight": "-5"
+`,
+				"hooks/pre-install/01-job-migrate.yaml": `apiVersion: batch/v1
+kind: Job
+metadata:
+  name: migrate
+  annotations:
+    "helm.sh/hook": pre-install,pre-upgrade
+    "helm.sh/hook-weight": "5"
+`,
+				"hooks/pre-upgrade/00-job-migrate.yaml": `apiVersion: batch/v1
+kind: Job
+metadata:
+  name: migrate
+  annotations:
+    "helm.sh/hook": pre-install,pre-upgrade
+    "helm.sh/hook-weight": "5"
+`,
+				"hooks/test-success/00-pod-web-test.yaml": `apiVersion: v1
+kind: Pod
+metadata:
+  name: web-test
+  annotations:
+    "helm.sh/hook": test-success
+`,
+			},
+			expectGone: []string{"base/hooks.yaml"},
+		},
+		{
+			name:      "drop tests",
+			dropTests: true,
+			expectGone: []string{
+				"base/hooks.yaml",
+				"hooks/test-success/00-pod-web-test.yaml",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := require.New(t)
+			mockFs := afero.Afero{Fs: afero.NewMemMapFs()}
+			tpl := &LocalTemplater{
+				Logger: &logger.TestLogger{T: t},
+				FS:     mockFs,
+			}
+
+			req.NoError(mockFs.WriteFile("base/deployment.yaml", []byte(renderedDeploymentAndHook), 0644))
+			req.NoError(mockFs.WriteFile("base/hooks.yaml", []byte(renderedHooks), 0644))
+
+			hooks, err := tpl.extractHooks("base", tt.dropTests)
+			req.NoError(err)
+			req.NoError(writeHooks(root.NewRootFS(mockFs, "."), hooksDest(api.HelmAsset{Dest: "base"}), hooks))
+
+			for name, contents := range tt.expectFiles {
+				actual, err := mockFs.ReadFile(name)
+				req.NoError(err, name)
+				req.Equal(contents, string(actual), name)
+			}
+			for _, name := range tt.expectGone {
+				exists, err := mockFs.Exists(name)
+				req.NoError(err)
+				req.False(exists, name)
+			}
+		})
+	}
+}
+
+func TestHooksDest(t *testing.T) {
+	tests := []struct {
+		name  string
+		asset api.HelmAsset
+		want  string
+	}{
+		{
+			name:  "base",
+			asset: api.HelmAsset{Dest: "base"},
+			want:  "hooks",
+		},
+		{
+			name:  "named upstream",
+			asset: api.HelmAsset{Dest: path.Join("base", "web")},
+			want:  path.Join("hooks", "web"),
+		},
+		{
+			name:  "explicit",
+			asset: api.HelmAsset{Dest: "base", HooksDest: "chart-hooks"},
+			want:  "chart-hooks",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, hooksDest(tt.asset))
+		})
+	}
+}
@@ -18,6 +18,7 @@ import (
 	"github.com/replicatedhq/ship/pkg/constants"
 	"github.com/replicatedhq/ship/pkg/lifecycle/render/root"
 	"github.com/replicatedhq/ship/pkg/process"
+	"github.com/replicatedhq/ship/pkg/specs/apptype"
 	"github.com/replicatedhq/ship/pkg/state"
 	"github.com/replicatedhq/ship/pkg/templates"
 	"github.com/replicatedhq/ship/pkg/util"
@@ -96,8 +97,14 @@ func (f *LocalTemplater) Template(
 		),
 	)
 
+	upstreamName := namedUpstream(asset)
+
 	debug.Log("event", "mkdirall.attempt")
 	renderDest := path.Join(constants.ShipPathInternalTmp, "chartrendered")
+	if upstreamName != "" {
+		// each chart of an application composed of named upstreams is rendered on its own
+		renderDest = path.Join(renderDest, upstreamName)
+	}
 	err := f.FS.MkdirAll(renderDest, 0755)
 	if err != nil {
 		debug.Log("event", "mkdirall.fail", "err", err, "helmtempdir", renderDest)
@@ -112,6 +119,9 @@ func (f *LocalTemplater) Template(
 
 	versioned := state.Versioned()
 	releaseName := versioned.CurrentReleaseName()
+	if upstreamName != "" {
+		releaseName = upstreamName
+	}
 	debug.Log("event", "releasename.resolve.fromState", "releasename", releaseName)
 
 	templateArgs := []string{
@@ -123,21 +133,52 @@ func (f *LocalTemplater) Template(
 		templateArgs = append(templateArgs, asset.HelmOpts...)
 	}
 
-	debug.Log("event", "helm.init")
-	if err := f.Commands.Init(); err != nil {
-		return errors.Wrap(err, "init helm client")
+	chartAPIVersion, err := f.chartAPIVersion(chartRoot, asset)
+	if err != nil {
+		return errors.Wrap(err, "determine chart version")
+	}
+	debug.Log("event", "chart.apiVersion", "apiVersion", chartAPIVersion)
+	if chartAPIVersion == apptype.ChartAPIVersionV2 {
+		chartRoot, err = f.prepareV2Chart(chartRoot)
+		if err != nil {
+			return errors.Wrap(err, "prepare v2 chart")
+		}
 	}
 
-	debug.Log("event", "helm.dependency.update")
-	if err := f.Commands.DependencyUpdate(chartRoot); err != nil {
-		return errors.Wrap(err, "update helm dependencies")
+	debug.Log("event", "dependencies.vendored.check")
+	missingDependencies, err := f.missingDependencies(chartRoot)
+	if err != nil {
+		return errors.Wrap(err, "check vendored dependencies")
+	}
+	if len(missingDependencies) > 0 {
+		if f.Viper.GetBool("offline") {
+			return errors.Errorf("dependencies %s are not vendored in the chart's charts/ directory, run without --offline to fetch them",
+				strings.Join(missingDependencies, ", "))
+		}
+
+		debug.Log("event", "helm.init")
+		if err := f.Commands.Init(); err != nil {
+			return errors.Wrap(err, "init helm client")
+		}
+
+		debug.Log("event", "helm.dependency.update", "missing", strings.Join(missingDependencies, ", "))
+		if err := f.Commands.DependencyUpdate(chartRoot); err != nil {
+			return errors.Wrap(err, "update helm dependencies")
+		}
+	}
+
+	var librarySubcharts []string
+	if chartAPIVersion == apptype.ChartAPIVersionV2 {
+		librarySubcharts, err = f.librarySubcharts(chartRoot)
+		if err != nil {
+			return errors.Wrap(err, "find library subcharts")
+		}
 	}
 
 	if asset.ValuesFrom != nil && asset.ValuesFrom.Lifecycle != nil {
 		tmpValuesPath := path.Join(constants.ShipPathInternalTmp, "values.yaml")
-		defaultValuesPath := path.Join(chartRoot, "values.yaml")
-		debug.Log("event", "writeTmpValues", "to", tmpValuesPath, "default", defaultValuesPath)
-		if err := f.writeStateHelmValuesTo(tmpValuesPath, defaultValuesPath); err != nil {
+		debug.Log("event", "writeTmpValues", "to", tmpValuesPath, "chartRoot", chartRoot)
+		if err := f.writeStateHelmValuesTo(tmpValuesPath, chartRoot, upstreamName); err != nil {
 			return errors.Wrapf(err, "copy state value to tmp directory %s", renderDest)
 		}
 
@@ -173,7 +214,35 @@ func (f *LocalTemplater) Template(
 	if err != nil {
 		return err
 	}
-	return f.cleanUpAndOutputRenderedFiles(rootFs, asset, tempRenderedChartDir)
+	if err := f.removeLibrarySubcharts(tempRenderedChartDir, librarySubcharts); err != nil {
+		return err
+	}
+	if err := f.cleanUpAndOutputRenderedFiles(rootFs, asset, tempRenderedChartDir); err != nil {
+		return err
+	}
+
+	if chartAPIVersion == apptype.ChartAPIVersionV2 {
+		if err := f.writeCRDs(rootFs, chartRoot, asset.Dest); err != nil {
+			return errors.Wrap(err, "write crds")
+		}
+	}
+	return nil
+}
+
+// chartAPIVersion is the apiVersion detected when the chart was fetched, or for a chart from ship.yaml, the one in its Chart.yaml
+func (f *LocalTemplater) chartAPIVersion(chartRoot string, asset api.HelmAsset) (string, error) {
+	if asset.Local != nil && asset.Local.ChartAPIVersion != "" {
+		return asset.Local.ChartAPIVersion, nil
+	}
+	return apptype.ChartAPIVersion(f.FS, chartRoot)
+}
+
+// namedUpstream is the named upstream whose helm values the asset is rendered with, if any
+func namedUpstream(asset api.HelmAsset) string {
+	if asset.ValuesFrom == nil || asset.ValuesFrom.Lifecycle == nil {
+		return ""
+	}
+	return asset.ValuesFrom.Lifecycle.Upstream
 }
 
 // checks to see if the specified arg is present in the list. If it is not, adds it set to the specified value
@@ -256,11 +325,16 @@ func (f *LocalTemplater) cleanUpAndOutputRenderedFiles(
 	tempRenderedChartTemplatesDir := path.Join(tempRenderedChartDir, "templates")
 	tempRenderedSubChartsDir := path.Join(tempRenderedChartDir, subChartsDirName)
 
+	hooksDest := hooksDest(asset)
 	if f.Viper.GetBool("rm-asset-dest") {
 		debug.Log("event", "baseDir.rm", "path", asset.Dest)
 		if err := f.FS.RemoveAll(asset.Dest); err != nil {
 			return errors.Wrapf(err, "rm asset dest, remove %s", asset.Dest)
 		}
+		debug.Log("event", "hooksDir.rm", "path", hooksDest)
+		if err := f.FS.RemoveAll(hooksDest); err != nil {
+			return errors.Wrapf(err, "rm asset dest, remove %s", hooksDest)
+		}
 	}
 
 	debug.Log("event", "bailIfPresent", "path", asset.Dest)
@@ -283,6 +357,20 @@ func (f *LocalTemplater) cleanUpAndOutputRenderedFiles(
 		return errors.Wrapf(err, "unable to validate chart dir")
 	}
 
+	hooks, err := f.extractHooks(tempRenderedChartDir, asset.DropTestHooks || f.Viper.GetBool("drop-test-hooks"))
+	if err != nil {
+		return errors.Wrap(err, "extract helm hooks")
+	}
+	if len(hooks) > 0 {
+		debug.Log("event", "hooks.write", "path", hooksDest, "hooks", len(hooks))
+		if err := util.BailIfPresent(f.FS, hooksDest, f.Logger); err != nil {
+			return err
+		}
+		if err := writeHooks(rootFs, hooksDest, hooks); err != nil {
+			return errors.Wrap(err, "write helm hooks")
+		}
+	}
+
 	debug.Log("event", "readdir", "folder", tempRenderedChartTemplatesDir)
 	files, err := f.FS.ReadDir(tempRenderedChartTemplatesDir)
 	if err != nil {
@@ -320,8 +408,9 @@ func (f *LocalTemplater) cleanUpAndOutputRenderedFiles(
 }
 
 // dest should be a path to a file, and its parent directory should already exist
-// if there are no values in state, defaultValuesPath will be copied into dest
-func (f *LocalTemplater) writeStateHelmValuesTo(dest string, defaultValuesPath string) error {
+// if there are no values in state, the values shipped with the chart and its subcharts will be copied into dest
+// if upstreamName is set, the values of that named upstream are used instead of the application's
+func (f *LocalTemplater) writeStateHelmValuesTo(dest string, chartRoot string, upstreamName string) error {
 	debug := level.Debug(log.With(f.Logger, "step.type", "helmValues", "resolveHelmValues"))
 	debug.Log("event", "tryLoadState")
 	editState, err := f.StateManager.TryLoad()
@@ -330,12 +419,23 @@ func (f *LocalTemplater) writeStateHelmValuesTo(dest string, defaultValuesPath s
 	}
 	helmValues := editState.CurrentHelmValues()
 	defaultHelmValues := editState.CurrentHelmValuesDefaults()
+	shippedChartPath := constants.HelmChartPath
 
-	defaultValuesShippedWithChartBytes, err := f.FS.ReadFile(filepath.Join(constants.HelmChartPath, "values.yaml"))
+	if upstreamName != "" {
+		upstream, ok := editState.Versioned().V2.UpstreamNamed(upstreamName)
+		if !ok {
+			return errors.Errorf("upstream %q not found in state", upstreamName)
+		}
+		helmValues = upstream.HelmValues
+		defaultHelmValues = upstream.HelmValuesDefaults
+		// named upstreams' charts aren't copied to the HelmChartPath
+		shippedChartPath = chartRoot
+	}
+
+	defaultValuesShippedWithChart, err := ChartValues(f.FS, shippedChartPath)
 	if err != nil {
-		return errors.Wrapf(err, "read helm values from %s", filepath.Join(constants.HelmChartPath, "values.yaml"))
+		return errors.Wrapf(err, "read helm values from %s", shippedChartPath)
 	}
-	defaultValuesShippedWithChart := string(defaultValuesShippedWithChartBytes)
 
 	if defaultHelmValues == "" {
 		debug.Log("event", "values.load", "message", "No default helm values in state; using helm values from state.")
@@ -357,7 +457,11 @@ func (f *LocalTemplater) writeStateHelmValuesTo(dest string, defaultValuesPath s
 		return errors.Wrapf(err, "write values.yaml to %s", dest)
 	}
 
-	err = f.StateManager.SerializeHelmValues(mergedValues, string(defaultValuesShippedWithChartBytes))
+	if upstreamName != "" {
+		err = f.StateManager.SerializeNamedUpstreamHelmValues(upstreamName, mergedValues, defaultValuesShippedWithChart)
+	} else {
+		err = f.StateManager.SerializeHelmValues(mergedValues, defaultValuesShippedWithChart)
+	}
 	if err != nil {
 		return errors.Wrapf(err, "serialize helm values to state")
 	}
@@ -422,7 +526,7 @@ func fixFile(fs afero.Afero, thisPath string, mode os.FileMode) error {
 			fmt.Fprintln(&outputFile, line)
 		} else {
 			// avoid adding trailing newlines
-			fmt.Fprintf(&outputFile, line)
+			fmt.Fprint(&outputFile, line)
 		}
 	}
 
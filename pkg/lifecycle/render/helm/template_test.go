@@ -136,7 +136,7 @@ func TestLocalTemplater(t *testing.T) {
 			}
 
 			mockState.EXPECT().TryLoad().Return(state2.VersionedState{
-				V1: &state2.V1{
+				V2: &state2.V2{
 					HelmValues:  "we fake",
 					ReleaseName: channelName,
 				},
@@ -158,8 +158,6 @@ func TestLocalTemplater(t *testing.T) {
 
 			templateArgs = addArgIfNotPresent(templateArgs, "--namespace", "default")
 
-			mockCommands.EXPECT().Init().Return(nil)
-			mockCommands.EXPECT().DependencyUpdate(chartRoot).Return(nil)
 			if test.ontemplate != nil {
 				mockCommands.EXPECT().Template(chartRoot, templateArgs).DoAndReturn(test.ontemplate(req, mockFs))
 			} else {
@@ -207,6 +205,71 @@ func TestLocalTemplater(t *testing.T) {
 	}
 }
 
+func TestLocalTemplaterNamedUpstream(t *testing.T) {
+	req := require.New(t)
+	mc := gomock.NewController(t)
+	defer mc.Finish()
+
+	testLogger := &logger.TestLogger{T: t}
+	mockState := state.NewMockManager(mc)
+	mockCommands := helm.NewMockCommands(mc)
+	mockFs := afero.Afero{Fs: afero.NewMemMapFs()}
+	tpl := &LocalTemplater{
+		Commands:       mockCommands,
+		Logger:         testLogger,
+		FS:             mockFs,
+		BuilderBuilder: templates.NewBuilderBuilder(testLogger, viper.New()),
+		Viper:          viper.New(),
+		StateManager:   mockState,
+		process:        process.Process{Logger: testLogger},
+	}
+
+	chartRoot := path.Join(constants.ShipPathInternalTmp, "charts", "ingress")
+	req.NoError(mockFs.WriteFile(path.Join(chartRoot, "values.yaml"), []byte("replicaCount: 1\n"), 0644))
+
+	mockState.EXPECT().TryLoad().Return(state2.VersionedState{
+		V2: &state2.V2{
+			ReleaseName: "platform",
+			HelmValues:  "app: values",
+			Upstreams: []state2.NamedUpstream{
+				{Name: "app", HelmValues: "app: values\n"},
+				{Name: "ingress", HelmValues: "replicaCount: 3\n", HelmValuesDefaults: "replicaCount: 1\n"},
+			},
+		},
+	}, nil).Times(2)
+	mockState.EXPECT().SerializeNamedUpstreamHelmValues("ingress", "replicaCount: 3\n", "replicaCount: 1\n").Return(nil)
+
+	renderDest := path.Join(constants.ShipPathInternalTmp, "chartrendered", "ingress")
+	mockCommands.EXPECT().Template(chartRoot, []string{
+		"--output-dir", renderDest,
+		"--name", "ingress",
+		"--values", path.Join(constants.ShipPathInternalTmp, "values.yaml"),
+		"--namespace", "default",
+	}).DoAndReturn(func(chartRoot string, args []string) error {
+		values, err := mockFs.ReadFile(path.Join(constants.ShipPathInternalTmp, "values.yaml"))
+		req.NoError(err)
+		req.Equal("replicaCount: 3\n", string(values))
+		return mockFs.WriteFile(path.Join(renderDest, "nginx-ingress", "templates", "deployment.yaml"), []byte("kind: Deployment\n"), 0644)
+	})
+
+	err := tpl.Template(
+		chartRoot,
+		root.Fs{Afero: mockFs},
+		api.HelmAsset{
+			AssetShared: api.AssetShared{Dest: path.Join(constants.KustomizeBasePath, "ingress")},
+			ValuesFrom:  &api.ValuesFrom{Lifecycle: &api.ValuesFromLifecycle{Upstream: "ingress"}},
+		},
+		api.ReleaseMetadata{},
+		[]libyaml.ConfigGroup{},
+		map[string]interface{}{},
+	)
+	req.NoError(err)
+
+	rendered, err := mockFs.ReadFile(path.Join(constants.KustomizeBasePath, "ingress", "deployment.yaml"))
+	req.NoError(err)
+	req.Equal("kind: Deployment\n", string(rendered))
+}
+
 func TestTryRemoveKustomizeBasePath(t *testing.T) {
 	tests := []struct {
 		name        string
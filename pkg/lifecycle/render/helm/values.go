@@ -3,11 +3,171 @@ package helm
 import (
 	"crypto/sha256"
 	"fmt"
+	"path"
+	"sort"
+	"strings"
 
 	"github.com/pkg/errors"
+	"github.com/spf13/afero"
 	yaml "gopkg.in/yaml.v2"
 )
 
+// ChartValues are the default values of the chart at chartRoot, followed by the default values of each subchart
+// vendored in its charts/ directory, under the name the subchart's values are set with. Each subchart's globals are
+// kept in its section, as helm reads them. The subcharts' values.yaml files are appended as they are, keeping
+// their comments, unless the chart already sets some of a subchart's values, when the two are merged instead.
+func ChartValues(fs afero.Afero, chartRoot string) (string, error) {
+	valuesPath := path.Join(chartRoot, "values.yaml")
+	contents, err := fs.ReadFile(valuesPath)
+	if err != nil {
+		return "", errors.Wrapf(err, "read %s", valuesPath)
+	}
+	chartValues := string(contents)
+
+	subchartValues, err := vendoredSubchartValues(fs, chartRoot)
+	if err != nil {
+		return "", errors.Wrap(err, "read subchart values")
+	}
+	if len(subchartValues) == 0 {
+		return chartValues, nil
+	}
+
+	parsed := map[string]interface{}{}
+	if err := yaml.Unmarshal(contents, &parsed); err != nil {
+		return "", errors.Wrapf(err, "unmarshal %s", valuesPath)
+	}
+
+	var names []string
+	overridden := false
+	for name := range subchartValues {
+		names = append(names, name)
+		if _, ok := parsed[name]; ok {
+			overridden = true
+		}
+	}
+	sort.Strings(names)
+
+	if !overridden {
+		appended := chartValues
+		if appended != "" && !strings.HasSuffix(appended, "\n") {
+			appended += "\n"
+		}
+		for _, name := range names {
+			appended += fmt.Sprintf("%s:\n%s", name, indentValues(subchartValues[name]))
+		}
+		if err := yaml.Unmarshal([]byte(appended), &map[string]interface{}{}); err == nil {
+			return appended, nil
+		}
+	}
+
+	for _, name := range names {
+		subchart := map[interface{}]interface{}{}
+		if err := yaml.Unmarshal([]byte(subchartValues[name]), &subchart); err != nil {
+			return "", errors.Wrapf(err, "unmarshal values of subchart %s", name)
+		}
+		if existing, ok := parsed[name]; ok {
+			if existingMap, isMap := existing.(map[interface{}]interface{}); isMap {
+				coalesceValues(existingMap, subchart)
+			}
+			continue
+		}
+		parsed[name] = subchart
+	}
+
+	merged, err := yaml.Marshal(parsed)
+	if err != nil {
+		return "", errors.Wrap(err, "marshal values")
+	}
+	return string(merged), nil
+}
+
+// vendoredSubchartValues are the values.yaml of each subchart in chartRoot/charts, keyed by the name or
+// names the chart's dependencies give the subchart. Subcharts without values are left out.
+func vendoredSubchartValues(fs afero.Afero, chartRoot string) (map[string]string, error) {
+	subcharts, err := vendoredSubcharts(fs, chartRoot)
+	if err != nil {
+		return nil, err
+	}
+	if len(subcharts) == 0 {
+		return nil, nil
+	}
+	dependencies, err := chartDependencies(fs, chartRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	values := map[string]string{}
+	for _, subchart := range subcharts {
+		var contents []byte
+		if subchart.Archived {
+			contents, err = readArchivedChartFile(fs, subchart.Path, "values.yaml")
+		} else {
+			valuesPath := path.Join(subchart.Path, "values.yaml")
+			if exists, existsErr := fs.Exists(valuesPath); existsErr != nil || !exists {
+				continue
+			}
+			contents, err = fs.ReadFile(valuesPath)
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "read values of %s", subchart.Path)
+		}
+		// helm won't coalesce a subchart's section if it isn't a map, so there's nothing to show for values that are only comments
+		parsed := map[string]interface{}{}
+		if err := yaml.Unmarshal(contents, &parsed); err != nil {
+			return nil, errors.Wrapf(err, "unmarshal values of %s", subchart.Path)
+		}
+		if len(parsed) == 0 {
+			continue
+		}
+
+		var names []string
+		for _, dependency := range dependencies {
+			if dependency.Name == subchart.Chartfile.Name && dependency.Alias != "" {
+				names = append(names, dependency.Alias)
+			}
+		}
+		if len(names) == 0 {
+			names = []string{subchart.Chartfile.Name}
+		}
+		for _, name := range names {
+			values[name] = string(contents)
+		}
+	}
+	return values, nil
+}
+
+// coalesceValues adds the subchart defaults to the values a chart sets for it, which take precedence
+func coalesceValues(values map[interface{}]interface{}, defaults map[interface{}]interface{}) {
+	for key, defaultValue := range defaults {
+		value, ok := values[key]
+		if !ok {
+			values[key] = defaultValue
+			continue
+		}
+		valueMap, valueIsMap := value.(map[interface{}]interface{})
+		defaultMap, defaultIsMap := defaultValue.(map[interface{}]interface{})
+		if valueIsMap && defaultIsMap {
+			coalesceValues(valueMap, defaultMap)
+		}
+	}
+}
+
+// indentValues nests a values.yaml under a key, dropping any document separators
+func indentValues(values string) string {
+	var lines []string
+	for _, line := range strings.Split(strings.TrimRight(values, "\n"), "\n") {
+		switch {
+		case strings.TrimSpace(line) == "---":
+			continue
+		case line == "":
+			lines = append(lines, line)
+		default:
+			lines = append(lines, "  "+line)
+		}
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
 // Merges user edited values from state file and vendor values from upstream Helm repo.
 // base is the original config from state
 // user is the modified config from state
@@ -1,8 +1,10 @@
 package helm
 
 import (
+	"path"
 	"testing"
 
+	"github.com/spf13/afero"
 	"github.com/stretchr/testify/require"
 )
 
@@ -92,3 +94,87 @@ key3: modified-by-vendor
 		})
 	}
 }
+
+func TestChartValues(t *testing.T) {
+	tests := []struct {
+		name         string
+		values       string
+		requirements string
+		subcharts    map[string][]byte
+		expected     string
+	}{
+		{
+			name:     "no subcharts",
+			values:   "# replicas\nreplicaCount: 1",
+			expected: "# replicas\nreplicaCount: 1",
+		},
+		{
+			name:   "subcharts appended",
+			values: "# replicas\nreplicaCount: 1\nglobal:\n  imageRegistry: quay.io\n",
+			subcharts: map[string][]byte{
+				"redis-3.0.0.tgz": packagedChart(require.New(t), "redis", map[string]string{
+					"Chart.yaml":  "name: redis\nversion: 3.0.0\n",
+					"values.yaml": "---\n# redis port\nport: 6379\nglobal:\n  storageClass: standard\n",
+				}),
+				"metrics/Chart.yaml":  []byte("name: metrics\nversion: 1.0.0\n"),
+				"metrics/values.yaml": []byte("# nothing to set\n"),
+				"common/Chart.yaml":   []byte("name: common\nversion: 1.0.0\n"),
+			},
+			expected: `# replicas
+replicaCount: 1
+global:
+  imageRegistry: quay.io
+redis:
+  # redis port
+  port: 6379
+  global:
+    storageClass: standard
+`,
+		},
+		{
+			name:   "aliased subchart",
+			values: "replicaCount: 1\n",
+			requirements: `dependencies:
+- name: redis
+  version: 3.0.0
+  alias: cache
+- name: redis
+  version: 3.0.0
+  alias: sessions
+`,
+			subcharts: map[string][]byte{
+				"redis/Chart.yaml":  []byte("name: redis\nversion: 3.0.0\n"),
+				"redis/values.yaml": []byte("port: 6379\n"),
+			},
+			expected: "replicaCount: 1\ncache:\n  port: 6379\nsessions:\n  port: 6379\n",
+		},
+		{
+			name:   "subchart values set by the chart",
+			values: "# replicas\nreplicaCount: 1\nredis:\n  port: 6380\n",
+			subcharts: map[string][]byte{
+				"redis/Chart.yaml":  []byte("name: redis\nversion: 3.0.0\n"),
+				"redis/values.yaml": []byte("port: 6379\npersistence:\n  enabled: true\n"),
+			},
+			expected: "redis:\n  persistence:\n    enabled: true\n  port: 6380\nreplicaCount: 1\n",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := require.New(t)
+			fs := afero.Afero{Fs: afero.NewMemMapFs()}
+			chartRoot := "/chart"
+			req.NoError(fs.WriteFile(path.Join(chartRoot, "Chart.yaml"), []byte("name: web\nversion: 0.1.0\n"), 0644))
+			req.NoError(fs.WriteFile(path.Join(chartRoot, "values.yaml"), []byte(test.values), 0644))
+			if test.requirements != "" {
+				req.NoError(fs.WriteFile(path.Join(chartRoot, "requirements.yaml"), []byte(test.requirements), 0644))
+			}
+			for filename, contents := range test.subcharts {
+				req.NoError(fs.WriteFile(path.Join(chartRoot, "charts", filename), contents, 0644))
+			}
+
+			values, err := ChartValues(fs, chartRoot)
+			req.NoError(err)
+			req.Equal(test.expected, values)
+		})
+	}
+}
@@ -57,10 +57,14 @@ func TestRenderNoConfig(t *testing.T) {
 			func() {
 				defer mc.Finish()
 
-				mockState.EXPECT().TryLoad().Return(state.V0(test.ViperConfig), nil)
+				config := test.ViperConfig
+				if config == nil {
+					config = map[string]interface{}{}
+				}
+				mockState.EXPECT().TryLoad().Return(state.VersionedState{V2: &state.V2{Config: config}}, nil)
 
 				p.EXPECT().
-					Build("testdir", test.Spec.Assets.V1, test.Spec.Config.V1, gomock.Any(), test.ViperConfig).
+					Build("testdir", test.Spec.Assets.V1, test.Spec.Config.V1, gomock.Any(), config).
 					Return(planner.Plan{}, nil)
 
 				p.EXPECT().
@@ -93,7 +93,7 @@ func (r *renderer) Execute(ctx context.Context, release *api.Release, step *api.
 	}
 
 	debug.Log("event", "commit")
-	if err := r.StateManager.SerializeConfig(release.Spec.Assets.V1, release.Metadata, stateTemplateContext); err != nil {
+	if err := r.StateManager.SerializeConfig(release.Spec.Assets.V1, release.Metadata, release.Spec.Config.V1, stateTemplateContext); err != nil {
 		return errors.Wrap(err, "serialize state")
 	}
 
@@ -37,11 +37,11 @@ func persistState(debug log.Logger, fs afero.Afero, statemanager state.Manager,
 		return errors.Wrapf(err, "load ship state")
 	}
 	versioned := shipstate.Versioned()
-	if versioned.V1.Terraform == nil {
-		versioned.V1.Terraform = &state.Terraform{}
+	if versioned.V2.Terraform == nil {
+		versioned.V2.Terraform = &state.Terraform{}
 	}
-	versioned.V1.Terraform.RawState = string(tfstate)
-	versioned.V1.Terraform.State = tfstatev3
+	versioned.V2.Terraform.RawState = string(tfstate)
+	versioned.V2.Terraform.State = tfstatev3
 	debug.Log("event", "state.save", "path", statePath)
 	err = statemanager.Save(versioned)
 	if err != nil {
@@ -60,7 +60,7 @@ func restoreState(debug log.Logger, fs afero.Afero, statemanager state.Manager,
 	}
 
 	versioned := shipstate.Versioned()
-	if versioned.V1.Terraform == nil || versioned.V1.Terraform.RawState == "" {
+	if versioned.V2.Terraform == nil || versioned.V2.Terraform.RawState == "" {
 		debug.Log("event", "tfstate.noPreviousState")
 		return nil
 	}
@@ -68,7 +68,7 @@ func restoreState(debug log.Logger, fs afero.Afero, statemanager state.Manager,
 	statePath := path.Join(dir, "terraform.tfstate")
 	debug.Log("event", "tfstate.writeFile", "path", statePath)
 
-	err = fs.WriteFile(statePath, []byte(versioned.V1.Terraform.RawState), 0644)
+	err = fs.WriteFile(statePath, []byte(versioned.V2.Terraform.RawState), 0644)
 	if err != nil {
 		return errors.Wrapf(err, "write state file")
 	}
@@ -44,10 +44,10 @@ func TestPersistState(t *testing.T) {
 }
 `,
 			instate: state.VersionedState{
-				V1: &state.V1{},
+				V2: &state.V2{},
 			},
 			outstate: state.VersionedState{
-				V1: &state.V1{
+				V2: &state.V2{
 					Terraform: &state.Terraform{
 						RawState: `{
     "version": 3,
@@ -102,11 +102,11 @@ func TestPersistState(t *testing.T) {
 			statemanager.EXPECT().Save(&matchers.Is{
 				Test: func(v interface{}) bool {
 					vstate := v.(state.VersionedState)
-					diff := deep.Equal(*vstate.V1.Terraform, *test.outstate.V1.Terraform)
+					diff := deep.Equal(*vstate.V2.Terraform, *test.outstate.V2.Terraform)
 					t.Log(strings.Join(diff, "\n"))
 					return len(diff) == 0
 				},
-				Describe: fmt.Sprintf("equal to %+v", *test.outstate.V1.Terraform),
+				Describe: fmt.Sprintf("equal to %+v", *test.outstate.V2.Terraform),
 			}).Return(nil)
 
 			err = persistState(debug, mockFs, statemanager, "installer")
@@ -144,7 +144,7 @@ func TestRestoreState(t *testing.T) {
 }
 `,
 			instate: state.VersionedState{
-				V1: &state.V1{
+				V2: &state.V2{
 					Terraform: &state.Terraform{
 						RawState: `{
     "version": 3,
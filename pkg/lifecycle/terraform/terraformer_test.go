@@ -221,8 +221,8 @@ func TestMockTerraform(t *testing.T) {
 		}
 	}
 
-	fmt.Fprintf(os.Stdout, config.Stdout)
-	fmt.Fprintf(os.Stderr, config.Stderr)
+	fmt.Fprint(os.Stdout, config.Stdout)
+	fmt.Fprint(os.Stderr, config.Stderr)
 
 	if config.Fail {
 		os.Exit(1)
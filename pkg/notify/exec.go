@@ -0,0 +1,48 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"os/exec"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+)
+
+// Exec runs a shell command with the payload as JSON on stdin. The most useful fields are also
+// set in the environment, as SHIP_UPSTREAM, SHIP_UPSTREAM_NAME, SHIP_PREVIOUS_CONTENT_SHA, SHIP_CONTENT_SHA and SHIP_VERSION.
+type Exec struct {
+	Logger  log.Logger
+	Command string
+}
+
+func (e *Exec) Notify(ctx context.Context, payload Payload) error {
+	debug := level.Debug(log.With(e.Logger, "struct", "notify.Exec", "method", "Notify"))
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return errors.Wrap(err, "marshal payload")
+	}
+
+	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", e.Command)
+	cmd.Stdin = bytes.NewReader(body)
+	cmd.Env = append(os.Environ(),
+		"SHIP_EVENT="+payload.Event,
+		"SHIP_UPSTREAM="+payload.Upstream,
+		"SHIP_UPSTREAM_NAME="+payload.Name,
+		"SHIP_PREVIOUS_CONTENT_SHA="+payload.PreviousContentSHA,
+		"SHIP_CONTENT_SHA="+payload.ContentSHA,
+		"SHIP_VERSION="+payload.Version,
+	)
+
+	debug.Log("event", "exec.run", "command", e.Command)
+	output, err := cmd.CombinedOutput()
+	debug.Log("event", "exec.complete", "command", e.Command, "output", string(output))
+	if err != nil {
+		return errors.Wrapf(err, "run %q: %s", e.Command, bytes.TrimSpace(output))
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package notify
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/hashicorp/go-multierror"
+	"github.com/spf13/viper"
+)
+
+// EventUpdate is sent when an upstream has a new content SHA
+const EventUpdate = "update"
+
+// Payload is sent to every notifier, as JSON, when `ship watch` finds an update
+type Payload struct {
+	Event string `json:"event"`
+	// Name is the name of the upstream, if the app has several named upstreams
+	Name string `json:"name,omitempty"`
+	// Upstream has any credentials redacted
+	Upstream           string    `json:"upstream"`
+	PreviousContentSHA string    `json:"previousContentSha"`
+	ContentSHA         string    `json:"contentSha"`
+	Version            string    `json:"version,omitempty"`
+	ReleaseNotes       string    `json:"releaseNotes,omitempty"`
+	Time               time.Time `json:"time"`
+}
+
+// Notifier tells something outside of ship about an update
+type Notifier interface {
+	Notify(ctx context.Context, payload Payload) error
+}
+
+// Notifiers sends each payload to every notifier
+type Notifiers []Notifier
+
+// NewNotifiers builds the notifiers set with --notify-webhook, which can be repeated, and --notify-exec
+func NewNotifiers(logger log.Logger, v *viper.Viper) Notifiers {
+	var notifiers Notifiers
+	for _, url := range v.GetStringSlice("notify-webhook") {
+		notifiers = append(notifiers, NewWebhook(logger, url, v.GetString("notify-webhook-secret")))
+	}
+	if command := v.GetString("notify-exec"); command != "" {
+		notifiers = append(notifiers, &Exec{Logger: logger, Command: command})
+	}
+	return notifiers
+}
+
+// Delivered is the set of notifiers, by their index in Notifiers, that have been told about an event
+type Delivered map[int]bool
+
+// Notify sends payload to every notifier not in delivered, even if an earlier one fails, and returns all of their errors.
+// Each notifier that succeeds is added to delivered, so that retrying the event only sends it to the ones that failed.
+// A nil delivered sends payload to every notifier.
+func (n Notifiers) Notify(ctx context.Context, payload Payload, delivered Delivered) error {
+	var multiErr *multierror.Error
+	for i, notifier := range n {
+		if delivered[i] {
+			continue
+		}
+		if err := notifier.Notify(ctx, payload); err != nil {
+			multiErr = multierror.Append(multiErr, err)
+			continue
+		}
+		if delivered != nil {
+			delivered[i] = true
+		}
+	}
+	return multiErr.ErrorOrNil()
+}
@@ -0,0 +1,119 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/require"
+)
+
+var testPayload = Payload{
+	Event:              EventUpdate,
+	Upstream:           "github.com/helm/charts/stable/nginx-ingress",
+	PreviousContentSHA: "abc",
+	ContentSHA:         "def",
+	Version:            "0.31.0",
+	ReleaseNotes:       "Bump controller image",
+	Time:               time.Date(2018, 10, 1, 12, 0, 0, 0, time.UTC),
+}
+
+func TestWebhook(t *testing.T) {
+	req := require.New(t)
+
+	var received Payload
+	var body []byte
+	var headers http.Header
+	status := http.StatusNoContent
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = r.Header
+		body, _ = ioutil.ReadAll(r.Body)
+		req.NoError(json.Unmarshal(body, &received))
+		w.WriteHeader(status)
+		w.Write([]byte("nope\n"))
+	}))
+	defer server.Close()
+
+	webhook := NewWebhook(log.NewNopLogger(), server.URL, "s3cret")
+	req.NoError(webhook.Notify(context.Background(), testPayload))
+	req.Equal(testPayload, received)
+	req.Equal("application/json", headers.Get("Content-Type"))
+	req.Equal(EventUpdate, headers.Get(EventHeader))
+	req.Equal(Sign("s3cret", body), headers.Get(SignatureHeader))
+	req.NotEqual(Sign("other", body), headers.Get(SignatureHeader))
+
+	unsigned := NewWebhook(log.NewNopLogger(), server.URL, "")
+	req.NoError(unsigned.Notify(context.Background(), testPayload))
+	req.Empty(headers.Get(SignatureHeader))
+
+	status = http.StatusInternalServerError
+	err := webhook.Notify(context.Background(), testPayload)
+	req.Error(err)
+	req.Contains(err.Error(), "status 500: nope")
+}
+
+func TestSign(t *testing.T) {
+	req := require.New(t)
+	// echo -n '{"event":"update"}' | openssl dgst -sha256 -hmac s3cret
+	req.Equal("sha256=8f5d87f422bb70397f68b21a9f240c8b7fe0d4ae3695dd303ce210ad7acf55ef", Sign("s3cret", []byte(`{"event":"update"}`)))
+}
+
+func TestExec(t *testing.T) {
+	req := require.New(t)
+	dir, err := ioutil.TempDir("", "ship-notify")
+	req.NoError(err)
+	defer os.RemoveAll(dir)
+
+	out := filepath.Join(dir, "payload.json")
+	notifier := &Exec{Logger: log.NewNopLogger(), Command: `cat > ` + out + ` && echo "$SHIP_CONTENT_SHA $SHIP_VERSION" >> ` + out}
+	req.NoError(notifier.Notify(context.Background(), testPayload))
+
+	contents, err := ioutil.ReadFile(out)
+	req.NoError(err)
+	var received Payload
+	decoder := json.NewDecoder(bytes.NewReader(contents))
+	req.NoError(decoder.Decode(&received))
+	req.Equal(testPayload, received)
+	rest, err := ioutil.ReadAll(decoder.Buffered())
+	req.NoError(err)
+	req.Equal("def 0.31.0\n", string(rest))
+
+	failing := &Exec{Logger: log.NewNopLogger(), Command: "echo broken >&2; exit 3"}
+	err = failing.Notify(context.Background(), testPayload)
+	req.Error(err)
+	req.Contains(err.Error(), "broken")
+}
+
+func TestNotifiers(t *testing.T) {
+	req := require.New(t)
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+	}))
+	defer server.Close()
+
+	notifiers := Notifiers{
+		&Exec{Logger: log.NewNopLogger(), Command: "exit 1"},
+		NewWebhook(log.NewNopLogger(), server.URL, ""),
+	}
+
+	// a failing notifier doesn't stop the rest
+	delivered := Delivered{}
+	err := notifiers.Notify(context.Background(), testPayload, delivered)
+	req.Error(err)
+	req.Equal(1, calls)
+	req.Equal(Delivered{1: true}, delivered)
+
+	// a retry only goes to the notifier that failed
+	err = notifiers.Notify(context.Background(), testPayload, delivered)
+	req.Error(err)
+	req.Equal(1, calls)
+}
@@ -0,0 +1,83 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/ship/pkg/util"
+)
+
+const (
+	// EventHeader names the event a webhook is for
+	EventHeader = "X-Ship-Event"
+	// SignatureHeader is the hex HMAC-SHA256 of the request body, keyed with the webhook secret, as "sha256=<hex>"
+	SignatureHeader = "X-Ship-Signature-256"
+)
+
+// Webhook POSTs the payload as JSON to a URL. If Secret is set, the body is signed with it, see SignatureHeader.
+type Webhook struct {
+	Logger log.Logger
+	URL    string
+	Secret string
+	Client *http.Client
+}
+
+func NewWebhook(logger log.Logger, url string, secret string) *Webhook {
+	return &Webhook{
+		Logger: logger,
+		URL:    url,
+		Secret: secret,
+		Client: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (w *Webhook) Notify(ctx context.Context, payload Payload) error {
+	debug := level.Debug(log.With(w.Logger, "struct", "notify.Webhook", "method", "Notify"))
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return errors.Wrap(err, "marshal payload")
+	}
+
+	req, err := http.NewRequest(http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrapf(err, "create request to webhook %s", util.Redact(w.URL))
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, payload.Event)
+	if w.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(w.Secret, body))
+	}
+
+	debug.Log("event", "webhook.post", "url", util.Redact(w.URL))
+	resp, err := w.Client.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "post to webhook %s", util.Redact(w.URL))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		message, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return errors.Errorf("post to webhook %s: status %d: %s", util.Redact(w.URL), resp.StatusCode, bytes.TrimSpace(message))
+	}
+	return nil
+}
+
+// Sign returns the value of SignatureHeader for body, so receivers can check a webhook came from ship
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
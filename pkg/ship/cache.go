@@ -0,0 +1,43 @@
+package ship
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/ship/pkg/util"
+)
+
+// PruneCache removes cached upstream versions that haven't been used within olderThan, or everything if it's 0
+func (s *Ship) PruneCache(ctx context.Context, olderThan time.Duration) error {
+	pruned, err := s.Cache.Prune(olderThan)
+	if err != nil {
+		return errors.Wrapf(err, "prune cache in %s", s.Cache.Dir)
+	}
+
+	if len(pruned) == 0 {
+		s.UI.Info("Nothing to prune")
+		return nil
+	}
+
+	var out bytes.Buffer
+	w := tabwriter.NewWriter(&out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "UPSTREAM\tVERSION\tLAST USED")
+	for _, entry := range pruned {
+		version := entry.Version.Name
+		if version == "" {
+			version = shortSHA(entry.Version.ID)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", util.Redact(entry.Upstream), version, entry.LastUsed.Local().Format(time.RFC3339))
+	}
+	if err := w.Flush(); err != nil {
+		return errors.Wrap(err, "format pruned cache entries")
+	}
+
+	s.UI.Output(out.String())
+	s.UI.Info(fmt.Sprintf("Removed %d cached upstream versions", len(pruned)))
+	return nil
+}
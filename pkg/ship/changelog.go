@@ -0,0 +1,51 @@
+package ship
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/ship/pkg/api"
+	"github.com/replicatedhq/ship/pkg/changelog"
+	"github.com/replicatedhq/ship/pkg/constants"
+	"github.com/replicatedhq/ship/pkg/state"
+)
+
+// ChangelogAndMaybeExit runs Changelog, writing the changelog to stdout
+func (s *Ship) ChangelogAndMaybeExit(ctx context.Context) error {
+	if err := s.Changelog(ctx, os.Stdout); err != nil {
+		s.ExitWithError(err)
+		return err
+	}
+	return nil
+}
+
+// Changelog renders the update in a scratch directory like UpdateDryRun, and writes what changed upstream
+// between the base in the working tree and the one the update would render to out
+func (s *Ship) Changelog(ctx context.Context, out io.Writer) error {
+	return s.renderUpdateInScratch(ctx, func(release *api.Release, existingState state.State, workDir, scratchDir string) error {
+		updatedState, err := s.State.TryLoad()
+		if err != nil {
+			return errors.Wrap(err, "load state")
+		}
+		changelogs, err := s.Changelogs.FromState(
+			existingState, filepath.Join(workDir, constants.KustomizeBasePath),
+			updatedState, filepath.Join(scratchDir, constants.KustomizeBasePath),
+		)
+		if err != nil {
+			return errors.Wrap(err, "build changelog")
+		}
+
+		if s.Viper.GetString("output") == "json" {
+			encoder := json.NewEncoder(out)
+			encoder.SetIndent("", "  ")
+			return errors.Wrap(encoder.Encode(changelogs), "write changelog")
+		}
+		_, err = fmt.Fprint(out, changelog.Format(changelogs))
+		return errors.Wrap(err, "write changelog")
+	})
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
 	"github.com/pkg/errors"
+	"github.com/replicatedhq/ship/pkg/changelog"
 	"github.com/replicatedhq/ship/pkg/filetree"
 	"github.com/replicatedhq/ship/pkg/fs"
 	"github.com/replicatedhq/ship/pkg/images"
@@ -42,8 +43,13 @@ import (
 	"github.com/replicatedhq/ship/pkg/patch"
 	"github.com/replicatedhq/ship/pkg/specs"
 	"github.com/replicatedhq/ship/pkg/specs/apptype"
+	"github.com/replicatedhq/ship/pkg/specs/bitbucketclient"
 	"github.com/replicatedhq/ship/pkg/specs/githubclient"
+	"github.com/replicatedhq/ship/pkg/specs/gitlabclient"
+	"github.com/replicatedhq/ship/pkg/specs/helmrepo"
 	"github.com/replicatedhq/ship/pkg/specs/replicatedapp"
+	"github.com/replicatedhq/ship/pkg/specs/upstreamcache"
+	"github.com/replicatedhq/ship/pkg/specs/verify"
 	"github.com/replicatedhq/ship/pkg/state"
 	"github.com/replicatedhq/ship/pkg/templates"
 	"github.com/replicatedhq/ship/pkg/ui"
@@ -101,6 +107,12 @@ func buildInjector(v *viper.Viper) (*dig.Container, error) {
 
 		github.NewRenderer,
 		githubclient.NewGithubClient,
+		gitlabclient.NewGitlabClient,
+		bitbucketclient.NewBitbucketClient,
+		helmrepo.NewClient,
+		upstreamcache.NewCache,
+		verify.NewVerifier,
+		changelog.NewBuilder,
 
 		terraform.NewRenderer,
 
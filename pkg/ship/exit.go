@@ -12,6 +12,13 @@ import (
 	"github.com/replicatedhq/ship/pkg/util/warnings"
 )
 
+const (
+	// ExitCodeError is the exit code when ship fails
+	ExitCodeError = 1
+	// ExitCodeCancelled is the exit code when ship watch is stopped with SIGINT or SIGTERM before it finds an update
+	ExitCodeCancelled = 130
+)
+
 // ExitWithError can be called if something goes wrong to print some friendly output
 func (s *Ship) ExitWithError(err error) {
 	if warnings.IsWarning(err) {
@@ -29,8 +36,12 @@ func (s *Ship) ExitWithError(err error) {
 	time.Sleep(100 * time.Millisecond) // hack, need to wait for flush output from above
 	s.preserveDebugLogsOrRequestReRun()
 
+	s.exit(ExitCodeError)
+}
+
+func (s *Ship) exit(code int) {
 	if !s.Viper.GetBool("no-os-exit") {
-		os.Exit(1)
+		os.Exit(code)
 	}
 }
 
@@ -0,0 +1,349 @@
+package ship
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/ship/pkg/constants"
+	"github.com/replicatedhq/ship/pkg/state"
+	"github.com/replicatedhq/ship/pkg/util"
+	"github.com/spf13/afero"
+)
+
+const (
+	// FleetEventUpdate is emitted for an app with at least one upstream that has changed
+	FleetEventUpdate = "update"
+	// FleetEventError is emitted for an app whose state or upstreams couldn't be read
+	FleetEventError = "error"
+)
+
+// FleetEvent is written to stdout as one line of JSON by `ship watch --fleet`
+type FleetEvent struct {
+	Event     string          `json:"event"`
+	App       string          `json:"app"`
+	StateFile string          `json:"stateFile"`
+	Time      time.Time       `json:"time"`
+	Upstreams []FleetUpstream `json:"upstreams,omitempty"`
+	Error     string          `json:"error,omitempty"`
+}
+
+// FleetUpstream is an upstream of an app that has changed. Name is empty unless the app has several named upstreams.
+type FleetUpstream struct {
+	Name               string `json:"name,omitempty"`
+	Upstream           string `json:"upstream"`
+	PreviousContentSHA string `json:"previousContentSha"`
+	ContentSHA         string `json:"contentSha"`
+}
+
+type fleetApp struct {
+	name      string
+	stateFile string
+	upstreams []state.NamedUpstream
+}
+
+type fleetResult struct {
+	contentSHA string
+	err        error
+}
+
+// fleetWatcher polls the upstreams of every app found under a glob. An upstream shared by several apps is read once per poll.
+type fleetWatcher struct {
+	logger  log.Logger
+	fs      afero.Afero
+	workers int
+	// readSHA reads the content sha of an upstream, fetching it into workDir. Each worker has its own workDir.
+	readSHA func(ctx context.Context, upstream string, workDir string) (string, error)
+	emit    func(event FleetEvent) error
+	metrics *watchMetrics
+	now     func() time.Time
+
+	// reported is the content sha last reported for each upstream of each app, so an update is only reported once
+	reported map[string]string
+	// failed is the error last reported for each app, so a persistent error is only reported once
+	failed map[string]string
+}
+
+// watchFleet polls every app whose state file is found under the --fleet glob, emitting an event for each app
+// that has an update. Unlike watching a single app, it doesn't exit when it finds one.
+func (s *Ship) watchFleet(ctx context.Context, schedule *pollSchedule, metrics *watchMetrics) error {
+	pattern := s.Viper.GetString("fleet")
+	watcher := &fleetWatcher{
+		logger:  s.Logger,
+		fs:      s.FS,
+		workers: s.Viper.GetInt("fleet-workers"),
+		readSHA: s.Resolver.ReadContentSHAForWatchIn,
+		emit: func(event FleetEvent) error {
+			serialized, err := json.Marshal(event)
+			if err != nil {
+				return errors.Wrap(err, "marshal fleet event")
+			}
+			s.UI.Output(string(serialized))
+			return nil
+		},
+		metrics:  metrics,
+		now:      time.Now,
+		reported: map[string]string{},
+		failed:   map[string]string{},
+	}
+
+	for {
+		if err := watcher.poll(ctx, pattern); err != nil {
+			return err
+		}
+
+		wait := schedule.afterSuccess()
+		level.Debug(s.Logger).Log("event", "fleet.polled", "sleeping", wait)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// poll reads the upstreams of every app in the fleet once
+func (w *fleetWatcher) poll(ctx context.Context, pattern string) error {
+	debug := level.Debug(log.With(w.logger, "struct", "fleetWatcher", "method", "poll"))
+
+	stateFiles, err := discoverFleet(w.fs, pattern)
+	if err != nil {
+		return errors.Wrapf(err, "discover state files matching %s", pattern)
+	}
+	if len(stateFiles) == 0 {
+		return errors.Errorf(`No state files found matching %s, please run "ship init" for each app`, pattern)
+	}
+
+	var apps []fleetApp
+	var upstreams []string
+	seen := map[string]bool{}
+	for _, stateFile := range stateFiles {
+		app, err := loadFleetApp(w.fs, stateFile)
+		if err != nil {
+			if err := w.reportError(fleetAppName(stateFile), stateFile, err.Error()); err != nil {
+				return err
+			}
+			continue
+		}
+		apps = append(apps, app)
+
+		for _, upstream := range app.upstreams {
+			if !seen[upstream.Upstream] {
+				seen[upstream.Upstream] = true
+				upstreams = append(upstreams, upstream.Upstream)
+			}
+		}
+	}
+
+	debug.Log("event", "fleet.discovered", "apps", len(stateFiles), "upstreams", len(upstreams))
+	results := w.readAll(ctx, upstreams)
+
+	for _, app := range apps {
+		if err := w.compare(app, results); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readAll reads the content sha of each upstream with a pool of workers.
+// Upstreams that weren't read before ctx was cancelled are left out.
+func (w *fleetWatcher) readAll(ctx context.Context, upstreams []string) map[string]fleetResult {
+	debug := level.Debug(log.With(w.logger, "struct", "fleetWatcher", "method", "readAll"))
+
+	workers := w.workers
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(upstreams) {
+		workers = len(upstreams)
+	}
+
+	jobs := make(chan string)
+	results := make(map[string]fleetResult, len(upstreams))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for i := 0; i < workers; i++ {
+		workDir := path.Join(constants.ShipPathInternalTmp, "fleet", strconv.Itoa(i))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for upstream := range jobs {
+				contentSHA, err := w.readSHA(ctx, upstream, workDir)
+				if removeErr := w.fs.RemoveAll(workDir); removeErr != nil {
+					debug.Log("event", "workDir.remove.fail", "workDir", workDir, "err", removeErr)
+				}
+				debug.Log("event", "sha.read", "upstream", util.Redact(upstream), "sha", contentSHA, "err", err)
+				w.metrics.observe("", upstream, contentSHA, err, w.now())
+
+				mu.Lock()
+				results[upstream] = fleetResult{contentSHA: contentSHA, err: err}
+				mu.Unlock()
+			}
+		}()
+	}
+
+send:
+	for _, upstream := range upstreams {
+		select {
+		case jobs <- upstream:
+		case <-ctx.Done():
+			break send
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	return results
+}
+
+// compare emits an update event if any of the app's upstreams have changed since it was last updated,
+// or an error event if any couldn't be read
+func (w *fleetWatcher) compare(app fleetApp, results map[string]fleetResult) error {
+	var updated []FleetUpstream
+	var failures []string
+
+	for _, upstream := range app.upstreams {
+		result, ok := results[upstream.Upstream]
+		if !ok {
+			continue
+		}
+
+		if result.err != nil {
+			failures = append(failures, fmt.Sprintf("read content SHA of %s: %s", util.Redact(upstream.Upstream), util.Redact(result.err.Error())))
+			continue
+		}
+
+		key := app.stateFile + "\x00" + upstream.Name
+		if result.contentSHA == upstream.ContentSHA || w.reported[key] == result.contentSHA {
+			continue
+		}
+		w.reported[key] = result.contentSHA
+		updated = append(updated, FleetUpstream{
+			Name:               upstream.Name,
+			Upstream:           util.Redact(upstream.Upstream),
+			PreviousContentSHA: upstream.ContentSHA,
+			ContentSHA:         result.contentSHA,
+		})
+	}
+
+	if len(failures) > 0 {
+		if err := w.reportError(app.name, app.stateFile, strings.Join(failures, "; ")); err != nil {
+			return err
+		}
+	} else {
+		delete(w.failed, app.stateFile)
+	}
+
+	if len(updated) == 0 {
+		return nil
+	}
+	return w.emit(FleetEvent{
+		Event:     FleetEventUpdate,
+		App:       app.name,
+		StateFile: app.stateFile,
+		Time:      w.now(),
+		Upstreams: updated,
+	})
+}
+
+func (w *fleetWatcher) reportError(app, stateFile, message string) error {
+	if w.failed[stateFile] == message {
+		return nil
+	}
+	w.failed[stateFile] = message
+	return w.emit(FleetEvent{
+		Event:     FleetEventError,
+		App:       app,
+		StateFile: stateFile,
+		Time:      w.now(),
+		Error:     message,
+	})
+}
+
+// discoverFleet finds every .ship/state.json in or under the paths matching pattern
+func discoverFleet(fs afero.Afero, pattern string) ([]string, error) {
+	matches, err := afero.Glob(fs, pattern)
+	if err != nil {
+		return nil, errors.Wrap(err, "glob")
+	}
+
+	found := map[string]bool{}
+	for _, match := range matches {
+		err := fs.Walk(match, func(walked string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() {
+				// fetched upstreams are kept in .ship/tmp
+				if info.Name() == ".git" || (info.Name() == "tmp" && filepath.Base(filepath.Dir(walked)) == ".ship") {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if info.Name() == "state.json" && filepath.Base(filepath.Dir(walked)) == ".ship" {
+				found[walked] = true
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "walk %s", match)
+		}
+	}
+
+	stateFiles := make([]string, 0, len(found))
+	for stateFile := range found {
+		stateFiles = append(stateFiles, stateFile)
+	}
+	sort.Strings(stateFiles)
+	return stateFiles, nil
+}
+
+func loadFleetApp(fs afero.Afero, stateFile string) (fleetApp, error) {
+	app := fleetApp{name: fleetAppName(stateFile), stateFile: stateFile}
+
+	loaded, err := state.LoadFile(fs, stateFile)
+	if err != nil {
+		return app, err
+	}
+	if _, empty := loaded.(state.Empty); empty {
+		return app, errors.Errorf(`No state found at %s, please run "ship init"`, stateFile)
+	}
+
+	versioned := loaded.Versioned()
+	if len(versioned.V2.Upstreams) > 0 {
+		for _, upstream := range versioned.V2.Upstreams {
+			if upstream.ContentSHA == "" {
+				return app, errors.Errorf(`No current SHA for upstream %s found at %s, please run "ship update"`, upstream.Name, stateFile)
+			}
+		}
+		app.upstreams = versioned.V2.Upstreams
+		return app, nil
+	}
+
+	if loaded.Upstream() == "" {
+		return app, errors.Errorf(`No current chart url found at %s, please run "ship init"`, stateFile)
+	}
+	if versioned.V2.ContentSHA == "" {
+		return app, errors.Errorf(`No current SHA found at %s, please run "ship init"`, stateFile)
+	}
+	app.upstreams = []state.NamedUpstream{{Upstream: loaded.Upstream(), ContentSHA: versioned.V2.ContentSHA}}
+	return app, nil
+}
+
+// fleetAppName is the directory an app's .ship directory is in
+func fleetAppName(stateFile string) string {
+	return filepath.Dir(filepath.Dir(stateFile))
+}
@@ -0,0 +1,582 @@
+package ship
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/mitchellh/go-homedir"
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/ship/pkg/api"
+	"github.com/replicatedhq/ship/pkg/changelog"
+	"github.com/replicatedhq/ship/pkg/constants"
+	"github.com/replicatedhq/ship/pkg/state"
+	"github.com/replicatedhq/ship/pkg/util"
+	"gopkg.in/src-d/go-git.v4"
+	gitconfig "gopkg.in/src-d/go-git.v4/config"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/filemode"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/config"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/index"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/http"
+)
+
+const (
+	defaultGitAuthorName  = "Replicated Ship"
+	defaultGitAuthorEmail = "ship@replicated.com"
+)
+
+var branchNameUnsafe = regexp.MustCompile(`[^A-Za-z0-9._/-]+`)
+
+// updatedUpstream is an upstream as ship update left it, for the git commit message and branch name
+type updatedUpstream struct {
+	Name         string
+	Upstream     string
+	Version      string
+	ContentSHA   string
+	ReleaseNotes string
+	// Changes is what changed between the base the update replaced and the new one
+	Changes *changelog.Changelog
+}
+
+// label is the upstream's version, or its short content SHA if it isn't versioned
+func (u updatedUpstream) label() string {
+	if u.Version != "" {
+		return u.Version
+	}
+	if len(u.ContentSHA) > 12 {
+		return u.ContentSHA[:12]
+	}
+	return u.ContentSHA
+}
+
+// gitUpdate is what --git-commit commits to a new branch after a successful update
+type gitUpdate struct {
+	Branch  string
+	Message string
+	// Paths are the files and directories to stage, relative to the working directory
+	Paths  []string
+	Author *object.Signature
+}
+
+// commitUpdate commits the state, base and rendered output that ship update changed to a new branch
+// named for the upstream version, and pushes the branch with --git-push
+func (s *Ship) commitUpdate(ctx context.Context, release *api.Release, existingState state.State) error {
+	debug := level.Debug(log.With(s.Logger, "method", "commitUpdate"))
+
+	currentState, err := s.State.TryLoad()
+	if err != nil {
+		return errors.Wrap(err, "load state")
+	}
+	upstreams := s.updatedUpstreams(ctx, release, currentState)
+	s.addChanges(upstreams, existingState, currentState)
+
+	workDir, err := os.Getwd()
+	if err != nil {
+		return errors.Wrap(err, "get working directory")
+	}
+	repo, err := git.PlainOpenWithOptions(workDir, &git.PlainOpenOptions{DetectDotGit: true})
+	if err != nil {
+		return errors.Wrap(err, "open git repository")
+	}
+
+	branch := s.Viper.GetString("git-branch")
+	if branch == "" {
+		branch = updateBranchName(upstreams)
+	}
+	author, err := gitAuthor(repo)
+	if err != nil {
+		return err
+	}
+	update := gitUpdate{
+		Branch:  branch,
+		Message: updateCommitMessage(upstreams),
+		Paths:   updatePaths(release, currentState),
+		Author:  author,
+	}
+
+	debug.Log("event", "commit", "branch", update.Branch, "paths", strings.Join(update.Paths, ","))
+	staged, err := commitToBranch(repo, workDir, update)
+	if err != nil {
+		return errors.Wrapf(err, "commit to branch %s", update.Branch)
+	}
+	if staged == 0 {
+		s.UI.Info("No changes to commit")
+		return nil
+	}
+	s.UI.Info(fmt.Sprintf("Committed %d changed files to branch %s", staged, update.Branch))
+
+	if !s.Viper.GetBool("git-push") {
+		return nil
+	}
+	remote := s.Viper.GetString("git-remote")
+	if err := s.pushBranch(ctx, repo, remote, update.Branch); err != nil {
+		return errors.Wrapf(err, "push branch %s to %s", update.Branch, remote)
+	}
+	s.UI.Info(fmt.Sprintf("Pushed branch %s to %s", update.Branch, remote))
+	return nil
+}
+
+// updatedUpstreams reads the version, content SHA and release notes of each upstream from the updated state,
+// preferring release notes that came with the release and looking them up with the upstream's host otherwise
+func (s *Ship) updatedUpstreams(ctx context.Context, release *api.Release, currentState state.State) []updatedUpstream {
+	v2 := currentState.Versioned().V2
+
+	if len(v2.Upstreams) > 0 {
+		upstreams := make([]updatedUpstream, 0, len(v2.Upstreams))
+		for _, named := range v2.Upstreams {
+			upstream := updatedUpstream{
+				Name:       named.Name,
+				Upstream:   named.Upstream,
+				Version:    named.UpstreamVersion,
+				ContentSHA: named.ContentSHA,
+			}
+			if named.Metadata != nil {
+				if upstream.Version == "" {
+					upstream.Version = named.Metadata.Version
+				}
+				upstream.ReleaseNotes = named.Metadata.ReleaseNotes
+			}
+			if upstream.ReleaseNotes == "" {
+				upstream.ReleaseNotes = s.Resolver.ResolveReleaseNotes(ctx, named.Upstream)
+			}
+			upstreams = append(upstreams, upstream)
+		}
+		return upstreams
+	}
+
+	upstream := updatedUpstream{
+		Name:         release.Metadata.ShipAppMetadata.Name,
+		Upstream:     currentState.Upstream(),
+		Version:      v2.UpstreamVersion,
+		ContentSHA:   v2.ContentSHA,
+		ReleaseNotes: release.Metadata.ReleaseNotes,
+	}
+	if v2.Metadata != nil {
+		if upstream.Name == "" {
+			upstream.Name = v2.Metadata.Name
+		}
+		if upstream.Version == "" {
+			upstream.Version = v2.Metadata.Version
+		}
+		if upstream.ReleaseNotes == "" {
+			upstream.ReleaseNotes = v2.Metadata.ReleaseNotes
+		}
+	}
+	if upstream.Version == "" {
+		upstream.Version = release.Metadata.ShipAppMetadata.Version
+	}
+	if upstream.Version == "" {
+		upstream.Version = release.Metadata.Semver
+	}
+	if upstream.ContentSHA == "" {
+		upstream.ContentSHA = release.Metadata.ShipAppMetadata.ContentSHA
+	}
+	if upstream.ReleaseNotes == "" {
+		upstream.ReleaseNotes = release.Metadata.ShipAppMetadata.ReleaseNotes
+	}
+	if upstream.ReleaseNotes == "" {
+		upstream.ReleaseNotes = s.Resolver.ResolveReleaseNotes(ctx, upstream.Upstream)
+	}
+	return []updatedUpstream{upstream}
+}
+
+// addChanges compares the base the update moved to constants.PreviousBasePath with the new one. The changelog
+// only adds to the commit message, so the commit goes ahead without it if it can't be built.
+func (s *Ship) addChanges(upstreams []updatedUpstream, existingState state.State, currentState state.State) {
+	changelogs, err := s.Changelogs.FromState(existingState, constants.PreviousBasePath, currentState, constants.KustomizeBasePath)
+	if err != nil {
+		s.UI.Warn(fmt.Sprintf("Failed to build a changelog for the commit message: %s", err.Error()))
+		return
+	}
+	for i := range upstreams {
+		for _, changes := range changelogs {
+			if changes.Name == upstreams[i].Name || len(changelogs) == 1 {
+				upstreams[i].Changes = changes
+				break
+			}
+		}
+	}
+}
+
+// updateBranchName is ship/update-<version>, or ship/update-<name>-<version>-... for an application composed
+// of several upstreams, with the short content SHA standing in for upstreams that aren't versioned
+func updateBranchName(upstreams []updatedUpstream) string {
+	var parts []string
+	for _, upstream := range upstreams {
+		if len(upstreams) > 1 {
+			parts = append(parts, upstream.Name)
+		}
+		parts = append(parts, upstream.label())
+	}
+
+	name := branchNameUnsafe.ReplaceAllString(strings.Join(parts, "-"), "-")
+	name = strings.Trim(strings.Replace(name, "..", ".", -1), "-./")
+	if name == "" {
+		return fmt.Sprintf("ship/update-%d", time.Now().Unix())
+	}
+	return "ship/update-" + name
+}
+
+// updateCommitMessage summarizes the update on its first line, followed by each upstream's release notes and changelog
+func updateCommitMessage(upstreams []updatedUpstream) string {
+	var summaries []string
+	for _, upstream := range upstreams {
+		name := upstream.Name
+		if name == "" {
+			name = util.Redact(upstream.Upstream)
+		}
+		summaries = append(summaries, fmt.Sprintf("%s to %s", name, upstream.label()))
+	}
+
+	message := "Update " + strings.Join(summaries, ", ") + "\n"
+	for _, upstream := range upstreams {
+		message += "\n"
+		if upstream.Name != "" && len(upstreams) > 1 {
+			message += upstream.Name + "\n"
+		}
+		message += fmt.Sprintf("Upstream: %s\n", util.Redact(upstream.Upstream))
+		if upstream.Version != "" {
+			message += fmt.Sprintf("Version: %s\n", upstream.Version)
+		}
+		if upstream.ContentSHA != "" {
+			message += fmt.Sprintf("Content SHA: %s\n", upstream.ContentSHA)
+		}
+		if notes := strings.TrimSpace(upstream.ReleaseNotes); notes != "" {
+			message += "\n" + notes + "\n"
+		}
+		if upstream.Changes != nil && !upstream.Changes.Empty() {
+			message += "\n" + upstream.Changes.String()
+		}
+	}
+	return message
+}
+
+// updatePaths are the state file, the base, and the rendered output of each kustomize step, environment overlay and helm hook event
+func updatePaths(release *api.Release, currentState state.State) []string {
+	paths := []string{constants.StatePath, constants.StateHistoryPath, constants.KustomizeBasePath}
+
+	var environments []string
+	if kustomizeState := currentState.CurrentKustomize(); kustomizeState != nil {
+		environments = kustomizeState.EnvironmentOverlays()
+	}
+
+	root := kustomizeRoot(release)
+	for _, step := range release.Spec.Lifecycle.V1 {
+		if step.Kustomize == nil {
+			continue
+		}
+		if step.Kustomize.Base != "" && filepath.Clean(step.Kustomize.Base) != constants.KustomizeBasePath {
+			paths = append(paths, step.Kustomize.Base)
+		}
+		if step.Kustomize.Dest == "" {
+			continue
+		}
+		paths = append(paths, filepath.Join(root, step.Kustomize.Dest))
+		for _, name := range environments {
+			paths = append(paths, filepath.Join(root, step.Kustomize.EnvironmentDest(name)))
+		}
+		if step.Kustomize.Hooks != "" {
+			paths = append(paths, filepath.Join(root, step.Kustomize.Hooks))
+			for _, event := range api.HelmHookEvents {
+				paths = append(paths, filepath.Join(root, step.Kustomize.HookDest(event)))
+			}
+		}
+	}
+	return paths
+}
+
+// commitToBranch creates update.Branch from HEAD, keeping the working tree as it is, and commits whatever changed
+// under update.Paths to it. It returns the number of files staged, and creates no branch if nothing changed.
+func commitToBranch(repo *git.Repository, workDir string, update gitUpdate) (int, error) {
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return 0, errors.Wrap(err, "get worktree")
+	}
+
+	// paths in the repo are relative to its root, which the working directory may be below
+	prefix, err := filepath.Rel(worktree.Filesystem.Root(), workDir)
+	if err != nil {
+		return 0, errors.Wrap(err, "find working directory in repository")
+	}
+	var prefixes []string
+	for _, path := range update.Paths {
+		prefixes = append(prefixes, filepath.ToSlash(filepath.Join(prefix, path)))
+	}
+
+	status, err := worktree.Status()
+	if err != nil {
+		return 0, errors.Wrap(err, "get worktree status")
+	}
+	var changed, unrelated []string
+	for path, fileStatus := range status {
+		if fileStatus.Worktree == git.Unmodified && fileStatus.Staging == git.Unmodified {
+			continue
+		}
+		if underAny(path, prefixes) {
+			changed = append(changed, path)
+		} else if fileStatus.Staging != git.Unmodified && fileStatus.Staging != git.Untracked {
+			unrelated = append(unrelated, path)
+		}
+	}
+	if len(changed) == 0 {
+		return 0, nil
+	}
+	// the whole index is committed, so anything else that's staged would end up in the update's commit
+	if len(unrelated) > 0 {
+		sort.Strings(unrelated)
+		return 0, errors.Errorf("changes to %s are staged, commit or unstage them before committing the update", strings.Join(unrelated, ", "))
+	}
+	sort.Strings(changed)
+
+	if err := createBranch(repo, plumbing.NewBranchReferenceName(update.Branch)); err != nil {
+		return 0, errors.Wrap(err, "create branch")
+	}
+
+	if err := stage(repo, worktree, changed); err != nil {
+		return 0, err
+	}
+
+	if _, err := worktree.Commit(update.Message, &git.CommitOptions{Author: update.Author}); err != nil {
+		return 0, errors.Wrap(err, "commit")
+	}
+	return len(changed), nil
+}
+
+// createBranch points a new branch at HEAD's commit and checks it out. The branch starts where HEAD is, so the index
+// and working tree are left as they are, which worktree.Checkout would otherwise reset.
+func createBranch(repo *git.Repository, branch plumbing.ReferenceName) error {
+	if _, err := repo.Reference(branch, false); err == nil {
+		return errors.Errorf("a branch named %q already exists", branch.Short())
+	} else if err != plumbing.ErrReferenceNotFound {
+		return errors.Wrapf(err, "look up branch %s", branch.Short())
+	}
+
+	head, err := repo.Head()
+	if err != nil {
+		return errors.Wrap(err, "resolve HEAD")
+	}
+	if err := repo.Storer.SetReference(plumbing.NewHashReference(branch, head.Hash())); err != nil {
+		return errors.Wrapf(err, "set branch %s", branch.Short())
+	}
+	if err := repo.Storer.SetReference(plumbing.NewSymbolicReference(plumbing.HEAD, branch)); err != nil {
+		return errors.Wrap(err, "set HEAD")
+	}
+	return nil
+}
+
+func underAny(path string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if path == prefix || strings.HasPrefix(path, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// stage adds each of paths to the index, or removes it if it was deleted, and writes the index once.
+// worktree.Add can't be used, it reads the status of the whole working tree for each path.
+func stage(repo *git.Repository, worktree *git.Worktree, paths []string) error {
+	idx, err := repo.Storer.Index()
+	if err != nil {
+		return errors.Wrap(err, "read index")
+	}
+
+	for _, path := range paths {
+		info, err := worktree.Filesystem.Lstat(path)
+		if os.IsNotExist(err) {
+			if _, err := idx.Remove(path); err != nil && err != index.ErrEntryNotFound {
+				return errors.Wrapf(err, "unstage %s", path)
+			}
+			continue
+		}
+		if err != nil {
+			return errors.Wrapf(err, "stat %s", path)
+		}
+
+		hash, err := writeBlob(repo, worktree, path, info)
+		if err != nil {
+			return errors.Wrapf(err, "stage %s", path)
+		}
+		entry, err := idx.Entry(path)
+		if err == index.ErrEntryNotFound {
+			entry = idx.Add(path)
+		} else if err != nil {
+			return errors.Wrapf(err, "stage %s", path)
+		}
+		entry.Hash = hash
+		entry.ModifiedAt = info.ModTime()
+		if entry.Mode, err = filemode.NewFromOSFileMode(info.Mode()); err != nil {
+			return errors.Wrapf(err, "stage %s", path)
+		}
+		if entry.Mode.IsRegular() {
+			entry.Size = uint32(info.Size())
+		}
+	}
+
+	return errors.Wrap(repo.Storer.SetIndex(idx), "write index")
+}
+
+// writeBlob stores the contents of the file at path, or the target of the symlink at path, as a blob
+func writeBlob(repo *git.Repository, worktree *git.Worktree, path string, info os.FileInfo) (plumbing.Hash, error) {
+	var contents []byte
+	if info.Mode()&os.ModeSymlink != 0 {
+		target, err := worktree.Filesystem.Readlink(path)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+		contents = []byte(target)
+	} else {
+		file, err := worktree.Filesystem.Open(path)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+		contents, err = ioutil.ReadAll(file)
+		file.Close()
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+	}
+
+	obj := repo.Storer.NewEncodedObject()
+	obj.SetType(plumbing.BlobObject)
+	obj.SetSize(int64(len(contents)))
+	writer, err := obj.Writer()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	if _, err := writer.Write(contents); err != nil {
+		writer.Close()
+		return plumbing.ZeroHash, err
+	}
+	if err := writer.Close(); err != nil {
+		return plumbing.ZeroHash, err
+	}
+	return repo.Storer.SetEncodedObject(obj)
+}
+
+// gitAuthor is taken from GIT_AUTHOR_NAME and GIT_AUTHOR_EMAIL, then the repository's config, then ~/.gitconfig
+func gitAuthor(repo *git.Repository) (*object.Signature, error) {
+	author := &object.Signature{
+		Name:  os.Getenv("GIT_AUTHOR_NAME"),
+		Email: os.Getenv("GIT_AUTHOR_EMAIL"),
+		When:  time.Now(),
+	}
+
+	repoConfig, err := repo.Config()
+	if err != nil {
+		return nil, errors.Wrap(err, "read git config")
+	}
+	configs := []*config.Config{repoConfig.Raw}
+	if home, err := homedir.Dir(); err == nil {
+		if global, err := readGitConfig(filepath.Join(home, ".gitconfig")); err == nil {
+			configs = append(configs, global)
+		}
+	}
+
+	for _, cfg := range configs {
+		user := cfg.Section("user")
+		if author.Name == "" {
+			author.Name = user.Option("name")
+		}
+		if author.Email == "" {
+			author.Email = user.Option("email")
+		}
+	}
+
+	if author.Name == "" {
+		author.Name = defaultGitAuthorName
+	}
+	if author.Email == "" {
+		author.Email = defaultGitAuthorEmail
+	}
+	return author, nil
+}
+
+func readGitConfig(path string) (*config.Config, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	cfg := config.New()
+	if err := config.NewDecoder(file).Decode(cfg); err != nil {
+		return nil, errors.Wrapf(err, "decode %s", path)
+	}
+	return cfg, nil
+}
+
+// pushBranch pushes branch to remote. Remotes on GitHub, GitLab and Bitbucket over https are authenticated
+// with the token used to fetch upstreams from there, and ssh remotes with the ssh agent.
+func (s *Ship) pushBranch(ctx context.Context, repo *git.Repository, remoteName string, branch string) error {
+	remote, err := repo.Remote(remoteName)
+	if err != nil {
+		return errors.Wrapf(err, "get remote %s", remoteName)
+	}
+
+	var auth transport.AuthMethod
+	if urls := remote.Config().URLs; len(urls) > 0 {
+		auth = s.gitPushAuth(urls[0])
+	}
+
+	ref := plumbing.NewBranchReferenceName(branch)
+	return repo.PushContext(ctx, &git.PushOptions{
+		RemoteName: remoteName,
+		RefSpecs:   []gitconfig.RefSpec{gitconfig.RefSpec(fmt.Sprintf("%s:%s", ref, ref))},
+		Auth:       auth,
+	})
+}
+
+// gitPushAuth returns the token auth for remoteURL if its host is exactly github.com, gitlab.com, bitbucket.org or the
+// host set with --github-base-url or --gitlab-base-url, and nil for any other remote
+func (s *Ship) gitPushAuth(remoteURL string) transport.AuthMethod {
+	endpoint, err := transport.NewEndpoint(remoteURL)
+	if err != nil || (endpoint.Protocol != "https" && endpoint.Protocol != "http") || endpoint.User != "" {
+		return nil
+	}
+	host := endpoint.Host
+	if endpoint.Port != 0 {
+		host = net.JoinHostPort(endpoint.Host, strconv.Itoa(endpoint.Port))
+	}
+
+	var username, token string
+	switch {
+	case host == "github.com" || host == "www.github.com" || host == s.configuredHost("github-base-url"):
+		username, token = "x-access-token", s.Viper.GetString("github-token")
+	case host == "gitlab.com" || host == s.configuredHost("gitlab-base-url"):
+		username, token = "oauth2", s.Viper.GetString("gitlab-token")
+	case host == "bitbucket.org":
+		username, token = "x-token-auth", s.Viper.GetString("bitbucket-token")
+	}
+	if token == "" {
+		return nil
+	}
+	return &http.BasicAuth{Username: username, Password: token}
+}
+
+// configuredHost is the host of the base URL set with the flag key, or "" if it isn't set
+func (s *Ship) configuredHost(key string) string {
+	baseURL := s.Viper.GetString(key)
+	if baseURL == "" {
+		return ""
+	}
+	parsed, err := url.Parse(baseURL)
+	if err != nil {
+		return ""
+	}
+	return parsed.Host
+}
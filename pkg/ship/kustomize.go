@@ -9,6 +9,7 @@ import (
 	"github.com/go-kit/kit/log/level"
 	"github.com/pkg/errors"
 	"github.com/replicatedhq/ship/pkg/api"
+	"github.com/replicatedhq/ship/pkg/lifecycle/kustomize"
 	"github.com/replicatedhq/ship/pkg/specs"
 	"github.com/replicatedhq/ship/pkg/state"
 	"github.com/replicatedhq/ship/pkg/util/warnings"
@@ -40,6 +41,12 @@ func (s *Ship) Init(ctx context.Context) error {
 	ctx, cancelFunc := context.WithCancel(ctx)
 	defer s.Shutdown(cancelFunc)
 
+	unlock, err := s.lockState()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
 	if s.Viper.GetString("raw") != "" {
 		release := s.fakeKustomizeRawRelease()
 		return s.execute(ctx, release, nil, true)
@@ -62,19 +69,120 @@ func (s *Ship) Init(ctx context.Context) error {
 		}
 	}
 
+	release, err := s.resolveInitRelease(ctx)
+	if err != nil {
+		return errors.Wrap(err, "resolve release")
+	}
+
+	release.Spec.Lifecycle = s.IDPatcher.EnsureAllStepsHaveUniqueIDs(release.Spec.Lifecycle)
+
+	if err := s.ensureOverlay(); err != nil {
+		return errors.Wrap(err, "ensure overlay")
+	}
+
+	if dir := s.Viper.GetString("adopt-overlay"); dir != "" {
+		if err := s.adoptOverlay(dir); err != nil {
+			return errors.Wrapf(err, "adopt overlay %s", dir)
+		}
+	}
+
+	if err := s.maybeWatchLocal(ctx); err != nil {
+		return errors.Wrap(err, "watch local upstream")
+	}
+
+	return s.execute(ctx, release, nil, true)
+}
+
+// resolveInitRelease resolves the upstream passed to init, or each of the named upstreams
+// of an application composed of several
+func (s *Ship) resolveInitRelease(ctx context.Context) (*api.Release, error) {
+	if named := s.Viper.GetStringSlice("upstreams"); len(named) > 0 {
+		upstreams, err := specs.ParseNamedUpstreams(named)
+		if err != nil {
+			return nil, err
+		}
+		return s.Resolver.ResolveUpstreams(ctx, upstreams)
+	}
+
 	// we already check in the CMD, but no harm in being extra safe here
 	target := s.Viper.GetString("upstream")
 	if target == "" {
-		return errors.New("No upstream provided")
+		return nil, errors.New("No upstream provided")
 	}
 
-	release, err := s.Resolver.ResolveRelease(ctx, target)
+	return s.Resolver.ResolveRelease(ctx, target)
+}
+
+// adoptOverlay imports a hand-maintained overlay directory into the --overlay overlay in state.
+// Its patches are checked against the rendered base once the kustomize step runs.
+func (s *Ship) adoptOverlay(dir string) error {
+	debug := level.Debug(log.With(s.Logger, "method", "adoptOverlay"))
+
+	overlay, err := kustomize.ReadOverlayDir(s.FS, dir)
 	if err != nil {
-		return errors.Wrap(err, "resolve release")
+		return err
 	}
 
-	release.Spec.Lifecycle = s.IDPatcher.EnsureAllStepsHaveUniqueIDs(release.Spec.Lifecycle)
-	return s.execute(ctx, release, nil, true)
+	overlayName := s.Viper.GetString("overlay")
+	if overlayName == "" {
+		overlayName = state.ShipOverlay
+	}
+	if err := api.ValidateOverlayName(overlayName); err != nil {
+		return err
+	}
+
+	currentState, err := s.State.TryLoad()
+	if err != nil {
+		return errors.Wrap(err, "load state")
+	}
+
+	kustomizeState := currentState.CurrentKustomize()
+	if kustomizeState == nil {
+		kustomizeState = &state.Kustomize{}
+	}
+	if kustomizeState.Overlays == nil {
+		kustomizeState.Overlays = map[string]state.Overlay{}
+	}
+
+	debug.Log("event", "overlay.adopt", "overlay", overlayName, "patches", len(overlay.Patches), "resources", len(overlay.Resources))
+	overlay.Metadata = &state.OverlayMetadata{AdoptedFrom: dir}
+	kustomizeState.Overlays[overlayName] = overlay
+	return s.State.SaveKustomize(kustomizeState)
+}
+
+// ensureOverlay adds the environment overlay requested with --overlay to state if it isn't there yet,
+// so the kustomize step will write and build it even before it has any patches
+func (s *Ship) ensureOverlay() error {
+	debug := level.Debug(log.With(s.Logger, "method", "ensureOverlay"))
+
+	overlayName := s.Viper.GetString("overlay")
+	if overlayName == "" || overlayName == state.ShipOverlay {
+		return nil
+	}
+	if err := api.ValidateOverlayName(overlayName); err != nil {
+		return err
+	}
+
+	currentState, err := s.State.TryLoad()
+	if err != nil {
+		return errors.Wrap(err, "load state")
+	}
+
+	kustomize := currentState.CurrentKustomize()
+	if kustomize == nil {
+		kustomize = &state.Kustomize{}
+	}
+	if kustomize.Overlays == nil {
+		kustomize.Overlays = map[string]state.Overlay{}
+	}
+
+	if _, ok := kustomize.Overlays[overlayName]; ok {
+		return nil
+	}
+
+	debug.Log("event", "overlay.create", "overlay", overlayName)
+	kustomize.Overlays[overlayName] = state.NewOverlay()
+	return s.State.SaveKustomize(kustomize)
 }
 
 func (s *Ship) promptToRemoveState() error {
@@ -13,6 +13,7 @@ import (
 	"github.com/mitchellh/cli"
 	"github.com/pkg/errors"
 	"github.com/replicatedhq/ship/pkg/api"
+	"github.com/replicatedhq/ship/pkg/changelog"
 	"github.com/replicatedhq/ship/pkg/constants"
 	"github.com/replicatedhq/ship/pkg/helpers/flags"
 	"github.com/replicatedhq/ship/pkg/lifecycle"
@@ -20,6 +21,7 @@ import (
 	"github.com/replicatedhq/ship/pkg/specs"
 	"github.com/replicatedhq/ship/pkg/specs/apptype"
 	"github.com/replicatedhq/ship/pkg/specs/replicatedapp"
+	"github.com/replicatedhq/ship/pkg/specs/upstreamcache"
 	"github.com/replicatedhq/ship/pkg/state"
 	"github.com/replicatedhq/ship/pkg/util"
 	"github.com/replicatedhq/ship/pkg/version"
@@ -53,6 +55,8 @@ type Ship struct {
 	IDPatcher        *specs.IDPatcher
 	FS               afero.Afero
 	Uploader         util.AssetUploader
+	Cache            *upstreamcache.Cache
+	Changelogs       *changelog.Builder
 
 	KustomizeRaw string
 	Runner       *lifecycle.Runner
@@ -73,6 +77,8 @@ func NewShip(
 	fs afero.Afero,
 	inspector apptype.Inspector,
 	uploader util.AssetUploader,
+	cache *upstreamcache.Cache,
+	changelogs *changelog.Builder,
 ) (*Ship, error) {
 
 	return &Ship{
@@ -100,6 +106,8 @@ func NewShip(
 		FS:               fs,
 		StateManager:     stateManager,
 		Uploader:         uploader,
+		Cache:            cache,
+		Changelogs:       changelogs,
 	}, nil
 }
 
@@ -178,6 +186,12 @@ func (s *Ship) Execute(ctx context.Context) error {
 
 	debug.Log("phase", "validate-inputs", "status", "complete")
 
+	unlock, err := s.lockState()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
 	selector := &replicatedapp.Selector{
 		CustomerID:     s.CustomerID,
 		ReleaseSemver:  s.ReleaseSemver,
@@ -0,0 +1,400 @@
+package ship
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/pmezard/go-difflib/difflib"
+	"github.com/replicatedhq/libyaml"
+	"github.com/replicatedhq/ship/pkg/api"
+	"github.com/replicatedhq/ship/pkg/constants"
+	"github.com/replicatedhq/ship/pkg/state"
+	"gopkg.in/yaml.v2"
+)
+
+// RekeyState re-encrypts the sensitive values in state with the key in --new-key-file
+func (s *Ship) RekeyState(ctx context.Context) error {
+	debug := level.Debug(log.With(s.Logger, "method", "RekeyState"))
+
+	newKeyFile := s.Viper.GetString("new-key-file")
+	if newKeyFile == "" {
+		return errors.New("please provide the new key with --new-key-file")
+	}
+
+	unlock, err := s.lockState()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	debug.Log("event", "newKey.read", "path", newKeyFile)
+	newKey, err := s.FS.ReadFile(newKeyFile)
+	if err != nil {
+		return errors.Wrapf(err, "read new key file %s", newKeyFile)
+	}
+
+	if err := s.State.Rekey(string(newKey)); err != nil {
+		return errors.Wrap(err, "rekey state")
+	}
+
+	s.UI.Info("State re-encrypted, use the new key for future ship runs")
+	return nil
+}
+
+// StateHistory prints the previous versions of state that can be rolled back to
+func (s *Ship) StateHistory(ctx context.Context) error {
+	entries, err := s.State.History()
+	if err != nil {
+		return errors.Wrap(err, "load state history")
+	}
+
+	if len(entries) == 0 {
+		s.UI.Info("No state history has been recorded yet")
+		return nil
+	}
+
+	var out bytes.Buffer
+	w := tabwriter.NewWriter(&out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "ENTRY\tTIMESTAMP\tCONTENT SHA\tREASON")
+	for i, entry := range entries {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", i+1, entry.Timestamp.Local().Format(time.RFC3339), shortSHA(entry.ContentSHA), entry.Reason)
+	}
+	if err := w.Flush(); err != nil {
+		return errors.Wrap(err, "format state history")
+	}
+
+	s.UI.Output(out.String())
+	return nil
+}
+
+// StateDiff prints a unified diff between two versions of state, where 0 is the current state
+func (s *Ship) StateDiff(ctx context.Context, from int, to int) error {
+	debug := level.Debug(log.With(s.Logger, "method", "StateDiff"))
+
+	debug.Log("event", "snapshot.load", "from", from, "to", to)
+	fromState, err := s.State.Snapshot(from)
+	if err != nil {
+		return errors.Wrapf(err, "load state %d", from)
+	}
+	toState, err := s.State.Snapshot(to)
+	if err != nil {
+		return errors.Wrapf(err, "load state %d", to)
+	}
+
+	diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(string(fromState)),
+		B:        difflib.SplitLines(string(toState)),
+		FromFile: historyLabel(from),
+		ToFile:   historyLabel(to),
+		Context:  3,
+	})
+	if err != nil {
+		return errors.Wrap(err, "diff state")
+	}
+
+	if diff == "" {
+		s.UI.Info("No differences")
+		return nil
+	}
+
+	s.UI.Output(diff)
+	return nil
+}
+
+// RollbackState restores the nth entry in state history
+func (s *Ship) RollbackState(ctx context.Context, n int) error {
+	if n == 0 {
+		return errors.New("entry 0 is the current state, pick an entry from ship state history to roll back to")
+	}
+
+	unlock, err := s.lockState()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := s.State.Rollback(n); err != nil {
+		return errors.Wrapf(err, "roll back to state history entry %d", n)
+	}
+
+	s.UI.Info(fmt.Sprintf("State rolled back to history entry %d, the previous state has been added to history", n))
+	return nil
+}
+
+// UnlockState removes the state lock left behind by a run that didn't release it.
+// Without force, it only reports who holds the lock.
+func (s *Ship) UnlockState(ctx context.Context, force bool) error {
+	if !force {
+		holder, err := s.State.LockHolder()
+		if err != nil {
+			return errors.Wrap(err, "read state lock")
+		}
+		if holder == nil {
+			s.UI.Info("State is not locked")
+			return nil
+		}
+		return errors.Errorf("state is locked by %s, pass --force to remove the lock if that run is no longer active", holder)
+	}
+
+	previous, err := s.State.ForceUnlock()
+	if err != nil {
+		return err
+	}
+	if previous == nil {
+		s.UI.Info("State was not locked")
+		return nil
+	}
+
+	s.UI.Info(fmt.Sprintf("Removed the state lock held by %s", previous))
+	return nil
+}
+
+// MigrateState rewrites state in the current schema version. With dryRun, it prints the migrations that
+// would be applied and a diff of the result, without writing anything.
+func (s *Ship) MigrateState(ctx context.Context, dryRun bool) error {
+	var migration *state.Migration
+	var err error
+	if dryRun {
+		migration, err = s.State.PlanMigration()
+	} else {
+		unlock, lockErr := s.lockState()
+		if lockErr != nil {
+			return lockErr
+		}
+		defer unlock()
+		migration, err = s.State.Migrate()
+	}
+	if err != nil {
+		return errors.Wrap(err, "migrate state")
+	}
+
+	if migration == nil {
+		s.UI.Info("No state to migrate")
+		return nil
+	}
+	if !migration.Needed() {
+		s.UI.Info(fmt.Sprintf("State is already at schema v%d", migration.To))
+		return nil
+	}
+
+	if dryRun {
+		s.UI.Info(fmt.Sprintf("State would be migrated from schema v%d to v%d:", migration.From, migration.To))
+	} else {
+		s.UI.Info(fmt.Sprintf("State migrated from schema v%d to v%d, the previous state has been added to history:", migration.From, migration.To))
+	}
+	for _, applied := range migration.Applied {
+		s.UI.Info(fmt.Sprintf("  %s", applied))
+	}
+
+	if !dryRun {
+		return nil
+	}
+
+	diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(string(migration.Before)),
+		B:        difflib.SplitLines(string(migration.After)),
+		FromFile: fmt.Sprintf("v%d", migration.From),
+		ToFile:   fmt.Sprintf("v%d", migration.To),
+		Context:  3,
+	})
+	if err != nil {
+		return errors.Wrap(err, "diff state")
+	}
+	s.UI.Output(diff)
+	return nil
+}
+
+// lockState takes the state lock for the rest of a run, the returned func releases it
+func (s *Ship) lockState() (func(), error) {
+	if err := s.State.Lock(); err != nil {
+		return nil, err
+	}
+
+	return func() {
+		if err := s.State.Unlock(); err != nil {
+			level.Warn(s.Logger).Log("event", "state.unlock.fail", "err", err)
+		}
+	}, nil
+}
+
+// GetStateValue prints the value at path in state
+func (s *Ship) GetStateValue(ctx context.Context, path string) error {
+	currentState, err := s.State.TryLoad()
+	if err != nil {
+		return errors.Wrap(err, "load state")
+	}
+
+	value, err := state.GetPath(currentState.Versioned(), path)
+	if err != nil {
+		return err
+	}
+
+	s.UI.Output(value)
+	return nil
+}
+
+// SetStateValue sets the value at path in state. Config items are checked against the
+// config groups of the release last fetched, unless skipValidation is set.
+func (s *Ship) SetStateValue(ctx context.Context, path string, value string, skipValidation bool) error {
+	debug := level.Debug(log.With(s.Logger, "method", "SetStateValue"))
+
+	unlock, err := s.lockState()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	currentState, err := s.State.TryLoad()
+	if err != nil {
+		return errors.Wrap(err, "load state")
+	}
+	versionedState := currentState.Versioned()
+
+	if item, ok := state.IsConfigPath(path); ok {
+		configGroups, err := s.releaseConfigGroups()
+		if err != nil && !skipValidation {
+			return err
+		}
+		if err := validateConfigItem(configGroups, item); err != nil && !skipValidation {
+			return err
+		}
+
+		if sensitive := state.SensitiveConfigKeys(configGroups); len(sensitive) > 0 {
+			versionedState.V2.SensitiveConfig = sensitive
+		}
+	}
+
+	debug.Log("event", "state.set", "path", path)
+	versionedState, err = state.SetPath(versionedState, path, value)
+	if err != nil {
+		return err
+	}
+
+	return errors.Wrap(s.State.Save(versionedState), "save state")
+}
+
+// UnsetStateValue removes the value at path from state
+func (s *Ship) UnsetStateValue(ctx context.Context, path string) error {
+	unlock, err := s.lockState()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	currentState, err := s.State.TryLoad()
+	if err != nil {
+		return errors.Wrap(err, "load state")
+	}
+
+	versionedState, err := state.UnsetPath(currentState.Versioned(), path)
+	if err != nil {
+		return err
+	}
+
+	return errors.Wrap(s.State.Save(versionedState), "save state")
+}
+
+// ExportHelmValues writes the helm values from state to out, or prints them if out is empty.
+// If values have never been saved, the chart's defaults are exported.
+// If upstream is set, the values of that named upstream are exported.
+func (s *Ship) ExportHelmValues(ctx context.Context, upstream string, out string) error {
+	currentState, err := s.State.TryLoad()
+	if err != nil {
+		return errors.Wrap(err, "load state")
+	}
+
+	values := currentState.CurrentHelmValues()
+	defaults := currentState.CurrentHelmValuesDefaults()
+	if upstream != "" {
+		named, ok := currentState.Versioned().V2.UpstreamNamed(upstream)
+		if !ok {
+			return errors.Errorf("there is no upstream named %q", upstream)
+		}
+		values, defaults = named.HelmValues, named.HelmValuesDefaults
+	}
+	if values == "" {
+		values = defaults
+	}
+
+	if out == "" {
+		s.UI.Output(values)
+		return nil
+	}
+
+	if err := s.FS.WriteFile(out, []byte(values), 0644); err != nil {
+		return errors.Wrapf(err, "write helm values to %s", out)
+	}
+	return nil
+}
+
+// ImportHelmValues replaces the helm values in state with the contents of a values file.
+// If upstream is set, the values of that named upstream are replaced.
+func (s *Ship) ImportHelmValues(ctx context.Context, upstream string, in string) error {
+	values, err := s.FS.ReadFile(in)
+	if err != nil {
+		return errors.Wrapf(err, "read helm values from %s", in)
+	}
+
+	var parsed map[string]interface{}
+	if err := yaml.Unmarshal(values, &parsed); err != nil {
+		return errors.Wrapf(err, "%s is not a valid values file", in)
+	}
+
+	path := "helmValues"
+	if upstream != "" {
+		path = fmt.Sprintf("upstreams.%s.helmValues", upstream)
+	}
+	return s.SetStateValue(ctx, path, string(values), false)
+}
+
+// releaseConfigGroups reads the config groups from the release persisted by the last run
+func (s *Ship) releaseConfigGroups() ([]libyaml.ConfigGroup, error) {
+	specYAML, err := s.FS.ReadFile(constants.ReleasePath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "read release from %s to validate config, pass --skip-validation to set it anyway", constants.ReleasePath)
+	}
+
+	var spec api.Spec
+	if err := yaml.Unmarshal(specYAML, &spec); err != nil {
+		return nil, errors.Wrapf(err, "decode release from %s", constants.ReleasePath)
+	}
+	return spec.Config.V1, nil
+}
+
+func validateConfigItem(configGroups []libyaml.ConfigGroup, name string) error {
+	var known []string
+	for _, configGroup := range configGroups {
+		for _, configItem := range configGroup.Items {
+			if configItem == nil {
+				continue
+			}
+			if configItem.Name == name {
+				return nil
+			}
+			known = append(known, configItem.Name)
+		}
+	}
+
+	return errors.Errorf("%q is not a config item in this release, expected one of: %s", name, strings.Join(known, ", "))
+}
+
+func historyLabel(n int) string {
+	if n == 0 {
+		return "current"
+	}
+	return fmt.Sprintf("history/%d", n)
+}
+
+func shortSHA(sha string) string {
+	if len(sha) > 12 {
+		return sha[:12]
+	}
+	return sha
+}
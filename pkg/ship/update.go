@@ -7,6 +7,8 @@ import (
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
 	"github.com/pkg/errors"
+	"github.com/replicatedhq/ship/pkg/api"
+	"github.com/replicatedhq/ship/pkg/constants"
 	"github.com/replicatedhq/ship/pkg/lifecycle/daemon/daemontypes"
 	"github.com/replicatedhq/ship/pkg/state"
 )
@@ -26,6 +28,12 @@ func (s *Ship) Update(ctx context.Context) error {
 
 	s.Viper.Set("rm-asset-dest", true)
 
+	unlock, err := s.lockState()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
 	s.Daemon.SetProgress(daemontypes.StringProgress("kustomize", `loading state`))
 	// does a state already exist
 	existingState, err := s.State.TryLoad()
@@ -39,25 +47,116 @@ func (s *Ship) Update(ctx context.Context) error {
 	}
 
 	debug.Log("event", "read.upstream")
-	upstreamURL := existingState.Upstream()
-	if upstreamURL == "" {
+	if existingState.Upstream() == "" && len(existingState.Versioned().V2.Upstreams) == 0 {
 		return errors.New(fmt.Sprintf(`No upstream URL found at %s, please run "ship init"`, s.Viper.GetString("state-file")))
 	}
 
-	debug.Log("event", "fetch latest chart")
-	s.Daemon.SetProgress(daemontypes.StringProgress("kustomize", `Downloading latest from upstream `+upstreamURL))
+	// resetting clears the completed steps, and resolving the update records the new upstream version and content SHA,
+	// so a failed update puts back the state it started from
+	previousState := existingState.Versioned()
+	restoreState := func() {
+		if err := s.StateManager.Save(previousState); err != nil {
+			level.Error(s.Logger).Log("event", "state.restore.fail", "err", err)
+		}
+	}
 
 	debug.Log("event", "reset steps completed")
 	if err := s.StateManager.ResetLifecycle(); err != nil {
 		return errors.Wrap(err, "reset state.json completed lifecycle")
 	}
 
-	release, err := s.Resolver.ResolveRelease(ctx, upstreamURL)
+	restoreBase, err := s.movePreviousBase()
+	if err != nil {
+		restoreState()
+		return errors.Wrap(err, "move previous base")
+	}
+
+	release, err := s.renderUpdate(ctx, existingState)
 	if err != nil {
-		return errors.Wrapf(err, "resolve helm chart metadata for %s", upstreamURL)
+		// the base is only replaced once the update has rendered, a failed fetch or render leaves the previous one
+		if restoreErr := restoreBase(); restoreErr != nil {
+			level.Error(s.Logger).Log("event", "base.restore.fail", "err", restoreErr)
+		}
+		restoreState()
+		return err
+	}
+
+	if s.Viper.GetBool("git-commit") {
+		return s.commitUpdate(ctx, release, existingState)
+	}
+	return nil
+}
+
+// renderUpdate fetches the latest from upstream and renders it into the base and overlays
+func (s *Ship) renderUpdate(ctx context.Context, existingState state.State) (*api.Release, error) {
+	release, err := s.resolveUpdateRelease(ctx, existingState)
+	if err != nil {
+		return nil, err
 	}
 
 	release.Spec.Lifecycle = s.IDPatcher.EnsureAllStepsHaveUniqueIDs(release.Spec.Lifecycle)
 
-	return s.execute(ctx, release, nil, true)
+	if err := s.ensureOverlay(); err != nil {
+		return nil, errors.Wrap(err, "ensure overlay")
+	}
+
+	if err := s.execute(ctx, release, nil, true); err != nil {
+		return nil, err
+	}
+	return release, nil
+}
+
+// movePreviousBase moves the base that's about to be replaced to constants.PreviousBasePath, where the kustomize step
+// compares it with the new base to find overlay patches that upstream changes have orphaned or conflict with.
+// The func it returns moves the previous base back, for when the update fails.
+func (s *Ship) movePreviousBase() (func() error, error) {
+	s.Viper.Set("previous-base", constants.PreviousBasePath)
+	noop := func() error { return nil }
+
+	exists, err := s.FS.Exists(constants.KustomizeBasePath)
+	if err != nil || !exists {
+		return noop, err
+	}
+	if err := s.FS.RemoveAll(constants.PreviousBasePath); err != nil {
+		return noop, errors.Wrapf(err, "remove %s", constants.PreviousBasePath)
+	}
+	if err := s.FS.MkdirAll(constants.ShipPathInternalTmp, 0755); err != nil {
+		return noop, errors.Wrapf(err, "mkdir %s", constants.ShipPathInternalTmp)
+	}
+	if err := s.FS.Rename(constants.KustomizeBasePath, constants.PreviousBasePath); err != nil {
+		return noop, err
+	}
+
+	return func() error {
+		if err := s.FS.RemoveAll(constants.KustomizeBasePath); err != nil {
+			return errors.Wrapf(err, "remove %s", constants.KustomizeBasePath)
+		}
+		return errors.Wrapf(s.FS.Rename(constants.PreviousBasePath, constants.KustomizeBasePath), "restore %s", constants.KustomizeBasePath)
+	}, nil
+}
+
+// resolveUpdateRelease fetches the latest from the upstream in state, or from each of the named upstreams
+// of an application composed of several
+func (s *Ship) resolveUpdateRelease(ctx context.Context, existingState state.State) (*api.Release, error) {
+	debug := level.Debug(log.With(s.Logger, "method", "resolveUpdateRelease"))
+
+	if upstreams := existingState.Versioned().V2.Upstreams; len(upstreams) > 0 {
+		debug.Log("event", "read.upstreams", "count", len(upstreams))
+		s.Daemon.SetProgress(daemontypes.StringProgress("kustomize", fmt.Sprintf("Downloading latest from %d upstreams", len(upstreams))))
+		release, err := s.Resolver.ResolveUpstreams(ctx, upstreams)
+		if err != nil {
+			return nil, errors.Wrap(err, "resolve upstreams")
+		}
+		return release, nil
+	}
+
+	upstreamURL := existingState.Upstream()
+	debug.Log("event", "fetch latest chart")
+	s.Daemon.SetProgress(daemontypes.StringProgress("kustomize", `Downloading latest from upstream `+upstreamURL))
+
+	release, err := s.Resolver.ResolveRelease(ctx, upstreamURL)
+	if err != nil {
+		return nil, errors.Wrapf(err, "resolve helm chart metadata for %s", upstreamURL)
+	}
+	return release, nil
 }
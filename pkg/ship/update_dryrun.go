@@ -0,0 +1,220 @@
+package ship
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/ship/pkg/api"
+	"github.com/replicatedhq/ship/pkg/constants"
+	"github.com/replicatedhq/ship/pkg/lifecycle/kustomize"
+	"github.com/replicatedhq/ship/pkg/specs/gogetter"
+	"github.com/replicatedhq/ship/pkg/state"
+)
+
+// UpdateDryRunAndMaybeExit runs UpdateDryRun, writing the diff to stdout
+func (s *Ship) UpdateDryRunAndMaybeExit(ctx context.Context) error {
+	if err := s.UpdateDryRun(ctx, os.Stdout); err != nil {
+		s.ExitWithError(err)
+		return err
+	}
+	return nil
+}
+
+// UpdateDryRun resolves and renders the update in a scratch directory, against a scratch copy of state,
+// and writes a per-resource diff of the kustomize output to out. Neither state nor the working tree are changed.
+func (s *Ship) UpdateDryRun(ctx context.Context, out io.Writer) error {
+	return s.renderUpdateInScratch(ctx, func(release *api.Release, existingState state.State, workDir, scratchDir string) error {
+		diffs, err := s.diffKustomizeOutput(release, workDir, scratchDir)
+		if err != nil {
+			return err
+		}
+
+		if s.Viper.GetString("output") == "json" {
+			encoder := json.NewEncoder(out)
+			encoder.SetIndent("", "  ")
+			return errors.Wrap(encoder.Encode(diffs), "write diff")
+		}
+		return errors.Wrap(writeOutputDiffs(out, diffs), "write diff")
+	})
+}
+
+// renderUpdateInScratch resolves and renders the update in a scratch directory, against a scratch copy of state,
+// then calls inspect to compare the scratch dir with the working directory before the scratch dir is removed
+func (s *Ship) renderUpdateInScratch(
+	ctx context.Context,
+	inspect func(release *api.Release, existingState state.State, workDir, scratchDir string) error,
+) error {
+	debug := level.Debug(log.With(s.Logger, "method", "renderUpdateInScratch"))
+
+	// from here on, state is only written to memory, and isn't locked since nothing else can see it
+	if err := s.State.UseScratch(); err != nil {
+		return errors.Wrap(err, "copy state")
+	}
+
+	existingState, err := s.State.TryLoad()
+	if err != nil {
+		return errors.Wrap(err, "load state")
+	}
+	if _, noExistingState := existingState.(state.Empty); noExistingState {
+		return errors.New(`No state file found at ` + s.Viper.GetString("state-file") + `, please run "ship init"`)
+	}
+	if existingState.Upstream() == "" && len(existingState.Versioned().V2.Upstreams) == 0 {
+		return errors.New(fmt.Sprintf(`No upstream URL found at %s, please run "ship init"`, s.Viper.GetString("state-file")))
+	}
+
+	workDir, err := os.Getwd()
+	if err != nil {
+		return errors.Wrap(err, "get working directory")
+	}
+	scratchDir, err := ioutil.TempDir("", "ship-update-scratch")
+	if err != nil {
+		return errors.Wrap(err, "create scratch dir")
+	}
+	defer os.RemoveAll(scratchDir)
+
+	if err := s.absoluteLocalUpstreams(existingState); err != nil {
+		return err
+	}
+
+	debug.Log("event", "chdir", "dir", scratchDir)
+	if err := os.Chdir(scratchDir); err != nil {
+		return errors.Wrap(err, "change to scratch dir")
+	}
+	defer os.Chdir(workDir)
+	ctx, cancelFunc := context.WithCancel(ctx)
+	// runs before changing back, so it cleans up the scratch dir's temp files rather than the working tree's
+	defer s.Shutdown(cancelFunc)
+
+	if err := s.FS.MkdirAll(constants.ShipPathInternalTmp, 0755); err != nil {
+		return errors.Wrapf(err, "mkdir %s", constants.ShipPathInternalTmp)
+	}
+	s.Viper.Set("rm-asset-dest", true)
+	// overlay patches are checked against the base in the working tree, which is left where it is
+	s.Viper.Set("previous-base", filepath.Join(workDir, constants.KustomizeBasePath))
+
+	if err := s.StateManager.ResetLifecycle(); err != nil {
+		return errors.Wrap(err, "reset state.json completed lifecycle")
+	}
+
+	release, err := s.resolveUpdateRelease(ctx, existingState)
+	if err != nil {
+		return err
+	}
+	release.Spec.Lifecycle = s.IDPatcher.EnsureAllStepsHaveUniqueIDs(release.Spec.Lifecycle)
+
+	if err := s.ensureOverlay(); err != nil {
+		return errors.Wrap(err, "ensure overlay")
+	}
+
+	if err := s.execute(ctx, release, nil, true); err != nil {
+		return err
+	}
+
+	return inspect(release, existingState, workDir, scratchDir)
+}
+
+// absoluteLocalUpstreams points any upstream on the local filesystem that's relative to the working directory
+// at its absolute path instead, so it can still be found from the scratch dir
+func (s *Ship) absoluteLocalUpstreams(existingState state.State) error {
+	if upstreams := existingState.Versioned().V2.Upstreams; len(upstreams) > 0 {
+		absolute := make([]state.NamedUpstream, 0, len(upstreams))
+		for _, upstream := range upstreams {
+			if localPath, ok := gogetter.LocalPath(upstream.Upstream); ok {
+				upstream.Upstream = localPath
+			}
+			absolute = append(absolute, upstream)
+		}
+		return errors.Wrap(s.State.SerializeNamedUpstreams(absolute), "serialize upstreams")
+	}
+
+	if localPath, ok := gogetter.LocalPath(existingState.Upstream()); ok {
+		return errors.Wrap(s.State.SerializeUpstream(localPath), "serialize upstream")
+	}
+	return nil
+}
+
+// diffKustomizeOutput compares the built yaml of each kustomize step, and of each environment overlay,
+// in the working directory and the scratch dir
+func (s *Ship) diffKustomizeOutput(release *api.Release, workDir string, scratchDir string) ([]*kustomize.OutputDiff, error) {
+	updatedState, err := s.State.TryLoad()
+	if err != nil {
+		return nil, errors.Wrap(err, "load state")
+	}
+	environments := updatedState.CurrentKustomize().EnvironmentOverlays()
+
+	root := kustomizeRoot(release)
+	diffs := []*kustomize.OutputDiff{}
+	for _, step := range release.Spec.Lifecycle.V1 {
+		if step.Kustomize == nil || step.Kustomize.Dest == "" {
+			continue
+		}
+
+		dests := []string{step.Kustomize.Dest}
+		for _, name := range environments {
+			dests = append(dests, step.Kustomize.EnvironmentDest(name))
+		}
+
+		for _, dest := range dests {
+			current, err := readIfExists(filepath.Join(workDir, root, dest))
+			if err != nil {
+				return nil, err
+			}
+			updated, err := readIfExists(filepath.Join(scratchDir, root, dest))
+			if err != nil {
+				return nil, err
+			}
+
+			diff, err := kustomize.DiffOutput(dest, current, updated)
+			if err != nil {
+				return nil, errors.Wrapf(err, "diff %s", dest)
+			}
+			diffs = append(diffs, diff)
+		}
+	}
+	return diffs, nil
+}
+
+// kustomizeRoot is the directory kustomize output is written relative to, the same one the kustomizer picks
+func kustomizeRoot(release *api.Release) string {
+	renderStep := release.FindRenderStep()
+	if renderStep == nil || renderStep.Root == "./" || renderStep.Root == "." {
+		return "."
+	}
+	if renderStep.Root != "" {
+		return renderStep.Root
+	}
+	return constants.InstallerPrefixPath
+}
+
+func readIfExists(path string) ([]byte, error) {
+	contents, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return contents, errors.Wrapf(err, "read %s", path)
+}
+
+func writeOutputDiffs(out io.Writer, diffs []*kustomize.OutputDiff) error {
+	for _, diff := range diffs {
+		if _, err := fmt.Fprintf(out, "%s: %d added, %d removed, %d changed\n", diff.Dest, diff.Added, diff.Removed, diff.Changed); err != nil {
+			return err
+		}
+		for _, resource := range diff.Resources {
+			if _, err := fmt.Fprintf(out, "\n%s %s\n%s", resource.Change, resource.ID(), resource.Diff); err != nil {
+				return err
+			}
+		}
+		if _, err := fmt.Fprintln(out); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package ship
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/mitchellh/cli"
+	"github.com/replicatedhq/ship/pkg/constants"
+	"github.com/replicatedhq/ship/pkg/specs"
+	"github.com/replicatedhq/ship/pkg/state"
+	"github.com/replicatedhq/ship/pkg/test-mocks/apptype"
+	"github.com/replicatedhq/ship/pkg/test-mocks/daemon"
+	"github.com/replicatedhq/ship/pkg/testing/logger"
+	"github.com/spf13/afero"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMovePreviousBaseRestore(t *testing.T) {
+	req := require.New(t)
+	tmpDir, err := ioutil.TempDir("", "ship-update")
+	req.NoError(err)
+	defer os.RemoveAll(tmpDir)
+	// directories are renamed, which the in-memory filesystem doesn't do for their contents
+	fs := afero.Afero{Fs: afero.NewBasePathFs(afero.NewOsFs(), tmpDir)}
+	s := &Ship{FS: fs, Viper: viper.New()}
+
+	deployment := filepath.Join(constants.KustomizeBasePath, "deployment.yaml")
+	req.NoError(fs.MkdirAll(constants.KustomizeBasePath, 0755))
+	req.NoError(fs.WriteFile(deployment, []byte("kind: Deployment"), 0644))
+
+	restoreBase, err := s.movePreviousBase()
+	req.NoError(err)
+	contents, err := fs.ReadFile(filepath.Join(constants.PreviousBasePath, "deployment.yaml"))
+	req.NoError(err)
+	req.Equal("kind: Deployment", string(contents))
+
+	// the update failed partway through writing the new base
+	req.NoError(fs.MkdirAll(constants.KustomizeBasePath, 0755))
+	req.NoError(fs.WriteFile(filepath.Join(constants.KustomizeBasePath, "partial.yaml"), []byte("kind: Service"), 0644))
+
+	req.NoError(restoreBase())
+	contents, err = fs.ReadFile(deployment)
+	req.NoError(err)
+	req.Equal("kind: Deployment", string(contents))
+	exists, err := fs.Exists(filepath.Join(constants.KustomizeBasePath, "partial.yaml"))
+	req.NoError(err)
+	req.False(exists)
+}
+
+func TestMovePreviousBaseWithoutBase(t *testing.T) {
+	req := require.New(t)
+	fs := afero.Afero{Fs: afero.NewMemMapFs()}
+	s := &Ship{FS: fs, Viper: viper.New()}
+
+	restoreBase, err := s.movePreviousBase()
+	req.NoError(err)
+	req.NoError(restoreBase())
+	req.Equal(constants.PreviousBasePath, s.Viper.GetString("previous-base"))
+}
+
+func TestUpdateFailureRestoresState(t *testing.T) {
+	req := require.New(t)
+	mc := gomock.NewController(t)
+	defer mc.Finish()
+	tmpDir, err := ioutil.TempDir("", "ship-update")
+	req.NoError(err)
+	defer os.RemoveAll(tmpDir)
+	fs := afero.Afero{Fs: afero.NewBasePathFs(afero.NewOsFs(), tmpDir)}
+	v := viper.New()
+	testLogger := &logger.TestLogger{T: t}
+	ui := cli.NewMockUi()
+	inspector := apptype.NewMockInspector(mc)
+	mockDaemon := daemon.NewMockDaemon(mc)
+	manager := &state.MManager{Logger: testLogger, FS: fs, V: v}
+	s := &Ship{
+		Logger:       testLogger,
+		Viper:        v,
+		FS:           fs,
+		UI:           ui,
+		Daemon:       mockDaemon,
+		State:        manager,
+		StateManager: manager,
+		Resolver:     specs.NewResolver(v, testLogger, fs, nil, manager, ui, inspector, nil, nil, nil, nil, nil, nil),
+	}
+
+	previous := state.VersionedState{V2: &state.V2{
+		Upstream:   "upstream",
+		ContentSHA: "abc",
+		Lifecycle:  &state.Lifecycle{Steps: map[string]state.StepProgress{"render": {Status: state.StepCompleted}}},
+	}}
+	req.NoError(manager.Save(previous))
+	req.NoError(fs.MkdirAll(constants.KustomizeBasePath, 0755))
+	req.NoError(fs.WriteFile(filepath.Join(constants.KustomizeBasePath, "deployment.yaml"), []byte("kind: Deployment"), 0644))
+	// the new content SHA is written before the upstream's Chart.yaml is read, which fails
+	req.NoError(fs.MkdirAll("upstream", 0755))
+	req.NoError(fs.WriteFile(filepath.Join("upstream", "Chart.yaml"), []byte("name: ["), 0644))
+
+	mockDaemon.EXPECT().SetProgress(gomock.Any()).AnyTimes()
+	inspector.EXPECT().DetermineApplicationType(gomock.Any(), "upstream").Return("k8s", "upstream", nil)
+
+	err = s.Update(context.Background())
+	req.Error(err)
+
+	restored, err := manager.TryLoad()
+	req.NoError(err)
+	req.Equal("abc", restored.Versioned().V2.ContentSHA)
+	req.Equal([]string{"render"}, restored.Versioned().V2.Lifecycle.CompletedSteps())
+	contents, err := fs.ReadFile(filepath.Join(constants.KustomizeBasePath, "deployment.yaml"))
+	req.NoError(err)
+	req.Equal("kind: Deployment", string(contents))
+}
@@ -3,16 +3,46 @@ package ship
 import (
 	"context"
 	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
 	"github.com/pkg/errors"
+	"github.com/replicatedhq/ship/pkg/api"
+	"github.com/replicatedhq/ship/pkg/notify"
 	"github.com/replicatedhq/ship/pkg/state"
+	"github.com/replicatedhq/ship/pkg/util"
 )
 
+// WatchAndExit watches until there's an update, exiting 0, or exits with ExitCodeError if watching fails
+// and ExitCodeCancelled if it's stopped with SIGINT or SIGTERM first
 func (s *Ship) WatchAndExit(ctx context.Context) error {
-	if err := s.Watch(ctx); err != nil {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+		defer signal.Stop(signals)
+
+		select {
+		case sig := <-signals:
+			level.Info(s.Logger).Log("event", "watch.cancel", "signal", sig)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	err := s.Watch(ctx)
+	if ctx.Err() != nil {
+		s.UI.Info("Stopped watching")
+		s.exit(ExitCodeCancelled)
+		return ctx.Err()
+	}
+	if err != nil {
 		s.ExitWithError(err)
 		return err
 	}
@@ -24,6 +54,28 @@ func (s *Ship) Watch(ctx context.Context) error {
 	ctx, cancelFunc := context.WithCancel(ctx)
 	defer s.Shutdown(cancelFunc)
 
+	var metrics *watchMetrics
+	if addr := s.Viper.GetString("metrics-addr"); addr != "" {
+		metrics = newWatchMetrics()
+		if err := serveWatchMetrics(ctx, s.Logger, addr, metrics); err != nil {
+			return err
+		}
+	}
+
+	schedule := newPollSchedule(s.Viper)
+	if s.Viper.GetString("fleet") != "" {
+		return s.watchFleet(ctx, schedule, metrics)
+	}
+
+	reporter := &updateReporter{
+		notifiers:    notify.NewNotifiers(s.Logger, s.Viper),
+		keepWatching: s.Viper.GetBool("keep-watching"),
+		notified:     map[string]string{},
+		pending:      map[string]*pendingUpdate{},
+		metrics:      metrics,
+		now:          time.Now,
+	}
+
 	for {
 		existingState, err := s.State.TryLoad()
 		if err != nil {
@@ -35,41 +87,173 @@ func (s *Ship) Watch(ctx context.Context) error {
 			return errors.New(`No state found, please run "ship init"`)
 		}
 
-		debug.Log("event", "read.upstream")
+		var updated bool
+		if upstreams := existingState.Versioned().V2.Upstreams; len(upstreams) > 0 {
+			updated, err = s.watchNamedUpstreams(ctx, reporter, upstreams)
+		} else {
+			updated, err = s.watchUpstream(ctx, reporter, existingState)
+		}
+		var wait time.Duration
+		switch {
+		case err != nil && ctx.Err() != nil:
+			return ctx.Err()
+		case err != nil && !isFetchError(err):
+			return err
+		case err != nil:
+			retryIn, ok := schedule.afterFailure()
+			if !ok {
+				return errors.Wrapf(err, "poll failed %d times in a row", schedule.failures)
+			}
+			s.UI.Warn(fmt.Sprintf("%s, retrying in %s", err.Error(), retryIn.Round(time.Second)))
+			wait = retryIn
+		case updated && !reporter.keepWatching:
+			return nil
+		default:
+			wait = schedule.afterSuccess()
+		}
 
-		upstream := existingState.Upstream()
-		if upstream == "" {
-			return errors.New(`No current chart url found at ` + s.Viper.GetString("state-file") + `, please run "ship init"`)
+		debug.Log("event", "poll.wait", "sleeping", wait)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
 		}
+	}
+}
+
+// updateReporter reports each update found by watch, and tells the notifiers about it.
+// With --keep-watching, an update that hasn't been applied yet is only reported once.
+type updateReporter struct {
+	notifiers    notify.Notifiers
+	keepWatching bool
+	// notified is the content sha last reported for each upstream, by name
+	notified map[string]string
+	// pending is the update each upstream, by name, is still notifying about, and the notifiers already told about it
+	pending map[string]*pendingUpdate
+	// metrics records each poll, for --metrics-addr
+	metrics *watchMetrics
+	now     func() time.Time
+}
+
+type pendingUpdate struct {
+	contentSHA string
+	delivered  notify.Delivered
+}
+
+func (r *updateReporter) observe(name, upstream string, metadata *api.ShipAppMetadata, err error) {
+	contentSHA := ""
+	if metadata != nil {
+		contentSHA = metadata.ContentSHA
+	}
+	r.metrics.observe(name, upstream, contentSHA, err, r.now())
+}
+
+// watchUpstream checks the upstream in state for an update
+func (s *Ship) watchUpstream(ctx context.Context, reporter *updateReporter, existingState state.State) (bool, error) {
+	debug := level.Debug(log.With(s.Logger, "method", "watchUpstream"))
 
-		debug.Log("event", "read.lastSHA")
-		lastSHA := existingState.Versioned().V1.ContentSHA
-		if lastSHA == "" {
-			return errors.New(`No current SHA found at ` + s.Viper.GetString("state-file") + `, please run "ship init"`)
+	debug.Log("event", "read.upstream")
+
+	upstream := existingState.Upstream()
+	if upstream == "" {
+		return false, errors.New(`No current chart url found at ` + s.Viper.GetString("state-file") + `, please run "ship init"`)
+	}
+
+	debug.Log("event", "read.lastSHA")
+	lastSHA := existingState.Versioned().V2.ContentSHA
+	if lastSHA == "" {
+		return false, errors.New(`No current SHA found at ` + s.Viper.GetString("state-file") + `, please run "ship init"`)
+	}
+
+	metadata, err := s.Resolver.ReadUpstreamForWatch(ctx, upstream)
+	reporter.observe("", upstream, metadata, err)
+	if err != nil {
+		return false, newFetchError(errors.Wrap(err, "read content SHA"))
+	}
+
+	debug.Log("event", "sha.read", "previous", lastSHA, "new", metadata.ContentSHA)
+	if metadata.ContentSHA != lastSHA {
+		return s.reportUpdate(ctx, reporter, "", upstream, lastSHA, metadata)
+	}
+	return false, nil
+}
+
+// watchNamedUpstreams checks each of the named upstreams in state for an update, reporting every one that has changed
+func (s *Ship) watchNamedUpstreams(ctx context.Context, reporter *updateReporter, upstreams []state.NamedUpstream) (bool, error) {
+	debug := level.Debug(log.With(s.Logger, "method", "watchNamedUpstreams"))
+
+	updated := false
+	for _, upstream := range upstreams {
+		if upstream.ContentSHA == "" {
+			return false, errors.Errorf(`No current SHA for upstream %s found at %s, please run "ship update"`, upstream.Name, s.Viper.GetString("state-file"))
 		}
 
-		contentSHA, err := s.Resolver.ReadContentSHAForWatch(ctx, upstream)
+		metadata, err := s.Resolver.ReadUpstreamForWatch(ctx, upstream.Upstream)
+		reporter.observe(upstream.Name, upstream.Upstream, metadata, err)
 		if err != nil {
-			return errors.Wrap(err, "read content SHA")
+			return false, newFetchError(errors.Wrapf(err, "read content SHA of upstream %s", upstream.Name))
 		}
 
-		if contentSHA != existingState.Versioned().V1.ContentSHA {
-			debug.Log(
-				"event", "new sha",
-				"previous", existingState.Versioned().V1.ContentSHA,
-				"new", contentSHA,
-			)
-			s.UI.Info(fmt.Sprintf("%s has an update available", upstream))
-			return nil
+		debug.Log("event", "sha.read", "upstream", upstream.Name, "previous", upstream.ContentSHA, "new", metadata.ContentSHA)
+		if metadata.ContentSHA != upstream.ContentSHA {
+			reported, err := s.reportUpdate(ctx, reporter, upstream.Name, upstream.Upstream, upstream.ContentSHA, metadata)
+			if err != nil {
+				return false, err
+			}
+			updated = updated || reported
 		}
+	}
+	return updated, nil
+}
+
+// reportUpdate prints that upstream has an update and notifies the notifiers. It returns false if the update
+// was already reported, or if notifying failed with --keep-watching, in which case it's tried again on the next poll.
+func (s *Ship) reportUpdate(ctx context.Context, reporter *updateReporter, name, upstream, previousSHA string, metadata *api.ShipAppMetadata) (bool, error) {
+	debug := level.Debug(log.With(s.Logger, "method", "reportUpdate"))
+
+	if reporter.notified[name] == metadata.ContentSHA {
+		debug.Log("event", "update.alreadyReported", "upstream", name, "sha", metadata.ContentSHA)
+		return false, nil
+	}
+
+	if name == "" {
+		s.UI.Info(fmt.Sprintf("%s has an update available", util.Redact(upstream)))
+	} else {
+		s.UI.Info(fmt.Sprintf("%s (%s) has an update available", name, util.Redact(upstream)))
+	}
 
-		debug.Log(
-			"event", "sha.unchanged",
-			"previous", existingState.Versioned().V1.ContentSHA,
-			"new", contentSHA,
-			"sleeping", s.Viper.GetDuration("interval"),
-		)
+	if len(reporter.notifiers) > 0 {
+		releaseNotes := metadata.ReleaseNotes
+		if releaseNotes == "" {
+			releaseNotes = s.Resolver.ResolveReleaseNotes(ctx, upstream)
+		}
+
+		pending := reporter.pending[name]
+		if pending == nil || pending.contentSHA != metadata.ContentSHA {
+			pending = &pendingUpdate{contentSHA: metadata.ContentSHA, delivered: notify.Delivered{}}
+			reporter.pending[name] = pending
+		}
 
-		time.Sleep(s.Viper.GetDuration("interval"))
+		err := reporter.notifiers.Notify(ctx, notify.Payload{
+			Event:              notify.EventUpdate,
+			Name:               name,
+			Upstream:           util.Redact(upstream),
+			PreviousContentSHA: previousSHA,
+			ContentSHA:         metadata.ContentSHA,
+			Version:            metadata.Version,
+			ReleaseNotes:       releaseNotes,
+			Time:               reporter.now(),
+		}, pending.delivered)
+		if err != nil {
+			if !reporter.keepWatching {
+				return false, errors.Wrap(err, "notify")
+			}
+			s.UI.Warn(fmt.Sprintf("Failed to notify about the update, will retry: %s", err.Error()))
+			return false, nil
+		}
+		delete(reporter.pending, name)
 	}
+
+	reporter.notified[name] = metadata.ContentSHA
+	return true, nil
 }
@@ -0,0 +1,145 @@
+package ship
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/ship/pkg/lifecycle/daemon/daemontypes"
+	"github.com/replicatedhq/ship/pkg/specs/gogetter"
+	"github.com/replicatedhq/ship/pkg/util"
+)
+
+// localWatchQuietPeriod is how long a local upstream has to go without changing before it's rendered again,
+// so an editor saving several files only causes one render
+const localWatchQuietPeriod = 500 * time.Millisecond
+
+// maybeWatchLocal starts re-rendering the application each time the local upstream changes, if --watch-local is set.
+// It stops when ctx is done.
+func (s *Ship) maybeWatchLocal(ctx context.Context) error {
+	if !s.Viper.GetBool("watch-local") {
+		return nil
+	}
+	debug := level.Debug(log.With(s.Logger, "method", "maybeWatchLocal"))
+
+	if len(s.Viper.GetStringSlice("upstreams")) > 0 {
+		return errors.New("--watch-local can't be used with more than one upstream")
+	}
+	if s.Headless || !s.Navcycle {
+		return errors.New("--watch-local needs the web console, it can't be used with --headless or --navcycle=false")
+	}
+
+	upstream := s.Viper.GetString("upstream")
+	dir, ok := gogetter.LocalPath(upstream)
+	if !ok {
+		return errors.Errorf("--watch-local needs an upstream on the local filesystem, like ./my-chart or file::/path/to/my-chart, not %s", util.Redact(upstream))
+	}
+
+	refresher, ok := s.Daemon.(daemontypes.Refresher)
+	if !ok {
+		return errors.New("--watch-local isn't supported by this daemon")
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return errors.Wrap(err, "create file watcher")
+	}
+	if err := addWatches(watcher, dir); err != nil {
+		watcher.Close()
+		return errors.Wrapf(err, "watch %s", dir)
+	}
+
+	// renders replace what the last one wrote instead of backing it up. It's set once here, before the watcher
+	// starts, because viper isn't safe to set while steps read it.
+	s.Viper.Set("rm-asset-dest", true)
+
+	debug.Log("event", "watch.start", "dir", dir)
+	s.UI.Info(fmt.Sprintf("Watching %s for changes ...", dir))
+	go func() {
+		defer watcher.Close()
+		watchLocal(ctx, s.Logger, watcher, localWatchQuietPeriod, func() {
+			s.refreshLocal(ctx, upstream, dir, refresher)
+		})
+	}()
+	return nil
+}
+
+// refreshLocal fetches the local upstream again, and re-runs the steps that render it
+func (s *Ship) refreshLocal(ctx context.Context, upstream, dir string, refresher daemontypes.Refresher) {
+	s.UI.Info(fmt.Sprintf("%s changed, rendering again ...", dir))
+
+	err := refresher.Refresh(ctx, func() error {
+		_, err := s.Resolver.ResolveRelease(ctx, upstream)
+		return err
+	})
+	if err != nil {
+		s.UI.Error(fmt.Sprintf("Render of %s failed: %v", dir, err))
+		return
+	}
+	s.UI.Info(fmt.Sprintf("Rendered %s", dir))
+}
+
+// watchLocal calls refresh once files under the watched directories change and then stay unchanged for quietPeriod.
+// Directories created under them are watched too. It returns when ctx is done.
+func watchLocal(ctx context.Context, logger log.Logger, watcher *fsnotify.Watcher, quietPeriod time.Duration, refresh func()) {
+	debug := level.Debug(log.With(logger, "method", "watchLocal"))
+
+	var quiet <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			debug.Log("event", "watch.stop")
+			return
+
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if event.Op == fsnotify.Chmod {
+				continue
+			}
+			debug.Log("event", "file.changed", "file", event.Name, "op", event.Op.String())
+
+			if event.Op&fsnotify.Create == fsnotify.Create {
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+					if err := addWatches(watcher, event.Name); err != nil {
+						level.Error(logger).Log("event", "watch.add.fail", "dir", event.Name, "err", err)
+					}
+				}
+			}
+			quiet = time.After(quietPeriod)
+
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			level.Error(logger).Log("event", "watch.fail", "err", err)
+
+		case <-quiet:
+			quiet = nil
+			refresh()
+		}
+	}
+}
+
+// addWatches watches dir and each directory under it, fsnotify doesn't watch recursively
+func addWatches(watcher *fsnotify.Watcher, dir string) error {
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		if info.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		return watcher.Add(path)
+	})
+}
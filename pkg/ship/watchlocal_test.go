@@ -0,0 +1,58 @@
+package ship
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/replicatedhq/ship/pkg/testing/logger"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatchLocal(t *testing.T) {
+	req := require.New(t)
+	dir, err := ioutil.TempDir("", "ship-watch-local")
+	req.NoError(err)
+	defer os.RemoveAll(dir)
+	req.NoError(ioutil.WriteFile(filepath.Join(dir, "Chart.yaml"), []byte("name: nginx"), 0644))
+
+	watcher, err := fsnotify.NewWatcher()
+	req.NoError(err)
+	defer watcher.Close()
+	req.NoError(addWatches(watcher, dir))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	refreshed := make(chan struct{}, 10)
+	go watchLocal(ctx, &logger.TestLogger{T: t}, watcher, 50*time.Millisecond, func() {
+		refreshed <- struct{}{}
+	})
+
+	awaitRefresh := func(reason string) {
+		select {
+		case <-refreshed:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("not refreshed after %s", reason)
+		}
+	}
+
+	// several writes in a row are rendered once
+	req.NoError(ioutil.WriteFile(filepath.Join(dir, "Chart.yaml"), []byte("name: nginx\nversion: 1"), 0644))
+	req.NoError(ioutil.WriteFile(filepath.Join(dir, "values.yaml"), []byte("replicas: 1"), 0644))
+	awaitRefresh("writing files")
+	select {
+	case <-refreshed:
+		t.Fatal("refreshed twice for one burst of writes")
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	// new directories are watched too
+	req.NoError(os.Mkdir(filepath.Join(dir, "templates"), 0755))
+	awaitRefresh("creating a directory")
+	req.NoError(ioutil.WriteFile(filepath.Join(dir, "templates", "deployment.yaml"), []byte("kind: Deployment"), 0644))
+	awaitRefresh("writing a file in a new directory")
+}
@@ -0,0 +1,124 @@
+package ship
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+	"github.com/replicatedhq/ship/pkg/util"
+)
+
+// watchMetrics counts the polls watch makes of each upstream, for --metrics-addr.
+// Upstreams are labelled with their name, if they have one, and their url with any credentials redacted.
+// A nil *watchMetrics records nothing.
+type watchMetrics struct {
+	registry    *prometheus.Registry
+	polls       *prometheus.CounterVec
+	failures    *prometheus.CounterVec
+	lastSuccess *prometheus.GaugeVec
+	contentSHA  *prometheus.GaugeVec
+
+	mu sync.Mutex
+	// lastSHA is the content sha each upstream's contentSHA series is labelled with, so it can be removed when it changes
+	lastSHA map[[2]string]string
+}
+
+func newWatchMetrics() *watchMetrics {
+	labels := []string{"name", "upstream"}
+	m := &watchMetrics{
+		registry: prometheus.NewRegistry(),
+		polls: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "ship_watch_polls_total",
+			Help: "Number of times the upstream has been polled for an update.",
+		}, labels),
+		failures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "ship_watch_poll_failures_total",
+			Help: "Number of polls of the upstream that failed.",
+		}, labels),
+		lastSuccess: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "ship_watch_last_success_timestamp_seconds",
+			Help: "Unix time the upstream was last polled successfully.",
+		}, labels),
+		contentSHA: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "ship_watch_upstream_content_sha",
+			Help: "Always 1, labelled with the content sha the upstream had when it was last polled.",
+		}, append(labels, "sha")),
+		lastSHA: map[[2]string]string{},
+	}
+	m.registry.MustRegister(m.polls, m.failures, m.lastSuccess, m.contentSHA)
+	return m
+}
+
+// observe records a poll of upstream that found contentSHA, or failed with err
+func (m *watchMetrics) observe(name, upstream, contentSHA string, err error, at time.Time) {
+	if m == nil {
+		return
+	}
+	upstream = util.Redact(upstream)
+
+	m.polls.WithLabelValues(name, upstream).Inc()
+	// created on the first poll, so the failure count is reported as 0 rather than missing until something fails
+	failures := m.failures.WithLabelValues(name, upstream)
+	if err != nil {
+		failures.Inc()
+		return
+	}
+	m.lastSuccess.WithLabelValues(name, upstream).Set(float64(at.Unix()))
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := [2]string{name, upstream}
+	if previous, ok := m.lastSHA[key]; ok && previous != contentSHA {
+		m.contentSHA.DeleteLabelValues(name, upstream, previous)
+	}
+	m.lastSHA[key] = contentSHA
+	m.contentSHA.WithLabelValues(name, upstream, contentSHA).Set(1)
+}
+
+// ServeHTTP writes the metrics in the Prometheus text format
+func (m *watchMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	families, err := m.registry.Gather()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", string(expfmt.FmtText))
+	encoder := expfmt.NewEncoder(w, expfmt.FmtText)
+	for _, family := range families {
+		if err := encoder.Encode(family); err != nil {
+			return
+		}
+	}
+}
+
+// serveWatchMetrics serves metrics on /metrics at addr until ctx is done
+func serveWatchMetrics(ctx context.Context, logger log.Logger, addr string, metrics *watchMetrics) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return errors.Wrapf(err, "listen on %s for metrics", addr)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics)
+	server := &http.Server{Handler: mux}
+
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+	go func() {
+		level.Info(logger).Log("event", "metrics.serve", "addr", listener.Addr().String())
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			level.Error(logger).Log("event", "metrics.serve.fail", "addr", addr, "err", err)
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,85 @@
+package ship
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/ship/pkg/specs/verify"
+	"github.com/spf13/viper"
+)
+
+// fetchError is a failure to read an upstream while polling. Unlike other errors, watch retries it with backoff.
+type fetchError struct {
+	error
+}
+
+// newFetchError marks err as worth retrying, unless it's a failed verification that won't pass on the next poll either
+func newFetchError(err error) error {
+	if _, ok := errors.Cause(err).(verify.Error); ok {
+		return err
+	}
+	return fetchError{err}
+}
+
+func isFetchError(err error) bool {
+	_, ok := err.(fetchError)
+	return ok
+}
+
+// pollSchedule decides how long watch waits before its next poll
+type pollSchedule struct {
+	interval time.Duration
+	// jitter is the fraction of each wait that's randomly added or taken away, so that many watchers don't poll in step
+	jitter float64
+	// backoff is the wait after the first failed poll. It doubles after each failure in a row, up to interval.
+	backoff time.Duration
+	// budget is the number of failed polls in a row that are retried before watch gives up
+	budget   int
+	failures int
+	random   func() float64
+}
+
+func newPollSchedule(v *viper.Viper) *pollSchedule {
+	return &pollSchedule{
+		interval: v.GetDuration("interval"),
+		jitter:   v.GetFloat64("interval-jitter"),
+		backoff:  v.GetDuration("retry-backoff"),
+		budget:   v.GetInt("retry-budget"),
+		random:   rand.New(rand.NewSource(time.Now().UnixNano())).Float64,
+	}
+}
+
+// afterSuccess resets the failures and returns the wait until the next poll
+func (p *pollSchedule) afterSuccess() time.Duration {
+	p.failures = 0
+	return p.jittered(p.interval)
+}
+
+// afterFailure returns the wait before retrying a failed poll, or false if the retry budget is spent
+func (p *pollSchedule) afterFailure() (time.Duration, bool) {
+	p.failures++
+	if p.failures > p.budget {
+		return 0, false
+	}
+
+	wait := p.backoff
+	for i := 1; i < p.failures && wait < p.interval; i++ {
+		wait *= 2
+	}
+	if wait > p.interval {
+		wait = p.interval
+	}
+	return p.jittered(wait), true
+}
+
+func (p *pollSchedule) jittered(wait time.Duration) time.Duration {
+	jitter := p.jitter
+	if jitter <= 0 {
+		return wait
+	}
+	if jitter > 1 {
+		jitter = 1
+	}
+	return wait + time.Duration((p.random()*2-1)*jitter*float64(wait))
+}
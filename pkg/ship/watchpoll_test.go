@@ -0,0 +1,57 @@
+package ship
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/ship/pkg/specs/verify"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPollSchedule(t *testing.T) {
+	req := require.New(t)
+	schedule := &pollSchedule{
+		interval: time.Minute,
+		backoff:  10 * time.Second,
+		budget:   4,
+		random:   func() float64 { return 0.5 },
+	}
+
+	var waits []time.Duration
+	for {
+		wait, ok := schedule.afterFailure()
+		if !ok {
+			break
+		}
+		waits = append(waits, wait)
+	}
+	req.Equal([]time.Duration{10 * time.Second, 20 * time.Second, 40 * time.Second, time.Minute}, waits)
+	req.Equal(5, schedule.failures)
+
+	req.Equal(time.Minute, schedule.afterSuccess())
+	req.Equal(0, schedule.failures)
+	wait, ok := schedule.afterFailure()
+	req.True(ok)
+	req.Equal(10*time.Second, wait)
+}
+
+func TestPollScheduleJitter(t *testing.T) {
+	req := require.New(t)
+	schedule := &pollSchedule{interval: time.Minute, jitter: 0.1}
+
+	schedule.random = func() float64 { return 0 }
+	req.Equal(54*time.Second, schedule.afterSuccess())
+	schedule.random = func() float64 { return 1 }
+	req.Equal(66*time.Second, schedule.afterSuccess())
+
+	schedule.jitter = 3
+	req.Equal(2*time.Minute, schedule.afterSuccess())
+}
+
+func TestFetchError(t *testing.T) {
+	req := require.New(t)
+	req.True(isFetchError(newFetchError(errors.New("connection refused"))))
+	req.False(isFetchError(errors.New("connection refused")))
+	req.False(isFetchError(newFetchError(errors.Wrap(verify.Error{}, "verify"))))
+}
@@ -0,0 +1,53 @@
+package apptype
+
+import (
+	"path"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/afero"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// ChartAPIVersionV1 charts are Helm 2 charts, with dependencies in requirements.yaml
+	ChartAPIVersionV1 = "v1"
+	// ChartAPIVersionV2 charts are Helm 3 charts, which can list dependencies in Chart.yaml,
+	// be library charts, and ship a values.schema.json
+	ChartAPIVersionV2 = "v2"
+)
+
+// ApplicationChartAPIVersion is the apiVersion of the chart of a helm or helm3 application
+func ApplicationChartAPIVersion(applicationType string) string {
+	if applicationType == "helm3" {
+		return ChartAPIVersionV2
+	}
+	return ChartAPIVersionV1
+}
+
+// ChartAPIVersion reads the apiVersion from the Chart.yaml in chartPath. Charts that don't declare one are v1,
+// as are directories without a Chart.yaml, which are left for helm to reject.
+func ChartAPIVersion(fs afero.Afero, chartPath string) (string, error) {
+	chartfilePath := path.Join(chartPath, "Chart.yaml")
+	if exists, err := fs.Exists(chartfilePath); err != nil || !exists {
+		return ChartAPIVersionV1, errors.Wrapf(err, "check for %s", chartfilePath)
+	}
+	contents, err := fs.ReadFile(chartfilePath)
+	if err != nil {
+		return "", errors.Wrapf(err, "read %s", chartfilePath)
+	}
+
+	var chartfile struct {
+		APIVersion string `yaml:"apiVersion"`
+	}
+	if err := yaml.Unmarshal(contents, &chartfile); err != nil {
+		return "", errors.Wrap(err, "unmarshal Chart.yaml")
+	}
+
+	switch chartfile.APIVersion {
+	case "", ChartAPIVersionV1:
+		return ChartAPIVersionV1, nil
+	case ChartAPIVersionV2:
+		return ChartAPIVersionV2, nil
+	}
+	return "", errors.Errorf("unsupported chart apiVersion %q", chartfile.APIVersion)
+}
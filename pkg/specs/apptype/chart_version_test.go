@@ -0,0 +1,60 @@
+package apptype
+
+import (
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChartAPIVersion(t *testing.T) {
+	tests := []struct {
+		name      string
+		chartfile string
+		expect    string
+		expectErr string
+	}{
+		{
+			name:      "v1",
+			chartfile: "apiVersion: v1\nname: nginx\nversion: 1.0.0\n",
+			expect:    ChartAPIVersionV1,
+		},
+		{
+			name:      "no apiVersion",
+			chartfile: "name: nginx\nversion: 1.0.0\n",
+			expect:    ChartAPIVersionV1,
+		},
+		{
+			name:      "v2",
+			chartfile: "apiVersion: v2\nname: nginx\nversion: 1.0.0\ndependencies:\n- name: redis\n",
+			expect:    ChartAPIVersionV2,
+		},
+		{
+			name:   "no Chart.yaml",
+			expect: ChartAPIVersionV1,
+		},
+		{
+			name:      "unsupported",
+			chartfile: "apiVersion: v3\nname: nginx\n",
+			expectErr: `unsupported chart apiVersion "v3"`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := require.New(t)
+			mockFs := afero.Afero{Fs: afero.NewMemMapFs()}
+			req.NoError(mockFs.MkdirAll("chart", 0755))
+			if test.chartfile != "" {
+				req.NoError(mockFs.WriteFile("chart/Chart.yaml", []byte(test.chartfile), 0644))
+			}
+
+			apiVersion, err := ChartAPIVersion(mockFs, "chart")
+			if test.expectErr != "" {
+				req.EqualError(err, test.expectErr)
+				return
+			}
+			req.NoError(err)
+			req.Equal(test.expect, apiVersion)
+		})
+	}
+}
@@ -12,8 +12,13 @@ import (
 	"github.com/mitchellh/cli"
 	"github.com/pkg/errors"
 	"github.com/replicatedhq/ship/pkg/constants"
+	"github.com/replicatedhq/ship/pkg/specs/bitbucketclient"
 	"github.com/replicatedhq/ship/pkg/specs/githubclient"
+	"github.com/replicatedhq/ship/pkg/specs/gitlabclient"
 	"github.com/replicatedhq/ship/pkg/specs/gogetter"
+	"github.com/replicatedhq/ship/pkg/specs/helmrepo"
+	"github.com/replicatedhq/ship/pkg/specs/upstreamcache"
+	"github.com/replicatedhq/ship/pkg/specs/verify"
 	"github.com/replicatedhq/ship/pkg/state"
 	"github.com/replicatedhq/ship/pkg/util"
 	errors2 "github.com/replicatedhq/ship/pkg/util/errors"
@@ -28,6 +33,13 @@ type Inspector interface {
 		ctx context.Context,
 		upstream string,
 	) (appType string, localPath string, err error)
+	// DetermineApplicationTypeAt is DetermineApplicationType, downloading the upstream to savePath
+	// instead of the shared constants.RepoSavePath, so several upstreams can be fetched at once
+	DetermineApplicationTypeAt(
+		ctx context.Context,
+		upstream string,
+		savePath string,
+	) (appType string, localPath string, err error)
 }
 
 func NewInspector(
@@ -36,22 +48,31 @@ func NewInspector(
 	v *viper.Viper,
 	stateManager state.Manager,
 	ui cli.Ui,
+	helmRepo *helmrepo.Client,
+	cache *upstreamcache.Cache,
+	verifier *verify.Verifier,
 ) Inspector {
 	return &inspector{
-		logger: logger,
-		fs:     fs,
-		viper:  v,
-		state:  stateManager,
-		ui:     ui,
+		logger:   logger,
+		fs:       fs,
+		viper:    v,
+		state:    stateManager,
+		ui:       ui,
+		helmRepo: helmRepo,
+		cache:    cache,
+		verifier: verifier,
 	}
 }
 
 type inspector struct {
-	logger log.Logger
-	fs     afero.Afero
-	viper  *viper.Viper
-	state  state.Manager
-	ui     cli.Ui
+	logger   log.Logger
+	fs       afero.Afero
+	viper    *viper.Viper
+	state    state.Manager
+	ui       cli.Ui
+	helmRepo *helmrepo.Client
+	cache    *upstreamcache.Cache
+	verifier *verify.Verifier
 }
 
 type FileFetcher interface {
@@ -62,6 +83,14 @@ func (r *inspector) DetermineApplicationType(
 	ctx context.Context,
 	upstream string,
 ) (appType string, localPath string, err error) {
+	return r.DetermineApplicationTypeAt(ctx, upstream, constants.RepoSavePath)
+}
+
+func (r *inspector) DetermineApplicationTypeAt(
+	ctx context.Context,
+	upstream string,
+	savePath string,
+) (appType string, localPath string, err error) {
 
 	// hack hack hack
 	isReplicatedApp := strings.HasPrefix(upstream, "replicated.app") ||
@@ -71,27 +100,58 @@ func (r *inspector) DetermineApplicationType(
 		return "replicated.app", "", nil
 	}
 
-	r.ui.Info(fmt.Sprintf("Attempting to retrieve upstream %s ...", upstream))
+	r.ui.Info(fmt.Sprintf("Attempting to retrieve upstream %s ...", util.Redact(upstream)))
+	if helmrepo.IsHelmRepoUpstream(upstream) {
+		return r.determineTypeFromContents(ctx, upstream, r.helmRepo, savePath)
+	}
+
 	// use the integrated github client if the url is a github url and does not contain "//", unless perfer-git is set)
-	if r.viper.GetBool("prefer-git") == false && util.IsGithubURL(upstream) {
-		githubClient := githubclient.NewGithubClient(r.fs, r.logger)
-		return r.determineTypeFromContents(ctx, upstream, githubClient)
+	githubClient := githubclient.NewGithubClient(r.fs, r.logger, r.viper, r.cache, r.verifier)
+	if r.viper.GetBool("prefer-git") == false && githubClient.IsGithubURL(upstream) {
+		return r.determineTypeFromContents(ctx, upstream, githubClient, savePath)
 	}
 
-	upstream, subdir, isSingleFile := gogetter.UntreeGithub(upstream)
-	if gogetter.IsGoGettable(upstream) {
+	gitlabClient := gitlabclient.NewGitlabClient(r.fs, r.logger, r.viper, r.cache, r.verifier)
+	if r.viper.GetBool("prefer-git") == false && gitlabClient.IsGitlabURL(upstream) {
+		return r.determineTypeFromContents(ctx, upstream, gitlabClient, savePath)
+	}
+
+	bitbucketClient := bitbucketclient.NewBitbucketClient(r.fs, r.logger, r.viper, r.cache, r.verifier)
+	if r.viper.GetBool("prefer-git") == false && bitbucketClient.IsBitbucketURL(upstream) {
+		return r.determineTypeFromContents(ctx, upstream, bitbucketClient, savePath)
+	}
+
+	gettable, subdir, isSingleFile := gogetter.UntreeGithub(upstream)
+	if gogetter.IsGoGettable(gettable) {
 		// get with go-getter
-		fetcher := gogetter.GoGetter{Logger: r.logger, FS: r.fs, Subdir: subdir, IsSingleFile: isSingleFile}
-		return r.determineTypeFromContents(ctx, upstream, &fetcher)
+		fetcher := gogetter.GoGetter{
+			Logger:               r.logger,
+			FS:                   r.fs,
+			Subdir:               subdir,
+			IsSingleFile:         isSingleFile,
+			GithubToken:          r.viper.GetString("github-token"),
+			GithubEnterpriseHost: githubClient.EnterpriseHost(),
+			SSHKeyPath:           r.viper.GetString("ssh-key"),
+			KnownHostsPath:       r.viper.GetString("ssh-known-hosts"),
+			Cache:                r.cache,
+			Verifier:             r.verifier,
+		}
+		appType, localPath, err = r.determineTypeFromContents(ctx, gettable, &fetcher, savePath)
+		// the resolver looks the verification up by the upstream it was given
+		if verification, ok := r.verifier.Verified(gettable); ok {
+			r.verifier.Record(upstream, verification)
+		}
+		return appType, localPath, err
 	}
 
-	return "", "", errors.New(fmt.Sprintf("upstream %s is not a replicated app, a github repo, or compatible with go-getter", upstream))
+	return "", "", errors.New(fmt.Sprintf("upstream %s is not a replicated app, a helm repository chart, a github repo, or compatible with go-getter", util.Redact(gettable)))
 }
 
 func (r *inspector) determineTypeFromContents(
 	ctx context.Context,
 	upstream string,
 	fetcher FileFetcher,
+	savePath string,
 ) (
 	applicationType string,
 	checkoutPath string,
@@ -99,20 +159,20 @@ func (r *inspector) determineTypeFromContents(
 ) {
 	debug := level.Debug(r.logger)
 
-	finalPath, err := fetcher.GetFiles(ctx, upstream, constants.RepoSavePath)
+	finalPath, err := fetcher.GetFiles(ctx, upstream, savePath)
 	if err != nil {
 		if _, ok := err.(errors2.FetchFilesError); ok {
-			r.ui.Info(fmt.Sprintf("Failed to retrieve upstream %s", upstream))
+			r.ui.Info(fmt.Sprintf("Failed to retrieve upstream %s", util.Redact(upstream)))
 
 			var retryError error
 			retries := r.viper.GetInt("retries")
 			hasSucceeded := false
 			for idx := 1; idx <= retries && !hasSucceeded; idx++ {
 				debug.Log("event", "retry.getFiles", "attempt", idx)
-				r.ui.Info(fmt.Sprintf("Retrying to retrieve upstream %s ...", upstream))
+				r.ui.Info(fmt.Sprintf("Retrying to retrieve upstream %s ...", util.Redact(upstream)))
 
 				time.Sleep(time.Second * 5)
-				finalPath, retryError = fetcher.GetFiles(ctx, upstream, constants.RepoSavePath)
+				finalPath, retryError = fetcher.GetFiles(ctx, upstream, savePath)
 
 				if retryError != nil {
 					r.ui.Info(fmt.Sprintf("Retry attempt %v out of %v to fetch upstream failed", idx, retries))
@@ -151,8 +211,29 @@ func (r *inspector) determineTypeFromContents(
 	debug.Log("event", "isChart.check", "isChart", isChart)
 
 	if isChart {
+		// v2 charts are helm3 apps, rendered with the Helm 3 features v1 charts don't have
+		apiVersion, err := ChartAPIVersion(r.fs, finalPath)
+		if err != nil {
+			return "", "", errors.Wrapf(err, "determine chart version of %s", util.Redact(upstream))
+		}
+		debug.Log("event", "chartAPIVersion.check", "apiVersion", apiVersion)
+		if apiVersion == ChartAPIVersionV2 {
+			return "helm3", finalPath, nil
+		}
 		return "helm", finalPath, nil
 	}
 
+	// if there's a kustomization, it has to be built rather than used as plain manifests
+	for _, filename := range []string{"kustomization.yaml", "kustomization.yml", "Kustomization"} {
+		isKustomization, err := r.fs.Exists(path.Join(finalPath, filename))
+		if err != nil {
+			return "", "", errors.Wrapf(err, "check for %s", filename)
+		}
+		if isKustomization {
+			debug.Log("event", "isKustomization.check", "filename", filename)
+			return "kustomize", finalPath, nil
+		}
+	}
+
 	return "k8s", finalPath, nil
 }
@@ -0,0 +1,294 @@
+package bitbucketclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/ship/pkg/specs/upstreamcache"
+	"github.com/replicatedhq/ship/pkg/specs/verify"
+	"github.com/replicatedhq/ship/pkg/util"
+	errors2 "github.com/replicatedhq/ship/pkg/util/errors"
+	"github.com/spf13/afero"
+	"github.com/spf13/viper"
+)
+
+const (
+	// DefaultAPIURL is the root of the Bitbucket Cloud 2.0 API
+	DefaultAPIURL = "https://api.bitbucket.org/2.0"
+	// DefaultWebURL is where Bitbucket Cloud serves repo archives
+	DefaultWebURL = "https://bitbucket.org"
+)
+
+// BitbucketClient fetches upstreams from Bitbucket Cloud
+type BitbucketClient struct {
+	logger     log.Logger
+	httpClient *http.Client
+	fs         afero.Afero
+	apiURL     string
+	webURL     string
+	token      string
+	// cache is used to skip downloading a ref that hasn't moved since it was last fetched, if set
+	cache *upstreamcache.Cache
+	// verifier rejects checks that can't be made against Bitbucket upstreams
+	verifier *verify.Verifier
+}
+
+// NewBitbucketClient builds a BitbucketClient. Requests are authenticated with the access token
+// set with --bitbucket-token or BITBUCKET_TOKEN, if there is one.
+func NewBitbucketClient(fs afero.Afero, logger log.Logger, v *viper.Viper, cache *upstreamcache.Cache, verifier *verify.Verifier) *BitbucketClient {
+	return &BitbucketClient{
+		logger:     logger,
+		httpClient: &http.Client{},
+		fs:         fs,
+		apiURL:     DefaultAPIURL,
+		webURL:     DefaultWebURL,
+		token:      v.GetString("bitbucket-token"),
+		cache:      cache,
+		verifier:   verifier,
+	}
+}
+
+// IsBitbucketURL returns true if upstream is a Bitbucket Cloud repo
+func (b *BitbucketClient) IsBitbucketURL(upstream string) bool {
+	return util.IsBitbucketURL(upstream)
+}
+
+func (b *BitbucketClient) GetFiles(
+	ctx context.Context,
+	upstream string,
+	destinationPath string,
+) (string, error) {
+	debug := level.Debug(log.With(b.logger, "method", "GetFiles"))
+
+	debug.Log("event", "parseBitbucketURL")
+	parsed, err := util.ParseBitbucketURL(upstream, "")
+	if err != nil {
+		return "", err
+	}
+	if err := b.verifier.RequireOnly("Bitbucket upstreams"); err != nil {
+		return "", err
+	}
+
+	debug.Log("event", "removeAll", "destinationPath", destinationPath)
+	err = b.fs.RemoveAll(destinationPath)
+	if err != nil {
+		return "", errors.Wrap(err, "remove chart clone destination")
+	}
+
+	repoPath := parsed.Subdir
+	downloadBasePath := ""
+	if filepath.Ext(repoPath) != "" {
+		downloadBasePath = repoPath
+		repoPath = ""
+	}
+	resolve := b.resolveCommit(ctx, parsed.Owner, parsed.Repo, parsed.Ref)
+	fetch := func(version *upstreamcache.Version) error {
+		if version.ID == "" {
+			// archives are only served for a named ref, so the default branch has to be looked up
+			resolved, err := resolve(nil)
+			if err != nil {
+				return err
+			}
+			*version = resolved
+		}
+		// download exactly the commit that was resolved, even if the branch has moved on since
+		if err := b.downloadAndExtractFiles(ctx, parsed.Owner, parsed.Repo, version.ID, downloadBasePath, destinationPath); err != nil {
+			return errors2.FetchFilesError{Message: util.RedactSecrets(err.Error(), b.token)}
+		}
+		return nil
+	}
+
+	if b.cache == nil {
+		err = fetch(&upstreamcache.Version{})
+	} else {
+		_, err = b.cache.Fetch(upstream, destinationPath, resolve, fetch)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	localPath := filepath.Join(destinationPath, repoPath)
+	exists, err := b.fs.Exists(localPath)
+	if err != nil {
+		return "", errors.Wrapf(err, "check %s", localPath)
+	}
+	if !exists {
+		return "", errors2.FetchFilesError{Message: fmt.Sprintf("Path %s in %s/%s not found", repoPath, parsed.Owner, parsed.Repo)}
+	}
+	return localPath, nil
+}
+
+// resolveCommit finds the commit hash that ref points to, or the main branch if ref is empty
+func (b *BitbucketClient) resolveCommit(ctx context.Context, owner, repo, ref string) func(previous *upstreamcache.Version) (upstreamcache.Version, error) {
+	return func(previous *upstreamcache.Version) (upstreamcache.Version, error) {
+		debug := level.Debug(log.With(b.logger, "method", "resolveCommit"))
+
+		resolvedRef := ref
+		if resolvedRef == "" {
+			mainBranch, err := b.mainBranch(ctx, owner, repo)
+			if err != nil {
+				return upstreamcache.Version{}, err
+			}
+			resolvedRef = mainBranch
+		}
+
+		var commit struct {
+			Hash string `json:"hash"`
+		}
+		if err := b.getJSON(ctx, repositoryPath(owner, repo, "commit", resolvedRef), nil, &commit); err != nil {
+			return upstreamcache.Version{}, errors2.FetchFilesError{
+				Message: util.RedactSecrets(fmt.Sprintf("resolve %s in %s/%s: %s", resolvedRef, owner, repo, err.Error()), b.token),
+			}
+		}
+
+		debug.Log("event", "commit.resolve", "ref", resolvedRef, "sha", commit.Hash)
+		return upstreamcache.Version{Ref: resolvedRef, ID: commit.Hash}, nil
+	}
+}
+
+func (b *BitbucketClient) mainBranch(ctx context.Context, owner, repo string) (string, error) {
+	var repository struct {
+		MainBranch struct {
+			Name string `json:"name"`
+		} `json:"mainbranch"`
+	}
+	if err := b.getJSON(ctx, repositoryPath(owner, repo), nil, &repository); err != nil {
+		return "", errors2.FetchFilesError{
+			Message: util.RedactSecrets(fmt.Sprintf("get repository %s/%s: %s", owner, repo, err.Error()), b.token),
+		}
+	}
+	if repository.MainBranch.Name == "" {
+		return "", errors2.FetchFilesError{Message: fmt.Sprintf("repository %s/%s has no main branch", owner, repo)}
+	}
+	return repository.MainBranch.Name, nil
+}
+
+func (b *BitbucketClient) downloadAndExtractFiles(
+	ctx context.Context,
+	owner string,
+	repo string,
+	ref string,
+	basePath string,
+	filePath string,
+) error {
+	debug := level.Debug(log.With(b.logger, "method", "downloadAndExtractFiles"))
+
+	archiveURL := fmt.Sprintf("%s/%s/%s/get/%s.tar.gz", b.webURL, url.PathEscape(owner), url.PathEscape(repo), url.PathEscape(ref))
+	debug.Log("event", "archive.download", "owner", owner, "repo", repo, "ref", ref)
+	resp, err := b.get(ctx, archiveURL)
+	if err != nil {
+		return errors.Wrapf(err, "downloading archive")
+	}
+	defer resp.Body.Close()
+
+	basePathFound, err := util.ExtractRepoArchive(b.fs, resp.Body, basePath, filePath)
+	if err != nil {
+		return err
+	}
+	if !basePathFound {
+		return errors.Errorf("Path %s in %s/%s at %s not found", basePath, owner, repo, ref)
+	}
+	return nil
+}
+
+// ResolveReleaseNotes returns the message of the latest commit to the upstream's path
+func (b *BitbucketClient) ResolveReleaseNotes(ctx context.Context, upstream string) (string, error) {
+	debug := level.Debug(log.With(b.logger, "method", "ResolveReleaseNotes"))
+
+	debug.Log("event", "parseBitbucketURL")
+	parsed, err := util.ParseBitbucketURL(upstream, "")
+	if err != nil {
+		return "", errors.Wrap(err, "not a valid bitbucket url")
+	}
+
+	ref := parsed.Ref
+	if ref == "" {
+		if ref, err = b.mainBranch(ctx, parsed.Owner, parsed.Repo); err != nil {
+			return "", err
+		}
+	}
+
+	query := url.Values{"pagelen": []string{"1"}}
+	if parsed.Subdir != "" {
+		query.Set("path", parsed.Subdir)
+	}
+
+	var commits struct {
+		Values []struct {
+			Message string `json:"message"`
+		} `json:"values"`
+	}
+	if err := b.getJSON(ctx, repositoryPath(parsed.Owner, parsed.Repo, "commits", ref), query, &commits); err != nil {
+		return "", errors.New(util.RedactSecrets(err.Error(), b.token))
+	}
+
+	if len(commits.Values) > 0 {
+		return commits.Values[0].Message, nil
+	}
+	return "", errors.New("No commit available")
+}
+
+// repositoryPath is the API path of a repo, or of a resource under it, with each part escaped
+func repositoryPath(owner, repo string, parts ...string) string {
+	escaped := []string{"repositories", url.PathEscape(owner), url.PathEscape(repo)}
+	for _, part := range parts {
+		escaped = append(escaped, url.PathEscape(part))
+	}
+	return strings.Join(escaped, "/")
+}
+
+func (b *BitbucketClient) getJSON(ctx context.Context, apiPath string, query url.Values, out interface{}) error {
+	requestURL := fmt.Sprintf("%s/%s", strings.TrimSuffix(b.apiURL, "/"), apiPath)
+	if len(query) > 0 {
+		requestURL = requestURL + "?" + query.Encode()
+	}
+
+	resp, err := b.get(ctx, requestURL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return errors.Wrapf(err, "decode %s", apiPath)
+	}
+	return nil
+}
+
+// get requests requestURL, authenticated with the token if there is one.
+// The response is only returned if it was a 200, and its body has to be closed.
+func (b *BitbucketClient) get(ctx context.Context, requestURL string) (*http.Response, error) {
+	req, err := http.NewRequest("GET", requestURL, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "create request for %s", requestURL)
+	}
+	req = req.WithContext(ctx)
+	if b.token != "" {
+		req.Header.Set("Authorization", "Bearer "+b.token)
+	}
+
+	httpClient := b.httpClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "get %s", requestURL)
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		resp.Body.Close()
+		return nil, errors.Errorf("get %s: unexpected status %s: %s", requestURL, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return resp, nil
+}
@@ -0,0 +1,180 @@
+package bitbucketclient
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/replicatedhq/ship/pkg/specs/upstreamcache"
+	"github.com/spf13/afero"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+)
+
+// bitbucketStandIn serves the parts of the 2.0 API and the archive downloads the client uses, for the repo platform/charts
+type bitbucketStandIn struct {
+	token     string
+	hash      string
+	archiveAt []string
+}
+
+func (s *bitbucketStandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.token != "" && r.Header.Get("Authorization") != "Bearer "+s.token {
+		http.Error(w, `{"type":"error","error":{"message":"Repository not found"}}`, http.StatusNotFound)
+		return
+	}
+
+	switch r.URL.Path {
+	case "/2.0/repositories/platform/charts":
+		fmt.Fprint(w, `{"mainbranch":{"name":"main","type":"branch"}}`)
+	case "/2.0/repositories/platform/charts/commit/main", "/2.0/repositories/platform/charts/commit/v1.2.0":
+		fmt.Fprintf(w, `{"hash":%q}`, s.hash)
+	case "/2.0/repositories/platform/charts/commits/main":
+		if r.URL.Query().Get("path") != "stable/nginx" {
+			fmt.Fprint(w, `{"values":[]}`)
+			return
+		}
+		fmt.Fprint(w, `{"values":[{"hash":"abc","message":"nginx: bump to 1.15\n"}]}`)
+	case "/platform/charts/get/" + s.hash + ".tar.gz":
+		s.archiveAt = append(s.archiveAt, s.hash)
+		w.Write(repoArchive(map[string]string{
+			"stable/nginx/Chart.yaml":                "name: nginx",
+			"stable/nginx/templates/deployment.yaml": "kind: Deployment",
+			"plain-k8s/service.yaml":                 "kind: Service",
+		}))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func repoArchive(files map[string]string) []byte {
+	var buf bytes.Buffer
+	gzipWriter := gzip.NewWriter(&buf)
+	tarWriter := tar.NewWriter(gzipWriter)
+	for name, contents := range files {
+		tarWriter.WriteHeader(&tar.Header{Name: "platform-charts-abc/" + name, Mode: 0644, Size: int64(len(contents)), Typeflag: tar.TypeReg})
+		tarWriter.Write([]byte(contents))
+	}
+	tarWriter.Close()
+	gzipWriter.Close()
+	return buf.Bytes()
+}
+
+func testClient(serverURL string, token string) *BitbucketClient {
+	v := viper.New()
+	v.Set("bitbucket-token", token)
+	client := NewBitbucketClient(afero.Afero{Fs: afero.NewMemMapFs()}, log.NewNopLogger(), v, nil, nil)
+	client.apiURL = serverURL + "/2.0"
+	client.webURL = serverURL
+	return client
+}
+
+func TestBitbucketClientGetFiles(t *testing.T) {
+	standIn := &bitbucketStandIn{token: "bb-secret", hash: "0123456789abcdef"}
+	server := httptest.NewServer(standIn)
+	defer server.Close()
+
+	tests := []struct {
+		name       string
+		upstream   string
+		token      string
+		expectFile string
+		expectErr  string
+	}{
+		{
+			name:       "chart in a subdir on the main branch",
+			upstream:   "bitbucket.org/platform/charts/stable/nginx",
+			token:      "bb-secret",
+			expectFile: "templates/deployment.yaml",
+		},
+		{
+			name:       "src at a ref",
+			upstream:   "https://bitbucket.org/platform/charts/src/v1.2.0/stable/nginx",
+			token:      "bb-secret",
+			expectFile: "Chart.yaml",
+		},
+		{
+			name:       "single file",
+			upstream:   "bitbucket.org/platform/charts/src/main/plain-k8s/service.yaml",
+			token:      "bb-secret",
+			expectFile: "plain-k8s/service.yaml",
+		},
+		{
+			name:      "missing subdir",
+			upstream:  "bitbucket.org/platform/charts/stable/mysql",
+			token:     "bb-secret",
+			expectErr: "Path stable/mysql in platform/charts not found",
+		},
+		{
+			name:      "wrong token",
+			upstream:  "bitbucket.org/platform/charts/stable/nginx",
+			token:     "bb-wrong",
+			expectErr: "404 Not Found",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := require.New(t)
+			standIn.archiveAt = nil
+			client := testClient(server.URL, test.token)
+
+			localPath, err := client.GetFiles(context.Background(), test.upstream, "/tmp/chart")
+			if test.expectErr != "" {
+				req.Error(err)
+				req.Contains(err.Error(), test.expectErr)
+				req.NotContains(err.Error(), test.token)
+				return
+			}
+			req.NoError(err)
+
+			exists, err := client.fs.Exists(filepath.Join(localPath, test.expectFile))
+			req.NoError(err)
+			req.True(exists, "%s in %s", test.expectFile, localPath)
+			req.Equal([]string{"0123456789abcdef"}, standIn.archiveAt)
+		})
+	}
+}
+
+func TestBitbucketClientGetFilesCached(t *testing.T) {
+	req := require.New(t)
+	standIn := &bitbucketStandIn{hash: "0123456789abcdef"}
+	server := httptest.NewServer(standIn)
+	defer server.Close()
+
+	client := testClient(server.URL, "")
+	client.cache = &upstreamcache.Cache{Logger: log.NewNopLogger(), FS: client.fs, Dir: "/cache"}
+	upstream := "bitbucket.org/platform/charts/stable/nginx"
+
+	_, err := client.GetFiles(context.Background(), upstream, "/tmp/chart")
+	req.NoError(err)
+	_, err = client.GetFiles(context.Background(), upstream, "/tmp/chart")
+	req.NoError(err)
+	req.Len(standIn.archiveAt, 1)
+
+	standIn.hash = "fedcba9876543210"
+	_, err = client.GetFiles(context.Background(), upstream, "/tmp/chart")
+	req.NoError(err)
+	req.Equal([]string{"0123456789abcdef", "fedcba9876543210"}, standIn.archiveAt)
+}
+
+func TestBitbucketClientResolveReleaseNotes(t *testing.T) {
+	req := require.New(t)
+	server := httptest.NewServer(&bitbucketStandIn{})
+	defer server.Close()
+	client := testClient(server.URL, "")
+
+	notes, err := client.ResolveReleaseNotes(context.Background(), "bitbucket.org/platform/charts/stable/nginx")
+	req.NoError(err)
+	req.Equal("nginx: bump to 1.15\n", notes)
+
+	_, err = client.ResolveReleaseNotes(context.Background(), "bitbucket.org/platform/charts/stable/mysql")
+	req.Error(err)
+	req.Equal("No commit available", err.Error())
+}
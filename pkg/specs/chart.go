@@ -15,11 +15,13 @@ import (
 	"github.com/replicatedhq/libyaml"
 	"github.com/replicatedhq/ship/pkg/api"
 	"github.com/replicatedhq/ship/pkg/constants"
+	"github.com/replicatedhq/ship/pkg/specs/githubclient"
+	"github.com/replicatedhq/ship/pkg/specs/helmrepo"
 	"github.com/replicatedhq/ship/pkg/util"
 	"gopkg.in/yaml.v2"
 )
 
-func (r *Resolver) DefaultHelmRelease(chartPath string) api.Spec {
+func (r *Resolver) DefaultHelmRelease(chartPath string, chartAPIVersion string) api.Spec {
 	spec := api.Spec{
 		Assets: api.Assets{
 			V1: []api.Asset{
@@ -29,7 +31,8 @@ func (r *Resolver) DefaultHelmRelease(chartPath string) api.Spec {
 							Dest: constants.KustomizeBasePath,
 						},
 						Local: &api.LocalHelmOpts{
-							ChartRoot: chartPath,
+							ChartRoot:       chartPath,
+							ChartAPIVersion: chartAPIVersion,
 						},
 						ValuesFrom: &api.ValuesFrom{
 							Lifecycle: &api.ValuesFromLifecycle{},
@@ -72,7 +75,8 @@ func (r *Resolver) DefaultHelmRelease(chartPath string) api.Spec {
 							ID:       "kustomize",
 							Requires: []string{"render"},
 						},
-						Dest: "rendered.yaml",
+						Dest:  "rendered.yaml",
+						Hooks: constants.HelmHooksPath,
 					},
 				},
 			},
@@ -148,6 +152,64 @@ to deploy the overlaid assets to your cluster.
 	return spec
 }
 
+// DefaultComposedRelease renders the charts among an application's named upstreams into base/<name>,
+// next to the manifests of the rest, and kustomizes all of base/ together
+func (r *Resolver) DefaultComposedRelease(assets []api.Asset) api.Spec {
+	spec := api.Spec{
+		Assets: api.Assets{
+			V1: assets,
+		},
+		Lifecycle: api.Lifecycle{
+			V1: []api.Step{
+				{
+					Render: &api.Render{
+						StepShared: api.StepShared{
+							ID: "render",
+						},
+						Root: ".",
+					},
+				},
+				{
+					KustomizeIntro: &api.KustomizeIntro{
+						StepShared: api.StepShared{
+							ID: "kustomize-intro",
+						},
+					},
+				},
+				{
+					Kustomize: &api.Kustomize{
+						Base:    constants.KustomizeBasePath,
+						Overlay: path.Join("overlays", "ship"),
+						StepShared: api.StepShared{
+							ID:       "kustomize",
+							Requires: []string{"render"},
+						},
+						Dest:  "rendered.yaml",
+						Hooks: constants.HelmHooksPath,
+					},
+				},
+			},
+		},
+	}
+	if !r.NoOutro {
+		spec.Lifecycle.V1 = append(spec.Lifecycle.V1, api.Step{
+			Message: &api.Message{
+				StepShared: api.StepShared{
+					ID:       "outro",
+					Requires: []string{"kustomize"},
+				},
+				Contents: `
+Assets are ready to deploy. You can run
+
+kubectl apply -f rendered.yaml
+
+to deploy the overlaid assets to your cluster.
+`},
+		})
+	}
+	return spec
+}
+
 func (r *Resolver) resolveMetadata(ctx context.Context, upstream, localPath string, applicationType string) (*api.ShipAppMetadata, error) {
 	debug := level.Debug(log.With(r.Logger, "method", "ResolveHelmMetadata"))
 
@@ -156,8 +218,8 @@ func (r *Resolver) resolveMetadata(ctx context.Context, upstream, localPath stri
 		return nil, errors.Wrap(err, "resolve base metadata")
 	}
 
-	if util.IsGithubURL(upstream) {
-		releaseNotes, err := r.GitHubReleaseNotesFetcher.ResolveReleaseNotes(ctx, upstream)
+	if fetcher := r.releaseNotesFetcher(upstream); fetcher != nil {
+		releaseNotes, err := fetcher.ResolveReleaseNotes(ctx, upstream)
 		if err != nil {
 			debug.Log("event", "releaseNotes.resolve.fail", "upstream", upstream, "err", err)
 		}
@@ -169,6 +231,13 @@ func (r *Resolver) resolveMetadata(ctx context.Context, upstream, localPath stri
 		return nil, errors.Wrap(err, "write content sha")
 	}
 
+	if resolved, ok := r.resolvedHelmRepoChart(upstream); ok {
+		debug.Log("event", "upstreamVersion.serialize", "upstream", upstream, "version", resolved.Version)
+		if err := r.StateManager.SerializeUpstreamVersion(resolved.Version); err != nil {
+			return nil, errors.Wrap(err, "write upstream version")
+		}
+	}
+
 	localChartPath := filepath.Join(localPath, "Chart.yaml")
 
 	exists, err := r.FS.Exists(localChartPath)
@@ -197,17 +266,34 @@ func (r *Resolver) resolveMetadata(ctx context.Context, upstream, localPath stri
 	return baseMetadata, nil
 }
 
+// releaseNotesFetcher returns the client that can look up the release notes of upstream, or nil if there isn't one
+func (r *Resolver) releaseNotesFetcher(upstream string) githubclient.GitHubReleaseNotesFetcher {
+	switch {
+	case util.IsGithubURL(upstream):
+		return r.GitHubReleaseNotesFetcher
+	case r.GitLab != nil && r.GitLab.IsGitlabURL(upstream):
+		return r.GitLab
+	case r.Bitbucket != nil && r.Bitbucket.IsBitbucketURL(upstream):
+		return r.Bitbucket
+	}
+	return nil
+}
+
 // ResolveBaseMetadata resolves URL, ContentSHA, and Readme for the resource
 func (r *Resolver) ResolveBaseMetadata(upstream string, localPath string) (*api.ShipAppMetadata, error) {
 	debug := level.Debug(log.With(r.Logger, "method", "resolveBaseMetaData"))
 	var md api.ShipAppMetadata
-	md.URL = upstream
+	md.URL = util.StripCredentials(upstream)
 	debug.Log("phase", "calculate-sha", "for", localPath)
 	contentSHA, err := r.shaSummer(r, localPath)
 	if err != nil {
 		return nil, errors.Wrapf(err, "calculate chart sha")
 	}
 	md.ContentSHA = contentSHA
+	if resolved, ok := r.resolvedHelmRepoChart(upstream); ok {
+		// use the tarball digest so it matches what ReadContentSHAForWatch finds in the repository index
+		md.ContentSHA = resolved.Digest
+	}
 
 	localReadmePath := filepath.Join(localPath, "README.md")
 	debug.Log("phase", "read-readme", "from", localReadmePath)
@@ -231,11 +317,34 @@ This is a deployment generator for
 
 Sources for your app have been generated at %s. This installer will walk you through
 customizing these resources and preparing them to deploy to your infrastructure.
-`, upstream, localPath)
+`, util.StripCredentials(upstream), localPath)
 	}
 	return &md, nil
 }
 
+// chartVersion reads the version from the Chart.yaml in localPath, if there is one
+func (r *Resolver) chartVersion(localPath string) string {
+	contents, err := r.FS.ReadFile(filepath.Join(localPath, "Chart.yaml"))
+	if err != nil {
+		return ""
+	}
+
+	var chart api.ShipAppMetadata
+	if err := yaml.Unmarshal(contents, &chart); err != nil {
+		level.Debug(r.Logger).Log("event", "chart.unmarshal.fail", "path", localPath, "err", err)
+		return ""
+	}
+	return chart.Version
+}
+
+// resolvedHelmRepoChart returns the chart version a helm repository upstream was fetched at during this run
+func (r *Resolver) resolvedHelmRepoChart(upstream string) (*helmrepo.Resolved, bool) {
+	if r.HelmRepo == nil || !helmrepo.IsHelmRepoUpstream(upstream) {
+		return nil, false
+	}
+	return r.HelmRepo.Resolved(upstream)
+}
+
 func (r *Resolver) maybeGetShipYAML(ctx context.Context, localPath string) (*api.Spec, error) {
 	localReleasePaths := []string{
 		filepath.Join(localPath, "ship.yaml"),
@@ -268,6 +377,22 @@ func (r *Resolver) maybeGetShipYAML(ctx context.Context, localPath string) (*api
 	return nil, nil
 }
 
+// persistSpec writes a release found in an upstream's ship.yaml to .ship/release.yml, like releases from
+// replicated.app, so later runs can read its config groups without resolving the upstream again
+func (r *Resolver) persistSpec(spec api.Spec) error {
+	specYAML, err := yaml.Marshal(spec)
+	if err != nil {
+		return errors.Wrap(err, "marshal release")
+	}
+	if err := r.FS.MkdirAll(filepath.Dir(constants.ReleasePath), 0700); err != nil {
+		return errors.Wrapf(err, "mkdir %s", filepath.Dir(constants.ReleasePath))
+	}
+	if err := r.FS.WriteFile(constants.ReleasePath, specYAML, 0644); err != nil {
+		return errors.Wrapf(err, "write %s", constants.ReleasePath)
+	}
+	return nil
+}
+
 type shaSummer func(r *Resolver, localPath string) (string, error)
 
 func (r *Resolver) calculateContentSHA(root string) (string, error) {
@@ -17,6 +17,7 @@ import (
 	"github.com/spf13/afero"
 	"github.com/spf13/viper"
 	"github.com/stretchr/testify/require"
+	yaml "gopkg.in/yaml.v2"
 )
 
 type ApplyUpstreamReleaseSpec struct {
@@ -540,3 +541,33 @@ spec:
 		})
 	}
 }
+
+func TestResolver_persistSpec(t *testing.T) {
+	req := require.New(t)
+	mockFs := afero.Afero{Fs: afero.NewMemMapFs()}
+	r := Resolver{FS: mockFs, Logger: log.NewNopLogger()}
+
+	shipYAML := `
+config:
+  v1:
+  - name: database
+    items:
+    - name: db_password
+      type: password
+lifecycle:
+  v1:
+  - render: {}
+`
+	var spec api.Spec
+	req.NoError(yaml.UnmarshalStrict([]byte(shipYAML), &spec))
+	req.NoError(r.persistSpec(spec))
+
+	persisted, err := mockFs.ReadFile(constants.ReleasePath)
+	req.NoError(err)
+	var reread api.Spec
+	req.NoError(yaml.Unmarshal(persisted, &reread))
+	req.Len(reread.Config.V1, 1)
+	req.Equal("database", reread.Config.V1[0].Name)
+	req.Equal("db_password", reread.Config.V1[0].Items[0].Name)
+	req.Equal("password", reread.Config.V1[0].Items[0].Type)
+}
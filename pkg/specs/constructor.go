@@ -4,8 +4,12 @@ import (
 	"github.com/go-kit/kit/log"
 	"github.com/mitchellh/cli"
 	"github.com/replicatedhq/ship/pkg/specs/apptype"
+	"github.com/replicatedhq/ship/pkg/specs/bitbucketclient"
 	"github.com/replicatedhq/ship/pkg/specs/githubclient"
+	"github.com/replicatedhq/ship/pkg/specs/gitlabclient"
+	"github.com/replicatedhq/ship/pkg/specs/helmrepo"
 	"github.com/replicatedhq/ship/pkg/specs/replicatedapp"
+	"github.com/replicatedhq/ship/pkg/specs/verify"
 	"github.com/replicatedhq/ship/pkg/state"
 	"github.com/spf13/afero"
 	"github.com/spf13/viper"
@@ -19,10 +23,15 @@ type Resolver struct {
 	FS                        afero.Afero
 	AppResolver               replicatedapp.Resolver
 	GitHubReleaseNotesFetcher githubclient.GitHubReleaseNotesFetcher
+	GitLab                    *gitlabclient.GitlabClient
+	Bitbucket                 *bitbucketclient.BitbucketClient
+	HelmRepo                  *helmrepo.Client
+	Verifier                  *verify.Verifier
 
 	ui               cli.Ui
 	appTypeInspector apptype.Inspector
 	shaSummer        shaSummer
+	kustomizeBuilder kustomizeBuilder
 
 	Viper   *viper.Viper
 	NoOutro bool
@@ -40,6 +49,10 @@ func NewResolver(
 	determiner apptype.Inspector,
 	appresolver replicatedapp.Resolver,
 	github *githubclient.GithubClient,
+	gitlab *gitlabclient.GitlabClient,
+	bitbucket *bitbucketclient.BitbucketClient,
+	helmRepo *helmrepo.Client,
+	verifier *verify.Verifier,
 ) *Resolver {
 	return &Resolver{
 		Logger:           logger,
@@ -52,8 +65,13 @@ func NewResolver(
 		shaSummer: func(resolver *Resolver, s string) (string, error) {
 			return resolver.calculateContentSHA(s)
 		},
+		kustomizeBuilder:          runKustomize,
 		AppResolver:               appresolver,
 		GitHubReleaseNotesFetcher: github,
+		GitLab:                    gitlab,
+		Bitbucket:                 bitbucket,
+		HelmRepo:                  helmRepo,
+		Verifier:                  verifier,
 		NoOutro:                   v.GetBool("no-outro"),
 	}
 }
@@ -1,14 +1,10 @@
 package githubclient
 
 import (
-	"archive/tar"
-	"compress/gzip"
 	"context"
 	"fmt"
-	"io"
 	"net/http"
 	"net/url"
-	"path"
 	"path/filepath"
 	"strings"
 
@@ -16,8 +12,13 @@ import (
 	"github.com/go-kit/kit/log/level"
 	"github.com/google/go-github/github"
 	"github.com/pkg/errors"
+	"github.com/replicatedhq/ship/pkg/specs/upstreamcache"
+	"github.com/replicatedhq/ship/pkg/specs/verify"
+	"github.com/replicatedhq/ship/pkg/state"
+	"github.com/replicatedhq/ship/pkg/util"
 	errors2 "github.com/replicatedhq/ship/pkg/util/errors"
 	"github.com/spf13/afero"
+	"github.com/spf13/viper"
 )
 
 type GitHubReleaseNotesFetcher interface {
@@ -27,18 +28,103 @@ type GitHubReleaseNotesFetcher interface {
 var _ GitHubReleaseNotesFetcher = &GithubClient{}
 
 type GithubClient struct {
-	logger log.Logger
-	client *github.Client
-	fs     afero.Afero
+	logger     log.Logger
+	client     *github.Client
+	httpClient *http.Client
+	fs         afero.Afero
+	// enterpriseHost is the host of the GitHub Enterprise instance set with --github-base-url, if any
+	enterpriseHost string
+	token          string
+	// cache is used to skip downloading a ref that hasn't moved since it was last fetched, if set
+	cache *upstreamcache.Cache
+	// verifier checks that refs are signed, if it's set and --verify-signatures was given
+	verifier *verify.Verifier
 }
 
-func NewGithubClient(fs afero.Afero, logger log.Logger) *GithubClient {
-	client := github.NewClient(nil)
+// NewGithubClient builds a GithubClient. Requests are authenticated with --github-token or GITHUB_TOKEN if set,
+// and go to the GitHub Enterprise API at --github-base-url instead of github.com if that's set.
+func NewGithubClient(fs afero.Afero, logger log.Logger, v *viper.Viper, cache *upstreamcache.Cache, verifier *verify.Verifier) *GithubClient {
+	token := v.GetString("github-token")
+	httpClient := &http.Client{}
+	if token != "" {
+		httpClient.Transport = &tokenTransport{token: token}
+	}
+
+	client := github.NewClient(httpClient)
+	enterpriseHost := ""
+	if baseURL := v.GetString("github-base-url"); baseURL != "" {
+		enterpriseClient, err := github.NewEnterpriseClient(baseURL, baseURL, httpClient)
+		if err != nil {
+			level.Error(logger).Log("event", "github.enterprise.client", "baseURL", util.Redact(baseURL), "err", err)
+		} else {
+			client = enterpriseClient
+			enterpriseHost = enterpriseClient.BaseURL.Host
+		}
+	}
+
+	if transport, ok := httpClient.Transport.(*tokenTransport); ok {
+		transport.host = client.BaseURL.Host
+	}
+
 	return &GithubClient{
-		client: client,
-		fs:     fs,
-		logger: logger,
+		client:         client,
+		httpClient:     httpClient,
+		fs:             fs,
+		logger:         logger,
+		enterpriseHost: enterpriseHost,
+		token:          token,
+		cache:          cache,
+		verifier:       verifier,
+	}
+}
+
+// tokenTransport authenticates requests to the GitHub API host with a token.
+// Archive downloads redirected to other hosts are already authorized by the redirect URL, so they don't get the token.
+type tokenTransport struct {
+	token string
+	host  string
+	base  http.RoundTripper
+}
+
+func (t *tokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if req.URL.Host != t.host {
+		return base.RoundTrip(req)
+	}
+
+	// RoundTrippers shouldn't modify the request they're given
+	authenticated := new(http.Request)
+	*authenticated = *req
+	authenticated.Header = make(http.Header, len(req.Header)+1)
+	for key, values := range req.Header {
+		authenticated.Header[key] = values
+	}
+	authenticated.Header.Set("Authorization", "token "+t.token)
+	return base.RoundTrip(authenticated)
+}
+
+// IsGithubURL returns true if upstream is on github.com, or on the GitHub Enterprise instance set with --github-base-url
+func (g *GithubClient) IsGithubURL(upstream string) bool {
+	if util.IsGithubURL(upstream) {
+		return true
+	}
+	return g.isEnterpriseURL(upstream)
+}
+
+// EnterpriseHost returns the host of the GitHub Enterprise instance set with --github-base-url, or "" if there isn't one
+func (g *GithubClient) EnterpriseHost() string {
+	return g.enterpriseHost
+}
+
+func (g *GithubClient) isEnterpriseURL(upstream string) bool {
+	if g.enterpriseHost == "" {
+		return false
 	}
+	trimmed := strings.TrimPrefix(strings.TrimPrefix(upstream, "https://"), "http://")
+	return strings.HasPrefix(trimmed, g.enterpriseHost+"/")
 }
 
 func (g *GithubClient) GetFiles(
@@ -49,10 +135,13 @@ func (g *GithubClient) GetFiles(
 	debug := level.Debug(log.With(g.logger, "method", "getRepoContents"))
 
 	debug.Log("event", "validateGithubURL")
-	validatedUpstreamURL, err := validateGithubURL(upstream)
+	validatedUpstreamURL, err := g.validateGithubURL(upstream)
 	if err != nil {
 		return "", err
 	}
+	if err := g.verifier.RequireOnly("GitHub upstreams", verify.FlagSignatures); err != nil {
+		return "", err
+	}
 
 	debug.Log("event", "decodeGithubURL")
 	owner, repo, branch, repoPath, err := decodeGitHubURL(validatedUpstreamURL.Path)
@@ -71,14 +160,150 @@ func (g *GithubClient) GetFiles(
 		downloadBasePath = repoPath
 		repoPath = ""
 	}
-	err = g.downloadAndExtractFiles(ctx, owner, repo, branch, downloadBasePath, destinationPath)
+	fetch := func(version *upstreamcache.Version) error {
+		ref := branch
+		if version.Verification != nil {
+			// download exactly the commit that was verified, even if the branch has moved on since
+			ref = version.ID
+		}
+		err := g.downloadAndExtractFiles(ctx, owner, repo, ref, downloadBasePath, destinationPath)
+		if err != nil {
+			return errors2.FetchFilesError{Message: util.RedactSecrets(err.Error(), g.token)}
+		}
+		return nil
+	}
+
+	resolve := g.resolveCommit(ctx, owner, repo, branch)
+	if g.verifier != nil && g.verifier.Signatures {
+		resolve = g.resolveSignedCommit(ctx, owner, repo, resolve)
+	}
+
+	var verification *state.Verification
+	if g.cache == nil {
+		version := upstreamcache.Version{}
+		if g.verifier != nil && g.verifier.Signatures {
+			if version, err = resolve(nil); err != nil {
+				return "", err
+			}
+		}
+		err = fetch(&version)
+		verification = version.Verification
+	} else {
+		var entry *upstreamcache.Entry
+		entry, err = g.cache.Fetch(upstream, destinationPath, func(previous *upstreamcache.Version) (upstreamcache.Version, error) {
+			version, err := resolve(previous)
+			verification = version.Verification
+			return version, err
+		}, fetch)
+		if err == nil && g.cache.Offline {
+			verification = entry.Version.Verification
+			if g.verifier != nil && g.verifier.Signatures && verification == nil {
+				return "", verify.Error{Message: fmt.Sprintf("%s was cached without checking its signature, run without --offline to check it", util.Redact(upstream))}
+			}
+		}
+	}
 	if err != nil {
-		return "", errors2.FetchFilesError{Message: err.Error()}
+		return "", err
 	}
+	g.verifier.Record(upstream, verification)
 
 	return filepath.Join(destinationPath, repoPath), nil
 }
 
+// resolveCommit finds the commit SHA that branch points to. The SHA the upstream was last fetched at is sent
+// as an ETag, so an unchanged branch costs a 304 that doesn't count against the rate limit.
+func (g *GithubClient) resolveCommit(ctx context.Context, owner, repo, branch string) func(previous *upstreamcache.Version) (upstreamcache.Version, error) {
+	return func(previous *upstreamcache.Version) (upstreamcache.Version, error) {
+		debug := level.Debug(log.With(g.logger, "method", "resolveCommit"))
+
+		ref := branch
+		if ref == "" {
+			ref = "HEAD"
+		}
+		lastSHA := ""
+		if previous != nil && previous.Ref == ref {
+			lastSHA = previous.ID
+		}
+
+		sha, resp, err := g.client.Repositories.GetCommitSHA1(ctx, owner, repo, ref, lastSHA)
+		if resp != nil && resp.StatusCode == http.StatusNotModified {
+			debug.Log("event", "commit.notModified", "ref", ref, "sha", lastSHA)
+			unchanged := *previous
+			// checked again if it was asked for, so it's only reported for runs that checked it
+			unchanged.Verification = nil
+			return unchanged, nil
+		}
+		if err != nil {
+			return upstreamcache.Version{}, errors2.FetchFilesError{
+				Message: util.RedactSecrets(fmt.Sprintf("resolve %s in %s/%s: %s", ref, owner, repo, err.Error()), g.token),
+			}
+		}
+
+		debug.Log("event", "commit.resolve", "ref", ref, "sha", sha)
+		return upstreamcache.Version{Ref: ref, ID: sha}, nil
+	}
+}
+
+// resolveSignedCommit wraps resolve, checking that the commit it resolves to is signed by a key in the keyring.
+// If the ref is an annotated tag with a signature, the tag's signature is checked instead of the commit's.
+func (g *GithubClient) resolveSignedCommit(
+	ctx context.Context,
+	owner, repo string,
+	resolve func(previous *upstreamcache.Version) (upstreamcache.Version, error),
+) func(previous *upstreamcache.Version) (upstreamcache.Version, error) {
+	return func(previous *upstreamcache.Version) (upstreamcache.Version, error) {
+		version, err := resolve(previous)
+		if err != nil {
+			return version, err
+		}
+
+		verification, err := g.verifySignature(ctx, owner, repo, version.Ref, version.ID)
+		if err != nil {
+			return upstreamcache.Version{}, err
+		}
+		version.Verification = verification
+		return version, nil
+	}
+}
+
+func (g *GithubClient) verifySignature(ctx context.Context, owner, repo, ref, sha string) (*state.Verification, error) {
+	debug := level.Debug(log.With(g.logger, "method", "verifySignature"))
+
+	if ref != "HEAD" {
+		// a missing tag is just a branch or a commit, so any error here falls through to checking the commit
+		tagRef, _, err := g.client.Git.GetRef(ctx, owner, repo, "tags/"+ref)
+		if err == nil && tagRef.GetObject().GetType() == "tag" {
+			tag, _, err := g.client.Git.GetTag(ctx, owner, repo, tagRef.GetObject().GetSHA())
+			if err != nil {
+				return nil, errors2.FetchFilesError{
+					Message: util.RedactSecrets(fmt.Sprintf("get tag %s in %s/%s: %s", ref, owner, repo, err.Error()), g.token),
+				}
+			}
+			signature := tag.GetVerification()
+			if signature.GetSignature() != "" {
+				if tag.GetObject().GetSHA() != sha {
+					return nil, verify.Error{Message: fmt.Sprintf("tag %s in %s/%s points to %s, not %s", ref, owner, repo, tag.GetObject().GetSHA(), sha)}
+				}
+				debug.Log("event", "tag.verify", "ref", ref, "sha", sha)
+				return g.verifier.VerifySignature(verify.MethodSignedTag, sha, signature.GetPayload(), signature.GetSignature())
+			}
+		}
+	}
+
+	commit, _, err := g.client.Git.GetCommit(ctx, owner, repo, sha)
+	if err != nil {
+		return nil, errors2.FetchFilesError{
+			Message: util.RedactSecrets(fmt.Sprintf("get commit %s in %s/%s: %s", sha, owner, repo, err.Error()), g.token),
+		}
+	}
+	signature := commit.GetVerification()
+	if signature.GetSignature() == "" {
+		return nil, verify.Error{Message: fmt.Sprintf("neither %s nor commit %s in %s/%s is signed", ref, sha, owner, repo)}
+	}
+	debug.Log("event", "commit.verify", "ref", ref, "sha", sha)
+	return g.verifier.VerifySignature(verify.MethodSignedCommit, sha, signature.GetPayload(), signature.GetSignature())
+}
+
 func (g *GithubClient) downloadAndExtractFiles(
 	ctx context.Context,
 	owner string,
@@ -99,68 +324,30 @@ func (g *GithubClient) downloadAndExtractFiles(
 		return errors.Wrapf(err, "get archive link for owner - %s repo - %s", owner, repo)
 	}
 
-	resp, err := http.Get(archiveLink.String())
+	httpClient := g.httpClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Get(archiveLink.String())
 	if err != nil {
 		return errors.Wrapf(err, "downloading archive")
 	}
 	defer resp.Body.Close()
 
-	uncompressedStream, err := gzip.NewReader(resp.Body)
-	if err != nil {
-		return errors.Wrapf(err, "create uncompressed stream")
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("downloading archive: unexpected status %s", resp.Status)
 	}
 
-	tarReader := tar.NewReader(uncompressedStream)
-
-	basePathFound := false
-	for {
-		header, err := tarReader.Next()
-		if err == io.EOF {
-			if !basePathFound {
-				branchString := branch
-				if branchString == "" {
-					branchString = "master"
-				}
-				return errors.Errorf("Path %s in %s/%s on branch %s not found", basePath, owner, repo, branchString)
-			}
-			break
-		}
-
-		if err != nil {
-			return errors.Wrapf(err, "extract tar gz, next()")
-		}
-
-		switch header.Typeflag {
-		case tar.TypeReg:
-			// need this in a func because defer in a loop was leaking handles
-			err := func() error {
-				fileName := strings.Join(strings.Split(header.Name, "/")[1:], "/")
-				if !strings.HasPrefix(fileName, basePath) {
-					return nil
-				}
-				basePathFound = true
-
-				if fileName != basePath {
-					fileName = strings.TrimPrefix(fileName, basePath)
-				}
-				dirPath, _ := path.Split(fileName)
-				if err := g.fs.MkdirAll(filepath.Join(filePath, dirPath), 0755); err != nil {
-					return errors.Wrapf(err, "extract tar gz, mkdir")
-				}
-				outFile, err := g.fs.Create(filepath.Join(filePath, fileName))
-				if err != nil {
-					return errors.Wrapf(err, "extract tar gz, create")
-				}
-				defer outFile.Close()
-				if _, err := io.Copy(outFile, tarReader); err != nil {
-					return errors.Wrapf(err, "extract tar gz, copy")
-				}
-				return nil
-			}()
-			if err != nil {
-				return err
-			}
+	basePathFound, err := util.ExtractRepoArchive(g.fs, resp.Body, basePath, filePath)
+	if err != nil {
+		return err
+	}
+	if !basePathFound {
+		branchString := branch
+		if branchString == "" {
+			branchString = "master"
 		}
+		return errors.Errorf("Path %s in %s/%s on branch %s not found", basePath, owner, repo, branchString)
 	}
 
 	return nil
@@ -170,7 +357,7 @@ func decodeGitHubURL(chartPath string) (owner string, repo string, branch string
 	splitPath := strings.Split(chartPath, "/")
 
 	if len(splitPath) < 3 {
-		return owner, repo, path, branch, errors.Wrapf(errors.New("unable to decode github url"), chartPath)
+		return owner, repo, branch, path, errors.Errorf("%s: unable to decode github url", chartPath)
 	}
 
 	owner = splitPath[1]
@@ -189,7 +376,7 @@ func decodeGitHubURL(chartPath string) (owner string, repo string, branch string
 	return owner, repo, branch, path, nil
 }
 
-func validateGithubURL(upstream string) (*url.URL, error) {
+func (g *GithubClient) validateGithubURL(upstream string) (*url.URL, error) {
 	if !strings.HasPrefix(upstream, "http") {
 
 		upstream = fmt.Sprintf("http://%s", upstream)
@@ -200,8 +387,9 @@ func validateGithubURL(upstream string) (*url.URL, error) {
 		return nil, err
 	}
 
-	if !strings.Contains(upstreamURL.Host, "github.com") {
-		return nil, errors.New(fmt.Sprintf("%s is not a Github URL", upstream))
+	isEnterprise := g.enterpriseHost != "" && upstreamURL.Host == g.enterpriseHost
+	if !strings.Contains(upstreamURL.Host, "github.com") && !isEnterprise {
+		return nil, errors.New(fmt.Sprintf("%s is not a Github URL", util.Redact(upstream)))
 	}
 
 	return upstreamURL, nil
@@ -211,7 +399,7 @@ func (g *GithubClient) ResolveReleaseNotes(ctx context.Context, upstream string)
 	debug := level.Debug(log.With(g.logger, "method", "ResolveReleaseNotes"))
 
 	debug.Log("event", "validateGithubURL")
-	validatedUpstreamURL, err := validateGithubURL(upstream)
+	validatedUpstreamURL, err := g.validateGithubURL(upstream)
 	if err != nil {
 		return "", errors.Wrap(err, "not a valid github url")
 	}
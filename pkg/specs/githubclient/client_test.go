@@ -1,9 +1,12 @@
 package githubclient
 
 import (
+	"bytes"
 	"context"
 	"encoding/base64"
+	"encoding/json"
 	"io"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -11,13 +14,18 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/go-kit/kit/log"
 	"github.com/google/go-github/github"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	"github.com/replicatedhq/ship/pkg/constants"
+	"github.com/replicatedhq/ship/pkg/specs/upstreamcache"
+	"github.com/replicatedhq/ship/pkg/specs/verify"
 	"github.com/spf13/afero"
+	"github.com/spf13/viper"
+	"golang.org/x/crypto/openpgp"
 )
 
 var client *github.Client
@@ -172,6 +180,210 @@ var _ = Describe("GithubClient", func() {
 		})
 	})
 
+	Describe("GetFiles from GitHub Enterprise with a token", func() {
+		enterpriseMux := http.NewServeMux()
+		enterprise := httptest.NewServer(enterpriseMux)
+		enterpriseHost := strings.TrimPrefix(enterprise.URL, "http://")
+		requireToken := func(next http.HandlerFunc) http.HandlerFunc {
+			return func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("Authorization") != "token s3cr3t" {
+					http.Error(w, "Bad credentials", http.StatusUnauthorized)
+					return
+				}
+				next(w, r)
+			}
+		}
+		redirectArchive := requireToken(func(w http.ResponseWriter, r *http.Request) {
+			http.Redirect(w, r, enterprise.URL+"/archive.tar.gz", http.StatusFound)
+		})
+		enterpriseMux.HandleFunc("/api/v3/repos/o/r/tarball/", redirectArchive)
+		enterpriseMux.HandleFunc("/api/v3/repos/o/r/tarball", redirectArchive)
+		archiveDownloads := 0
+		enterpriseMux.HandleFunc("/archive.tar.gz", requireToken(func(w http.ResponseWriter, r *http.Request) {
+			archiveDownloads++
+			mux.ServeHTTP(w, r)
+		}))
+		enterpriseMux.HandleFunc("/api/v3/repos/o/r/commits/HEAD", requireToken(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("If-None-Match") == `"abc123"` {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			io.WriteString(w, "abc123")
+		}))
+
+		newClient := func(token string) *GithubClient {
+			v := viper.New()
+			v.Set("github-base-url", enterprise.URL+"/api/v3/")
+			v.Set("github-token", token)
+			return NewGithubClient(afero.Afero{Fs: afero.NewMemMapFs()}, log.NewNopLogger(), v, nil, nil)
+		}
+
+		It("should recognize enterprise urls", func() {
+			gitClient := newClient("s3cr3t")
+			Expect(gitClient.IsGithubURL(enterpriseHost + "/o/r")).To(BeTrue())
+			Expect(gitClient.IsGithubURL("github.com/o/r")).To(BeTrue())
+			Expect(gitClient.IsGithubURL("gitlab.com/o/r")).To(BeFalse())
+		})
+
+		It("should fetch with the token", func() {
+			gitClient := newClient("s3cr3t")
+			dest, err := gitClient.GetFiles(context.Background(), enterpriseHost+"/o/r", constants.HelmChartPath)
+			Expect(err).NotTo(HaveOccurred())
+
+			chart, err := gitClient.fs.ReadFile(path.Join(dest, "Chart.yaml"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(chart)).To(Equal("bar"))
+		})
+
+		It("should fail without leaking the token", func() {
+			gitClient := newClient("wr0ng")
+			_, err := gitClient.GetFiles(context.Background(), enterpriseHost+"/o/r", constants.HelmChartPath)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("401"))
+			Expect(err.Error()).NotTo(ContainSubstring("wr0ng"))
+		})
+
+		It("should only download an unchanged ref once with a cache", func() {
+			fs := afero.Afero{Fs: afero.NewMemMapFs()}
+			v := viper.New()
+			v.Set("github-base-url", enterprise.URL+"/api/v3/")
+			v.Set("github-token", "s3cr3t")
+			v.Set("cache-dir", "/cache")
+			cache := upstreamcache.NewCache(log.NewNopLogger(), fs, v, time.Now)
+			gitClient := NewGithubClient(fs, log.NewNopLogger(), v, cache, nil)
+
+			archiveDownloads = 0
+			for i := 0; i < 3; i++ {
+				dest, err := gitClient.GetFiles(context.Background(), enterpriseHost+"/o/r", constants.HelmChartPath)
+				Expect(err).NotTo(HaveOccurred())
+				chart, err := fs.ReadFile(path.Join(dest, "Chart.yaml"))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(chart)).To(Equal("bar"))
+			}
+			Expect(archiveDownloads).To(Equal(1))
+
+			cache.Offline = true
+			offline := NewGithubClient(fs, log.NewNopLogger(), v, cache, nil)
+			dest, err := offline.GetFiles(context.Background(), enterpriseHost+"/o/r", constants.HelmChartPath)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fs.Exists(path.Join(dest, "Chart.yaml"))).To(BeTrue())
+		})
+	})
+
+	Describe("GetFiles with --verify-signatures", func() {
+		var signer *openpgp.Entity
+		var keyringPath string
+		BeforeEach(func() {
+			if signer != nil {
+				return
+			}
+			var err error
+			signer, err = openpgp.NewEntity("Release Bot", "", "release@example.com", nil)
+			Expect(err).NotTo(HaveOccurred())
+			keyringDir, err := ioutil.TempDir("", "githubclient-keyring")
+			Expect(err).NotTo(HaveOccurred())
+			var keyring bytes.Buffer
+			Expect(signer.Serialize(&keyring)).To(Succeed())
+			keyringPath = filepath.Join(keyringDir, "pubring.gpg")
+			Expect(ioutil.WriteFile(keyringPath, keyring.Bytes(), 0644)).To(Succeed())
+		})
+
+		sign := func(payload string) string {
+			var signature bytes.Buffer
+			openpgp.ArmoredDetachSign(&signature, signer, strings.NewReader(payload), nil)
+			return signature.String()
+		}
+		verification := func(payload, signature string) map[string]interface{} {
+			return map[string]interface{}{"verified": signature != "", "payload": payload, "signature": signature}
+		}
+		writeJSON := func(w http.ResponseWriter, v interface{}) {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(v)
+		}
+
+		commitSHA := "0123456789abcdef0123456789abcdef01234567"
+		tagSHA := "89abcdef0123456789abcdef0123456789abcdef"
+		commitPayload := "tree 4b825dc642cb6eb9a060e54bf8d69288fbee4904\n\nrelease\n"
+		tagPayload := "object " + commitSHA + "\ntype commit\ntag v2.0.0\n\nv2.0.0\n"
+		var tarballRefs []string
+		for _, repo := range []string{"signed", "unsigned", "tagged"} {
+			repo := repo
+			mux.HandleFunc("/repos/o/"+repo+"/commits/", func(w http.ResponseWriter, r *http.Request) {
+				io.WriteString(w, commitSHA)
+			})
+			mux.HandleFunc("/repos/o/"+repo+"/tarball/", func(w http.ResponseWriter, r *http.Request) {
+				tarballRefs = append(tarballRefs, path.Base(r.URL.Path))
+				redirectArchive(w, r)
+			})
+			mux.HandleFunc("/repos/o/"+repo+"/git/commits/"+commitSHA, func(w http.ResponseWriter, r *http.Request) {
+				signature := ""
+				if repo == "signed" {
+					signature = sign(commitPayload)
+				}
+				writeJSON(w, map[string]interface{}{"sha": commitSHA, "verification": verification(commitPayload, signature)})
+			})
+		}
+		mux.HandleFunc("/repos/o/tagged/git/refs/tags/v2.0.0", func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, map[string]interface{}{"ref": "refs/tags/v2.0.0", "object": map[string]string{"type": "tag", "sha": tagSHA}})
+		})
+		mux.HandleFunc("/repos/o/tagged/git/tags/"+tagSHA, func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, map[string]interface{}{
+				"sha":          tagSHA,
+				"object":       map[string]string{"type": "commit", "sha": commitSHA},
+				"verification": verification(tagPayload, sign(tagPayload)),
+			})
+		})
+
+		newClient := func() (*GithubClient, *verify.Verifier) {
+			verifier := &verify.Verifier{Logger: log.NewNopLogger(), Keyring: keyringPath, Signatures: true}
+			return &GithubClient{
+				client:   client,
+				fs:       afero.Afero{Fs: afero.NewMemMapFs()},
+				logger:   log.NewNopLogger(),
+				verifier: verifier,
+			}, verifier
+		}
+
+		It("should download the signed commit a branch points to", func() {
+			tarballRefs = nil
+			gitClient, verifier := newClient()
+			dest, err := gitClient.GetFiles(context.Background(), "github.com/o/signed/tree/master/", constants.HelmChartPath)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(gitClient.fs.Exists(path.Join(dest, "Chart.yaml"))).To(BeTrue())
+			Expect(tarballRefs).To(Equal([]string{commitSHA}))
+
+			verified, ok := verifier.Verified("github.com/o/signed/tree/master/")
+			Expect(ok).To(BeTrue())
+			Expect(verified.Method).To(Equal(verify.MethodSignedCommit))
+			Expect(verified.Digest).To(Equal(commitSHA))
+			Expect(verified.Signer).To(Equal("Release Bot <release@example.com>"))
+		})
+
+		It("should check the signature on an annotated tag", func() {
+			gitClient, verifier := newClient()
+			_, err := gitClient.GetFiles(context.Background(), "github.com/o/tagged/tree/v2.0.0/", constants.HelmChartPath)
+			Expect(err).NotTo(HaveOccurred())
+
+			verified, ok := verifier.Verified("github.com/o/tagged/tree/v2.0.0/")
+			Expect(ok).To(BeTrue())
+			Expect(verified.Method).To(Equal(verify.MethodSignedTag))
+			Expect(verified.Digest).To(Equal(commitSHA))
+		})
+
+		It("should refuse an unsigned commit without downloading it", func() {
+			tarballRefs = nil
+			gitClient, verifier := newClient()
+			_, err := gitClient.GetFiles(context.Background(), "github.com/o/unsigned/tree/master/", constants.HelmChartPath)
+			Expect(err).To(HaveOccurred())
+			Expect(err).To(BeAssignableToTypeOf(verify.Error{}))
+			Expect(err.Error()).To(ContainSubstring("is signed"))
+			Expect(tarballRefs).To(BeEmpty())
+
+			_, ok := verifier.Verified("github.com/o/unsigned/tree/master/")
+			Expect(ok).To(BeFalse())
+		})
+	})
+
 	Describe("decodeGitHubURL", func() {
 		Context("With a valid github url", func() {
 			It("should decode a valid url without a path", func() {
@@ -0,0 +1,314 @@
+package gitlabclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/ship/pkg/specs/upstreamcache"
+	"github.com/replicatedhq/ship/pkg/specs/verify"
+	"github.com/replicatedhq/ship/pkg/util"
+	errors2 "github.com/replicatedhq/ship/pkg/util/errors"
+	"github.com/spf13/afero"
+	"github.com/spf13/viper"
+)
+
+// DefaultBaseURL is the GitLab instance used unless --gitlab-base-url is set
+const DefaultBaseURL = "https://gitlab.com"
+
+// GitlabClient fetches upstreams from gitlab.com, or a self-hosted GitLab, with the v4 API
+type GitlabClient struct {
+	logger     log.Logger
+	httpClient *http.Client
+	fs         afero.Afero
+	// baseURL is the root of the GitLab instance set with --gitlab-base-url, or gitlab.com. The API is under /api/v4
+	baseURL *url.URL
+	// selfHostedHost is the host of the instance set with --gitlab-base-url, if any
+	selfHostedHost string
+	token          string
+	// cache is used to skip downloading a ref that hasn't moved since it was last fetched, if set
+	cache *upstreamcache.Cache
+	// verifier rejects checks that can't be made against GitLab upstreams
+	verifier *verify.Verifier
+}
+
+// NewGitlabClient builds a GitlabClient for upstreams on gitlab.com, and on the self-hosted GitLab at --gitlab-base-url if that's set.
+// Requests are authenticated with --gitlab-token or GITLAB_TOKEN if set, which is only sent to the self-hosted GitLab if there is one.
+func NewGitlabClient(fs afero.Afero, logger log.Logger, v *viper.Viper, cache *upstreamcache.Cache, verifier *verify.Verifier) *GitlabClient {
+	baseURL, _ := url.Parse(DefaultBaseURL)
+	selfHostedHost := ""
+	if configured := v.GetString("gitlab-base-url"); configured != "" {
+		parsed, err := url.Parse(strings.TrimSuffix(configured, "/"))
+		if err != nil || parsed.Host == "" {
+			level.Error(logger).Log("event", "gitlab.baseURL.parse", "baseURL", util.Redact(configured), "err", err)
+		} else {
+			baseURL = parsed
+			selfHostedHost = parsed.Host
+		}
+	}
+
+	return &GitlabClient{
+		logger:         logger,
+		httpClient:     &http.Client{},
+		fs:             fs,
+		baseURL:        baseURL,
+		selfHostedHost: selfHostedHost,
+		token:          v.GetString("gitlab-token"),
+		cache:          cache,
+		verifier:       verifier,
+	}
+}
+
+// IsGitlabURL returns true if upstream is on gitlab.com, or on the self-hosted GitLab set with --gitlab-base-url
+func (g *GitlabClient) IsGitlabURL(upstream string) bool {
+	return util.IsGitlabURL(upstream, g.selfHostedHost)
+}
+
+func (g *GitlabClient) GetFiles(
+	ctx context.Context,
+	upstream string,
+	destinationPath string,
+) (string, error) {
+	debug := level.Debug(log.With(g.logger, "method", "GetFiles"))
+
+	debug.Log("event", "parseGitlabURL")
+	parsed, err := util.ParseGitlabURL(upstream, g.selfHostedHost, "")
+	if err != nil {
+		return "", err
+	}
+	if err := g.verifier.RequireOnly("GitLab upstreams"); err != nil {
+		return "", err
+	}
+
+	debug.Log("event", "removeAll", "destinationPath", destinationPath)
+	err = g.fs.RemoveAll(destinationPath)
+	if err != nil {
+		return "", errors.Wrap(err, "remove chart clone destination")
+	}
+
+	repoPath := parsed.Subdir
+	downloadBasePath := ""
+	if parsed.IsBlob || filepath.Ext(repoPath) != "" {
+		downloadBasePath = repoPath
+		repoPath = ""
+	}
+	fetch := func(version *upstreamcache.Version) error {
+		ref := parsed.Ref
+		if version.ID != "" {
+			// download exactly the commit that was resolved, even if the branch has moved on since
+			ref = version.ID
+		}
+		if err := g.downloadAndExtractFiles(ctx, parsed.Host, parsed.Project, ref, downloadBasePath, destinationPath); err != nil {
+			return errors2.FetchFilesError{Message: util.RedactSecrets(err.Error(), g.token)}
+		}
+		return nil
+	}
+
+	if g.cache == nil {
+		err = fetch(&upstreamcache.Version{})
+	} else {
+		_, err = g.cache.Fetch(upstream, destinationPath, g.resolveCommit(ctx, parsed.Host, parsed.Project, parsed.Ref), fetch)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	localPath := filepath.Join(destinationPath, repoPath)
+	exists, err := g.fs.Exists(localPath)
+	if err != nil {
+		return "", errors.Wrapf(err, "check %s", localPath)
+	}
+	if !exists {
+		return "", errors2.FetchFilesError{Message: fmt.Sprintf("Path %s in %s not found", repoPath, parsed.Project)}
+	}
+	return localPath, nil
+}
+
+// resolveCommit finds the commit SHA that ref points to, or the default branch if ref is empty
+func (g *GitlabClient) resolveCommit(ctx context.Context, host, project, ref string) func(previous *upstreamcache.Version) (upstreamcache.Version, error) {
+	return func(previous *upstreamcache.Version) (upstreamcache.Version, error) {
+		debug := level.Debug(log.With(g.logger, "method", "resolveCommit"))
+
+		if ref == "" {
+			defaultBranch, err := g.defaultBranch(ctx, host, project)
+			if err != nil {
+				return upstreamcache.Version{}, err
+			}
+			ref = defaultBranch
+		}
+
+		var commit struct {
+			ID string `json:"id"`
+		}
+		if err := g.getJSON(ctx, host, projectPath(project, "repository", "commits", ref), nil, &commit); err != nil {
+			return upstreamcache.Version{}, errors2.FetchFilesError{
+				Message: util.RedactSecrets(fmt.Sprintf("resolve %s in %s: %s", ref, project, err.Error()), g.token),
+			}
+		}
+
+		debug.Log("event", "commit.resolve", "ref", ref, "sha", commit.ID)
+		return upstreamcache.Version{Ref: ref, ID: commit.ID}, nil
+	}
+}
+
+func (g *GitlabClient) defaultBranch(ctx context.Context, host, project string) (string, error) {
+	var projectInfo struct {
+		DefaultBranch string `json:"default_branch"`
+	}
+	if err := g.getJSON(ctx, host, projectPath(project), nil, &projectInfo); err != nil {
+		return "", errors2.FetchFilesError{
+			Message: util.RedactSecrets(fmt.Sprintf("get project %s: %s", project, err.Error()), g.token),
+		}
+	}
+	if projectInfo.DefaultBranch == "" {
+		return "", errors2.FetchFilesError{Message: fmt.Sprintf("project %s has no default branch", project)}
+	}
+	return projectInfo.DefaultBranch, nil
+}
+
+func (g *GitlabClient) downloadAndExtractFiles(
+	ctx context.Context,
+	host string,
+	project string,
+	ref string,
+	basePath string,
+	filePath string,
+) error {
+	debug := level.Debug(log.With(g.logger, "method", "downloadAndExtractFiles"))
+
+	query := url.Values{}
+	if ref != "" {
+		query.Set("sha", ref)
+	}
+	debug.Log("event", "archive.download", "project", project, "ref", ref)
+	resp, err := g.get(ctx, host, projectPath(project, "repository", "archive.tar.gz"), query)
+	if err != nil {
+		return errors.Wrapf(err, "downloading archive")
+	}
+	defer resp.Body.Close()
+
+	basePathFound, err := util.ExtractRepoArchive(g.fs, resp.Body, basePath, filePath)
+	if err != nil {
+		return err
+	}
+	if !basePathFound {
+		refString := ref
+		if refString == "" {
+			refString = "the default branch"
+		}
+		return errors.Errorf("Path %s in %s on %s not found", basePath, project, refString)
+	}
+	return nil
+}
+
+// ResolveReleaseNotes returns the message of the latest commit to the upstream's path
+func (g *GitlabClient) ResolveReleaseNotes(ctx context.Context, upstream string) (string, error) {
+	debug := level.Debug(log.With(g.logger, "method", "ResolveReleaseNotes"))
+
+	debug.Log("event", "parseGitlabURL")
+	parsed, err := util.ParseGitlabURL(upstream, g.selfHostedHost, "")
+	if err != nil {
+		return "", errors.Wrap(err, "not a valid gitlab url")
+	}
+
+	query := url.Values{"per_page": []string{"1"}}
+	if parsed.Ref != "" {
+		query.Set("ref_name", parsed.Ref)
+	}
+	if parsed.Subdir != "" {
+		query.Set("path", parsed.Subdir)
+	}
+
+	var commits []struct {
+		Message string `json:"message"`
+	}
+	if err := g.getJSON(ctx, parsed.Host, projectPath(parsed.Project, "repository", "commits"), query, &commits); err != nil {
+		return "", errors.New(util.RedactSecrets(err.Error(), g.token))
+	}
+
+	if len(commits) > 0 {
+		return commits[0].Message, nil
+	}
+	return "", errors.New("No commit available")
+}
+
+// projectPath is the API path of project, or of a resource under it. The project and each part are escaped,
+// so a project in a group or a ref with a slash is still one path segment.
+func projectPath(project string, parts ...string) string {
+	escaped := []string{"projects", url.PathEscape(project)}
+	for _, part := range parts {
+		escaped = append(escaped, url.PathEscape(part))
+	}
+	return strings.Join(escaped, "/")
+}
+
+func (g *GitlabClient) getJSON(ctx context.Context, host string, apiPath string, query url.Values, out interface{}) error {
+	resp, err := g.get(ctx, host, apiPath, query)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return errors.Wrapf(err, "decode %s", apiPath)
+	}
+	return nil
+}
+
+// instanceURL is the root of the GitLab instance at host, which is gitlab.com or the instance set with --gitlab-base-url
+func (g *GitlabClient) instanceURL(host string) string {
+	if g.selfHostedHost != "" && host == g.selfHostedHost {
+		return strings.TrimSuffix(g.baseURL.String(), "/")
+	}
+	return DefaultBaseURL
+}
+
+// tokenHost is the host of the GitLab instance the token is for
+func (g *GitlabClient) tokenHost() string {
+	if g.selfHostedHost != "" {
+		return g.selfHostedHost
+	}
+	return util.GitlabHost
+}
+
+// get requests apiPath from the v4 API of the GitLab instance at host, authenticated with the token if there is one
+// and it's for that instance. The response is only returned if it was a 200, and its body has to be closed.
+func (g *GitlabClient) get(ctx context.Context, host string, apiPath string, query url.Values) (*http.Response, error) {
+	requestURL := fmt.Sprintf("%s/api/v4/%s", g.instanceURL(host), apiPath)
+	if len(query) > 0 {
+		requestURL = requestURL + "?" + query.Encode()
+	}
+
+	req, err := http.NewRequest("GET", requestURL, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "create request for %s", apiPath)
+	}
+	req = req.WithContext(ctx)
+	if g.token != "" && host == g.tokenHost() {
+		req.Header.Set("PRIVATE-TOKEN", g.token)
+	}
+
+	httpClient := g.httpClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "get %s", apiPath)
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		resp.Body.Close()
+		return nil, errors.Errorf("get %s: unexpected status %s: %s", apiPath, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return resp, nil
+}
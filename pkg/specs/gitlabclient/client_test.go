@@ -0,0 +1,245 @@
+package gitlabclient
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/ship/pkg/specs/upstreamcache"
+	"github.com/spf13/afero"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+)
+
+// gitlabStandIn serves the parts of the v4 API the client uses, for the project platform/charts
+type gitlabStandIn struct {
+	token     string
+	sha       string
+	archives  int
+	archiveAt []string
+}
+
+func (s *gitlabStandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.token != "" && r.Header.Get("PRIVATE-TOKEN") != s.token {
+		http.Error(w, `{"message":"404 Project Not Found"}`, http.StatusNotFound)
+		return
+	}
+
+	switch r.URL.EscapedPath() {
+	case "/api/v4/projects/platform%2Fcharts":
+		fmt.Fprint(w, `{"default_branch":"main"}`)
+	case "/api/v4/projects/platform%2Fcharts/repository/commits/main",
+		"/api/v4/projects/platform%2Fcharts/repository/commits/v1.2.0":
+		fmt.Fprintf(w, `{"id":%q}`, s.sha)
+	case "/api/v4/projects/platform%2Fcharts/repository/commits":
+		if r.URL.Query().Get("path") != "stable/nginx" {
+			fmt.Fprint(w, `[]`)
+			return
+		}
+		fmt.Fprint(w, `[{"id":"abc","message":"nginx: bump to 1.15"}]`)
+	case "/api/v4/projects/platform%2Fcharts/repository/archive.tar.gz":
+		s.archives++
+		s.archiveAt = append(s.archiveAt, r.URL.Query().Get("sha"))
+		w.Write(repoArchive(map[string]string{
+			"stable/nginx/Chart.yaml":                "name: nginx",
+			"stable/nginx/templates/deployment.yaml": "kind: Deployment",
+			"plain-k8s/service.yaml":                 "kind: Service",
+		}))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func repoArchive(files map[string]string) []byte {
+	var buf bytes.Buffer
+	gzipWriter := gzip.NewWriter(&buf)
+	tarWriter := tar.NewWriter(gzipWriter)
+	for name, contents := range files {
+		tarWriter.WriteHeader(&tar.Header{Name: "charts-main-abc/" + name, Mode: 0644, Size: int64(len(contents)), Typeflag: tar.TypeReg})
+		tarWriter.Write([]byte(contents))
+	}
+	tarWriter.Close()
+	gzipWriter.Close()
+	return buf.Bytes()
+}
+
+func testClient(t *testing.T, serverURL string, token string) *GitlabClient {
+	v := viper.New()
+	v.Set("gitlab-base-url", serverURL)
+	v.Set("gitlab-token", token)
+	return NewGitlabClient(afero.Afero{Fs: afero.NewMemMapFs()}, log.NewNopLogger(), v, nil, nil)
+}
+
+func TestGitlabClientGetFiles(t *testing.T) {
+	standIn := &gitlabStandIn{token: "glpat-secret", sha: "0123456789abcdef"}
+	server := httptest.NewServer(standIn)
+	defer server.Close()
+	serverURL, _ := url.Parse(server.URL)
+
+	tests := []struct {
+		name       string
+		upstream   string
+		token      string
+		expectFile string
+		expectRef  string
+		expectErr  string
+	}{
+		{
+			name:       "chart in a subdir",
+			upstream:   serverURL.Host + "/platform/charts/stable/nginx",
+			token:      "glpat-secret",
+			expectFile: "templates/deployment.yaml",
+		},
+		{
+			name:       "tree at a ref",
+			upstream:   "https://" + serverURL.Host + "/platform/charts/-/tree/v1.2.0/stable/nginx",
+			token:      "glpat-secret",
+			expectFile: "Chart.yaml",
+			expectRef:  "v1.2.0",
+		},
+		{
+			name:       "blob",
+			upstream:   serverURL.Host + "/platform/charts/-/blob/main/plain-k8s/service.yaml",
+			token:      "glpat-secret",
+			expectFile: "plain-k8s/service.yaml",
+			expectRef:  "main",
+		},
+		{
+			name:      "missing subdir",
+			upstream:  serverURL.Host + "/platform/charts/stable/mysql",
+			token:     "glpat-secret",
+			expectErr: "Path stable/mysql in platform/charts not found",
+		},
+		{
+			name:      "wrong token",
+			upstream:  serverURL.Host + "/platform/charts/stable/nginx",
+			token:     "glpat-wrong",
+			expectErr: "404 Not Found",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := require.New(t)
+			standIn.archiveAt = nil
+			client := testClient(t, server.URL, test.token)
+
+			localPath, err := client.GetFiles(context.Background(), test.upstream, "/tmp/chart")
+			if test.expectErr != "" {
+				req.Error(err)
+				req.Contains(err.Error(), test.expectErr)
+				req.NotContains(err.Error(), test.token)
+				return
+			}
+			req.NoError(err)
+
+			exists, err := client.fs.Exists(filepath.Join(localPath, test.expectFile))
+			req.NoError(err)
+			req.True(exists, "%s in %s", test.expectFile, localPath)
+			req.Equal([]string{test.expectRef}, standIn.archiveAt)
+		})
+	}
+}
+
+func TestGitlabClientGetFilesCached(t *testing.T) {
+	req := require.New(t)
+	standIn := &gitlabStandIn{sha: "0123456789abcdef"}
+	server := httptest.NewServer(standIn)
+	defer server.Close()
+	serverURL, _ := url.Parse(server.URL)
+
+	client := testClient(t, server.URL, "")
+	client.cache = &upstreamcache.Cache{Logger: log.NewNopLogger(), FS: client.fs, Dir: "/cache"}
+	upstream := serverURL.Host + "/platform/charts/stable/nginx"
+
+	_, err := client.GetFiles(context.Background(), upstream, "/tmp/chart")
+	req.NoError(err)
+	_, err = client.GetFiles(context.Background(), upstream, "/tmp/chart")
+	req.NoError(err)
+	req.Equal(1, standIn.archives)
+	req.Equal([]string{"0123456789abcdef"}, standIn.archiveAt)
+
+	standIn.sha = "fedcba9876543210"
+	_, err = client.GetFiles(context.Background(), upstream, "/tmp/chart")
+	req.NoError(err)
+	req.Equal(2, standIn.archives)
+}
+
+func TestGitlabClientResolveReleaseNotes(t *testing.T) {
+	req := require.New(t)
+	server := httptest.NewServer(&gitlabStandIn{})
+	defer server.Close()
+	serverURL, _ := url.Parse(server.URL)
+	client := testClient(t, server.URL, "")
+
+	notes, err := client.ResolveReleaseNotes(context.Background(), serverURL.Host+"/platform/charts/stable/nginx")
+	req.NoError(err)
+	req.Equal("nginx: bump to 1.15", notes)
+
+	_, err = client.ResolveReleaseNotes(context.Background(), serverURL.Host+"/platform/charts/stable/mysql")
+	req.Error(err)
+	req.Equal("No commit available", err.Error())
+
+	req.True(client.IsGitlabURL(serverURL.Host + "/platform/charts"))
+	req.True(client.IsGitlabURL("gitlab.com/platform/charts"))
+	req.False(client.IsGitlabURL("github.com/platform/charts"))
+}
+
+// recordingTransport records the requests made through it, without sending them
+type recordingTransport struct {
+	requests []*http.Request
+}
+
+func (r *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	r.requests = append(r.requests, req)
+	return nil, errors.New("not sent")
+}
+
+func TestGitlabClientRequestHost(t *testing.T) {
+	tests := []struct {
+		name        string
+		upstream    string
+		expectURL   string
+		expectToken string
+	}{
+		{
+			name:        "self-hosted",
+			upstream:    "git.acme.com/platform/charts/stable/nginx",
+			expectURL:   "https://git.acme.com/gitlab/api/v4/projects/platform%2Fcharts",
+			expectToken: "glpat-secret",
+		},
+		{
+			name:      "gitlab.com",
+			upstream:  "gitlab.com/platform/charts/stable/nginx",
+			expectURL: "https://gitlab.com/api/v4/projects/platform%2Fcharts",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := require.New(t)
+			client := testClient(t, "https://git.acme.com/gitlab", "glpat-secret")
+			transport := &recordingTransport{}
+			client.httpClient = &http.Client{Transport: transport}
+
+			_, err := client.GetFiles(context.Background(), test.upstream, "/tmp/chart")
+			req.Error(err)
+			_, err = client.ResolveReleaseNotes(context.Background(), test.upstream)
+			req.Error(err)
+
+			req.Len(transport.requests, 2)
+			for _, request := range transport.requests {
+				req.True(strings.HasPrefix(request.URL.String(), test.expectURL), request.URL.String())
+				req.Equal(test.expectToken, request.Header.Get("PRIVATE-TOKEN"))
+			}
+		})
+	}
+}
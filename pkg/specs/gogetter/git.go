@@ -0,0 +1,108 @@
+package gogetter
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/go-getter"
+	"github.com/pkg/errors"
+)
+
+// sshGitGetter clones git repos like go-getter's git getter, but sets GIT_SSH_COMMAND on each git command it runs
+// rather than reading it from the process environment, so fetches with different ssh options can run concurrently
+type sshGitGetter struct {
+	sshCommand string
+}
+
+var _ getter.Getter = &sshGitGetter{}
+
+// gettersWithSSHCommand are go-getter's getters, with git repos cloned using sshCommand
+func gettersWithSSHCommand(sshCommand string) map[string]getter.Getter {
+	getters := map[string]getter.Getter{}
+	for scheme, schemeGetter := range getter.Getters {
+		getters[scheme] = schemeGetter
+	}
+	getters["git"] = &sshGitGetter{sshCommand: sshCommand}
+	return getters
+}
+
+func (g *sshGitGetter) ClientMode(_ *url.URL) (getter.ClientMode, error) {
+	return getter.ClientModeDir, nil
+}
+
+// Get clones the repo at u into dst, which shouldn't exist yet, and checks out the ref query parameter if it's set
+func (g *sshGitGetter) Get(dst string, u *url.URL) error {
+	if _, err := exec.LookPath("git"); err != nil {
+		return errors.New("git must be available and on the PATH")
+	}
+
+	repo := *u
+	query := repo.Query()
+	ref := query.Get("ref")
+	query.Del("ref")
+	repo.RawQuery = query.Encode()
+
+	if err := g.run("", "clone", "--", repo.String(), dst); err != nil {
+		return err
+	}
+	if ref != "" {
+		if err := g.run(dst, "checkout", ref); err != nil {
+			return err
+		}
+	}
+	return g.run(dst, "submodule", "update", "--init", "--recursive")
+}
+
+// GetFile clones the repo holding the file at u, and copies the file to dst
+func (g *sshGitGetter) GetFile(dst string, u *url.URL) error {
+	tmpDir, err := ioutil.TempDir("", "ship-git")
+	if err != nil {
+		return errors.Wrap(err, "create temp dir")
+	}
+	defer os.RemoveAll(tmpDir)
+
+	repo := *u
+	filename := filepath.Base(repo.Path)
+	repo.Path = filepath.Dir(repo.Path)
+	cloneDir := filepath.Join(tmpDir, "repo")
+	if err := g.Get(cloneDir, &repo); err != nil {
+		return err
+	}
+
+	contents, err := ioutil.ReadFile(filepath.Join(cloneDir, filename))
+	if err != nil {
+		return errors.Wrapf(err, "read %s", filename)
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return errors.Wrapf(err, "create %s", filepath.Dir(dst))
+	}
+	return errors.Wrapf(ioutil.WriteFile(dst, contents, 0644), "write %s", dst)
+}
+
+func (g *sshGitGetter) run(dir string, args ...string) error {
+	cmd := g.command(dir, args...)
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	if err := cmd.Run(); err != nil {
+		return errors.Errorf("git %s: %s: %s", args[0], err, strings.TrimSpace(output.String()))
+	}
+	return nil
+}
+
+func (g *sshGitGetter) command(dir string, args ...string) *exec.Cmd {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	for _, env := range os.Environ() {
+		if !strings.HasPrefix(env, "GIT_SSH_COMMAND=") {
+			cmd.Env = append(cmd.Env, env)
+		}
+	}
+	cmd.Env = append(cmd.Env, "GIT_SSH_COMMAND="+g.sshCommand)
+	return cmd
+}
@@ -0,0 +1,97 @@
+package gogetter
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestGoGetterSSHCommandPerFetch(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "ship-gogetter-ssh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// stands in for ssh, recording the -i it was run with and failing the clone
+	fakeSSH := filepath.Join(tmpDir, "fake-ssh")
+	script := "#!/bin/sh\necho \"$2\" > \"$(dirname \"$0\")/used-$(basename \"$2\")\"\nexit 1\n"
+	if err := ioutil.WriteFile(fakeSSH, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			g := GoGetter{SSHKeyPath: fmt.Sprintf("key-%d", i)}
+			// the fake ssh is run in place of ssh, with the key options ship adds
+			sshCommand := strings.Replace(g.sshCommand(), "ssh", fakeSSH, 1)
+			client := &sshGitGetter{sshCommand: sshCommand}
+			if err := client.run("", "clone", "ssh://git@example.invalid/repo.git", filepath.Join(tmpDir, fmt.Sprintf("clone-%d", i))); err == nil {
+				t.Errorf("clone %d succeeded, expected the fake ssh to fail it", i)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for i := 0; i < 4; i++ {
+		if _, err := os.Stat(filepath.Join(tmpDir, fmt.Sprintf("used-key-%d", i))); err != nil {
+			t.Errorf("clone %d wasn't run with its own ssh command: %v", i, err)
+		}
+	}
+	if value, ok := os.LookupEnv("GIT_SSH_COMMAND"); ok {
+		t.Errorf("GIT_SSH_COMMAND was set in the process environment to %q", value)
+	}
+}
+
+func TestSSHGitGetterClone(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "ship-gogetter-clone")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	repo := filepath.Join(tmpDir, "repo")
+	g := &sshGitGetter{sshCommand: "ssh"}
+	for _, args := range [][]string{
+		{"init", "-q", repo},
+		{"-C", repo, "-c", "user.name=ship", "-c", "user.email=ship@example.com", "commit", "-q", "--allow-empty", "-m", "initial"},
+		{"-C", repo, "tag", "v1.0.0"},
+	} {
+		if err := g.run("", args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(repo, "Chart.yaml"), []byte("name: nginx\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.run(repo, "add", "Chart.yaml"); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.run(repo, "-c", "user.name=ship", "-c", "user.email=ship@example.com", "commit", "-q", "-m", "chart"); err != nil {
+		t.Fatal(err)
+	}
+
+	getter := GoGetter{SSHKeyPath: "/nonexistent/key"}
+	dst := filepath.Join(tmpDir, "fetched")
+	if err := getter.getAny(dst, "git::file://"+repo+"?ref=v1.0.0"); err != nil {
+		t.Fatalf("getAny: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dst, "Chart.yaml")); !os.IsNotExist(err) {
+		t.Errorf("expected Chart.yaml to be missing at v1.0.0, got %v", err)
+	}
+
+	dst = filepath.Join(tmpDir, "fetched-head")
+	if err := getter.getAny(dst, "git::file://"+repo); err != nil {
+		t.Fatalf("getAny: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dst, "Chart.yaml")); err != nil {
+		t.Errorf("expected Chart.yaml at HEAD: %v", err)
+	}
+}
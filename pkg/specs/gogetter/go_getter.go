@@ -3,15 +3,20 @@ package gogetter
 import (
 	"context"
 	"fmt"
+	"net/url"
 	"os"
 	"path"
 	"path/filepath"
+	"regexp"
+	"strings"
 
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
 	"github.com/hashicorp/go-getter"
 	"github.com/pkg/errors"
-	"github.com/replicatedhq/ship/pkg/constants"
+	"github.com/replicatedhq/ship/pkg/specs/upstreamcache"
+	"github.com/replicatedhq/ship/pkg/specs/verify"
+	"github.com/replicatedhq/ship/pkg/state"
 	"github.com/replicatedhq/ship/pkg/util"
 	errors2 "github.com/replicatedhq/ship/pkg/util/errors"
 	"github.com/spf13/afero"
@@ -22,45 +27,172 @@ type GoGetter struct {
 	FS           afero.Afero
 	Subdir       string
 	IsSingleFile bool
+
+	// GithubToken authenticates https git clones from github.com, or from GithubEnterpriseHost if it's set
+	GithubToken          string
+	GithubEnterpriseHost string
+	// SSHKeyPath and KnownHostsPath are used for ssh git clones, in place of the user's ssh config
+	SSHKeyPath     string
+	KnownHostsPath string
+
+	// Cache keeps fetched upstreams between runs, if set. go-getter can't ask whether a source has changed,
+	// so only sources pinned to a commit SHA skip fetching, but every source can be restored with --offline.
+	Cache *upstreamcache.Cache
+	// Verifier pins the digest of archive upstreams, if it's set and --upstream-sha256 was given
+	Verifier *verify.Verifier
 }
 
+var commitSHARegex = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
 // TODO figure out how to copy files from host into afero filesystem for testing, or how to force go-getter to fetch into afero
 func (g *GoGetter) GetFiles(ctx context.Context, upstream, savePath string) (string, error) {
 	debug := level.Debug(g.Logger)
-	debug.Log("event", "gogetter.GetFiles", "upstream", upstream, "savePath", savePath)
+	debug.Log("event", "gogetter.GetFiles", "upstream", util.Redact(upstream), "savePath", savePath)
+
+	finalPath := filepath.Join(savePath, g.Subdir)
+	if g.IsSingleFile {
+		finalPath = savePath
+	}
+
+	if err := g.Verifier.RequireOnly("go-getter upstreams", verify.FlagSHA256); err != nil {
+		return "", err
+	}
+	source, verification, err := g.withChecksum(upstream)
+	if err != nil {
+		return "", err
+	}
+
+	if g.Cache == nil {
+		if err := g.fetch(ctx, source, savePath, verification); err != nil {
+			return "", err
+		}
+	} else {
+		// the checksum is part of the cache key, so an archive restored offline was checked against it when it was fetched
+		_, err := g.Cache.Fetch(
+			source+g.Subdir,
+			savePath,
+			func(*upstreamcache.Version) (upstreamcache.Version, error) {
+				return pinnedVersion(source), nil
+			},
+			func(version *upstreamcache.Version) error {
+				version.Verification = verification
+				return g.fetch(ctx, source, savePath, verification)
+			},
+		)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	g.Verifier.Record(upstream, verification)
+	return finalPath, nil
+}
+
+// withChecksum adds the digest pinned with --upstream-sha256 to upstream as go-getter's checksum parameter,
+// so go-getter checks the archive before unpacking it. It returns the verification the checksum makes, if there is one,
+// which includes any checksum that was already in upstream.
+func (g *GoGetter) withChecksum(upstream string) (string, *state.Verification, error) {
+	forced, source := splitForcedGetter(upstream)
+	source, subdir := getter.SourceDirSubdir(source)
+
+	sourceURL, err := url.Parse(source)
+	if err != nil {
+		if g.Verifier != nil && g.Verifier.SHA256 != "" {
+			return "", nil, errors.Wrapf(err, "parse upstream %s to add its checksum", util.Redact(upstream))
+		}
+		return upstream, nil, nil
+	}
+
+	query := sourceURL.Query()
+	if g.Verifier != nil && g.Verifier.SHA256 != "" {
+		query.Set("checksum", "sha256:"+g.Verifier.SHA256)
+		sourceURL.RawQuery = query.Encode()
+		upstream = sourceURL.String()
+		if forced != "" {
+			upstream = forced + "::" + upstream
+		}
+		if subdir != "" {
+			upstream += "//" + subdir
+		}
+	}
+
+	checksum := query.Get("checksum")
+	if checksum == "" {
+		return upstream, nil, nil
+	}
+	return upstream, &state.Verification{Method: checksumMethod(checksum), Digest: strings.ToLower(checksum)}, nil
+}
+
+// checksumMethod is the hash type of a go-getter checksum, like sha256 in sha256:abc123
+func checksumMethod(checksum string) string {
+	if idx := strings.Index(checksum, ":"); idx > 0 {
+		return strings.ToLower(checksum[:idx])
+	}
+	return "checksum"
+}
+
+// pinnedVersion returns the commit an upstream's ref pins it to, if it's a full commit SHA that can't move
+func pinnedVersion(upstream string) upstreamcache.Version {
+	source, _ := getter.SourceDirSubdir(upstream)
+	if idx := strings.Index(source, "?"); idx >= 0 {
+		if query, err := url.ParseQuery(source[idx+1:]); err == nil {
+			if ref := query.Get("ref"); commitSHARegex.MatchString(ref) {
+				return upstreamcache.Version{Ref: ref, ID: ref}
+			}
+		}
+	}
+	return upstreamcache.Version{}
+}
+
+func (g *GoGetter) fetch(ctx context.Context, upstream, savePath string, verification *state.Verification) error {
+	debug := level.Debug(g.Logger)
 
 	if g.IsSingleFile {
-		debug.Log("event", "gogetter.GetSingleFile", "upstream", upstream, "savePath", savePath)
-		return g.GetSingleFile(ctx, upstream, savePath)
+		debug.Log("event", "gogetter.GetSingleFile", "upstream", util.Redact(upstream), "savePath", savePath)
+		_, err := g.GetSingleFile(ctx, upstream, savePath)
+		return g.checksumError(err, verification)
 	}
 
-	err := getter.GetAny(savePath, upstream)
+	err := g.getAny(savePath, upstream)
 	if err != nil {
-		return "", errors2.FetchFilesError{Message: err.Error()}
+		return g.checksumError(errors2.FetchFilesError{Message: g.redact(err.Error())}, verification)
 	}
 
 	// if there is a `.git` directory, remove it - it's dynamic and will break the content hash used by `ship update`
 	gitPresent, err := g.FS.Exists(path.Join(savePath, ".git"))
 	if err != nil {
-		return "", errors.Wrap(err, "check for .git directory")
+		return errors.Wrap(err, "check for .git directory")
 	}
 	if gitPresent {
 		err := g.FS.RemoveAll(path.Join(savePath, ".git"))
 		if err != nil {
-			return "", errors.Wrap(err, "remove .git directory")
+			return errors.Wrap(err, "remove .git directory")
 		}
 	}
 	debug.Log("event", "gitPresent.check", "gitPresent", gitPresent)
 
-	return filepath.Join(savePath, g.Subdir), nil
+	return nil
+}
+
+// checksumError turns go-getter's failure to match or make a checksum into a verify.Error, so it isn't retried
+func (g *GoGetter) checksumError(err error, verification *state.Verification) error {
+	if err == nil || verification == nil {
+		return err
+	}
+	message := strings.ToLower(err.Error())
+	if strings.Contains(message, "checksums did not match") || strings.Contains(message, "checksum cannot be specified") {
+		return verify.Error{Message: g.redact(err.Error())}
+	}
+	return err
 }
 
 func (g *GoGetter) GetSingleFile(ctx context.Context, upstream, savePath string) (string, error) {
-	tmpDir := filepath.Join(constants.ShipPathInternalTmp, "gogetter-file")
+	// next to savePath, so fetches into different save paths don't share it
+	tmpDir := savePath + "-gogetter-file"
 
-	err := getter.GetAny(tmpDir, upstream)
+	err := g.getAny(tmpDir, upstream)
 	if err != nil {
-		return "", errors2.FetchFilesError{Message: err.Error()}
+		return "", errors2.FetchFilesError{Message: g.redact(err.Error())}
 	}
 	defer g.FS.RemoveAll(tmpDir)
 
@@ -77,6 +209,119 @@ func (g *GoGetter) GetSingleFile(ctx context.Context, upstream, savePath string)
 	return savePath, nil
 }
 
+// getAny fetches upstream into dst with go-getter, adding any configured git credentials
+func (g *GoGetter) getAny(dst, upstream string) error {
+	source, err := g.withCredentials(upstream)
+	if err != nil {
+		return err
+	}
+
+	if sshCommand := g.sshCommand(); sshCommand != "" {
+		client := &getter.Client{
+			Src:     source,
+			Dst:     dst,
+			Mode:    getter.ClientModeAny,
+			Getters: gettersWithSSHCommand(sshCommand),
+		}
+		return client.Get()
+	}
+
+	return getter.GetAny(dst, source)
+}
+
+// withCredentials adds the GitHub token to upstream if it resolves to an https git clone of a GitHub repo
+func (g *GoGetter) withCredentials(upstream string) (string, error) {
+	if g.GithubToken == "" {
+		return upstream, nil
+	}
+
+	pwd, err := os.Getwd()
+	if err != nil {
+		return "", errors.Wrap(err, "get working directory")
+	}
+	detected, err := getter.Detect(upstream, pwd, getter.Detectors)
+	if err != nil {
+		return "", errors.Wrapf(err, "detect source of %s", util.Redact(upstream))
+	}
+
+	forced, source := splitForcedGetter(detected)
+	if forced != "git" {
+		return upstream, nil
+	}
+
+	source, subdir := getter.SourceDirSubdir(source)
+	sourceURL, err := url.Parse(source)
+	if err != nil || sourceURL.Scheme != "https" || sourceURL.User != nil || !g.isGithubHost(sourceURL.Host) {
+		return upstream, nil
+	}
+
+	sourceURL.User = url.UserPassword("x-access-token", g.GithubToken)
+	withToken := "git::" + sourceURL.String()
+	if subdir != "" {
+		withToken += "//" + subdir
+	}
+	return withToken, nil
+}
+
+func (g *GoGetter) isGithubHost(host string) bool {
+	return host == "github.com" || host == "www.github.com" || (g.GithubEnterpriseHost != "" && host == g.GithubEnterpriseHost)
+}
+
+// sshCommand builds the ssh command git should use for the configured key and known hosts, if any
+func (g *GoGetter) sshCommand() string {
+	if g.SSHKeyPath == "" && g.KnownHostsPath == "" {
+		return ""
+	}
+
+	command := []string{"ssh"}
+	if g.SSHKeyPath != "" {
+		command = append(command, "-i", shellQuote(g.SSHKeyPath), "-o", "IdentitiesOnly=yes")
+	}
+	if g.KnownHostsPath != "" {
+		command = append(command, "-o", "UserKnownHostsFile="+shellQuote(g.KnownHostsPath), "-o", "StrictHostKeyChecking=yes")
+	}
+	return strings.Join(command, " ")
+}
+
+func (g *GoGetter) redact(message string) string {
+	return util.RedactSecrets(message, g.GithubToken)
+}
+
+func splitForcedGetter(source string) (forced string, rest string) {
+	if idx := strings.Index(source, "::"); idx > 0 && !strings.Contains(source[:idx], "/") {
+		return source[:idx], source[idx+2:]
+	}
+	return "", source
+}
+
+// git runs GIT_SSH_COMMAND through a shell
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'"'"'`, -1) + "'"
+}
+
+// LocalPath returns the absolute path of the directory an upstream on the local filesystem refers to,
+// either a file:: url or a path, and false for any other upstream
+func LocalPath(upstream string) (string, bool) {
+	forced, source := splitForcedGetter(upstream)
+	if forced != "" && forced != "file" {
+		return "", false
+	}
+	source = strings.TrimPrefix(source, "file://")
+
+	isPath := forced == "file" || filepath.IsAbs(source) ||
+		strings.HasPrefix(source, "./") || strings.HasPrefix(source, "../")
+	if !isPath {
+		return "", false
+	}
+
+	dir, subdir := getter.SourceDirSubdir(source)
+	abs, err := filepath.Abs(filepath.Join(dir, subdir))
+	if err != nil {
+		return "", false
+	}
+	return abs, true
+}
+
 func IsGoGettable(path string) bool {
 	_, err := getter.Detect(path, "", getter.Detectors)
 	if err != nil {
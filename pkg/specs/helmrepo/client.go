@@ -0,0 +1,492 @@
+package helmrepo
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/ghodss/yaml"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/ship/pkg/specs/upstreamcache"
+	"github.com/replicatedhq/ship/pkg/specs/verify"
+	"github.com/replicatedhq/ship/pkg/state"
+	errors2 "github.com/replicatedhq/ship/pkg/util/errors"
+	"github.com/spf13/afero"
+	"github.com/spf13/viper"
+	"k8s.io/helm/pkg/repo"
+)
+
+const (
+	// Scheme is the upstream scheme for charts in a helm repository served over https
+	Scheme = "helm://"
+	// InsecureScheme is the upstream scheme for charts in a helm repository served over plain http
+	InsecureScheme = "helm+http://"
+)
+
+// Upstream is a parsed helm repository upstream, like helm://charts.example.com/stable/nginx?version=~1.2
+type Upstream struct {
+	RepoURL string
+	Chart   string
+	// Constraint is the semver constraint the chart version must satisfy, any version if empty
+	Constraint string
+}
+
+// IsHelmRepoUpstream returns true if upstream refers to a chart in a helm repository
+func IsHelmRepoUpstream(upstream string) bool {
+	return strings.HasPrefix(upstream, Scheme) || strings.HasPrefix(upstream, InsecureScheme)
+}
+
+// ParseUpstream parses a helm://<repo-url>/<chart>?version=<constraint> upstream
+func ParseUpstream(upstream string) (*Upstream, error) {
+	scheme := "https://"
+	trimmed := strings.TrimPrefix(upstream, Scheme)
+	if strings.HasPrefix(upstream, InsecureScheme) {
+		scheme = "http://"
+		trimmed = strings.TrimPrefix(upstream, InsecureScheme)
+	} else if trimmed == upstream {
+		return nil, errors.Errorf("upstream %s does not start with %s", upstream, Scheme)
+	}
+
+	parsed, err := url.Parse(scheme + trimmed)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parse upstream %s", upstream)
+	}
+
+	repoPath, chart := path.Split(strings.TrimSuffix(parsed.Path, "/"))
+	if parsed.Host == "" || chart == "" {
+		return nil, errors.Errorf("upstream %s should look like %s<repo-url>/<chart>?version=<constraint>", upstream, Scheme)
+	}
+
+	repoURL := url.URL{Scheme: parsed.Scheme, User: parsed.User, Host: parsed.Host, Path: strings.TrimSuffix(repoPath, "/")}
+	return &Upstream{
+		RepoURL:    repoURL.String(),
+		Chart:      chart,
+		Constraint: parsed.Query().Get("version"),
+	}, nil
+}
+
+// Resolved is the chart version an upstream resolved to
+type Resolved struct {
+	Chart   string
+	Version string
+	// Digest is the hex sha256 of the chart tarball. It's taken from the repository index when
+	// the index has one, and computed from the tarball when it's downloaded.
+	Digest string
+	URL    string
+}
+
+// Client resolves upstream version constraints against a helm repository's index.yaml and fetches charts.
+// The version an upstream resolved to is remembered for the rest of the run, see Resolved.
+type Client struct {
+	Logger log.Logger
+	FS     afero.Afero
+	HTTP   *http.Client
+	// Cache keeps indexes and charts between runs, if set
+	Cache *upstreamcache.Cache
+	// Verifier checks chart provenance and pinned digests, if it's set and they were asked for
+	Verifier *verify.Verifier
+	// Username and Password are sent as basic auth to the hosts of the repositories upstreams resolve against.
+	// Credentials in an upstream's url are used instead when it has them.
+	Username string
+	Password string
+
+	mu        sync.Mutex
+	resolved  map[string]*Resolved
+	repoHosts map[string]bool
+}
+
+// NewClient builds a Client
+func NewClient(logger log.Logger, fs afero.Afero, v *viper.Viper, cache *upstreamcache.Cache, verifier *verify.Verifier) *Client {
+	return &Client{
+		Logger:    logger,
+		FS:        fs,
+		HTTP:      http.DefaultClient,
+		Cache:     cache,
+		Verifier:  verifier,
+		Username:  v.GetString("helm-repo-username"),
+		Password:  v.GetString("helm-repo-password"),
+		resolved:  map[string]*Resolved{},
+		repoHosts: map[string]bool{},
+	}
+}
+
+// Resolve finds the newest chart version in the repository that satisfies the upstream's version constraint
+func (c *Client) Resolve(ctx context.Context, upstream string) (*Resolved, error) {
+	debug := level.Debug(log.With(c.Logger, "struct", "helmrepo.Client", "method", "Resolve"))
+
+	parsed, err := ParseUpstream(upstream)
+	if err != nil {
+		return nil, err
+	}
+
+	if repoURL, err := url.Parse(parsed.RepoURL); err == nil {
+		c.mu.Lock()
+		c.repoHosts[repoURL.Host] = true
+		c.mu.Unlock()
+	}
+
+	indexURL := parsed.RepoURL + "/index.yaml"
+	debug.Log("event", "index.fetch", "url", indexURL)
+	indexBytes, err := c.getIndex(ctx, indexURL)
+	if err != nil {
+		return nil, err
+	}
+
+	var index repo.IndexFile
+	if err := yaml.Unmarshal(indexBytes, &index); err != nil {
+		return nil, errors.Wrapf(err, "unmarshal %s", indexURL)
+	}
+	index.SortEntries()
+
+	chartVersion, err := index.Get(parsed.Chart, parsed.Constraint)
+	if err != nil {
+		return nil, errors.Wrapf(err, "find version of chart %s matching %q in %s", parsed.Chart, parsed.Constraint, parsed.RepoURL)
+	}
+	if len(chartVersion.URLs) == 0 {
+		return nil, errors.Errorf("chart %s version %s in %s has no download url", parsed.Chart, chartVersion.Version, parsed.RepoURL)
+	}
+
+	chartURL, err := repo.ResolveReferenceURL(parsed.RepoURL+"/", chartVersion.URLs[0])
+	if err != nil {
+		return nil, errors.Wrapf(err, "resolve url of chart %s version %s", parsed.Chart, chartVersion.Version)
+	}
+
+	resolved := &Resolved{
+		Chart:   parsed.Chart,
+		Version: chartVersion.Version,
+		Digest:  chartVersion.Digest,
+		URL:     chartURL,
+	}
+	debug.Log("event", "version.resolve", "chart", resolved.Chart, "constraint", parsed.Constraint, "version", resolved.Version)
+	return resolved, nil
+}
+
+// ContentSHA returns the digest of the chart tarball the upstream currently resolves to,
+// only downloading the chart if the repository index doesn't include digests
+func (c *Client) ContentSHA(ctx context.Context, upstream string) (string, error) {
+	contentSHA, _, err := c.LatestVersion(ctx, upstream)
+	return contentSHA, err
+}
+
+// LatestVersion is ContentSHA, also returning the chart version the upstream currently resolves to
+func (c *Client) LatestVersion(ctx context.Context, upstream string) (contentSHA string, version string, err error) {
+	if c.Cache != nil && c.Cache.Offline {
+		latest, err := c.Cache.Latest(upstream)
+		if err != nil {
+			return "", "", err
+		}
+		if latest == nil {
+			return "", "", errors.Errorf("upstream %s has not been cached, run without --offline to fetch it", upstream)
+		}
+		return latest.Version.ID, latest.Version.Name, nil
+	}
+
+	resolved, err := c.Resolve(ctx, upstream)
+	if err != nil {
+		return "", "", err
+	}
+	if resolved.Digest != "" {
+		return resolved.Digest, resolved.Version, nil
+	}
+
+	tarball, err := c.get(ctx, resolved.URL)
+	if err != nil {
+		return "", "", err
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(tarball)), resolved.Version, nil
+}
+
+// GetFiles resolves the upstream's chart version, downloads the chart tarball and unpacks it into savePath.
+// It returns the path of the unpacked chart. With a cache, a chart version that's already been fetched isn't downloaded again.
+// Provenance and pinned digests are checked before the chart is unpacked, if they were asked for.
+func (c *Client) GetFiles(ctx context.Context, upstream, savePath string) (string, error) {
+	parsed, err := ParseUpstream(upstream)
+	if err != nil {
+		return "", err
+	}
+	if err := c.Verifier.RequireOnly("helm repository upstreams", verify.FlagProvenance, verify.FlagSHA256); err != nil {
+		return "", err
+	}
+
+	var resolved *Resolved
+	resolve := func(*upstreamcache.Version) (upstreamcache.Version, error) {
+		resolved, err = c.Resolve(ctx, upstream)
+		if err != nil {
+			return upstreamcache.Version{}, err
+		}
+		return upstreamcache.Version{Ref: parsed.Constraint, ID: resolved.Digest, Name: resolved.Version}, nil
+	}
+	fetch := func(version *upstreamcache.Version) error {
+		verification, err := c.download(ctx, resolved, savePath)
+		if err != nil {
+			return err
+		}
+		// the index may not list digests, but the tarball's is known now
+		version.ID = resolved.Digest
+		version.Verification = verification
+		return nil
+	}
+
+	var verification *state.Verification
+	if c.Cache == nil {
+		version, err := resolve(nil)
+		if err != nil {
+			return "", err
+		}
+		if err := fetch(&version); err != nil {
+			return "", err
+		}
+		verification = version.Verification
+	} else {
+		entry, err := c.Cache.Fetch(upstream, savePath, resolve, fetch)
+		if err != nil {
+			return "", err
+		}
+		if resolved == nil {
+			// restored offline, without resolving against the index
+			resolved = &Resolved{Chart: parsed.Chart, Version: entry.Version.Name, Digest: entry.Version.ID}
+		}
+
+		if c.Verifier != nil && c.Verifier.Provenance && !isProvenance(entry.Version.Verification) {
+			if resolved.URL == "" {
+				return "", verify.Error{Message: fmt.Sprintf("chart %s version %s was cached without checking its provenance, run without --offline to check it", resolved.Chart, resolved.Version)}
+			}
+			// cached before provenance was asked for, so the tarball has to be fetched again to check it
+			if err := fetch(&entry.Version); err != nil {
+				return "", err
+			}
+			if _, err := c.Cache.Store(upstream, entry.Version, savePath); err != nil {
+				return "", err
+			}
+		}
+		verification = entry.Version.Verification
+	}
+
+	// the digest is checked after fetching too, since a cached chart isn't downloaded again
+	if c.Verifier != nil && c.Verifier.SHA256 != "" && !isProvenance(verification) {
+		if verification, err = c.Verifier.VerifyDigest(upstream, resolved.Digest); err != nil {
+			return "", err
+		}
+	}
+	c.Verifier.Record(upstream, verification)
+
+	c.mu.Lock()
+	if c.resolved == nil {
+		c.resolved = map[string]*Resolved{}
+	}
+	c.resolved[upstream] = resolved
+	c.mu.Unlock()
+
+	return filepath.Join(savePath, resolved.Chart), nil
+}
+
+// Resolved returns the chart version upstream was last fetched at by GetFiles during this run
+func (c *Client) Resolved(upstream string) (*Resolved, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	resolved, ok := c.resolved[upstream]
+	return resolved, ok
+}
+
+// download fetches the chart tarball for resolved, checks it against the index digest and unpacks it into savePath.
+// If provenance or a pinned digest was asked for, the tarball is checked before it's unpacked.
+func (c *Client) download(ctx context.Context, resolved *Resolved, savePath string) (*state.Verification, error) {
+	debug := level.Debug(log.With(c.Logger, "struct", "helmrepo.Client", "method", "download"))
+
+	debug.Log("event", "chart.fetch", "url", resolved.URL)
+	tarball, err := c.get(ctx, resolved.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	digest := fmt.Sprintf("%x", sha256.Sum256(tarball))
+	if resolved.Digest != "" && resolved.Digest != digest {
+		return nil, errors.Errorf("chart %s version %s has digest %s, but the repository index lists %s", resolved.Chart, resolved.Version, digest, resolved.Digest)
+	}
+	resolved.Digest = digest
+
+	verification, err := c.verify(ctx, resolved, tarball)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.FS.RemoveAll(savePath); err != nil {
+		return nil, errors.Wrapf(err, "remove %s", savePath)
+	}
+	if err := c.extract(tarball, savePath); err != nil {
+		return nil, errors.Wrapf(err, "unpack chart %s version %s", resolved.Chart, resolved.Version)
+	}
+	return verification, nil
+}
+
+// verify checks a downloaded chart tarball against its provenance file or the pinned digest, whichever was asked for
+func (c *Client) verify(ctx context.Context, resolved *Resolved, tarball []byte) (*state.Verification, error) {
+	if c.Verifier == nil {
+		return nil, nil
+	}
+
+	var verification *state.Verification
+	var err error
+	if c.Verifier.SHA256 != "" {
+		if verification, err = c.Verifier.VerifyDigest(resolved.URL, resolved.Digest); err != nil {
+			return nil, err
+		}
+	}
+	if c.Verifier.Provenance {
+		provenanceURL := resolved.URL + ".prov"
+		level.Debug(c.Logger).Log("event", "provenance.fetch", "url", provenanceURL)
+		provenanceFile, err := c.get(ctx, provenanceURL)
+		if err != nil {
+			return nil, err
+		}
+		chartURL, err := url.Parse(resolved.URL)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parse %s", resolved.URL)
+		}
+		if verification, err = c.Verifier.VerifyChart(path.Base(chartURL.Path), tarball, provenanceFile); err != nil {
+			return nil, err
+		}
+	}
+	return verification, nil
+}
+
+func isProvenance(verification *state.Verification) bool {
+	return verification != nil && verification.Method == verify.MethodHelmProvenance
+}
+
+// getIndex fetches a repository index. With a cache, the index is requested with the ETag of the cached copy,
+// and offline the cached copy is used without any request.
+func (c *Client) getIndex(ctx context.Context, indexURL string) ([]byte, error) {
+	if c.Cache == nil {
+		return c.get(ctx, indexURL)
+	}
+
+	etag, cached, ok, err := c.Cache.Document(indexURL)
+	if err != nil {
+		return nil, err
+	}
+	if c.Cache.Offline {
+		if !ok {
+			return nil, errors.Errorf("%s has not been cached, run without --offline to fetch it", indexURL)
+		}
+		return cached, nil
+	}
+	if !ok {
+		etag = ""
+	}
+
+	body, newETag, notModified, err := c.conditionalGet(ctx, indexURL, etag)
+	if err != nil {
+		return nil, err
+	}
+	if notModified {
+		level.Debug(c.Logger).Log("event", "index.notModified", "url", indexURL)
+		return cached, nil
+	}
+	if newETag != "" {
+		if err := c.Cache.StoreDocument(indexURL, newETag, body); err != nil {
+			return nil, errors.Wrapf(err, "cache %s", indexURL)
+		}
+	}
+	return body, nil
+}
+
+func (c *Client) get(ctx context.Context, target string) ([]byte, error) {
+	body, _, _, err := c.conditionalGet(ctx, target, "")
+	return body, err
+}
+
+// conditionalGet requests target, sending etag as If-None-Match if it's set
+func (c *Client) conditionalGet(ctx context.Context, target, etag string) (body []byte, newETag string, notModified bool, err error) {
+	req, err := http.NewRequest("GET", target, nil)
+	if err != nil {
+		return nil, "", false, errors.Wrapf(err, "build request for %s", target)
+	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	if c.Username != "" && req.URL.User == nil {
+		c.mu.Lock()
+		repoHost := c.repoHosts[req.URL.Host]
+		c.mu.Unlock()
+		if repoHost {
+			req.SetBasicAuth(c.Username, c.Password)
+		}
+	}
+
+	resp, err := c.HTTP.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, "", false, errors2.FetchFilesError{Message: fmt.Sprintf("get %s: %s", target, err.Error())}
+	}
+	defer resp.Body.Close()
+
+	if etag != "" && resp.StatusCode == http.StatusNotModified {
+		return nil, etag, true, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", false, errors2.FetchFilesError{Message: fmt.Sprintf("get %s: unexpected status %s", target, resp.Status)}
+	}
+
+	body, err = ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", false, errors2.FetchFilesError{Message: fmt.Sprintf("read %s: %s", target, err.Error())}
+	}
+	return body, resp.Header.Get("ETag"), false, nil
+}
+
+func (c *Client) extract(tarball []byte, dest string) error {
+	gzipReader, err := gzip.NewReader(bytes.NewReader(tarball))
+	if err != nil {
+		return errors.Wrap(err, "read gzip")
+	}
+	defer gzipReader.Close()
+
+	tarReader := tar.NewReader(gzipReader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrap(err, "read tar")
+		}
+
+		name := path.Clean(filepath.ToSlash(header.Name))
+		if name == ".." || strings.HasPrefix(name, "../") || path.IsAbs(name) {
+			return errors.Errorf("chart archive contains %s, which is outside of the chart", header.Name)
+		}
+		target := filepath.Join(dest, filepath.FromSlash(name))
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := c.FS.MkdirAll(target, 0755); err != nil {
+				return errors.Wrapf(err, "create %s", target)
+			}
+		case tar.TypeReg, tar.TypeRegA:
+			if err := c.FS.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return errors.Wrapf(err, "create %s", filepath.Dir(target))
+			}
+			contents, err := ioutil.ReadAll(tarReader)
+			if err != nil {
+				return errors.Wrapf(err, "read %s", header.Name)
+			}
+			if err := c.FS.WriteFile(target, contents, os.FileMode(0644)); err != nil {
+				return errors.Wrapf(err, "write %s", target)
+			}
+		}
+	}
+}
@@ -0,0 +1,510 @@
+package helmrepo
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/replicatedhq/ship/pkg/specs/upstreamcache"
+	"github.com/replicatedhq/ship/pkg/specs/verify"
+	"github.com/spf13/afero"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/openpgp"
+	"k8s.io/helm/pkg/provenance"
+)
+
+func TestParseUpstream(t *testing.T) {
+	tests := []struct {
+		name     string
+		upstream string
+		want     *Upstream
+		wantErr  bool
+	}{
+		{
+			name:     "with constraint",
+			upstream: "helm://kubernetes-charts.storage.googleapis.com/nginx-ingress?version=~0.30",
+			want: &Upstream{
+				RepoURL:    "https://kubernetes-charts.storage.googleapis.com",
+				Chart:      "nginx-ingress",
+				Constraint: "~0.30",
+			},
+		},
+		{
+			name:     "repo with a path, no constraint",
+			upstream: "helm://charts.example.com/repos/stable/mysql",
+			want: &Upstream{
+				RepoURL: "https://charts.example.com/repos/stable",
+				Chart:   "mysql",
+			},
+		},
+		{
+			name:     "insecure",
+			upstream: "helm+http://localhost:8879/charts/mysql?version=>=1.0.0",
+			want: &Upstream{
+				RepoURL:    "http://localhost:8879/charts",
+				Chart:      "mysql",
+				Constraint: ">=1.0.0",
+			},
+		},
+		{
+			name:     "no chart",
+			upstream: "helm://charts.example.com",
+			wantErr:  true,
+		},
+		{
+			name:     "not a helm upstream",
+			upstream: "github.com/helm/charts/stable/mysql",
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := require.New(t)
+			got, err := ParseUpstream(tt.upstream)
+			if tt.wantErr {
+				req.Error(err)
+				return
+			}
+			req.NoError(err)
+			req.Equal(tt.want, got)
+		})
+	}
+}
+
+func TestClient(t *testing.T) {
+	tarballs := map[string][]byte{
+		"nginx-1.1.0.tgz": chartTarball(t, "nginx", "1.1.0", "nginx/"),
+		"nginx-1.2.0.tgz": chartTarball(t, "nginx", "1.2.0", "nginx/"),
+		"nginx-1.2.3.tgz": chartTarball(t, "nginx", "1.2.3", "nginx/"),
+		"nginx-2.0.0.tgz": chartTarball(t, "nginx", "2.0.0", "nginx/"),
+		"evil-1.0.0.tgz":  chartTarball(t, "evil", "1.0.0", "../"),
+	}
+
+	tests := []struct {
+		name        string
+		constraint  string
+		badDigest   bool
+		wantVersion string
+		wantErr     string
+	}{
+		{
+			name:        "tilde constraint picks the newest patch",
+			constraint:  "~1.2",
+			wantVersion: "1.2.3",
+		},
+		{
+			name:        "no constraint picks the newest version",
+			constraint:  "",
+			wantVersion: "2.0.0",
+		},
+		{
+			name:        "exact version",
+			constraint:  "1.2.0",
+			wantVersion: "1.2.0",
+		},
+		{
+			name:       "nothing satisfies the constraint",
+			constraint: "~3.0",
+			wantErr:    "find version of chart nginx",
+		},
+		{
+			name:       "digest doesn't match the index",
+			constraint: "~1.2",
+			badDigest:  true,
+			wantErr:    "but the repository index lists",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := require.New(t)
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/charts/index.yaml" {
+					fmt.Fprint(w, index(tarballs, tt.badDigest))
+					return
+				}
+				tarball, ok := tarballs[strings.TrimPrefix(r.URL.Path, "/charts/")]
+				if !ok {
+					http.NotFound(w, r)
+					return
+				}
+				w.Write(tarball) // nolint: errcheck
+			}))
+			defer server.Close()
+
+			upstream := InsecureScheme + strings.TrimPrefix(server.URL, "http://") + "/charts/nginx"
+			if tt.constraint != "" {
+				upstream += "?version=" + tt.constraint
+			}
+
+			fs := afero.Afero{Fs: afero.NewMemMapFs()}
+			client := NewClient(log.NewNopLogger(), fs, viper.New(), nil, nil)
+
+			chartPath, err := client.GetFiles(context.Background(), upstream, ".ship/tmp/chart")
+			if tt.wantErr != "" {
+				req.Error(err)
+				req.Contains(err.Error(), tt.wantErr)
+				_, ok := client.Resolved(upstream)
+				req.False(ok)
+				return
+			}
+			req.NoError(err)
+			req.Equal(filepath.Join(".ship/tmp/chart", "nginx"), chartPath)
+
+			chartYAML, err := fs.ReadFile(filepath.Join(chartPath, "Chart.yaml"))
+			req.NoError(err)
+			req.Contains(string(chartYAML), "version: "+tt.wantVersion)
+
+			resolved, ok := client.Resolved(upstream)
+			req.True(ok)
+			req.Equal(tt.wantVersion, resolved.Version)
+			wantDigest := fmt.Sprintf("%x", sha256.Sum256(tarballs["nginx-"+tt.wantVersion+".tgz"]))
+			req.Equal(wantDigest, resolved.Digest)
+
+			contentSHA, err := client.ContentSHA(context.Background(), upstream)
+			req.NoError(err)
+			req.Equal(wantDigest, contentSHA)
+
+			_, version, err := client.LatestVersion(context.Background(), upstream)
+			req.NoError(err)
+			req.Equal(tt.wantVersion, version)
+		})
+	}
+
+	t.Run("archive entries outside the chart", func(t *testing.T) {
+		req := require.New(t)
+		fs := afero.Afero{Fs: afero.NewMemMapFs()}
+		client := NewClient(log.NewNopLogger(), fs, viper.New(), nil, nil)
+
+		err := client.extract(tarballs["evil-1.0.0.tgz"], ".ship/tmp/chart")
+		req.Error(err)
+		req.Contains(err.Error(), "outside of the chart")
+	})
+}
+
+func TestClientCache(t *testing.T) {
+	req := require.New(t)
+	tarball := chartTarball(t, "nginx", "1.2.3", "nginx/")
+	indexYAML := index(map[string][]byte{"nginx-1.2.3.tgz": tarball}, false)
+
+	var indexRequests, notModified, downloads int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/charts/index.yaml":
+			indexRequests++
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				notModified++
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set("ETag", `"v1"`)
+			fmt.Fprint(w, indexYAML)
+		case "/charts/nginx-1.2.3.tgz":
+			downloads++
+			w.Write(tarball) // nolint: errcheck
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	upstream := InsecureScheme + strings.TrimPrefix(server.URL, "http://") + "/charts/nginx?version=~1.2"
+	fs := afero.Afero{Fs: afero.NewMemMapFs()}
+	cache := &upstreamcache.Cache{Logger: log.NewNopLogger(), FS: fs, Dir: "/cache"}
+
+	for i := 0; i < 2; i++ {
+		client := NewClient(log.NewNopLogger(), fs, viper.New(), cache, nil)
+		chartPath, err := client.GetFiles(context.Background(), upstream, ".ship/tmp/chart")
+		req.NoError(err)
+		exists, err := fs.Exists(filepath.Join(chartPath, "Chart.yaml"))
+		req.NoError(err)
+		req.True(exists)
+		resolved, ok := client.Resolved(upstream)
+		req.True(ok)
+		req.Equal("1.2.3", resolved.Version)
+	}
+	req.Equal(2, indexRequests)
+	req.Equal(1, notModified)
+	req.Equal(1, downloads)
+
+	server.Close()
+	cache.Offline = true
+	client := NewClient(log.NewNopLogger(), fs, viper.New(), cache, nil)
+	_, err := client.GetFiles(context.Background(), upstream, ".ship/tmp/chart")
+	req.NoError(err)
+	resolved, ok := client.Resolved(upstream)
+	req.True(ok)
+	req.Equal("1.2.3", resolved.Version)
+	req.Equal(fmt.Sprintf("%x", sha256.Sum256(tarball)), resolved.Digest)
+
+	contentSHA, err := client.ContentSHA(context.Background(), upstream)
+	req.NoError(err)
+	req.Equal(resolved.Digest, contentSHA)
+}
+
+func TestClientVerify(t *testing.T) {
+	tarball := chartTarball(t, "nginx", "1.2.3", "nginx/")
+	indexYAML := index(map[string][]byte{"nginx-1.2.3.tgz": tarball}, false)
+	signer, keyring := testKeyring(t, "Charts", "charts@example.com")
+	defer os.RemoveAll(filepath.Dir(keyring))
+	mallory, malloryKeyring := testKeyring(t, "Mallory", "mallory@example.com")
+	defer os.RemoveAll(filepath.Dir(malloryKeyring))
+
+	digest := fmt.Sprintf("%x", sha256.Sum256(tarball))
+	tests := []struct {
+		name       string
+		provenance []byte
+		verifier   *verify.Verifier
+		wantSigner string
+		wantDigest string
+		wantErr    string
+	}{
+		{
+			name:       "signed by a key in the keyring",
+			provenance: signChart(t, signer, tarball),
+			verifier:   &verify.Verifier{Keyring: keyring, Provenance: true},
+			wantSigner: "Charts <charts@example.com>",
+			wantDigest: "sha256:" + digest,
+		},
+		{
+			name:       "signed by someone else",
+			provenance: signChart(t, mallory, tarball),
+			verifier:   &verify.Verifier{Keyring: keyring, Provenance: true},
+			wantErr:    "verify provenance of nginx-1.2.3.tgz",
+		},
+		{
+			name:     "no provenance file",
+			verifier: &verify.Verifier{Keyring: keyring, Provenance: true},
+			wantErr:  "nginx-1.2.3.tgz.prov: unexpected status 404",
+		},
+		{
+			name:       "pinned digest",
+			verifier:   &verify.Verifier{SHA256: digest},
+			wantDigest: "sha256:" + digest,
+		},
+		{
+			name:     "different pinned digest",
+			verifier: &verify.Verifier{SHA256: strings.Repeat("0", len(digest))},
+			wantErr:  "but " + strings.Repeat("0", len(digest)) + " is pinned",
+		},
+		{
+			name:     "signatures can't be checked",
+			verifier: &verify.Verifier{Signatures: true},
+			wantErr:  "--verify-signatures can't be used with helm repository upstreams",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := require.New(t)
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/charts/index.yaml":
+					fmt.Fprint(w, indexYAML)
+				case "/charts/nginx-1.2.3.tgz":
+					w.Write(tarball) // nolint: errcheck
+				case "/charts/nginx-1.2.3.tgz.prov":
+					if tt.provenance == nil {
+						http.NotFound(w, r)
+						return
+					}
+					w.Write(tt.provenance) // nolint: errcheck
+				default:
+					http.NotFound(w, r)
+				}
+			}))
+			defer server.Close()
+
+			upstream := InsecureScheme + strings.TrimPrefix(server.URL, "http://") + "/charts/nginx?version=1.2.3"
+			fs := afero.Afero{Fs: afero.NewMemMapFs()}
+			tt.verifier.Logger = log.NewNopLogger()
+			client := NewClient(log.NewNopLogger(), fs, viper.New(), nil, tt.verifier)
+
+			_, err := client.GetFiles(context.Background(), upstream, ".ship/tmp/chart")
+			if tt.wantErr != "" {
+				req.Error(err)
+				req.Contains(err.Error(), tt.wantErr)
+				// nothing is unpacked from a chart that failed verification
+				exists, err := fs.Exists(".ship/tmp/chart")
+				req.NoError(err)
+				req.False(exists)
+				_, ok := tt.verifier.Verified(upstream)
+				req.False(ok)
+				return
+			}
+			req.NoError(err)
+
+			verification, ok := tt.verifier.Verified(upstream)
+			req.True(ok)
+			req.Equal(tt.wantSigner, verification.Signer)
+			req.Equal(tt.wantDigest, verification.Digest)
+		})
+	}
+
+	t.Run("cached before provenance was asked for", func(t *testing.T) {
+		req := require.New(t)
+		downloads := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/charts/index.yaml":
+				fmt.Fprint(w, indexYAML)
+			case "/charts/nginx-1.2.3.tgz":
+				downloads++
+				w.Write(tarball) // nolint: errcheck
+			case "/charts/nginx-1.2.3.tgz.prov":
+				w.Write(signChart(t, signer, tarball)) // nolint: errcheck
+			default:
+				http.NotFound(w, r)
+			}
+		}))
+		defer server.Close()
+
+		upstream := InsecureScheme + strings.TrimPrefix(server.URL, "http://") + "/charts/nginx?version=1.2.3"
+		fs := afero.Afero{Fs: afero.NewMemMapFs()}
+		cache := &upstreamcache.Cache{Logger: log.NewNopLogger(), FS: fs, Dir: "/cache"}
+
+		_, err := NewClient(log.NewNopLogger(), fs, viper.New(), cache, nil).GetFiles(context.Background(), upstream, ".ship/tmp/chart")
+		req.NoError(err)
+
+		verifier := &verify.Verifier{Logger: log.NewNopLogger(), Keyring: keyring, Provenance: true}
+		cache.Offline = true
+		_, err = NewClient(log.NewNopLogger(), fs, viper.New(), cache, verifier).GetFiles(context.Background(), upstream, ".ship/tmp/chart")
+		req.Error(err)
+		req.Contains(err.Error(), "without checking its provenance")
+
+		cache.Offline = false
+		for i := 0; i < 2; i++ {
+			_, err = NewClient(log.NewNopLogger(), fs, viper.New(), cache, verifier).GetFiles(context.Background(), upstream, ".ship/tmp/chart")
+			req.NoError(err)
+		}
+		// downloaded again once to check it, then the verified chart is used from the cache
+		req.Equal(2, downloads)
+
+		cache.Offline = true
+		_, err = NewClient(log.NewNopLogger(), fs, viper.New(), cache, verifier).GetFiles(context.Background(), upstream, ".ship/tmp/chart")
+		req.NoError(err)
+		verification, ok := verifier.Verified(upstream)
+		req.True(ok)
+		req.Equal(verify.MethodHelmProvenance, verification.Method)
+	})
+}
+
+func index(tarballs map[string][]byte, badDigest bool) string {
+	var entries []string
+	for _, version := range []string{"1.1.0", "1.2.0", "1.2.3", "2.0.0"} {
+		name := "nginx-" + version + ".tgz"
+		digest := fmt.Sprintf("%x", sha256.Sum256(tarballs[name]))
+		if badDigest {
+			digest = strings.Repeat("0", len(digest))
+		}
+		entries = append(entries, fmt.Sprintf(`  - name: nginx
+    version: %s
+    digest: %s
+    urls:
+    - %s`, version, digest, name))
+	}
+	return "apiVersion: v1\nentries:\n  nginx:\n" + strings.Join(entries, "\n") + "\n"
+}
+
+func chartTarball(t *testing.T, name, version, dir string) []byte {
+	var buf bytes.Buffer
+	gzipWriter := gzip.NewWriter(&buf)
+	tarWriter := tar.NewWriter(gzipWriter)
+
+	files := map[string]string{
+		"Chart.yaml":                fmt.Sprintf("name: %s\nversion: %s\n", name, version),
+		"templates/deployment.yaml": "kind: Deployment\n",
+	}
+	for _, filename := range []string{"Chart.yaml", "templates/deployment.yaml"} {
+		contents := files[filename]
+		header := &tar.Header{Name: dir + filename, Mode: 0644, Size: int64(len(contents)), Typeflag: tar.TypeReg}
+		require.NoError(t, tarWriter.WriteHeader(header))
+		_, err := tarWriter.Write([]byte(contents))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tarWriter.Close())
+	require.NoError(t, gzipWriter.Close())
+	return buf.Bytes()
+}
+
+func testKeyring(t *testing.T, name, email string) (*openpgp.Entity, string) {
+	req := require.New(t)
+	entity, err := openpgp.NewEntity(name, "", email, nil)
+	req.NoError(err)
+
+	dir, err := ioutil.TempDir("", "helmrepo-keyring")
+	req.NoError(err)
+	var keyring bytes.Buffer
+	req.NoError(entity.Serialize(&keyring))
+	path := filepath.Join(dir, "pubring.gpg")
+	req.NoError(ioutil.WriteFile(path, keyring.Bytes(), 0644))
+	return entity, path
+}
+
+func signChart(t *testing.T, signer *openpgp.Entity, tarball []byte) []byte {
+	req := require.New(t)
+	dir, err := ioutil.TempDir("", "helmrepo-sign")
+	req.NoError(err)
+	defer os.RemoveAll(dir)
+
+	chartPath := filepath.Join(dir, "nginx-1.2.3.tgz")
+	req.NoError(ioutil.WriteFile(chartPath, tarball, 0644))
+	signed, err := (&provenance.Signatory{Entity: signer}).ClearSign(chartPath)
+	req.NoError(err)
+	return []byte(signed)
+}
+
+func TestClientBasicAuth(t *testing.T) {
+	tarball := chartTarball(t, "nginx", "1.2.3", "nginx/")
+
+	// charts are served from another host, which shouldn't be sent the repository's credentials
+	var chartAuth bool
+	chartServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _, chartAuth = r.BasicAuth()
+		w.Write(tarball) // nolint: errcheck
+	}))
+	defer chartServer.Close()
+
+	repoServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if username, password, ok := r.BasicAuth(); !ok || username != "ship" || password != "hunter2" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		index := strings.Replace(index(map[string][]byte{"nginx-1.2.3.tgz": tarball}, false), "nginx-1.2.3.tgz", chartServer.URL+"/nginx-1.2.3.tgz", 1)
+		fmt.Fprint(w, index)
+	}))
+	defer repoServer.Close()
+
+	upstream := InsecureScheme + strings.TrimPrefix(repoServer.URL, "http://") + "/nginx?version=1.2.3"
+
+	t.Run("without credentials", func(t *testing.T) {
+		req := require.New(t)
+		fs := afero.Afero{Fs: afero.NewMemMapFs()}
+		_, err := NewClient(log.NewNopLogger(), fs, viper.New(), nil, nil).GetFiles(context.Background(), upstream, ".ship/tmp/chart")
+		req.Error(err)
+		req.Contains(err.Error(), "401")
+	})
+
+	t.Run("with credentials", func(t *testing.T) {
+		req := require.New(t)
+		fs := afero.Afero{Fs: afero.NewMemMapFs()}
+		v := viper.New()
+		v.Set("helm-repo-username", "ship")
+		v.Set("helm-repo-password", "hunter2")
+		chartPath, err := NewClient(log.NewNopLogger(), fs, v, nil, nil).GetFiles(context.Background(), upstream, ".ship/tmp/chart")
+		req.NoError(err)
+		req.Equal(filepath.Join(".ship/tmp/chart", "nginx"), chartPath)
+		req.False(chartAuth, "credentials were sent to the chart host")
+	})
+}
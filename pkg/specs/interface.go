@@ -13,6 +13,8 @@ import (
 	"github.com/pkg/errors"
 	"github.com/replicatedhq/ship/pkg/api"
 	"github.com/replicatedhq/ship/pkg/constants"
+	"github.com/replicatedhq/ship/pkg/specs/apptype"
+	"github.com/replicatedhq/ship/pkg/specs/helmrepo"
 	"github.com/replicatedhq/ship/pkg/specs/replicatedapp"
 	"github.com/replicatedhq/ship/pkg/util"
 )
@@ -22,31 +24,42 @@ import (
 // A "target string" is something like
 //
 //   github.com/helm/charts/stable/nginx-ingress
+//   helm://kubernetes-charts.storage.googleapis.com/nginx-ingress?version=~0.30
 //   replicated.app/cool-ci-tool?customer_id=...&installation_id=...
 //   file::/home/bob/apps/ship.yaml
 //   file::/home/luke/my-charts/proton-torpedoes
 func (r *Resolver) ResolveRelease(ctx context.Context, upstream string) (*api.Release, error) {
 	debug := log.With(level.Debug(r.Logger), "method", "ResolveRelease")
-	r.ui.Info(fmt.Sprintf("Reading %s ...", upstream))
+	r.ui.Info(fmt.Sprintf("Reading %s ...", util.Redact(upstream)))
 
 	r.ui.Info("Determining application type ...")
 	applicationType, localPath, err := r.appTypeInspector.DetermineApplicationType(ctx, upstream)
 	if err != nil {
-		return nil, errors.Wrapf(err, "determine type of %s", upstream)
+		return nil, errors.Wrapf(err, "determine type of %s", util.Redact(upstream))
 	}
 	debug.Log("event", "applicationType.resolve", "type", applicationType)
 	r.ui.Info(fmt.Sprintf("Detected application type %s", applicationType))
 
-	debug.Log("event", "upstream.Serialize", "for", localPath, "upstream", upstream)
+	debug.Log("event", "upstream.Serialize", "for", localPath, "upstream", util.Redact(upstream))
 	err = r.StateManager.SerializeUpstream(upstream)
 	if err != nil {
 		return nil, errors.Wrapf(err, "write upstream")
 	}
 
+	// cleared when nothing was verified, so state never claims a verification this fetch didn't make
+	verification, _ := r.Verifier.Verified(upstream)
+	if verification != nil {
+		debug.Log("event", "upstream.verified", "method", verification.Method, "signer", verification.Signer)
+		r.ui.Info(fmt.Sprintf("Verified upstream (%s): %s", verification.Method, verifiedBy(verification)))
+	}
+	if err := r.StateManager.SerializeUpstreamVerification(verification); err != nil {
+		return nil, errors.Wrap(err, "write upstream verification")
+	}
+
 	switch applicationType {
 
-	case "helm":
-		defaultRelease := r.DefaultHelmRelease(localPath)
+	case "helm", "helm3":
+		defaultRelease := r.DefaultHelmRelease(localPath, apptype.ApplicationChartAPIVersion(applicationType))
 		return r.resolveRelease(
 			ctx,
 			upstream,
@@ -69,6 +82,22 @@ func (r *Resolver) ResolveRelease(ctx context.Context, upstream string) (*api.Re
 			false,
 		)
 
+	case "kustomize":
+		builtPath, err := r.buildKustomization(ctx, localPath, constants.KustomizeBuildPath)
+		if err != nil {
+			return nil, errors.Wrapf(err, "build kustomization %s", util.Redact(upstream))
+		}
+		defaultRelease := r.DefaultRawRelease(constants.KustomizeBasePath)
+		return r.resolveRelease(
+			ctx,
+			upstream,
+			builtPath,
+			constants.KustomizeBasePath,
+			&defaultRelease,
+			applicationType,
+			false,
+		)
+
 	case "replicated.app":
 		parsed, err := url.Parse(upstream)
 		if err != nil {
@@ -86,17 +115,75 @@ func (r *Resolver) ResolveRelease(ctx context.Context, upstream string) (*api.Re
 
 	}
 
-	return nil, errors.Errorf("unknown application type %q for upstream %q", applicationType, upstream)
+	return nil, errors.Errorf("unknown application type %q for upstream %q", applicationType, util.Redact(upstream))
 }
 
 // read the content sha without writing anything to state
 func (r *Resolver) ReadContentSHAForWatch(ctx context.Context, upstream string) (string, error) {
+	metadata, err := r.ReadUpstreamForWatch(ctx, upstream)
+	if err != nil {
+		return "", err
+	}
+	return metadata.ContentSHA, nil
+}
+
+// ReadUpstreamForWatch reads the content sha of upstream, and its version if it has one, without writing anything to state.
+// Release notes are only included if they come with the release, see ResolveReleaseNotes.
+func (r *Resolver) ReadUpstreamForWatch(ctx context.Context, upstream string) (*api.ShipAppMetadata, error) {
+	return r.readUpstreamForWatch(ctx, upstream, r.appTypeInspector.DetermineApplicationType, constants.KustomizeBuildPath)
+}
+
+// ReadContentSHAForWatchIn is ReadContentSHAForWatch, fetching and building the upstream under workDir
+// instead of the shared paths in .ship/tmp, so several upstreams can be read at once
+func (r *Resolver) ReadContentSHAForWatchIn(ctx context.Context, upstream string, workDir string) (string, error) {
+	determine := func(ctx context.Context, upstream string) (string, string, error) {
+		return r.appTypeInspector.DetermineApplicationTypeAt(ctx, upstream, filepath.Join(workDir, "repo"))
+	}
+	metadata, err := r.readUpstreamForWatch(ctx, upstream, determine, filepath.Join(workDir, "kustomize-build"))
+	if err != nil {
+		return "", err
+	}
+	return metadata.ContentSHA, nil
+}
 
+// ResolveReleaseNotes looks up the release notes of upstream's current release, if its host publishes them.
+// Failing to find them isn't an error, there just aren't any notes.
+func (r *Resolver) ResolveReleaseNotes(ctx context.Context, upstream string) string {
+	fetcher := r.releaseNotesFetcher(upstream)
+	if fetcher == nil {
+		return ""
+	}
+
+	releaseNotes, err := fetcher.ResolveReleaseNotes(ctx, upstream)
+	if err != nil {
+		level.Debug(r.Logger).Log("event", "releaseNotes.resolve.fail", "upstream", util.Redact(upstream), "err", err)
+		return ""
+	}
+	return releaseNotes
+}
+
+func (r *Resolver) readUpstreamForWatch(
+	ctx context.Context,
+	upstream string,
+	determine func(ctx context.Context, upstream string) (appType string, localPath string, err error),
+	kustomizeBuildPath string,
+) (*api.ShipAppMetadata, error) {
 	debug := level.Debug(log.With(r.Logger, "method", "ReadContentSHAForWatch"))
+
+	// helm repositories publish chart digests in their index, so there's no need to download the chart
+	if helmrepo.IsHelmRepoUpstream(upstream) {
+		debug.Log("event", "helmrepo.resolve", "upstream", util.Redact(upstream))
+		contentSHA, version, err := r.HelmRepo.LatestVersion(ctx, upstream)
+		if err != nil {
+			return nil, errors.Wrapf(err, "resolve content sha for %s", util.Redact(upstream))
+		}
+		return &api.ShipAppMetadata{ContentSHA: contentSHA, Version: version}, nil
+	}
+
 	debug.Log("event", "fetch latest chart")
-	appType, localPath, err := r.appTypeInspector.DetermineApplicationType(ctx, upstream)
+	appType, localPath, err := determine(ctx, upstream)
 	if err != nil {
-		return "", errors.Wrapf(err, "resolve app type for %s", upstream)
+		return nil, errors.Wrapf(err, "resolve app type for %s", util.Redact(upstream))
 	}
 	debug.Log("event", "apptype.inspect", "type", appType, "localPath", localPath)
 
@@ -110,31 +197,53 @@ func (r *Resolver) ReadContentSHAForWatch(ctx context.Context, upstream string)
 	// but in this case we only want to read the metadata without persisting anything to state,
 	// and there doesn't seem to be a good way to evolve that abstraction cleanly from what we have, at least not just yet
 	switch appType {
-	case "helm":
-	case "k8s":
-	case "inline.replicated.app":
+	case "kustomize":
+		builtPath, err := r.buildKustomization(ctx, localPath, kustomizeBuildPath)
+		if err != nil {
+			return nil, errors.Wrapf(err, "build kustomization %s", util.Redact(upstream))
+		}
+		defer func() {
+			if err := r.FS.RemoveAll(builtPath); err != nil {
+				level.Error(r.Logger).Log("event", "remove watch dir", "err", err)
+			}
+		}()
+
+		metadata, err := r.ResolveBaseMetadata(upstream, builtPath)
+		if err != nil {
+			return nil, errors.Wrapf(err, "resolve metadata and content sha for %s %s", appType, util.Redact(upstream))
+		}
+		return metadata, nil
+
+	case "helm", "helm3", "k8s", "inline.replicated.app":
 		metadata, err := r.ResolveBaseMetadata(upstream, localPath)
 		if err != nil {
-			return "", errors.Wrapf(err, "resolve metadata and content sha for %s %s", appType, upstream)
+			return nil, errors.Wrapf(err, "resolve metadata and content sha for %s %s", appType, util.Redact(upstream))
 		}
-		return metadata.ContentSHA, nil
+		if appType == "helm" || appType == "helm3" {
+			metadata.Version = r.chartVersion(localPath)
+		}
+		return metadata, nil
 
 	case "replicated.app":
 		parsed, err := url.Parse(upstream)
 		if err != nil {
-			return "", errors.Wrapf(err, "parse url %s", upstream)
+			return nil, errors.Wrapf(err, "parse url %s", upstream)
 		}
 		selector := (&replicatedapp.Selector{}).UnmarshalFrom(parsed)
 
 		release, err := r.AppResolver.FetchRelease(ctx, selector)
 		if err != nil {
-			return "", errors.Wrap(err, "fetch release")
+			return nil, errors.Wrap(err, "fetch release")
 		}
 
-		return fmt.Sprintf("%x", sha256.Sum256([]byte(release.Spec))), nil
+		return &api.ShipAppMetadata{
+			ContentSHA:   fmt.Sprintf("%x", sha256.Sum256([]byte(release.Spec))),
+			Version:      release.Semver,
+			ReleaseNotes: release.ReleaseNotes,
+		}, nil
 	}
 
-	return "", errors.Errorf("Could not determine application type of upstream %s", upstream)
+	return nil, errors.Errorf("Could not determine application type of upstream %s", util.Redact(upstream))
 }
 
 func (r *Resolver) resolveRelease(
@@ -188,9 +297,11 @@ func (r *Resolver) resolveRelease(
 		debug.Log("event", "no ship.yaml for release")
 		r.ui.Info("ship.yaml not found in upstream, generating default lifecycle for application ...")
 		spec = defaultSpec
+	} else if err := r.persistSpec(*spec); err != nil {
+		return nil, errors.Wrapf(err, "persist ship.yaml release for %s", destPath)
 	}
 
-	if applicationType == "k8s" {
+	if applicationType == "k8s" || applicationType == "kustomize" {
 		err = r.maybeSplitMultidocYaml(ctx, destPath)
 		if err != nil {
 			return nil, errors.Wrap(err, "split multipath yaml")
@@ -264,6 +375,9 @@ func (r *Resolver) resolveInlineShipYAMLRelease(
 	if err != nil || spec == nil {
 		return nil, errors.Wrapf(err, "resolve ship.yaml release for %s", localPath)
 	}
+	if err := r.persistSpec(*spec); err != nil {
+		return nil, errors.Wrapf(err, "persist ship.yaml release for %s", localPath)
+	}
 
 	release := &api.Release{
 		Metadata: api.ReleaseMetadata{
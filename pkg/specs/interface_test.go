@@ -9,8 +9,12 @@ import (
 
 	"github.com/go-kit/kit/log"
 	"github.com/golang/mock/gomock"
+	"github.com/pkg/errors"
 	"github.com/replicatedhq/ship/pkg/api"
+	apptype2 "github.com/replicatedhq/ship/pkg/specs/apptype"
 	replicatedapp2 "github.com/replicatedhq/ship/pkg/specs/replicatedapp"
+	"github.com/replicatedhq/ship/pkg/specs/verify"
+	state2 "github.com/replicatedhq/ship/pkg/state"
 	"github.com/replicatedhq/ship/pkg/test-mocks/apptype"
 	"github.com/replicatedhq/ship/pkg/test-mocks/githubclient"
 	"github.com/replicatedhq/ship/pkg/test-mocks/replicatedapp"
@@ -26,10 +30,12 @@ func TestResolver_ResolveRelease(t *testing.T) {
 	viperResolver := Resolver{Viper: viper.New()}
 	ctx := context.Background()
 	tests := []struct {
-		name      string
-		upstream  string
-		shaSummer shaSummer
-		expect    func(
+		name             string
+		upstream         string
+		shaSummer        shaSummer
+		kustomizeBuilder kustomizeBuilder
+		verified         *state2.Verification
+		expect           func(
 			t *testing.T,
 			mockUi *ui.MockUi,
 			appType *apptype.MockInspector,
@@ -77,6 +83,7 @@ icon: https://kfbr.392/x5.png
 					}).After(inOrder)
 				inOrder = mockUi.EXPECT().Info("Detected application type helm").After(inOrder)
 				inOrder = mockState.EXPECT().SerializeUpstream("github.com/helm/charts/stable/x5").After(inOrder)
+				inOrder = mockState.EXPECT().SerializeUpstreamVerification(nil).After(inOrder)
 				mockReleaseNotesFetcher.EXPECT().
 					ResolveReleaseNotes(ctx, "github.com/helm/charts/stable/x5").
 					Return("some release notes", nil)
@@ -96,7 +103,7 @@ icon: https://kfbr.392/x5.png
 
 			},
 			expectRelease: &api.Release{
-				Spec: viperResolver.DefaultHelmRelease("fake-tmp"),
+				Spec: viperResolver.DefaultHelmRelease("fake-tmp", apptype2.ChartAPIVersionV1),
 				Metadata: api.ReleaseMetadata{
 					ShipAppMetadata: api.ShipAppMetadata{
 						Version:      "0.1.0",
@@ -132,6 +139,7 @@ icon: https://kfbr.392/x5.png
 
 				inOrder = mockUi.EXPECT().Info("Detected application type replicated.app").After(inOrder)
 				inOrder = mockState.EXPECT().SerializeUpstream("replicated.app?customer_id=12345&installation_id=67890").After(inOrder)
+				inOrder = mockState.EXPECT().SerializeUpstreamVerification(nil).After(inOrder)
 				mockAppResolver.EXPECT().ResolveAppRelease(ctx, &replicatedapp2.Selector{
 					CustomerID:     "12345",
 					InstallationID: "67890",
@@ -148,11 +156,17 @@ icon: https://kfbr.392/x5.png
 			},
 		},
 		{
-			name:     "plain k8s app",
+			name:     "plain k8s app at a signed commit",
 			upstream: "github.com/replicatedhq/test-charts/plain-k8s",
 			shaSummer: func(resolver *Resolver, s string) (string, error) {
 				return "abcdef1234567890", nil
 			},
+			verified: &state2.Verification{
+				Method:      "signed-commit",
+				Digest:      "0123456789abcdef0123456789abcdef01234567",
+				Signer:      "Release Bot <release@example.com>",
+				Fingerprint: "ABCDEF",
+			},
 			expect: func(
 				t *testing.T,
 				mockUi *ui.MockUi,
@@ -176,6 +190,13 @@ icon: https://kfbr.392/x5.png
 					}).After(inOrder)
 				inOrder = mockUi.EXPECT().Info("Detected application type k8s").After(inOrder)
 				inOrder = mockState.EXPECT().SerializeUpstream("github.com/replicatedhq/test-charts/plain-k8s").After(inOrder)
+				inOrder = mockUi.EXPECT().Info("Verified upstream (signed-commit): Release Bot <release@example.com>").After(inOrder)
+				inOrder = mockState.EXPECT().SerializeUpstreamVerification(&state2.Verification{
+					Method:      "signed-commit",
+					Digest:      "0123456789abcdef0123456789abcdef01234567",
+					Signer:      "Release Bot <release@example.com>",
+					Fingerprint: "ABCDEF",
+				}).After(inOrder)
 				inOrder = mockReleaseNotesFetcher.EXPECT().
 					ResolveReleaseNotes(ctx, "github.com/replicatedhq/test-charts/plain-k8s").
 					Return("plain-k8s example", nil).After(inOrder)
@@ -196,6 +217,57 @@ icon: https://kfbr.392/x5.png
 				},
 			},
 		},
+		{
+			name:     "kustomization in a git repo",
+			upstream: "git::https://gitlab.com/o/platform.git//overlays/prod",
+			shaSummer: func(resolver *Resolver, s string) (string, error) {
+				return "abcdef1234567890", nil
+			},
+			kustomizeBuilder: func(resolver *Resolver, kustomizationPath string) ([]byte, error) {
+				if kustomizationPath != "fake-tmp" {
+					return nil, errors.Errorf("built %s", kustomizationPath)
+				}
+				return []byte("apiVersion: v1\nkind: Service\nmetadata:\n  name: web\n---\napiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: web\n"), nil
+			},
+			expect: func(
+				t *testing.T,
+				mockUi *ui.MockUi,
+				appType *apptype.MockInspector,
+				mockState *state.MockManager,
+				mockFs afero.Afero,
+				mockAppResolver *replicatedapp.MockResolver,
+				mockReleaseNotesFetcher *githubclient.MockGitHubReleaseNotesFetcher,
+			) {
+				req := require.New(t)
+				inOrder := mockUi.EXPECT().Info("Reading git::https://gitlab.com/o/platform.git//overlays/prod ...")
+				inOrder = mockUi.EXPECT().Info("Determining application type ...").After(inOrder)
+				inOrder = appType.EXPECT().
+					DetermineApplicationType(ctx, "git::https://gitlab.com/o/platform.git//overlays/prod").
+					DoAndReturn(func(context.Context, string) (string, string, error) {
+						req.NoError(mockFs.MkdirAll("fake-tmp", 0755))
+						req.NoError(mockFs.WriteFile(path.Join("fake-tmp", "README.md"), []byte("its the readme"), 0644))
+						req.NoError(mockFs.WriteFile(path.Join("fake-tmp", "kustomization.yaml"), []byte("bases:\n- ../../base\n"), 0644))
+						return "kustomize", "fake-tmp", nil
+					}).After(inOrder)
+				inOrder = mockUi.EXPECT().Info("Detected application type kustomize").After(inOrder)
+				inOrder = mockState.EXPECT().SerializeUpstream("git::https://gitlab.com/o/platform.git//overlays/prod").After(inOrder)
+				inOrder = mockState.EXPECT().SerializeUpstreamVerification(nil).After(inOrder)
+				inOrder = mockState.EXPECT().SerializeContentSHA("abcdef1234567890").After(inOrder)
+				inOrder = mockUi.EXPECT().Info("Looking for ship.yaml ...").After(inOrder)
+				inOrder = mockUi.EXPECT().Info("ship.yaml not found in upstream, generating default lifecycle for application ...").After(inOrder)
+				mockState.EXPECT().SerializeReleaseName("ship").After(inOrder)
+			},
+			expectRelease: &api.Release{
+				Spec: viperResolver.DefaultRawRelease("base"),
+				Metadata: api.ReleaseMetadata{
+					ShipAppMetadata: api.ShipAppMetadata{
+						URL:        "git::https://gitlab.com/o/platform.git//overlays/prod",
+						Readme:     "its the readme",
+						ContentSHA: "abcdef1234567890",
+					},
+				},
+			},
+		},
 	}
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
@@ -218,6 +290,9 @@ icon: https://kfbr.392/x5.png
 			err = mockFs.MkdirAll(".ship/tmp/", 0755)
 			req.NoError(err)
 
+			verifier := &verify.Verifier{Logger: log.NewNopLogger()}
+			verifier.Record(test.upstream, test.verified)
+
 			resolver := &Resolver{
 				Logger:                    log.NewNopLogger(),
 				StateManager:              mockState,
@@ -227,7 +302,9 @@ icon: https://kfbr.392/x5.png
 				ui:                        mockUI,
 				appTypeInspector:          appType,
 				shaSummer:                 test.shaSummer,
+				kustomizeBuilder:          test.kustomizeBuilder,
 				GitHubReleaseNotesFetcher: mockReleaseNotesFetcher,
+				Verifier:                  verifier,
 			}
 			test.expect(t, mockUI, appType, mockState, mockFs, mockAppResolver, mockReleaseNotesFetcher)
 
@@ -294,6 +371,37 @@ func TestResolver_ReadContentSHAForWatch(t *testing.T) {
 	}
 }
 
+func TestResolver_ReadUpstreamForWatch(t *testing.T) {
+	req := require.New(t)
+	ctx := context.Background()
+	mc := gomock.NewController(t)
+	inspector := apptype.NewMockInspector(mc)
+	fs := afero.Afero{Fs: afero.NewMemMapFs()}
+
+	req.NoError(fs.WriteFile("fetched/Chart.yaml", []byte("name: nginx\nversion: 1.2.3\n"), 0644))
+	inspector.EXPECT().
+		DetermineApplicationType(ctx, "github.com/o/charts/nginx").
+		Return("helm", "fetched", nil)
+
+	r := &Resolver{
+		Logger:           &logger.TestLogger{T: t},
+		appTypeInspector: inspector,
+		shaSummer: func(*Resolver, string) (string, error) {
+			return "abcdef1234567890", nil
+		},
+		FS: fs,
+	}
+
+	metadata, err := r.ReadUpstreamForWatch(ctx, "github.com/o/charts/nginx")
+	req.NoError(err)
+	req.Equal("abcdef1234567890", metadata.ContentSHA)
+	req.Equal("1.2.3", metadata.Version)
+
+	exists, err := fs.Exists("fetched")
+	req.NoError(err)
+	req.False(exists)
+}
+
 func TestResolver_recursiveCopy(t *testing.T) {
 	type fileStruct struct {
 		name string
@@ -0,0 +1,63 @@
+package specs
+
+import (
+	"context"
+	"os"
+	"path"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/ship/pkg/patch"
+)
+
+type kustomizeBuilder func(r *Resolver, kustomizationPath string) ([]byte, error)
+
+func runKustomize(r *Resolver, kustomizationPath string) ([]byte, error) {
+	patcher := patch.ShipPatcher{Logger: r.Logger, FS: r.FS}
+	return patcher.RunKustomize(kustomizationPath)
+}
+
+// buildKustomization runs kustomize build on an upstream that is itself a kustomization, with its own bases,
+// patches and generators, and writes the resources it produces to buildPath, which is returned.
+// The ship overlay is then layered on top of the built resources like it would be on plain manifests.
+func (r *Resolver) buildKustomization(ctx context.Context, localPath, buildPath string) (string, error) {
+	debug := level.Debug(log.With(r.Logger, "method", "buildKustomization"))
+
+	debug.Log("event", "kustomize.build", "path", localPath)
+	built, err := r.kustomizeBuilder(r, localPath)
+	if err != nil {
+		return "", errors.Wrapf(err, "kustomize build %s", localPath)
+	}
+
+	if err := r.FS.RemoveAll(buildPath); err != nil {
+		return "", errors.Wrapf(err, "remove %s", buildPath)
+	}
+	if err := r.FS.MkdirAll(buildPath, 0755); err != nil {
+		return "", errors.Wrapf(err, "create %s", buildPath)
+	}
+
+	builtPath := path.Join(buildPath, "upstream.yaml")
+	if err := r.FS.WriteFile(builtPath, built, 0644); err != nil {
+		return "", errors.Wrapf(err, "write %s", builtPath)
+	}
+	if err := r.maybeSplitMultidocYaml(ctx, buildPath); err != nil {
+		return "", errors.Wrap(err, "split multidoc yaml")
+	}
+
+	// the readme is kept for the release metadata, the built resources are all that's needed otherwise
+	readme, err := r.FS.ReadFile(path.Join(localPath, "README.md"))
+	if err == nil {
+		if err := r.FS.WriteFile(path.Join(buildPath, "README.md"), readme, 0644); err != nil {
+			return "", errors.Wrap(err, "copy README.md")
+		}
+	} else if !os.IsNotExist(err) {
+		return "", errors.Wrapf(err, "read %s", path.Join(localPath, "README.md"))
+	}
+
+	if err := r.FS.RemoveAll(localPath); err != nil {
+		return "", errors.Wrapf(err, "remove %s", localPath)
+	}
+
+	return buildPath, nil
+}
@@ -0,0 +1,45 @@
+package specs
+
+import (
+	"context"
+	"path"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/replicatedhq/ship/pkg/constants"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolver_buildKustomization(t *testing.T) {
+	req := require.New(t)
+	fs := afero.Afero{Fs: afero.NewMemMapFs()}
+	req.NoError(fs.WriteFile(path.Join("fetched", "kustomization.yaml"), []byte("resources:\n- deployment.yaml\n"), 0644))
+	req.NoError(fs.WriteFile(path.Join("fetched", "deployment.yaml"), []byte("kind: Deployment\n"), 0644))
+	req.NoError(fs.WriteFile(path.Join("fetched", "README.md"), []byte("its the readme"), 0644))
+
+	r := &Resolver{
+		Logger: log.NewNopLogger(),
+		FS:     fs,
+		kustomizeBuilder: func(r *Resolver, kustomizationPath string) ([]byte, error) {
+			req.Equal("fetched", kustomizationPath)
+			return []byte("apiVersion: v1\nkind: Service\nmetadata:\n  name: web\n---\napiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: web\n  namespace: prod\n"), nil
+		},
+	}
+
+	builtPath, err := r.buildKustomization(context.Background(), "fetched", constants.KustomizeBuildPath)
+	req.NoError(err)
+	req.Equal(constants.KustomizeBuildPath, builtPath)
+
+	files, err := fs.ReadDir(builtPath)
+	req.NoError(err)
+	var names []string
+	for _, file := range files {
+		names = append(names, file.Name())
+	}
+	req.Equal([]string{"Deployment-web-prod.yaml", "README.md", "Service-web.yaml"}, names)
+
+	exists, err := fs.Exists("fetched")
+	req.NoError(err)
+	req.False(exists)
+}
@@ -0,0 +1,495 @@
+package upstreamcache
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/mitchellh/go-homedir"
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/ship/pkg/state"
+	"github.com/replicatedhq/ship/pkg/util"
+	"github.com/spf13/afero"
+	"github.com/spf13/viper"
+)
+
+// DefaultDir is where upstreams are cached unless --cache-dir says otherwise
+const DefaultDir = "~/.ship/cache"
+
+// Version identifies one version of an upstream's contents
+type Version struct {
+	// Ref is what was asked for, like a branch, tag or chart version constraint
+	Ref string `json:"ref,omitempty"`
+	// ID is what Ref resolved to, like a commit SHA or chart digest.
+	// If it's still empty after fetching, the digest of the fetched files is used.
+	ID string `json:"id,omitempty"`
+	// Name is a human readable name for the version, like a chart version
+	Name string `json:"name,omitempty"`
+	// Verification is how the contents were verified when they were fetched, if they were
+	Verification *state.Verification `json:"verification,omitempty"`
+}
+
+// Entry is one cached version of an upstream
+type Entry struct {
+	Key       string    `json:"key"`
+	Upstream  string    `json:"upstream"`
+	Version   Version   `json:"version"`
+	FetchedAt time.Time `json:"fetchedAt"`
+	LastUsed  time.Time `json:"lastUsed"`
+	// Files is the dir in the entry's dir that holds its files
+	Files string `json:"files,omitempty"`
+}
+
+// document is a cached response to a conditional request, like a helm repository index
+type document struct {
+	URL  string `json:"url"`
+	ETag string `json:"etag"`
+	Body []byte `json:"body"`
+}
+
+// Cache keeps fetched upstream contents between runs, keyed by upstream and the version they resolved to,
+// so fetchers only download an upstream when it's changed. Credentials are stripped from upstreams before they're cached.
+type Cache struct {
+	Logger log.Logger
+	FS     afero.Afero
+	Dir    string
+	// Offline restricts fetches to the cache, restoring the latest cached version of an upstream without any requests
+	Offline bool
+	Now     func() time.Time
+}
+
+// NewCache builds a Cache in --cache-dir
+func NewCache(logger log.Logger, fs afero.Afero, v *viper.Viper, now func() time.Time) *Cache {
+	dir := v.GetString("cache-dir")
+	if dir == "" {
+		dir = DefaultDir
+	}
+	if expanded, err := homedir.Expand(dir); err == nil {
+		dir = expanded
+	} else {
+		level.Error(logger).Log("event", "cache.dir.expand", "dir", dir, "err", err)
+	}
+
+	return &Cache{
+		Logger:  logger,
+		FS:      fs,
+		Dir:     dir,
+		Offline: v.GetBool("offline"),
+		Now:     now,
+	}
+}
+
+// Fetch fills dest with the version of upstream that resolve returns, restoring it from the cache if it's there and
+// calling fetch to fill dest and caching the result if it isn't. resolve is passed the version upstream was last
+// fetched at, if any, so it can make a conditional request. fetch can fill in the version's ID if it's only known
+// after fetching. When offline, the latest cached version is restored without calling either.
+func (c *Cache) Fetch(
+	upstream string,
+	dest string,
+	resolve func(previous *Version) (Version, error),
+	fetch func(version *Version) error,
+) (*Entry, error) {
+	debug := level.Debug(log.With(c.Logger, "struct", "upstreamcache.Cache", "method", "Fetch"))
+
+	latest, err := c.Latest(upstream)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.Offline {
+		if latest == nil {
+			return nil, errors.Errorf("upstream %s has not been cached, run without --offline to fetch it", util.Redact(upstream))
+		}
+		debug.Log("event", "offline.restore", "key", latest.Key)
+		return latest, c.Restore(latest, dest)
+	}
+
+	var previous *Version
+	if latest != nil {
+		previous = &latest.Version
+	}
+	version, err := resolve(previous)
+	if err != nil {
+		return nil, err
+	}
+
+	if version.ID != "" {
+		cached, err := c.Get(upstream, version)
+		if err != nil {
+			return nil, err
+		}
+		if cached != nil {
+			debug.Log("event", "cache.hit", "key", cached.Key, "version", version.ID)
+			if err := c.Restore(cached, dest); err != nil {
+				return nil, err
+			}
+			return cached, c.setLatest(upstream, cached.Key)
+		}
+	}
+
+	debug.Log("event", "cache.miss", "version", version.ID)
+	if err := fetch(&version); err != nil {
+		return nil, err
+	}
+	return c.Store(upstream, version, dest)
+}
+
+// Get returns the cached entry for a version of upstream, or nil if it isn't cached
+func (c *Cache) Get(upstream string, version Version) (*Entry, error) {
+	return c.readEntry(c.key(upstream, version))
+}
+
+// Latest returns the most recently fetched version of upstream, or nil if it has never been cached
+func (c *Cache) Latest(upstream string) (*Entry, error) {
+	latestPath := c.latestPath(upstream)
+	exists, err := c.FS.Exists(latestPath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "check %s", latestPath)
+	}
+	if !exists {
+		return nil, nil
+	}
+
+	key, err := c.FS.ReadFile(latestPath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "read %s", latestPath)
+	}
+	return c.readEntry(string(key))
+}
+
+// Restore replaces dest with the cached files of entry
+func (c *Cache) Restore(entry *Entry, dest string) error {
+	if err := c.FS.RemoveAll(dest); err != nil {
+		return errors.Wrapf(err, "remove %s", dest)
+	}
+	if err := copyDir(c.FS, c.filesPath(entry), dest); err != nil {
+		return errors.Wrapf(err, "restore %s from cache", util.Redact(entry.Upstream))
+	}
+
+	entry.LastUsed = c.now()
+	return c.writeEntry(entry)
+}
+
+// Store caches the files in src as version of upstream, and records it as the latest version of upstream
+func (c *Cache) Store(upstream string, version Version, src string) (*Entry, error) {
+	if version.ID == "" {
+		digest, err := digestDir(c.FS, src)
+		if err != nil {
+			return nil, errors.Wrapf(err, "digest %s", src)
+		}
+		version.ID = digest
+	}
+
+	now := c.now()
+	entry := &Entry{
+		Key:       c.key(upstream, version),
+		Upstream:  util.StripCredentials(upstream),
+		Version:   version,
+		FetchedAt: now,
+		LastUsed:  now,
+	}
+
+	// each store copies the files into a dir of its own and only then writes entry.json, which names that dir,
+	// so concurrent runs and interrupted stores never leave an entry pointing at partial files
+	entryDir := filepath.Join(c.Dir, "entries", entry.Key)
+	if err := c.FS.MkdirAll(entryDir, 0755); err != nil {
+		return nil, errors.Wrapf(err, "create %s", entryDir)
+	}
+	filesPath, err := c.FS.TempDir(entryDir, "files-")
+	if err != nil {
+		return nil, errors.Wrapf(err, "create files dir in %s", entryDir)
+	}
+	if err := copyDir(c.FS, src, filesPath); err != nil {
+		c.FS.RemoveAll(filesPath) // nolint: errcheck
+		return nil, errors.Wrapf(err, "copy %s into cache", src)
+	}
+	entry.Files = filepath.Base(filesPath)
+
+	previous, err := c.readEntry(entry.Key)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.writeEntry(entry); err != nil {
+		return nil, err
+	}
+	// an entry stored again, like one that's been verified since, no longer needs the files it was stored with
+	if previous != nil && previous.Files != entry.Files {
+		if err := c.FS.RemoveAll(c.filesPath(previous)); err != nil {
+			return nil, errors.Wrapf(err, "remove %s", c.filesPath(previous))
+		}
+	}
+	return entry, c.setLatest(upstream, entry.Key)
+}
+
+func (c *Cache) setLatest(upstream, key string) error {
+	latestPath := c.latestPath(upstream)
+	if err := c.FS.MkdirAll(filepath.Dir(latestPath), 0755); err != nil {
+		return errors.Wrapf(err, "create %s", filepath.Dir(latestPath))
+	}
+	return errors.Wrap(writeFileAtomic(c.FS, latestPath, []byte(key)), "record latest cached version")
+}
+
+// Document returns the cached body and ETag of a response from url, for an If-None-Match request
+func (c *Cache) Document(url string) (etag string, body []byte, ok bool, err error) {
+	documentPath := c.documentPath(url)
+	exists, err := c.FS.Exists(documentPath)
+	if err != nil {
+		return "", nil, false, errors.Wrapf(err, "check %s", documentPath)
+	}
+	if !exists {
+		return "", nil, false, nil
+	}
+
+	serialized, err := c.FS.ReadFile(documentPath)
+	if err != nil {
+		return "", nil, false, errors.Wrapf(err, "read %s", documentPath)
+	}
+	var doc document
+	if err := json.Unmarshal(serialized, &doc); err != nil {
+		return "", nil, false, errors.Wrapf(err, "unmarshal %s", documentPath)
+	}
+	return doc.ETag, doc.Body, true, nil
+}
+
+// StoreDocument caches a response from url along with its ETag
+func (c *Cache) StoreDocument(url, etag string, body []byte) error {
+	serialized, err := json.Marshal(document{URL: util.StripCredentials(url), ETag: etag, Body: body})
+	if err != nil {
+		return errors.Wrap(err, "marshal cached document")
+	}
+	documentPath := c.documentPath(url)
+	if err := c.FS.MkdirAll(filepath.Dir(documentPath), 0755); err != nil {
+		return errors.Wrap(err, "create cache documents dir")
+	}
+	return writeFileAtomic(c.FS, documentPath, serialized)
+}
+
+// Entries returns every cached entry, least recently used first
+func (c *Cache) Entries() ([]Entry, error) {
+	entriesDir := filepath.Join(c.Dir, "entries")
+	exists, err := c.FS.DirExists(entriesDir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "check %s", entriesDir)
+	}
+	if !exists {
+		return nil, nil
+	}
+
+	infos, err := c.FS.ReadDir(entriesDir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "read %s", entriesDir)
+	}
+
+	var entries []Entry
+	for _, info := range infos {
+		if !info.IsDir() {
+			continue
+		}
+		entry, err := c.readEntry(info.Name())
+		if err != nil {
+			return nil, err
+		}
+		if entry != nil {
+			entries = append(entries, *entry)
+		}
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].LastUsed.Before(entries[j].LastUsed)
+	})
+	return entries, nil
+}
+
+// Prune removes entries that haven't been used within maxAge, or every entry and cached document if maxAge is 0
+func (c *Cache) Prune(maxAge time.Duration) ([]Entry, error) {
+	if maxAge == 0 {
+		entries, err := c.Entries()
+		if err != nil {
+			return nil, err
+		}
+		if err := c.FS.RemoveAll(c.Dir); err != nil {
+			return nil, errors.Wrapf(err, "remove %s", c.Dir)
+		}
+		return entries, nil
+	}
+
+	entries, err := c.Entries()
+	if err != nil {
+		return nil, err
+	}
+
+	cutoff := c.now().Add(-maxAge)
+	var pruned []Entry
+	for _, entry := range entries {
+		if !entry.LastUsed.Before(cutoff) {
+			continue
+		}
+		if err := c.FS.RemoveAll(filepath.Join(c.Dir, "entries", entry.Key)); err != nil {
+			return pruned, errors.Wrapf(err, "remove cached %s", util.Redact(entry.Upstream))
+		}
+		pruned = append(pruned, entry)
+
+		latestPath := c.latestPath(entry.Upstream)
+		if latest, err := c.FS.ReadFile(latestPath); err == nil && string(latest) == entry.Key {
+			if err := c.FS.Remove(latestPath); err != nil {
+				return pruned, errors.Wrapf(err, "remove %s", latestPath)
+			}
+		}
+	}
+	return pruned, nil
+}
+
+func (c *Cache) readEntry(key string) (*Entry, error) {
+	entryPath := filepath.Join(c.Dir, "entries", key, "entry.json")
+	exists, err := c.FS.Exists(entryPath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "check %s", entryPath)
+	}
+	if !exists {
+		return nil, nil
+	}
+
+	serialized, err := c.FS.ReadFile(entryPath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "read %s", entryPath)
+	}
+	var entry Entry
+	if err := json.Unmarshal(serialized, &entry); err != nil {
+		return nil, errors.Wrapf(err, "unmarshal %s", entryPath)
+	}
+	return &entry, nil
+}
+
+func (c *Cache) writeEntry(entry *Entry) error {
+	entryPath := filepath.Join(c.Dir, "entries", entry.Key, "entry.json")
+	if err := c.FS.MkdirAll(filepath.Dir(entryPath), 0755); err != nil {
+		return errors.Wrapf(err, "create %s", filepath.Dir(entryPath))
+	}
+	return writeJSON(c.FS, entryPath, entry)
+}
+
+func (c *Cache) key(upstream string, version Version) string {
+	return hash(util.StripCredentials(upstream), version.Ref, version.ID)
+}
+
+func (c *Cache) filesPath(entry *Entry) string {
+	files := entry.Files
+	if files == "" {
+		files = "files"
+	}
+	return filepath.Join(c.Dir, "entries", entry.Key, files)
+}
+
+func (c *Cache) latestPath(upstream string) string {
+	return filepath.Join(c.Dir, "latest", hash(util.StripCredentials(upstream)))
+}
+
+func (c *Cache) documentPath(url string) string {
+	return filepath.Join(c.Dir, "documents", hash(util.StripCredentials(url))+".json")
+}
+
+func (c *Cache) now() time.Time {
+	if c.Now == nil {
+		return time.Now()
+	}
+	return c.Now()
+}
+
+func hash(parts ...string) string {
+	h := sha256.New()
+	for _, part := range parts {
+		fmt.Fprintf(h, "%s\x00", part)
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+func writeJSON(fs afero.Afero, path string, entry *Entry) error {
+	serialized, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "marshal cache entry")
+	}
+	return writeFileAtomic(fs, path, serialized)
+}
+
+// writeFileAtomic writes contents to a temp file next to path and renames it over path,
+// so readers see either the old contents or the new ones
+func writeFileAtomic(fs afero.Afero, path string, contents []byte) error {
+	tmpFile, err := fs.TempFile(filepath.Dir(path), "."+filepath.Base(path))
+	if err != nil {
+		return errors.Wrapf(err, "create temp file for %s", path)
+	}
+	_, err = tmpFile.Write(contents)
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = fs.Chmod(tmpFile.Name(), 0644)
+	}
+	if err == nil {
+		err = fs.Rename(tmpFile.Name(), path)
+	}
+	if err != nil {
+		fs.Remove(tmpFile.Name()) // nolint: errcheck
+		return errors.Wrapf(err, "write %s", path)
+	}
+	return nil
+}
+
+func copyDir(fs afero.Afero, src, dest string) error {
+	return fs.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dest, rel)
+
+		if info.IsDir() {
+			return fs.MkdirAll(target, 0755)
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		contents, err := fs.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return fs.WriteFile(target, contents, info.Mode().Perm())
+	})
+}
+
+// digestDir hashes the relative paths and contents of every file in dir
+func digestDir(fs afero.Afero, dir string) (string, error) {
+	h := sha256.New()
+	err := fs.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		contents, err := fs.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(h, "%s\x00%d\x00", filepath.ToSlash(rel), len(contents))
+		h.Write(contents)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
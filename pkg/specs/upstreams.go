@@ -0,0 +1,209 @@
+package specs
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/ship/pkg/api"
+	"github.com/replicatedhq/ship/pkg/constants"
+	"github.com/replicatedhq/ship/pkg/specs/apptype"
+	"github.com/replicatedhq/ship/pkg/state"
+	"github.com/replicatedhq/ship/pkg/util"
+	"gopkg.in/yaml.v2"
+)
+
+// names are used as directories under base/ and as helm release names, so they're kept to DNS labels
+var namedUpstreamRegex = regexp.MustCompile(`^([a-z0-9]([-a-z0-9]*[a-z0-9])?)=(.+)$`)
+
+// IsNamedUpstream reports whether arg is a name=upstream pair, like ingress=github.com/helm/charts/stable/nginx-ingress
+func IsNamedUpstream(arg string) bool {
+	return namedUpstreamRegex.MatchString(arg)
+}
+
+// ParseNamedUpstreams parses the name=upstream pairs of an application composed of several upstreams
+func ParseNamedUpstreams(args []string) ([]state.NamedUpstream, error) {
+	seen := map[string]bool{}
+	upstreams := make([]state.NamedUpstream, 0, len(args))
+	for _, arg := range args {
+		match := namedUpstreamRegex.FindStringSubmatch(arg)
+		if match == nil {
+			return nil, errors.Errorf("%q is not a name=upstream pair, names are lowercase letters, digits and dashes", util.Redact(arg))
+		}
+		name, upstream := match[1], match[3]
+		if seen[name] {
+			return nil, errors.Errorf("upstream name %q is used more than once", name)
+		}
+		seen[name] = true
+		upstreams = append(upstreams, state.NamedUpstream{Name: name, Upstream: upstream})
+	}
+	return upstreams, nil
+}
+
+// ResolveUpstreams fetches each of an application's named upstreams into base/<name>, and returns one release
+// that renders the helm charts among them and kustomizes all of base/ together.
+// Each upstream's content sha, version and verification are recorded with it in state.
+func (r *Resolver) ResolveUpstreams(ctx context.Context, upstreams []state.NamedUpstream) (*api.Release, error) {
+	debug := log.With(level.Debug(r.Logger), "method", "ResolveUpstreams")
+
+	if r.Viper.GetBool("rm-asset-dest") {
+		if err := r.FS.RemoveAll(constants.KustomizeBasePath); err != nil {
+			return nil, errors.Wrapf(err, "remove asset dest %s", constants.KustomizeBasePath)
+		}
+	}
+
+	if err := util.BailIfPresent(r.FS, constants.KustomizeBasePath, debug); err != nil {
+		return nil, errors.Wrapf(err, "backup %s", constants.KustomizeBasePath)
+	}
+
+	var assets []api.Asset
+	resolved := make([]state.NamedUpstream, 0, len(upstreams))
+	for _, upstream := range upstreams {
+		named, asset, err := r.resolveNamedUpstream(ctx, upstream)
+		if err != nil {
+			return nil, errors.Wrapf(err, "resolve upstream %s", upstream.Name)
+		}
+		resolved = append(resolved, named)
+		if asset != nil {
+			assets = append(assets, *asset)
+		}
+	}
+
+	debug.Log("event", "upstreams.serialize", "count", len(resolved))
+	if err := r.StateManager.SerializeNamedUpstreams(resolved); err != nil {
+		return nil, errors.Wrap(err, "write upstreams")
+	}
+
+	return &api.Release{
+		Spec: r.DefaultComposedRelease(assets),
+	}, nil
+}
+
+// resolveNamedUpstream fetches one named upstream. Manifests are written straight to base/<name>,
+// and charts are kept aside and returned as an asset to be rendered there.
+func (r *Resolver) resolveNamedUpstream(ctx context.Context, upstream state.NamedUpstream) (state.NamedUpstream, *api.Asset, error) {
+	debug := log.With(level.Debug(r.Logger), "method", "resolveNamedUpstream", "upstream", upstream.Name)
+	r.ui.Info(fmt.Sprintf("Reading %s from %s ...", upstream.Name, util.Redact(upstream.Upstream)))
+
+	applicationType, localPath, err := r.appTypeInspector.DetermineApplicationType(ctx, upstream.Upstream)
+	if err != nil {
+		return upstream, nil, errors.Wrapf(err, "determine type of %s", util.Redact(upstream.Upstream))
+	}
+	debug.Log("event", "applicationType.resolve", "type", applicationType)
+	if applicationType != "helm" && applicationType != "helm3" && applicationType != "k8s" && applicationType != "kustomize" {
+		return upstream, nil, errors.Errorf("%s is a %s application, only helm charts, kustomizations and kubernetes manifests can be combined with other upstreams", util.Redact(upstream.Upstream), applicationType)
+	}
+	r.ui.Info(fmt.Sprintf("Detected application type %s", applicationType))
+
+	if applicationType == "kustomize" {
+		localPath, err = r.buildKustomization(ctx, localPath, constants.KustomizeBuildPath)
+		if err != nil {
+			return upstream, nil, errors.Wrapf(err, "build kustomization %s", util.Redact(upstream.Upstream))
+		}
+	}
+
+	metadata, err := r.namedUpstreamMetadata(upstream.Upstream, localPath, applicationType)
+	if err != nil {
+		return upstream, nil, errors.Wrapf(err, "resolve metadata for %s", localPath)
+	}
+
+	if upstream.ContentSHA != "" && upstream.ContentSHA != metadata.ContentSHA {
+		r.ui.Info(fmt.Sprintf("%s has changed since it was last fetched", upstream.Name))
+	}
+	upstream.ContentSHA = metadata.ContentSHA
+	upstream.UpstreamVersion = ""
+	if resolved, ok := r.resolvedHelmRepoChart(upstream.Upstream); ok {
+		upstream.UpstreamVersion = resolved.Version
+	}
+	upstream.Metadata = &state.Metadata{
+		ApplicationType: applicationType,
+		Name:            metadata.Name,
+		Version:         metadata.Version,
+		AppVersion:      metadata.AppVersion,
+	}
+	if verification, _ := r.Verifier.Verified(upstream.Upstream); verification != nil {
+		debug.Log("event", "upstream.verified", "method", verification.Method, "signer", verification.Signer)
+		r.ui.Info(fmt.Sprintf("Verified %s (%s): %s", upstream.Name, verification.Method, verifiedBy(verification)))
+		upstream.Metadata.Verification = verification
+	}
+
+	dest := path.Join(constants.KustomizeBasePath, upstream.Name)
+	var asset *api.Asset
+	switch applicationType {
+	case "helm", "helm3":
+		chartRoot := path.Join(constants.HelmChartsPath, upstream.Name)
+		if err := r.FS.RemoveAll(chartRoot); err != nil {
+			return upstream, nil, errors.Wrapf(err, "remove %s", chartRoot)
+		}
+		if err := r.recursiveCopy(localPath, chartRoot); err != nil {
+			return upstream, nil, errors.Wrapf(err, "copy %s to %s", localPath, chartRoot)
+		}
+		asset = &api.Asset{
+			Helm: &api.HelmAsset{
+				AssetShared: api.AssetShared{
+					Dest: dest,
+				},
+				Local: &api.LocalHelmOpts{
+					ChartRoot:       chartRoot,
+					ChartAPIVersion: apptype.ApplicationChartAPIVersion(applicationType),
+				},
+				ValuesFrom: &api.ValuesFrom{
+					Lifecycle: &api.ValuesFromLifecycle{
+						Upstream: upstream.Name,
+					},
+				},
+			},
+		}
+
+	case "k8s", "kustomize":
+		if err := r.recursiveCopy(localPath, dest); err != nil {
+			return upstream, nil, errors.Wrapf(err, "copy %s to %s", localPath, dest)
+		}
+		if err := r.maybeSplitMultidocYaml(ctx, dest); err != nil {
+			return upstream, nil, errors.Wrap(err, "split multipath yaml")
+		}
+	}
+
+	// the next upstream is fetched to the same place
+	if err := r.FS.RemoveAll(localPath); err != nil {
+		return upstream, nil, errors.Wrapf(err, "remove %s", localPath)
+	}
+
+	return upstream, asset, nil
+}
+
+// namedUpstreamMetadata reads the content sha of a fetched upstream, and the name and version of a chart,
+// without writing them to state as resolveMetadata does for a single upstream
+func (r *Resolver) namedUpstreamMetadata(upstream, localPath, applicationType string) (*api.ShipAppMetadata, error) {
+	metadata, err := r.ResolveBaseMetadata(upstream, localPath)
+	if err != nil {
+		return nil, errors.Wrap(err, "resolve base metadata")
+	}
+
+	if applicationType != "helm" && applicationType != "helm3" {
+		return metadata, nil
+	}
+
+	localChartPath := filepath.Join(localPath, "Chart.yaml")
+	chart, err := r.FS.ReadFile(localChartPath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "read file from %s", localChartPath)
+	}
+	if err := yaml.Unmarshal(chart, metadata); err != nil {
+		return nil, errors.Wrapf(err, "unmarshal %s", localChartPath)
+	}
+	return metadata, nil
+}
+
+// verifiedBy is who signed a verified upstream, or the digest it was verified against
+func verifiedBy(verification *state.Verification) string {
+	if verification.Signer != "" {
+		return verification.Signer
+	}
+	return verification.Digest
+}
@@ -0,0 +1,176 @@
+package specs
+
+import (
+	"context"
+	"path"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/golang/mock/gomock"
+	"github.com/replicatedhq/ship/pkg/api"
+	"github.com/replicatedhq/ship/pkg/constants"
+	"github.com/replicatedhq/ship/pkg/specs/verify"
+	state2 "github.com/replicatedhq/ship/pkg/state"
+	"github.com/replicatedhq/ship/pkg/test-mocks/apptype"
+	"github.com/replicatedhq/ship/pkg/test-mocks/state"
+	"github.com/replicatedhq/ship/pkg/test-mocks/ui"
+	"github.com/spf13/afero"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseNamedUpstreams(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		want    []state2.NamedUpstream
+		wantErr string
+	}{
+		{
+			name: "charts and manifests",
+			args: []string{
+				"ingress=github.com/helm/charts/stable/nginx-ingress",
+				"cert-manager=helm://kubernetes-charts.storage.googleapis.com/cert-manager?version=~0.5",
+			},
+			want: []state2.NamedUpstream{
+				{Name: "ingress", Upstream: "github.com/helm/charts/stable/nginx-ingress"},
+				{Name: "cert-manager", Upstream: "helm://kubernetes-charts.storage.googleapis.com/cert-manager?version=~0.5"},
+			},
+		},
+		{
+			name:    "unnamed",
+			args:    []string{"ingress=github.com/helm/charts/stable/nginx-ingress", "github.com/o/app"},
+			wantErr: `"github.com/o/app" is not a name=upstream pair`,
+		},
+		{
+			name:    "name that isn't a directory name",
+			args:    []string{"Cert_Manager=github.com/o/cert-manager"},
+			wantErr: "is not a name=upstream pair",
+		},
+		{
+			name:    "duplicate name",
+			args:    []string{"app=github.com/o/app", "app=github.com/o/other"},
+			wantErr: `upstream name "app" is used more than once`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := require.New(t)
+			upstreams, err := ParseNamedUpstreams(tt.args)
+			if tt.wantErr != "" {
+				req.Error(err)
+				req.Contains(err.Error(), tt.wantErr)
+				return
+			}
+			req.NoError(err)
+			req.Equal(tt.want, upstreams)
+		})
+	}
+
+	require.False(t, IsNamedUpstream("helm://charts.example.com/app?version=1.2.3"))
+	require.False(t, IsNamedUpstream("git::https://gitlab.com/o/r.git?ref=v1"))
+}
+
+func TestResolver_ResolveUpstreams(t *testing.T) {
+	req := require.New(t)
+	ctx := context.Background()
+	mc := gomock.NewController(t)
+	defer mc.Finish()
+	mockUI := ui.NewMockUi(mc)
+	inspector := apptype.NewMockInspector(mc)
+	mockState := state.NewMockManager(mc)
+
+	// need a real FS because afero.Rename on a memMapFs doesn't copy directories recursively
+	fs := afero.Afero{Fs: afero.NewOsFs()}
+	tmpdir, err := fs.TempDir("./", "resolve-upstreams")
+	req.NoError(err)
+	defer fs.RemoveAll(tmpdir)
+	mockFs := afero.Afero{Fs: afero.NewBasePathFs(afero.NewOsFs(), tmpdir)}
+
+	verification := &state2.Verification{Method: verify.MethodSignedTag, Digest: "abc123", Signer: "Release Bot <release@example.com>"}
+	verifier := &verify.Verifier{Logger: log.NewNopLogger()}
+	verifier.Record("github.com/o/ingress", verification)
+
+	resolver := &Resolver{
+		Logger:           log.NewNopLogger(),
+		StateManager:     mockState,
+		FS:               mockFs,
+		Viper:            viper.New(),
+		ui:               mockUI,
+		appTypeInspector: inspector,
+		shaSummer: func(resolver *Resolver, localPath string) (string, error) {
+			return "abcdef1234567890", nil
+		},
+		Verifier: verifier,
+	}
+
+	fetched := path.Join(constants.RepoSavePath, "fetched")
+	inOrder := mockUI.EXPECT().Info("Reading ingress from github.com/o/ingress ...")
+	inOrder = inspector.EXPECT().DetermineApplicationType(ctx, "github.com/o/ingress").
+		DoAndReturn(func(context.Context, string) (string, string, error) {
+			req.NoError(mockFs.MkdirAll(fetched, 0755))
+			req.NoError(mockFs.WriteFile(path.Join(fetched, "Chart.yaml"), []byte("name: nginx-ingress\nversion: 0.30.0\n"), 0644))
+			req.NoError(mockFs.WriteFile(path.Join(fetched, "values.yaml"), []byte("replicaCount: 1\n"), 0644))
+			return "helm", fetched, nil
+		}).After(inOrder)
+	inOrder = mockUI.EXPECT().Info("Detected application type helm").After(inOrder)
+	inOrder = mockUI.EXPECT().Info("Verified ingress (signed-tag): Release Bot <release@example.com>").After(inOrder)
+	inOrder = mockUI.EXPECT().Info("Reading app from github.com/o/app ...").After(inOrder)
+	inOrder = inspector.EXPECT().DetermineApplicationType(ctx, "github.com/o/app").
+		DoAndReturn(func(context.Context, string) (string, string, error) {
+			req.NoError(mockFs.MkdirAll(fetched, 0755))
+			req.NoError(mockFs.WriteFile(path.Join(fetched, "deployment.yaml"), []byte("kind: Deployment\nmetadata:\n  name: app\n"), 0644))
+			return "k8s", fetched, nil
+		}).After(inOrder)
+	inOrder = mockUI.EXPECT().Info("Detected application type k8s").After(inOrder)
+	inOrder = mockUI.EXPECT().Info("app has changed since it was last fetched").After(inOrder)
+	mockState.EXPECT().SerializeNamedUpstreams([]state2.NamedUpstream{
+		{
+			Name:       "ingress",
+			Upstream:   "github.com/o/ingress",
+			ContentSHA: "abcdef1234567890",
+			HelmValues: "replicaCount: 2\n",
+			Metadata: &state2.Metadata{
+				ApplicationType: "helm",
+				Name:            "nginx-ingress",
+				Version:         "0.30.0",
+				Verification:    verification,
+			},
+		},
+		{
+			Name:       "app",
+			Upstream:   "github.com/o/app",
+			ContentSHA: "abcdef1234567890",
+			Metadata:   &state2.Metadata{ApplicationType: "k8s"},
+		},
+	}).Return(nil).After(inOrder)
+
+	release, err := resolver.ResolveUpstreams(ctx, []state2.NamedUpstream{
+		{Name: "ingress", Upstream: "github.com/o/ingress", HelmValues: "replicaCount: 2\n"},
+		{Name: "app", Upstream: "github.com/o/app", ContentSHA: "0987654321fedcba"},
+	})
+	req.NoError(err)
+
+	chartRoot := path.Join(constants.HelmChartsPath, "ingress")
+	req.Equal(resolver.DefaultComposedRelease([]api.Asset{
+		{
+			Helm: &api.HelmAsset{
+				AssetShared: api.AssetShared{Dest: path.Join("base", "ingress")},
+				Local:       &api.LocalHelmOpts{ChartRoot: chartRoot, ChartAPIVersion: "v1"},
+				ValuesFrom:  &api.ValuesFrom{Lifecycle: &api.ValuesFromLifecycle{Upstream: "ingress"}},
+			},
+		},
+	}), release.Spec)
+
+	chart, err := mockFs.ReadFile(path.Join(chartRoot, "Chart.yaml"))
+	req.NoError(err)
+	req.Contains(string(chart), "nginx-ingress")
+
+	deployment, err := mockFs.ReadFile(path.Join("base", "app", "deployment.yaml"))
+	req.NoError(err)
+	req.Contains(string(deployment), "kind: Deployment")
+
+	exists, err := mockFs.Exists(fetched)
+	req.NoError(err)
+	req.False(exists)
+}
@@ -0,0 +1,253 @@
+package verify
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/ship/pkg/helm"
+	"github.com/replicatedhq/ship/pkg/state"
+	"github.com/replicatedhq/ship/pkg/util"
+	"github.com/spf13/viper"
+	"golang.org/x/crypto/openpgp"
+	"k8s.io/helm/pkg/provenance"
+)
+
+const (
+	// MethodHelmProvenance is a chart verified against its .prov file
+	MethodHelmProvenance = "helm-provenance"
+	// MethodSignedTag is a git ref verified by the signature on its annotated tag
+	MethodSignedTag = "signed-tag"
+	// MethodSignedCommit is a git ref verified by the signature on the commit it points to
+	MethodSignedCommit = "signed-commit"
+	// MethodSHA256 is an archive verified against a pinned digest
+	MethodSHA256 = "sha256"
+)
+
+const (
+	// FlagProvenance requires helm repository charts to have valid provenance
+	FlagProvenance = "verify-provenance"
+	// FlagSignatures requires GitHub upstreams to be at a signed tag or commit
+	FlagSignatures = "verify-signatures"
+	// FlagSHA256 pins the digest of an archive upstream
+	FlagSHA256 = "upstream-sha256"
+)
+
+// Error is a failed verification. Unlike a failed fetch, it isn't retried.
+type Error struct {
+	Message string
+}
+
+func (e Error) Error() string {
+	return e.Message
+}
+
+// Verifier checks fetched upstreams before anything is written to base/. Every check is opt in.
+// How an upstream was verified is remembered for the rest of the run, see Verified.
+type Verifier struct {
+	Logger log.Logger
+	// Keyring is the path of the public keyring signatures are checked against, binary or armored
+	Keyring string
+	// Provenance requires helm repository charts to have a .prov file signed by a key in Keyring
+	Provenance bool
+	// Signatures requires GitHub upstreams to be at a tag or commit signed by a key in Keyring
+	Signatures bool
+	// SHA256 is the hex digest an archive upstream must match, if set
+	SHA256 string
+
+	mu       sync.Mutex
+	verified map[string]*state.Verification
+}
+
+// NewVerifier builds a Verifier from --verify-provenance, --verify-signatures, --upstream-sha256 and --keyring.
+// The keyring defaults to the one helm uses.
+func NewVerifier(logger log.Logger, v *viper.Viper) *Verifier {
+	keyring := v.GetString("keyring")
+	if keyring == "" {
+		keyring = helm.DefaultKeyring()
+	}
+
+	return &Verifier{
+		Logger:     logger,
+		Keyring:    keyring,
+		Provenance: v.GetBool(FlagProvenance),
+		Signatures: v.GetBool(FlagSignatures),
+		SHA256:     strings.ToLower(strings.TrimPrefix(v.GetString(FlagSHA256), "sha256:")),
+		verified:   map[string]*state.Verification{},
+	}
+}
+
+// RequireOnly returns an Error if a check was asked for that isn't one of supported,
+// so an upstream is never passed as verified by a check that couldn't be made
+func (v *Verifier) RequireOnly(upstreamKind string, supported ...string) error {
+	if v == nil {
+		return nil
+	}
+
+	requested := map[string]bool{
+		FlagProvenance: v.Provenance,
+		FlagSignatures: v.Signatures,
+		FlagSHA256:     v.SHA256 != "",
+	}
+	for _, flag := range []string{FlagProvenance, FlagSignatures, FlagSHA256} {
+		if !requested[flag] {
+			continue
+		}
+		isSupported := false
+		for _, s := range supported {
+			isSupported = isSupported || s == flag
+		}
+		if !isSupported {
+			return Error{Message: fmt.Sprintf("--%s can't be used with %s", flag, upstreamKind)}
+		}
+	}
+	return nil
+}
+
+// VerifyDigest checks digest, the hex sha256 of an archive, against the pinned digest
+func (v *Verifier) VerifyDigest(upstream, digest string) (*state.Verification, error) {
+	if !strings.EqualFold(digest, v.SHA256) {
+		return nil, Error{Message: fmt.Sprintf("upstream %s has sha256 %s, but %s is pinned", util.Redact(upstream), digest, v.SHA256)}
+	}
+	return &state.Verification{Method: MethodSHA256, Digest: "sha256:" + strings.ToLower(digest)}, nil
+}
+
+// VerifyChart checks a chart tarball against its provenance file. filename is the tarball's name in the repository,
+// which is what the provenance file lists the chart's digest under.
+func (v *Verifier) VerifyChart(filename string, tarball, provenanceFile []byte) (*state.Verification, error) {
+	debug := level.Debug(log.With(v.Logger, "struct", "verify.Verifier", "method", "VerifyChart"))
+
+	keyring, err := v.keyring()
+	if err != nil {
+		return nil, err
+	}
+
+	// provenance reads the chart and signature from disk
+	tmpDir, err := ioutil.TempDir("", "ship-verify")
+	if err != nil {
+		return nil, errors.Wrap(err, "create temp dir")
+	}
+	defer os.RemoveAll(tmpDir)
+
+	chartPath := filepath.Join(tmpDir, filepath.Base(filename))
+	if err := ioutil.WriteFile(chartPath, tarball, 0644); err != nil {
+		return nil, errors.Wrapf(err, "write %s", chartPath)
+	}
+	if err := ioutil.WriteFile(chartPath+".prov", provenanceFile, 0644); err != nil {
+		return nil, errors.Wrapf(err, "write %s.prov", chartPath)
+	}
+
+	signatory := &provenance.Signatory{KeyRing: keyring}
+	verification, err := signatory.Verify(chartPath, chartPath+".prov")
+	if err != nil {
+		return nil, Error{Message: fmt.Sprintf("verify provenance of %s: %s", filename, err.Error())}
+	}
+
+	debug.Log("event", "provenance.verified", "chart", filename, "signer", identity(verification.SignedBy))
+	return &state.Verification{
+		Method:      MethodHelmProvenance,
+		Digest:      verification.FileHash,
+		Signer:      identity(verification.SignedBy),
+		Fingerprint: fingerprint(verification.SignedBy),
+	}, nil
+}
+
+// VerifySignature checks an armored detached signature over a git object's payload, as the GitHub API returns them.
+// method is MethodSignedTag or MethodSignedCommit, and digest is the SHA of the commit that was verified.
+func (v *Verifier) VerifySignature(method, digest, payload, signature string) (*state.Verification, error) {
+	debug := level.Debug(log.With(v.Logger, "struct", "verify.Verifier", "method", "VerifySignature"))
+
+	keyring, err := v.keyring()
+	if err != nil {
+		return nil, err
+	}
+
+	signer, err := openpgp.CheckArmoredDetachedSignature(keyring, strings.NewReader(payload), strings.NewReader(signature))
+	if err != nil {
+		return nil, Error{Message: fmt.Sprintf("verify signature on %s: %s", digest, err.Error())}
+	}
+
+	debug.Log("event", "signature.verified", "method", method, "digest", digest, "signer", identity(signer))
+	return &state.Verification{
+		Method:      method,
+		Digest:      digest,
+		Signer:      identity(signer),
+		Fingerprint: fingerprint(signer),
+	}, nil
+}
+
+// Record remembers how upstream was verified, for Verified
+func (v *Verifier) Record(upstream string, verification *state.Verification) {
+	if v == nil || verification == nil {
+		return
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.verified == nil {
+		v.verified = map[string]*state.Verification{}
+	}
+	v.verified[upstream] = verification
+}
+
+// Verified returns how upstream was verified when it was fetched during this run, if it was
+func (v *Verifier) Verified(upstream string) (*state.Verification, bool) {
+	if v == nil {
+		return nil, false
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	verification, ok := v.verified[upstream]
+	return verification, ok
+}
+
+func (v *Verifier) keyring() (openpgp.EntityList, error) {
+	contents, err := ioutil.ReadFile(v.Keyring)
+	if err != nil {
+		return nil, errors.Wrapf(err, "read keyring %s", v.Keyring)
+	}
+
+	keyring, err := openpgp.ReadKeyRing(bytes.NewReader(contents))
+	if err != nil {
+		// exported with gpg --export --armor
+		armored, armoredErr := openpgp.ReadArmoredKeyRing(bytes.NewReader(contents))
+		if armoredErr != nil {
+			return nil, errors.Wrapf(err, "read keyring %s", v.Keyring)
+		}
+		keyring = armored
+	}
+	return keyring, nil
+}
+
+// identity is the entity's primary user id, or its first if none is marked primary
+func identity(entity *openpgp.Entity) string {
+	if entity == nil {
+		return ""
+	}
+	var names []string
+	for name, id := range entity.Identities {
+		if id.SelfSignature != nil && id.SelfSignature.IsPrimaryId != nil && *id.SelfSignature.IsPrimaryId {
+			return name
+		}
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return ""
+	}
+	sort.Strings(names)
+	return names[0]
+}
+
+func fingerprint(entity *openpgp.Entity) string {
+	if entity == nil || entity.PrimaryKey == nil {
+		return ""
+	}
+	return fmt.Sprintf("%X", entity.PrimaryKey.Fingerprint)
+}
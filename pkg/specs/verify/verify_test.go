@@ -0,0 +1,157 @@
+package verify
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+	"k8s.io/helm/pkg/provenance"
+)
+
+func TestVerifyChart(t *testing.T) {
+	req := require.New(t)
+	signer, keyring := testKeyring(t, "Charts", "charts@example.com", true)
+	other, otherKeyring := testKeyring(t, "Mallory", "mallory@example.com", true)
+	defer os.RemoveAll(filepath.Dir(keyring))
+	defer os.RemoveAll(filepath.Dir(otherKeyring))
+
+	tarball := chartTarball(t)
+	verifier := &Verifier{Logger: log.NewNopLogger(), Keyring: keyring, Provenance: true}
+
+	verification, err := verifier.VerifyChart("nginx-1.2.3.tgz", tarball, signChart(t, signer, "nginx-1.2.3.tgz", tarball))
+	req.NoError(err)
+	req.Equal(MethodHelmProvenance, verification.Method)
+	req.Equal("Charts <charts@example.com>", verification.Signer)
+	req.Equal(fmt.Sprintf("sha256:%x", sha256.Sum256(tarball)), verification.Digest)
+	req.Equal(fmt.Sprintf("%X", signer.PrimaryKey.Fingerprint), verification.Fingerprint)
+
+	_, err = verifier.VerifyChart("nginx-1.2.3.tgz", []byte("tampered"), signChart(t, signer, "nginx-1.2.3.tgz", tarball))
+	req.Error(err)
+	req.IsType(Error{}, err)
+	req.Contains(err.Error(), "sha256 sum does not match")
+
+	_, err = verifier.VerifyChart("nginx-1.2.3.tgz", tarball, signChart(t, other, "nginx-1.2.3.tgz", tarball))
+	req.Error(err)
+	req.IsType(Error{}, err)
+}
+
+func TestVerifySignature(t *testing.T) {
+	req := require.New(t)
+	signer, keyring := testKeyring(t, "Release Bot", "release@example.com", false)
+	defer os.RemoveAll(filepath.Dir(keyring))
+
+	payload := "tree 4b825dc642cb6eb9a060e54bf8d69288fbee4904\nauthor Bob <bob@example.com> 1538395200 +0000\n\nrelease 1.2.3\n"
+	var signature bytes.Buffer
+	req.NoError(openpgp.ArmoredDetachSign(&signature, signer, strings.NewReader(payload), nil))
+
+	verifier := &Verifier{Logger: log.NewNopLogger(), Keyring: keyring, Signatures: true}
+	verification, err := verifier.VerifySignature(MethodSignedCommit, "abc123", payload, signature.String())
+	req.NoError(err)
+	req.Equal(MethodSignedCommit, verification.Method)
+	req.Equal("abc123", verification.Digest)
+	req.Equal("Release Bot <release@example.com>", verification.Signer)
+
+	_, err = verifier.VerifySignature(MethodSignedCommit, "abc123", payload+"tampered", signature.String())
+	req.Error(err)
+	req.IsType(Error{}, err)
+
+	verifier.Keyring = filepath.Join(filepath.Dir(keyring), "missing.gpg")
+	_, err = verifier.VerifySignature(MethodSignedCommit, "abc123", payload, signature.String())
+	req.Error(err)
+	req.Contains(err.Error(), "read keyring")
+}
+
+func TestVerifyDigest(t *testing.T) {
+	req := require.New(t)
+	digest := fmt.Sprintf("%x", sha256.Sum256([]byte("archive")))
+	verifier := &Verifier{SHA256: digest}
+
+	verification, err := verifier.VerifyDigest("https://example.com/app.tgz", strings.ToUpper(digest))
+	req.NoError(err)
+	req.Equal(MethodSHA256, verification.Method)
+	req.Equal("sha256:"+digest, verification.Digest)
+
+	_, err = verifier.VerifyDigest("https://bob:pw@example.com/app.tgz", strings.Repeat("0", len(digest)))
+	req.Error(err)
+	req.IsType(Error{}, err)
+	req.NotContains(err.Error(), "pw")
+}
+
+func TestRequireOnly(t *testing.T) {
+	req := require.New(t)
+
+	var unset *Verifier
+	req.NoError(unset.RequireOnly("GitHub upstreams", FlagSignatures))
+	_, ok := unset.Verified("github.com/o/r")
+	req.False(ok)
+
+	verifier := &Verifier{Signatures: true}
+	req.NoError(verifier.RequireOnly("GitHub upstreams", FlagSignatures))
+	err := verifier.RequireOnly("helm repository upstreams", FlagProvenance, FlagSHA256)
+	req.Error(err)
+	req.Equal("--verify-signatures can't be used with helm repository upstreams", err.Error())
+}
+
+// testKeyring generates a key and writes its public key to a keyring in a new temp dir
+func testKeyring(t *testing.T, name, email string, armored bool) (*openpgp.Entity, string) {
+	req := require.New(t)
+	entity, err := openpgp.NewEntity(name, "", email, nil)
+	req.NoError(err)
+
+	dir, err := ioutil.TempDir("", "ship-verify-test")
+	req.NoError(err)
+
+	var keyring bytes.Buffer
+	if armored {
+		writer, err := armor.Encode(&keyring, openpgp.PublicKeyType, nil)
+		req.NoError(err)
+		req.NoError(entity.Serialize(writer))
+		req.NoError(writer.Close())
+	} else {
+		req.NoError(entity.Serialize(&keyring))
+	}
+
+	path := filepath.Join(dir, "pubring.gpg")
+	req.NoError(ioutil.WriteFile(path, keyring.Bytes(), 0644))
+	return entity, path
+}
+
+func signChart(t *testing.T, signer *openpgp.Entity, filename string, tarball []byte) []byte {
+	req := require.New(t)
+	dir, err := ioutil.TempDir("", "ship-verify-sign")
+	req.NoError(err)
+	defer os.RemoveAll(dir)
+
+	chartPath := filepath.Join(dir, filename)
+	req.NoError(ioutil.WriteFile(chartPath, tarball, 0644))
+
+	signed, err := (&provenance.Signatory{Entity: signer}).ClearSign(chartPath)
+	req.NoError(err)
+	return []byte(signed)
+}
+
+func chartTarball(t *testing.T) []byte {
+	req := require.New(t)
+	var buf bytes.Buffer
+	gzipWriter := gzip.NewWriter(&buf)
+	tarWriter := tar.NewWriter(gzipWriter)
+
+	contents := "name: nginx\nversion: 1.2.3\n"
+	req.NoError(tarWriter.WriteHeader(&tar.Header{Name: "nginx/Chart.yaml", Mode: 0644, Size: int64(len(contents)), Typeflag: tar.TypeReg}))
+	_, err := tarWriter.Write([]byte(contents))
+	req.NoError(err)
+	req.NoError(tarWriter.Close())
+	req.NoError(gzipWriter.Close())
+	return buf.Bytes()
+}
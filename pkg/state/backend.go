@@ -0,0 +1,56 @@
+package state
+
+import (
+	"fmt"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+	"github.com/spf13/afero"
+	"github.com/spf13/viper"
+)
+
+const (
+	// stateObject is the name backends store the current state under
+	stateObject = "state"
+	// historyObject is the name backends store state history under
+	historyObject = "history"
+)
+
+// StateBackend reads and writes serialized state wherever --state-from says it lives.
+// Backends store a small number of named objects, currently the state itself and its history.
+type StateBackend interface {
+	// Read returns the stored object, or nil if it hasn't been written yet
+	Read(name string) ([]byte, error)
+	Write(name string, data []byte) error
+}
+
+// NewBackend returns the StateBackend selected with --state-from
+func NewBackend(logger log.Logger, fs afero.Afero, v *viper.Viper) (StateBackend, error) {
+	stateFrom := v.GetString("state-from")
+	if stateFrom == "" {
+		stateFrom = "file"
+	}
+
+	switch stateFrom {
+	case "file":
+		return &FileBackend{Logger: logger, FS: fs}, nil
+	case "secret":
+		return newSecretBackend(logger, v)
+	case "configmap":
+		return newConfigMapBackend(logger, v)
+	case "s3":
+		return newS3Backend(logger, v)
+	default:
+		err := fmt.Errorf("unsupported state-from value: %q", stateFrom)
+		return nil, errors.Wrap(err, "create state backend")
+	}
+}
+
+// objectKey maps a named object onto the key the current state is kept under,
+// for backends that keep everything side by side in one place
+func objectKey(stateKey string, name string) string {
+	if name == stateObject {
+		return stateKey
+	}
+	return fmt.Sprintf("%s-%s", stateKey, name)
+}
@@ -0,0 +1,154 @@
+package state
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/ship/pkg/constants"
+	"github.com/spf13/afero"
+)
+
+var _ StateBackend = &FileBackend{}
+var _ Locker = &FileBackend{}
+
+// FileBackend keeps state in the .ship directory of the working directory
+type FileBackend struct {
+	Logger log.Logger
+	FS     afero.Afero
+}
+
+func (b *FileBackend) path(name string) string {
+	switch name {
+	case stateObject:
+		return constants.StatePath
+	case historyObject:
+		return constants.StateHistoryPath
+	default:
+		return filepath.Join(constants.ShipPathInternal, name+".json")
+	}
+}
+
+func (b *FileBackend) Read(name string) ([]byte, error) {
+	path := b.path(name)
+	if _, err := b.FS.Stat(path); os.IsNotExist(err) {
+		level.Debug(b.Logger).Log("msg", "no saved state exists", "path", path)
+		return nil, nil
+	}
+
+	serialized, err := b.FS.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "read %s", path)
+	}
+	return serialized, nil
+}
+
+func (b *FileBackend) Write(name string, data []byte) error {
+	path := b.path(name)
+	if err := b.FS.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return errors.Wrapf(err, "mkdir %s", filepath.Dir(path))
+	}
+
+	if err := b.FS.WriteFile(path, data, 0644); err != nil {
+		return errors.Wrapf(err, "write %s", path)
+	}
+	return nil
+}
+
+func (b *FileBackend) Lock(holder LockHolder) error {
+	current, err := b.LockHolder()
+	if err != nil {
+		return err
+	}
+	if current != nil {
+		if current.is(holder) {
+			return nil
+		}
+		return &LockedError{Holder: *current}
+	}
+
+	serialized, err := json.Marshal(holder)
+	if err != nil {
+		return errors.Wrap(err, "serialize lock holder")
+	}
+
+	if err := b.FS.MkdirAll(filepath.Dir(constants.StateLockPath), 0700); err != nil {
+		return errors.Wrapf(err, "mkdir %s", filepath.Dir(constants.StateLockPath))
+	}
+
+	// O_EXCL so that only one of two runs racing for the lock gets it
+	lockfile, err := b.FS.OpenFile(constants.StateLockPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if os.IsExist(err) {
+		current, err := b.LockHolder()
+		if err != nil {
+			return err
+		}
+		if current != nil {
+			return &LockedError{Holder: *current}
+		}
+		return errors.Errorf("lockfile %s was removed while acquiring it", constants.StateLockPath)
+	}
+	if err != nil {
+		return errors.Wrapf(err, "create lockfile %s", constants.StateLockPath)
+	}
+	defer lockfile.Close()
+
+	if _, err := lockfile.Write(serialized); err != nil {
+		return errors.Wrapf(err, "write lockfile %s", constants.StateLockPath)
+	}
+	return nil
+}
+
+func (b *FileBackend) Unlock(holder LockHolder) error {
+	current, err := b.LockHolder()
+	if err != nil {
+		return err
+	}
+	if current == nil {
+		return nil
+	}
+	if !current.is(holder) {
+		return errors.Errorf("lock was taken over by %s", current)
+	}
+	return b.removeLockfile()
+}
+
+func (b *FileBackend) ForceUnlock() (*LockHolder, error) {
+	current, err := b.LockHolder()
+	if err != nil {
+		// an unreadable lockfile is exactly the kind of thing --force is for
+		level.Debug(b.Logger).Log("event", "lockfile.read.fail", "err", err)
+	}
+	return current, b.removeLockfile()
+}
+
+func (b *FileBackend) LockHolder() (*LockHolder, error) {
+	if _, err := b.FS.Stat(constants.StateLockPath); os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	serialized, err := b.FS.ReadFile(constants.StateLockPath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "read lockfile %s", constants.StateLockPath)
+	}
+
+	var holder LockHolder
+	if len(serialized) == 0 {
+		// another run has created the lockfile, but hasn't written itself into it yet
+		return &holder, nil
+	}
+	if err := json.Unmarshal(serialized, &holder); err != nil {
+		return nil, errors.Wrapf(err, "unmarshal lockfile %s", constants.StateLockPath)
+	}
+	return &holder, nil
+}
+
+func (b *FileBackend) removeLockfile() error {
+	if err := b.FS.Remove(constants.StateLockPath); err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "remove lockfile %s", constants.StateLockPath)
+	}
+	return nil
+}
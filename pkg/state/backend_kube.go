@@ -0,0 +1,482 @@
+package state
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+	corev1 "k8s.io/api/core/v1"
+	kubeerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// lockAnnotation holds the LockHolder of the run that has locked the state in a Secret or ConfigMap
+const lockAnnotation = "ship.replicated.com/state-lock"
+
+var _ StateBackend = &SecretBackend{}
+var _ StateBackend = &ConfigMapBackend{}
+var _ Locker = &SecretBackend{}
+var _ Locker = &ConfigMapBackend{}
+
+// SecretBackend keeps state in a key of a Kubernetes Secret.
+// Writes are rejected if the Secret has changed since this run first read it.
+type SecretBackend struct {
+	kubeBackend
+}
+
+// ConfigMapBackend keeps state in a key of a Kubernetes ConfigMap.
+// Writes are rejected if the ConfigMap has changed since this run first read it.
+type ConfigMapBackend struct {
+	kubeBackend
+}
+
+// kubeBackend keeps state in a key of a Kubernetes object, using objects to read and write it
+type kubeBackend struct {
+	Logger    log.Logger
+	Namespace string
+	Name      string
+	Key       string
+
+	objects kubeObjects
+
+	mu sync.Mutex
+	// resourceVersion is the version of the object this run last read or wrote
+	resourceVersion string
+}
+
+// kubeObjects gets, creates and updates the kind of object a kubeBackend keeps state in
+type kubeObjects interface {
+	// Kind is the name of the kind in errors and logs
+	Kind() string
+	New(meta metav1.ObjectMeta) kubeObject
+	Get(name string) (kubeObject, error)
+	Create(object kubeObject) (kubeObject, error)
+	Update(object kubeObject) (kubeObject, error)
+}
+
+// kubeObject is a Secret or ConfigMap, with access to its data by key
+type kubeObject interface {
+	metav1.Object
+	Value(key string) ([]byte, bool)
+	SetValue(key string, data []byte)
+}
+
+func newSecretBackend(logger log.Logger, v *viper.Viper) (*SecretBackend, error) {
+	ns, name, key, err := kubeObjectFlags(v, "secret")
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := kubeClient(v)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SecretBackend{kubeBackend{
+		Logger:    logger,
+		Namespace: ns,
+		Name:      name,
+		Key:       key,
+		objects:   secrets{client.CoreV1().Secrets(ns)},
+	}}, nil
+}
+
+func newConfigMapBackend(logger log.Logger, v *viper.Viper) (*ConfigMapBackend, error) {
+	ns, name, key, err := kubeObjectFlags(v, "configmap")
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := kubeClient(v)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ConfigMapBackend{kubeBackend{
+		Logger:    logger,
+		Namespace: ns,
+		Name:      name,
+		Key:       key,
+		objects:   configMaps{client.CoreV1().ConfigMaps(ns)},
+	}}, nil
+}
+
+// kubeObjectFlags reads the <kind>-namespace, <kind>-name and <kind>-key flags
+func kubeObjectFlags(v *viper.Viper, kind string) (string, string, string, error) {
+	ns := v.GetString(kind + "-namespace")
+	if ns == "" {
+		return "", "", "", errors.Errorf("%s-namespace is not set", kind)
+	}
+	name := v.GetString(kind + "-name")
+	if name == "" {
+		return "", "", "", errors.Errorf("%s-name is not set", kind)
+	}
+	key := v.GetString(kind + "-key")
+	if key == "" {
+		return "", "", "", errors.Errorf("%s-key is not set", kind)
+	}
+	return ns, name, key, nil
+}
+
+// kubeClient connects with --kubeconfig and --kube-context if either is set.
+// Otherwise, the in-cluster config is preferred, falling back to the usual kubeconfig loading rules.
+func kubeClient(v *viper.Viper) (kubernetes.Interface, error) {
+	kubeconfig := v.GetString("kubeconfig")
+	kubeContext := v.GetString("kube-context")
+
+	config, err := rest.InClusterConfig()
+	if kubeconfig != "" || kubeContext != "" || err != nil {
+		loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+		loadingRules.ExplicitPath = kubeconfig
+		overrides := &clientcmd.ConfigOverrides{CurrentContext: kubeContext}
+
+		config, err = clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, overrides).ClientConfig()
+		if err != nil {
+			return nil, errors.Wrap(err, "load kubeconfig")
+		}
+	}
+
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, errors.Wrap(err, "get kubernetes client")
+	}
+	return clientset, nil
+}
+
+func (b *kubeBackend) Read(name string) ([]byte, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	object, err := b.objects.Get(b.Name)
+	if kubeerrors.IsNotFound(err) {
+		level.Debug(b.Logger).Log("msg", "no saved state exists", b.objects.Kind(), b.Name)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "get %s", b.objects.Kind())
+	}
+
+	if b.resourceVersion == "" {
+		b.resourceVersion = object.GetResourceVersion()
+	}
+	data, ok := object.Value(objectKey(b.Key, name))
+	if !ok {
+		return nil, nil
+	}
+	return data, nil
+}
+
+func (b *kubeBackend) Write(name string, data []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	kind := b.objects.Kind()
+	debug := level.Debug(log.With(b.Logger, "method", "kubeBackend.Write", "kind", kind))
+	key := objectKey(b.Key, name)
+
+	object, err := b.objects.Get(b.Name)
+	if kubeerrors.IsNotFound(err) {
+		debug.Log("event", "object.create", "name", b.Name, "key", key)
+		object = b.objects.New(metav1.ObjectMeta{Name: b.Name, Namespace: b.Namespace})
+		object.SetValue(key, data)
+		return b.create(object)
+	}
+	if err != nil {
+		return errors.Wrapf(err, "get %s", kind)
+	}
+
+	object.SetValue(key, data)
+
+	debug.Log("event", "object.update", "name", b.Name, "key", key)
+	return b.update(object)
+}
+
+func (b *kubeBackend) create(object kubeObject) error {
+	created, err := b.objects.Create(object)
+	if kubeerrors.IsAlreadyExists(err) {
+		return errors.Errorf("state %s %s/%s was created by another process while this run was using it", b.objects.Kind(), b.Namespace, b.Name)
+	}
+	if err != nil {
+		return errors.Wrapf(err, "create %s", b.objects.Kind())
+	}
+	b.resourceVersion = created.GetResourceVersion()
+	return nil
+}
+
+// update writes object, as long as nothing else has changed it since this run last saw it
+func (b *kubeBackend) update(object kubeObject) error {
+	if b.resourceVersion != "" {
+		object.SetResourceVersion(b.resourceVersion)
+	}
+
+	updated, err := b.objects.Update(object)
+	if kubeerrors.IsConflict(err) {
+		return errors.Errorf("state %s %s/%s was changed by another process while this run was using it, re-run to pick up its changes", b.objects.Kind(), b.Namespace, b.Name)
+	}
+	if err != nil {
+		return errors.Wrapf(err, "update %s", b.objects.Kind())
+	}
+	b.resourceVersion = updated.GetResourceVersion()
+	return nil
+}
+
+func (b *kubeBackend) Lock(holder LockHolder) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	annotation, err := lockAnnotationValue(holder)
+	if err != nil {
+		return err
+	}
+
+	object, err := b.objects.Get(b.Name)
+	if kubeerrors.IsNotFound(err) {
+		return b.create(b.objects.New(metav1.ObjectMeta{
+			Name:        b.Name,
+			Namespace:   b.Namespace,
+			Annotations: map[string]string{lockAnnotation: annotation},
+		}))
+	}
+	if err != nil {
+		return errors.Wrapf(err, "get %s", b.objects.Kind())
+	}
+
+	annotations := object.GetAnnotations()
+	if current := lockHolderFrom(annotations); current != nil && !current.is(holder) {
+		return &LockedError{Holder: *current}
+	}
+
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[lockAnnotation] = annotation
+	object.SetAnnotations(annotations)
+
+	// the resourceVersion from the Get keeps two runs from both taking the lock
+	updated, err := b.objects.Update(object)
+	if kubeerrors.IsConflict(err) {
+		return b.lockedError()
+	}
+	if err != nil {
+		return errors.Wrapf(err, "update %s", b.objects.Kind())
+	}
+	b.resourceVersion = updated.GetResourceVersion()
+	return nil
+}
+
+func (b *kubeBackend) Unlock(holder LockHolder) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	object, err := b.objects.Get(b.Name)
+	if kubeerrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrapf(err, "get %s", b.objects.Kind())
+	}
+
+	current := lockHolderFrom(object.GetAnnotations())
+	if current == nil {
+		return nil
+	}
+	if !current.is(holder) {
+		return errors.Errorf("lock was taken over by %s", current)
+	}
+
+	annotations := object.GetAnnotations()
+	delete(annotations, lockAnnotation)
+	object.SetAnnotations(annotations)
+	return b.update(object)
+}
+
+func (b *kubeBackend) ForceUnlock() (*LockHolder, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	object, err := b.objects.Get(b.Name)
+	if kubeerrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "get %s", b.objects.Kind())
+	}
+
+	current := lockHolderFrom(object.GetAnnotations())
+	if current == nil {
+		return nil, nil
+	}
+
+	annotations := object.GetAnnotations()
+	delete(annotations, lockAnnotation)
+	object.SetAnnotations(annotations)
+	if _, err := b.objects.Update(object); err != nil {
+		return nil, errors.Wrapf(err, "update %s", b.objects.Kind())
+	}
+	return current, nil
+}
+
+func (b *kubeBackend) LockHolder() (*LockHolder, error) {
+	object, err := b.objects.Get(b.Name)
+	if kubeerrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "get %s", b.objects.Kind())
+	}
+	return lockHolderFrom(object.GetAnnotations()), nil
+}
+
+func (b *kubeBackend) lockedError() error {
+	object, err := b.objects.Get(b.Name)
+	if err != nil {
+		return errors.Wrapf(err, "get %s", b.objects.Kind())
+	}
+	return &LockedError{Holder: lockHolderOrUnknown(object.GetAnnotations())}
+}
+
+// secrets are the Secrets in a namespace
+type secrets struct {
+	client corev1client.SecretInterface
+}
+
+type secretObject struct {
+	*corev1.Secret
+}
+
+func (s secrets) Kind() string {
+	return "secret"
+}
+
+func (s secrets) New(meta metav1.ObjectMeta) kubeObject {
+	return secretObject{&corev1.Secret{ObjectMeta: meta}}
+}
+
+func (s secrets) Get(name string) (kubeObject, error) {
+	secret, err := s.client.Get(name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return secretObject{secret}, nil
+}
+
+func (s secrets) Create(object kubeObject) (kubeObject, error) {
+	created, err := s.client.Create(object.(secretObject).Secret)
+	if err != nil {
+		return nil, err
+	}
+	return secretObject{created}, nil
+}
+
+func (s secrets) Update(object kubeObject) (kubeObject, error) {
+	updated, err := s.client.Update(object.(secretObject).Secret)
+	if err != nil {
+		return nil, err
+	}
+	return secretObject{updated}, nil
+}
+
+func (o secretObject) Value(key string) ([]byte, bool) {
+	data, ok := o.Secret.Data[key]
+	return data, ok
+}
+
+func (o secretObject) SetValue(key string, data []byte) {
+	if o.Secret.Data == nil {
+		o.Secret.Data = map[string][]byte{}
+	}
+	o.Secret.Data[key] = data
+}
+
+// configMaps are the ConfigMaps in a namespace
+type configMaps struct {
+	client corev1client.ConfigMapInterface
+}
+
+type configMapObject struct {
+	*corev1.ConfigMap
+}
+
+func (c configMaps) Kind() string {
+	return "configmap"
+}
+
+func (c configMaps) New(meta metav1.ObjectMeta) kubeObject {
+	return configMapObject{&corev1.ConfigMap{ObjectMeta: meta}}
+}
+
+func (c configMaps) Get(name string) (kubeObject, error) {
+	configMap, err := c.client.Get(name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return configMapObject{configMap}, nil
+}
+
+func (c configMaps) Create(object kubeObject) (kubeObject, error) {
+	created, err := c.client.Create(object.(configMapObject).ConfigMap)
+	if err != nil {
+		return nil, err
+	}
+	return configMapObject{created}, nil
+}
+
+func (c configMaps) Update(object kubeObject) (kubeObject, error) {
+	updated, err := c.client.Update(object.(configMapObject).ConfigMap)
+	if err != nil {
+		return nil, err
+	}
+	return configMapObject{updated}, nil
+}
+
+func (o configMapObject) Value(key string) ([]byte, bool) {
+	data, ok := o.ConfigMap.Data[key]
+	if !ok {
+		return nil, false
+	}
+	return []byte(data), true
+}
+
+func (o configMapObject) SetValue(key string, data []byte) {
+	if o.ConfigMap.Data == nil {
+		o.ConfigMap.Data = map[string]string{}
+	}
+	o.ConfigMap.Data[key] = string(data)
+}
+
+func lockAnnotationValue(holder LockHolder) (string, error) {
+	serialized, err := json.Marshal(holder)
+	if err != nil {
+		return "", errors.Wrap(err, "serialize lock holder")
+	}
+	return string(serialized), nil
+}
+
+// lockHolderFrom reads the lock annotation, returning nil if the object isn't locked
+func lockHolderFrom(annotations map[string]string) *LockHolder {
+	serialized, ok := annotations[lockAnnotation]
+	if !ok {
+		return nil
+	}
+
+	var holder LockHolder
+	// an annotation we can't make sense of still means someone holds the lock
+	_ = json.Unmarshal([]byte(serialized), &holder)
+	return &holder
+}
+
+// lockHolderOrUnknown is used when a conflicting write means someone else got there first,
+// even if they've already released the lock again
+func lockHolderOrUnknown(annotations map[string]string) LockHolder {
+	if holder := lockHolderFrom(annotations); holder != nil {
+		return *holder
+	}
+	return LockHolder{}
+}
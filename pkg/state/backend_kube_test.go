@@ -0,0 +1,247 @@
+package state
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	kubeerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+// fakeResourceVersions tracks the resourceVersion of each object and, like the API server, rejects stale updates
+type fakeResourceVersions struct {
+	mu       sync.Mutex
+	resource string
+	versions map[string]int
+}
+
+func (f *fakeResourceVersions) create(name string) (string, error) {
+	if _, ok := f.versions[name]; ok {
+		return "", kubeerrors.NewAlreadyExists(schema.GroupResource{Resource: f.resource}, name)
+	}
+	f.versions[name] = 1
+	return "1", nil
+}
+
+func (f *fakeResourceVersions) update(name string, resourceVersion string) (string, error) {
+	current, ok := f.versions[name]
+	if !ok {
+		return "", kubeerrors.NewNotFound(schema.GroupResource{Resource: f.resource}, name)
+	}
+	if resourceVersion != "" && resourceVersion != strconv.Itoa(current) {
+		return "", kubeerrors.NewConflict(schema.GroupResource{Resource: f.resource}, name, nil)
+	}
+	f.versions[name] = current + 1
+	return strconv.Itoa(current + 1), nil
+}
+
+type fakeSecrets struct {
+	corev1client.SecretInterface
+	store   fakeResourceVersions
+	secrets map[string]*corev1.Secret
+}
+
+func newFakeSecrets() *fakeSecrets {
+	return &fakeSecrets{
+		store:   fakeResourceVersions{resource: "secrets", versions: map[string]int{}},
+		secrets: map[string]*corev1.Secret{},
+	}
+}
+
+func (f *fakeSecrets) Get(name string, options metav1.GetOptions) (*corev1.Secret, error) {
+	f.store.mu.Lock()
+	defer f.store.mu.Unlock()
+	secret, ok := f.secrets[name]
+	if !ok {
+		return nil, kubeerrors.NewNotFound(schema.GroupResource{Resource: "secrets"}, name)
+	}
+	return secret.DeepCopy(), nil
+}
+
+func (f *fakeSecrets) Create(secret *corev1.Secret) (*corev1.Secret, error) {
+	f.store.mu.Lock()
+	defer f.store.mu.Unlock()
+	version, err := f.store.create(secret.Name)
+	if err != nil {
+		return nil, err
+	}
+	stored := secret.DeepCopy()
+	stored.ResourceVersion = version
+	f.secrets[secret.Name] = stored
+	return stored.DeepCopy(), nil
+}
+
+func (f *fakeSecrets) Update(secret *corev1.Secret) (*corev1.Secret, error) {
+	f.store.mu.Lock()
+	defer f.store.mu.Unlock()
+	version, err := f.store.update(secret.Name, secret.ResourceVersion)
+	if err != nil {
+		return nil, err
+	}
+	stored := secret.DeepCopy()
+	stored.ResourceVersion = version
+	f.secrets[secret.Name] = stored
+	return stored.DeepCopy(), nil
+}
+
+type fakeConfigMaps struct {
+	corev1client.ConfigMapInterface
+	store      fakeResourceVersions
+	configMaps map[string]*corev1.ConfigMap
+}
+
+func newFakeConfigMaps() *fakeConfigMaps {
+	return &fakeConfigMaps{
+		store:      fakeResourceVersions{resource: "configmaps", versions: map[string]int{}},
+		configMaps: map[string]*corev1.ConfigMap{},
+	}
+}
+
+func (f *fakeConfigMaps) Get(name string, options metav1.GetOptions) (*corev1.ConfigMap, error) {
+	f.store.mu.Lock()
+	defer f.store.mu.Unlock()
+	configMap, ok := f.configMaps[name]
+	if !ok {
+		return nil, kubeerrors.NewNotFound(schema.GroupResource{Resource: "configmaps"}, name)
+	}
+	return configMap.DeepCopy(), nil
+}
+
+func (f *fakeConfigMaps) Create(configMap *corev1.ConfigMap) (*corev1.ConfigMap, error) {
+	f.store.mu.Lock()
+	defer f.store.mu.Unlock()
+	version, err := f.store.create(configMap.Name)
+	if err != nil {
+		return nil, err
+	}
+	stored := configMap.DeepCopy()
+	stored.ResourceVersion = version
+	f.configMaps[configMap.Name] = stored
+	return stored.DeepCopy(), nil
+}
+
+func (f *fakeConfigMaps) Update(configMap *corev1.ConfigMap) (*corev1.ConfigMap, error) {
+	f.store.mu.Lock()
+	defer f.store.mu.Unlock()
+	version, err := f.store.update(configMap.Name, configMap.ResourceVersion)
+	if err != nil {
+		return nil, err
+	}
+	stored := configMap.DeepCopy()
+	stored.ResourceVersion = version
+	f.configMaps[configMap.Name] = stored
+	return stored.DeepCopy(), nil
+}
+
+// kubeBackendsFor returns a func that makes backends which share one fake Secret or ConfigMap, one per ship run
+func kubeBackendsFor(kind string) func() *kubeBackend {
+	var objects kubeObjects
+	switch kind {
+	case "secret":
+		objects = secrets{newFakeSecrets()}
+	case "configmap":
+		objects = configMaps{newFakeConfigMaps()}
+	}
+	return func() *kubeBackend {
+		return &kubeBackend{
+			Logger:    log.NewNopLogger(),
+			Namespace: "default",
+			Name:      "ship-state",
+			Key:       "state.json",
+			objects:   objects,
+		}
+	}
+}
+
+func TestKubeBackendConflictingWrite(t *testing.T) {
+	for _, kind := range []string{"secret", "configmap"} {
+		t.Run(kind, func(t *testing.T) {
+			req := require.New(t)
+			newBackend := kubeBackendsFor(kind)
+
+			req.NoError(newBackend().Write(stateObject, []byte(`{"v2": {}}`)))
+
+			first := newBackend()
+			second := newBackend()
+			_, err := first.Read(stateObject)
+			req.NoError(err)
+			_, err = second.Read(stateObject)
+			req.NoError(err)
+
+			req.NoError(second.Write(stateObject, []byte(`{"v2": {"upstream": "second"}}`)))
+
+			err = first.Write(stateObject, []byte(`{"v2": {"upstream": "first"}}`))
+			req.Error(err)
+			req.Contains(err.Error(), "was changed by another process while this run was using it")
+
+			// the write that lost didn't clobber the one that won
+			stored, err := newBackend().Read(stateObject)
+			req.NoError(err)
+			req.Equal(`{"v2": {"upstream": "second"}}`, string(stored))
+
+			// the run that won can keep writing
+			req.NoError(second.Write(historyObject, []byte(`[]`)))
+		})
+	}
+}
+
+func TestKubeBackendLock(t *testing.T) {
+	first := LockHolder{PID: 4242, Host: "ci-runner-2", Command: "ship update", Since: time.Now().Round(time.Second)}
+	second := LockHolder{PID: 99, Host: "laptop", Command: "ship state set", Since: time.Now().Round(time.Second)}
+
+	for _, kind := range []string{"secret", "configmap"} {
+		t.Run(kind, func(t *testing.T) {
+			req := require.New(t)
+			newBackend := kubeBackendsFor(kind)
+
+			firstRun := newBackend()
+			req.NoError(firstRun.Lock(first))
+
+			secondRun := newBackend()
+			err := secondRun.Lock(second)
+			req.Error(err)
+			req.True(IsLocked(err))
+			req.Contains(err.Error(), "state is locked by pid 4242 on ci-runner-2 (ship update)")
+
+			// the holder can take the lock again, and keep writing while it holds it
+			req.NoError(firstRun.Lock(first))
+			req.NoError(firstRun.Write(stateObject, []byte(`{"v2": {}}`)))
+
+			err = secondRun.Unlock(second)
+			req.Error(err)
+			req.Contains(err.Error(), "lock was taken over by")
+
+			holder, err := secondRun.ForceUnlock()
+			req.NoError(err)
+			req.NotNil(holder)
+			req.Equal(first.PID, holder.PID)
+			req.Equal(first.Host, holder.Host)
+
+			holder, err = secondRun.LockHolder()
+			req.NoError(err)
+			req.Nil(holder)
+
+			req.NoError(secondRun.Lock(second))
+			holder, err = newBackend().LockHolder()
+			req.NoError(err)
+			req.Equal(second.PID, holder.PID)
+
+			// state written while the first run held the lock survived the force unlock
+			stored, err := newBackend().Read(stateObject)
+			req.NoError(err)
+			req.Equal(`{"v2": {}}`, string(stored))
+
+			req.NoError(secondRun.Unlock(second))
+			holder, err = newBackend().LockHolder()
+			req.NoError(err)
+			req.Nil(holder)
+		})
+	}
+}
@@ -0,0 +1,29 @@
+package state
+
+import (
+	"sync"
+)
+
+var _ StateBackend = &MemoryBackend{}
+
+// MemoryBackend keeps state in memory, so nothing written to it outlives the process
+type MemoryBackend struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func (b *MemoryBackend) Read(name string) ([]byte, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.objects[name], nil
+}
+
+func (b *MemoryBackend) Write(name string, data []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.objects == nil {
+		b.objects = map[string][]byte{}
+	}
+	b.objects[name] = append([]byte(nil), data...)
+	return nil
+}
@@ -0,0 +1,115 @@
+package state
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+)
+
+var _ StateBackend = &S3Backend{}
+
+// S3Backend keeps state in an object in an S3-compatible object store.
+// Credentials come from the usual AWS environment variables, shared config or instance profile.
+type S3Backend struct {
+	Logger log.Logger
+	Client *s3.S3
+	Bucket string
+	Key    string
+}
+
+func newS3Backend(logger log.Logger, v *viper.Viper) (*S3Backend, error) {
+	bucket := v.GetString("s3-bucket")
+	if bucket == "" {
+		return nil, errors.New("s3-bucket is not set")
+	}
+	key := v.GetString("s3-key")
+	if key == "" {
+		return nil, errors.New("s3-key is not set")
+	}
+
+	config := aws.NewConfig().WithRegion(v.GetString("s3-region"))
+	if endpoint := v.GetString("s3-endpoint"); endpoint != "" {
+		// S3-compatible stores like minio generally don't support virtual-hosted buckets
+		config = config.WithEndpoint(endpoint).WithS3ForcePathStyle(true)
+	}
+
+	sess, err := session.NewSession(config)
+	if err != nil {
+		return nil, errors.Wrap(err, "create s3 session")
+	}
+
+	return &S3Backend{
+		Logger: logger,
+		Client: s3.New(sess),
+		Bucket: bucket,
+		Key:    key,
+	}, nil
+}
+
+// objectKey keeps other objects next to state, so a state key of ship/state.json
+// has its history in ship/state-history.json
+func (b *S3Backend) objectKey(name string) string {
+	if name == stateObject {
+		return b.Key
+	}
+	ext := path.Ext(b.Key)
+	return strings.TrimSuffix(b.Key, ext) + "-" + name + ext
+}
+
+func (b *S3Backend) Read(name string) ([]byte, error) {
+	key := b.objectKey(name)
+	out, err := b.Client.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(b.Bucket),
+		Key:    aws.String(key),
+	})
+	if isS3NotFound(err) {
+		level.Debug(b.Logger).Log("msg", "no saved state exists", "bucket", b.Bucket, "key", key)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "get s3://%s/%s", b.Bucket, key)
+	}
+	defer out.Body.Close()
+
+	data, err := ioutil.ReadAll(out.Body)
+	if err != nil {
+		return nil, errors.Wrapf(err, "read s3://%s/%s", b.Bucket, key)
+	}
+	return data, nil
+}
+
+func (b *S3Backend) Write(name string, data []byte) error {
+	key := b.objectKey(name)
+	level.Debug(log.With(b.Logger, "method", "S3Backend.Write")).Log("event", "object.put", "bucket", b.Bucket, "key", key)
+
+	_, err := b.Client.PutObject(&s3.PutObjectInput{
+		Bucket:      aws.String(b.Bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(data),
+		ContentType: aws.String("application/json"),
+	})
+	if err != nil {
+		return errors.Wrapf(err, "put s3://%s/%s", b.Bucket, key)
+	}
+	return nil
+}
+
+func isS3NotFound(err error) bool {
+	if aerr, ok := err.(awserr.RequestFailure); ok {
+		return aerr.StatusCode() == 404
+	}
+	if aerr, ok := err.(awserr.Error); ok {
+		return aerr.Code() == s3.ErrCodeNoSuchKey
+	}
+	return false
+}
@@ -0,0 +1,140 @@
+package state
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/replicatedhq/ship/pkg/constants"
+	"github.com/spf13/afero"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeObjectStore is a minimal stand-in for an S3-compatible store using path-style requests
+type fakeObjectStore struct {
+	sync.Mutex
+	objects map[string][]byte
+}
+
+func (f *fakeObjectStore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+
+	switch r.Method {
+	case http.MethodGet:
+		object, ok := f.objects[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?><Error><Code>NoSuchKey</Code></Error>`))
+			return
+		}
+		w.Write(object)
+	case http.MethodPut:
+		body, _ := ioutil.ReadAll(r.Body)
+		f.objects[r.URL.Path] = body
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func TestBackends(t *testing.T) {
+	store := &fakeObjectStore{objects: map[string][]byte{}}
+	server := httptest.NewServer(store)
+	defer server.Close()
+
+	os.Setenv("AWS_ACCESS_KEY_ID", "minio")
+	os.Setenv("AWS_SECRET_ACCESS_KEY", "minio123")
+	defer os.Unsetenv("AWS_ACCESS_KEY_ID")
+	defer os.Unsetenv("AWS_SECRET_ACCESS_KEY")
+
+	tests := []struct {
+		name       string
+		viper      map[string]interface{}
+		wantStored func(req *require.Assertions, fs afero.Afero)
+		wantErr    string
+	}{
+		{
+			name:  "file",
+			viper: map[string]interface{}{"state-from": "file"},
+			wantStored: func(req *require.Assertions, fs afero.Afero) {
+				exists, err := fs.Exists(constants.StatePath)
+				req.NoError(err)
+				req.True(exists)
+				exists, err = fs.Exists(constants.StateHistoryPath)
+				req.NoError(err)
+				req.True(exists)
+			},
+		},
+		{
+			name: "s3",
+			viper: map[string]interface{}{
+				"state-from":  "s3",
+				"s3-bucket":   "ship",
+				"s3-key":      "myapp/state.json",
+				"s3-region":   "us-east-1",
+				"s3-endpoint": server.URL,
+			},
+			wantStored: func(req *require.Assertions, fs afero.Afero) {
+				req.Contains(store.objects, "/ship/myapp/state.json")
+				req.Contains(store.objects, "/ship/myapp/state-history.json")
+			},
+		},
+		{
+			name:    "s3 without a bucket",
+			viper:   map[string]interface{}{"state-from": "s3", "s3-key": "state.json"},
+			wantErr: "s3-bucket is not set",
+		},
+		{
+			name:    "configmap without a name",
+			viper:   map[string]interface{}{"state-from": "configmap", "configmap-namespace": "default", "configmap-key": "state"},
+			wantErr: "configmap-name is not set",
+		},
+		{
+			name:    "unknown",
+			viper:   map[string]interface{}{"state-from": "carrier-pigeon"},
+			wantErr: `unsupported state-from value: "carrier-pigeon"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := require.New(t)
+			fs := afero.Afero{Fs: afero.NewMemMapFs()}
+			v := viper.New()
+			for key, value := range tt.viper {
+				v.Set(key, value)
+			}
+
+			m := &MManager{Logger: log.NewNopLogger(), FS: fs, V: v}
+			if tt.wantErr != "" {
+				_, err := m.TryLoad()
+				req.Error(err)
+				req.Contains(err.Error(), tt.wantErr)
+				return
+			}
+
+			loaded, err := m.TryLoad()
+			req.NoError(err)
+			req.True(loaded.IsEmpty())
+
+			req.NoError(m.SerializeContentSHA("abc"))
+			m = &MManager{Logger: log.NewNopLogger(), FS: fs, V: v}
+			req.NoError(m.SerializeContentSHA("def"))
+
+			loaded, err = m.TryLoad()
+			req.NoError(err)
+			req.Equal("def", loaded.Versioned().V2.ContentSHA)
+
+			history, err := m.History()
+			req.NoError(err)
+			req.Len(history, 1)
+			req.Equal("abc", history[0].ContentSHA)
+
+			tt.wantStored(req, fs)
+		})
+	}
+}
@@ -0,0 +1,235 @@
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// EditablePaths describes the paths accepted by GetPath, SetPath and UnsetPath
+const EditablePaths = `config.<item>, helmValues, releaseName, upstreams.<name>.helmValues, overlays.<overlay>.patches.<file>, overlays.<overlay>.resources.<file>`
+
+// statePath is a parsed path into state
+type statePath struct {
+	field   string
+	key     string
+	overlay string
+}
+
+func parseStatePath(path string) (statePath, error) {
+	parts := strings.SplitN(path, ".", 2)
+	switch parts[0] {
+	case "helmValues", "releaseName":
+		if len(parts) != 1 {
+			break
+		}
+		return statePath{field: parts[0]}, nil
+	case "config":
+		if len(parts) != 2 || parts[1] == "" {
+			break
+		}
+		return statePath{field: "config", key: parts[1]}, nil
+	case "upstreams":
+		upstreamParts := strings.SplitN(path, ".", 3)
+		if len(upstreamParts) != 3 || upstreamParts[1] == "" || upstreamParts[2] != "helmValues" {
+			break
+		}
+		return statePath{field: "upstreamHelmValues", key: upstreamParts[1]}, nil
+	case "overlays":
+		// file names have dots in them, so only split off as much as we need
+		overlayParts := strings.SplitN(path, ".", 4)
+		if len(overlayParts) != 4 || overlayParts[1] == "" || overlayParts[3] == "" {
+			break
+		}
+		if overlayParts[2] != "patches" && overlayParts[2] != "resources" {
+			break
+		}
+		return statePath{field: overlayParts[2], overlay: overlayParts[1], key: overlayParts[3]}, nil
+	}
+
+	return statePath{}, errors.Errorf("unsupported state path %q, expected one of %s", path, EditablePaths)
+}
+
+// IsConfigPath returns the config item name if path refers to a config value
+func IsConfigPath(path string) (string, bool) {
+	parsed, err := parseStatePath(path)
+	if err != nil || parsed.field != "config" {
+		return "", false
+	}
+	return parsed.key, true
+}
+
+// GetPath returns the value at path in state
+func GetPath(state VersionedState, path string) (string, error) {
+	parsed, err := parseStatePath(path)
+	if err != nil {
+		return "", err
+	}
+	if state.V2 == nil {
+		return "", errors.Errorf("%s is not set", path)
+	}
+
+	switch parsed.field {
+	case "helmValues":
+		return state.V2.HelmValues, nil
+	case "releaseName":
+		return state.V2.ReleaseName, nil
+	case "upstreamHelmValues":
+		upstream, ok := state.V2.UpstreamNamed(parsed.key)
+		if !ok {
+			return "", errors.Errorf("%s is not set, there is no upstream named %q", path, parsed.key)
+		}
+		return upstream.HelmValues, nil
+	case "config":
+		value, ok := state.V2.Config[parsed.key]
+		if !ok {
+			return "", errors.Errorf("%s is not set", path)
+		}
+		if str, ok := value.(string); ok {
+			return str, nil
+		}
+		serialized, err := json.Marshal(value)
+		if err != nil {
+			return "", errors.Wrapf(err, "serialize %s", path)
+		}
+		return string(serialized), nil
+	default:
+		overlay := state.V2.Kustomize.overlayOrEmpty(parsed.overlay)
+		files := overlay.Patches
+		if parsed.field == "resources" {
+			files = overlay.Resources
+		}
+		contents, ok := files[parsed.key]
+		if !ok {
+			return "", errors.Errorf("%s is not set, %s", path, availableFiles(parsed, files))
+		}
+		return contents, nil
+	}
+}
+
+// SetPath sets the value at path in state
+func SetPath(state VersionedState, path string, value string) (VersionedState, error) {
+	parsed, err := parseStatePath(path)
+	if err != nil {
+		return state, err
+	}
+	if state.V2 == nil {
+		state.V2 = &V2{}
+	}
+
+	switch parsed.field {
+	case "helmValues":
+		state.V2.HelmValues = value
+	case "releaseName":
+		state.V2.ReleaseName = value
+	case "upstreamHelmValues":
+		i, err := namedUpstreamIndex(state.V2, parsed.key)
+		if err != nil {
+			return state, err
+		}
+		state.V2.Upstreams[i].HelmValues = value
+	case "config":
+		if state.V2.Config == nil {
+			state.V2.Config = map[string]interface{}{}
+		}
+		state.V2.Config[parsed.key] = value
+	default:
+		kustomize := state.V2.Kustomize
+		if kustomize == nil {
+			kustomize = &Kustomize{}
+		}
+		if kustomize.Overlays == nil {
+			kustomize.Overlays = map[string]Overlay{}
+		}
+
+		overlay := kustomize.Overlay(parsed.overlay)
+		if parsed.field == "resources" {
+			if overlay.Resources == nil {
+				overlay.Resources = map[string]string{}
+			}
+			overlay.Resources[parsed.key] = value
+		} else {
+			if overlay.Patches == nil {
+				overlay.Patches = map[string]string{}
+			}
+			overlay.Patches[parsed.key] = value
+		}
+
+		kustomize.Overlays[parsed.overlay] = overlay
+		state.V2.Kustomize = kustomize
+	}
+
+	return state, nil
+}
+
+// UnsetPath removes the value at path from state
+func UnsetPath(state VersionedState, path string) (VersionedState, error) {
+	parsed, err := parseStatePath(path)
+	if err != nil {
+		return state, err
+	}
+	if state.V2 == nil {
+		return state, nil
+	}
+
+	switch parsed.field {
+	case "helmValues":
+		state.V2.HelmValues = ""
+	case "releaseName":
+		state.V2.ReleaseName = ""
+	case "upstreamHelmValues":
+		if i, err := namedUpstreamIndex(state.V2, parsed.key); err == nil {
+			state.V2.Upstreams[i].HelmValues = ""
+		}
+	case "config":
+		delete(state.V2.Config, parsed.key)
+	default:
+		if state.V2.Kustomize == nil {
+			return state, nil
+		}
+		overlay, ok := state.V2.Kustomize.Overlays[parsed.overlay]
+		if !ok {
+			return state, nil
+		}
+		if parsed.field == "resources" {
+			delete(overlay.Resources, parsed.key)
+		} else {
+			delete(overlay.Patches, parsed.key)
+		}
+		state.V2.Kustomize.Overlays[parsed.overlay] = overlay
+	}
+
+	return state, nil
+}
+
+func namedUpstreamIndex(v2 *V2, name string) (int, error) {
+	for i, upstream := range v2.Upstreams {
+		if upstream.Name == name {
+			return i, nil
+		}
+	}
+	return 0, errors.Errorf("there is no upstream named %q", name)
+}
+
+func (k *Kustomize) overlayOrEmpty(name string) Overlay {
+	if k == nil {
+		return NewOverlay()
+	}
+	return k.Overlay(name)
+}
+
+func availableFiles(parsed statePath, files map[string]string) string {
+	if len(files) == 0 {
+		return fmt.Sprintf("overlay %q has no %s", parsed.overlay, parsed.field)
+	}
+
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return fmt.Sprintf("overlay %q has %s %s", parsed.overlay, parsed.field, strings.Join(names, ", "))
+}
@@ -0,0 +1,113 @@
+package state
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEditPaths(t *testing.T) {
+	tests := []struct {
+		name      string
+		path      string
+		value     string
+		upstreams []NamedUpstream
+		wantErr   string
+		check     func(req *require.Assertions, state VersionedState)
+	}{
+		{
+			name:  "config item",
+			path:  "config.db_host",
+			value: "postgres.local",
+			check: func(req *require.Assertions, state VersionedState) {
+				req.Equal("postgres.local", state.V2.Config["db_host"])
+			},
+		},
+		{
+			name:  "helm values",
+			path:  "helmValues",
+			value: "replicaCount: 2\n",
+			check: func(req *require.Assertions, state VersionedState) {
+				req.Equal("replicaCount: 2\n", state.V2.HelmValues)
+			},
+		},
+		{
+			name:  "release name",
+			path:  "releaseName",
+			value: "my-release",
+			check: func(req *require.Assertions, state VersionedState) {
+				req.Equal("my-release", state.V2.ReleaseName)
+			},
+		},
+		{
+			name:      "named upstream helm values",
+			path:      "upstreams.ingress.helmValues",
+			value:     "controller:\n  replicaCount: 2\n",
+			upstreams: []NamedUpstream{{Name: "app", Upstream: "github.com/o/app"}, {Name: "ingress", Upstream: "github.com/o/ingress"}},
+			check: func(req *require.Assertions, state VersionedState) {
+				req.Equal("controller:\n  replicaCount: 2\n", state.V2.Upstreams[1].HelmValues)
+				req.Empty(state.V2.Upstreams[0].HelmValues)
+			},
+		},
+		{
+			name:      "helm values of an unknown upstream",
+			path:      "upstreams.monitoring.helmValues",
+			upstreams: []NamedUpstream{{Name: "ingress", Upstream: "github.com/o/ingress"}},
+			wantErr:   `there is no upstream named "monitoring"`,
+		},
+		{
+			name:  "overlay patch with dots in the file name",
+			path:  "overlays.staging.patches./deployment.yaml",
+			value: "kind: Deployment\n",
+			check: func(req *require.Assertions, state VersionedState) {
+				req.Equal("kind: Deployment\n", state.V2.Kustomize.Overlays["staging"].Patches["/deployment.yaml"])
+			},
+		},
+		{
+			name:  "overlay resource",
+			path:  "overlays.ship.resources./configmap.yaml",
+			value: "kind: ConfigMap\n",
+			check: func(req *require.Assertions, state VersionedState) {
+				req.Equal("kind: ConfigMap\n", state.V2.Kustomize.Ship().Resources["/configmap.yaml"])
+			},
+		},
+		{
+			name:    "unknown field",
+			path:    "upstream",
+			wantErr: `unsupported state path "upstream"`,
+		},
+		{
+			name:    "unknown overlay map",
+			path:    "overlays.ship.bases./deployment.yaml",
+			wantErr: `unsupported state path`,
+		},
+		{
+			name:    "config without an item",
+			path:    "config",
+			wantErr: `unsupported state path`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := require.New(t)
+
+			state, err := SetPath(VersionedState{V2: &V2{Upstreams: tt.upstreams}}, tt.path, tt.value)
+			if tt.wantErr != "" {
+				req.Error(err)
+				req.Contains(err.Error(), tt.wantErr)
+				return
+			}
+			req.NoError(err)
+			tt.check(req, state)
+
+			value, err := GetPath(state, tt.path)
+			req.NoError(err)
+			req.Equal(tt.value, value)
+
+			state, err = UnsetPath(state, tt.path)
+			req.NoError(err)
+			value, _ = GetPath(state, tt.path)
+			req.Empty(value)
+		})
+	}
+}
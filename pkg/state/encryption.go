@@ -0,0 +1,288 @@
+package state
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/libyaml"
+	"golang.org/x/crypto/scrypt"
+)
+
+// StateKeyEnv is the environment variable that can hold the key used to encrypt sensitive config values
+const StateKeyEnv = "SHIP_STATE_KEY"
+
+// encryptedValuePrefix marks a config value in the serialized state as ciphertext
+const encryptedValuePrefix = "ship:enc:v1:"
+
+// scrypt parameters for deriving the key that wraps the data key from the state key
+const (
+	scryptN       = 1 << 15
+	scryptR       = 8
+	scryptP       = 1
+	scryptKeySize = 32
+	saltSize      = 16
+)
+
+// Encryption holds what's needed to decrypt sensitive config values at rest.
+// Values are encrypted with a random data key, and the data key is encrypted with a key derived with scrypt
+// from the state key from --state-key-file or SHIP_STATE_KEY and Salt, so rotating the state key never
+// requires more than re-wrapping the data key.
+type Encryption struct {
+	DataKey string `json:"dataKey" yaml:"dataKey" hcl:"dataKey"`
+	Salt    string `json:"salt" yaml:"salt" hcl:"salt"`
+}
+
+// SensitiveConfigKeys returns the names of the config items whose values should be encrypted at rest
+func SensitiveConfigKeys(configGroups []libyaml.ConfigGroup) []string {
+	var keys []string
+	for _, configGroup := range configGroups {
+		for _, configItem := range configGroup.Items {
+			if configItem == nil {
+				continue
+			}
+			if isSensitiveConfigItem(configItem) {
+				keys = append(keys, configItem.Name)
+			}
+		}
+	}
+	return keys
+}
+
+func isSensitiveConfigItem(item *libyaml.ConfigItem) bool {
+	if item.Type == "password" {
+		return true
+	}
+	secret, ok := item.Props["secret"].(bool)
+	return ok && secret
+}
+
+// stateKey reads the key used to encrypt sensitive values, preferring --state-key-file over SHIP_STATE_KEY.
+// An empty key means encryption is not configured.
+func (m *MManager) stateKey() (string, error) {
+	if m.key != "" {
+		return m.key, nil
+	}
+
+	var material string
+	if keyFile := m.V.GetString("state-key-file"); keyFile != "" {
+		contents, err := m.FS.ReadFile(keyFile)
+		if err != nil {
+			return "", errors.Wrapf(err, "read state key file %s", keyFile)
+		}
+		material = string(contents)
+	} else {
+		material = os.Getenv(StateKeyEnv)
+	}
+
+	return checkStateKey(material)
+}
+
+func checkStateKey(material string) (string, error) {
+	material = strings.TrimSpace(material)
+	if material == "" {
+		return "", nil
+	}
+	if len(material) < 16 {
+		return "", errors.New("state key must be at least 16 characters")
+	}
+	return material, nil
+}
+
+// wrappingKey derives the key that wraps the data key in encryption from the state key
+func wrappingKey(stateKey string, encryption *Encryption) ([]byte, error) {
+	if encryption.Salt == "" {
+		return nil, errors.New("state encryption has no salt for the data key")
+	}
+	salt, err := base64.StdEncoding.DecodeString(encryption.Salt)
+	if err != nil {
+		return nil, errors.Wrap(err, "decode salt")
+	}
+	return deriveKey(stateKey, salt)
+}
+
+func deriveKey(stateKey string, salt []byte) ([]byte, error) {
+	key, err := scrypt.Key([]byte(stateKey), salt, scryptN, scryptR, scryptP, scryptKeySize)
+	if err != nil {
+		return nil, errors.Wrap(err, "derive key")
+	}
+	return key, nil
+}
+
+// encryptSensitive returns a copy of state with every sensitive config value encrypted.
+// If no state key is configured, state is returned as-is.
+func (m *MManager) encryptSensitive(state VersionedState) (VersionedState, error) {
+	if state.V2 == nil || len(state.V2.SensitiveConfig) == 0 {
+		return state, nil
+	}
+
+	key, err := m.stateKey()
+	if err != nil {
+		return state, errors.Wrap(err, "load state key")
+	}
+	if key == "" {
+		return state, nil
+	}
+	return encryptWith(key, state)
+}
+
+// encryptWith returns a copy of state with every sensitive config value encrypted with key
+func encryptWith(key string, state VersionedState) (VersionedState, error) {
+	dataKey, encryption, err := dataKeyFor(key, state.V2.Encryption)
+	if err != nil {
+		return state, err
+	}
+
+	v2 := *state.V2
+	v2.Encryption = encryption
+	v2.Config = make(map[string]interface{}, len(state.V2.Config))
+	for k, v := range state.V2.Config {
+		v2.Config[k] = v
+	}
+
+	for _, name := range v2.SensitiveConfig {
+		value, ok := v2.Config[name].(string)
+		if !ok || strings.HasPrefix(value, encryptedValuePrefix) {
+			continue
+		}
+		sealed, err := seal(dataKey, []byte(value))
+		if err != nil {
+			return state, errors.Wrapf(err, "encrypt config item %s", name)
+		}
+		v2.Config[name] = encryptedValuePrefix + sealed
+	}
+
+	return VersionedState{V2: &v2}, nil
+}
+
+// decryptSensitive decrypts every encrypted config value in place
+func (m *MManager) decryptSensitive(state VersionedState) (VersionedState, error) {
+	if state.V2 == nil || state.V2.Encryption == nil {
+		return state, nil
+	}
+
+	key, err := m.stateKey()
+	if err != nil {
+		return state, errors.Wrap(err, "load state key")
+	}
+	if key == "" {
+		return state, errors.Errorf("state contains encrypted values, but no key was provided with --state-key-file or %s", StateKeyEnv)
+	}
+	return decryptWith(key, state)
+}
+
+// decryptWith decrypts every encrypted config value in state in place with key
+func decryptWith(key string, state VersionedState) (VersionedState, error) {
+	wrapping, err := wrappingKey(key, state.V2.Encryption)
+	if err != nil {
+		return state, err
+	}
+	dataKey, err := open(wrapping, state.V2.Encryption.DataKey)
+	if err != nil {
+		return state, errors.Wrap(err, "decrypt data key, is this the right state key?")
+	}
+
+	for name, v := range state.V2.Config {
+		value, ok := v.(string)
+		if !ok || !strings.HasPrefix(value, encryptedValuePrefix) {
+			continue
+		}
+		plaintext, err := open(dataKey, strings.TrimPrefix(value, encryptedValuePrefix))
+		if err != nil {
+			return state, errors.Wrapf(err, "decrypt config item %s", name)
+		}
+		state.V2.Config[name] = string(plaintext)
+	}
+
+	return state, nil
+}
+
+// dataKeyFor unwraps the existing data key with key, or generates a new one if there isn't one yet
+func dataKeyFor(key string, existing *Encryption) ([]byte, *Encryption, error) {
+	if existing != nil && existing.DataKey != "" {
+		wrapping, err := wrappingKey(key, existing)
+		if err != nil {
+			return nil, nil, err
+		}
+		dataKey, err := open(wrapping, existing.DataKey)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "decrypt data key, is this the right state key?")
+		}
+		return dataKey, existing, nil
+	}
+
+	dataKey := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return nil, nil, errors.Wrap(err, "generate data key")
+	}
+
+	salt := make([]byte, saltSize)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, nil, errors.Wrap(err, "generate salt")
+	}
+	wrapping, err := deriveKey(key, salt)
+	if err != nil {
+		return nil, nil, err
+	}
+	wrapped, err := seal(wrapping, dataKey)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "encrypt data key")
+	}
+
+	return dataKey, &Encryption{DataKey: wrapped, Salt: base64.StdEncoding.EncodeToString(salt)}, nil
+}
+
+func seal(key []byte, plaintext []byte) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", errors.Wrap(err, "generate nonce")
+	}
+
+	sealed := gcm.Seal(nonce, nonce, plaintext, nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func open(key []byte, encoded string) ([]byte, error) {
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, errors.Wrap(err, "decode ciphertext")
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "decrypt")
+	}
+	return plaintext, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "create cipher")
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, errors.Wrap(err, "create gcm")
+	}
+	return gcm, nil
+}
@@ -0,0 +1,199 @@
+package state
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/replicatedhq/libyaml"
+	"github.com/replicatedhq/ship/pkg/api"
+	"github.com/replicatedhq/ship/pkg/constants"
+	"github.com/spf13/afero"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSensitiveConfigKeys(t *testing.T) {
+	req := require.New(t)
+
+	keys := SensitiveConfigKeys([]libyaml.ConfigGroup{
+		{
+			Name: "database",
+			Items: []*libyaml.ConfigItem{
+				{Name: "db_host", Type: "text"},
+				{Name: "db_password", Type: "password"},
+				{Name: "api_token", Type: "text", Props: map[string]interface{}{"secret": true}},
+			},
+		},
+	})
+
+	req.Equal([]string{"db_password", "api_token"}, keys)
+}
+
+func TestEncryptSensitiveConfig(t *testing.T) {
+	configGroups := []libyaml.ConfigGroup{
+		{
+			Name: "database",
+			Items: []*libyaml.ConfigItem{
+				{Name: "db_host", Type: "text"},
+				{Name: "db_password", Type: "password"},
+			},
+		},
+	}
+	templateContext := map[string]interface{}{
+		"db_host":     "postgres.local",
+		"db_password": "hunter2hunter2",
+	}
+
+	tests := []struct {
+		name          string
+		key           string
+		wantPlaintext bool
+	}{
+		{
+			name:          "no key configured",
+			wantPlaintext: true,
+		},
+		{
+			name: "key configured",
+			key:  "0123456789abcdef0123456789abcdef",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := require.New(t)
+			fs := afero.Afero{Fs: afero.NewMemMapFs()}
+			v := viper.New()
+			if tt.key != "" {
+				req.NoError(fs.WriteFile("state.key", []byte(tt.key), 0600))
+				v.Set("state-key-file", "state.key")
+			}
+
+			m := &MManager{
+				Logger: log.NewNopLogger(),
+				FS:     fs,
+				V:      v,
+			}
+
+			err := m.SerializeConfig(nil, api.ReleaseMetadata{}, configGroups, templateContext)
+			req.NoError(err)
+
+			serialized, err := fs.ReadFile(constants.StatePath)
+			req.NoError(err)
+			req.Contains(string(serialized), "postgres.local")
+			if tt.wantPlaintext {
+				req.Contains(string(serialized), "hunter2hunter2")
+			} else {
+				req.NotContains(string(serialized), "hunter2hunter2")
+				req.Contains(string(serialized), `"salt"`)
+			}
+
+			loaded, err := m.TryLoad()
+			req.NoError(err)
+			req.Equal(templateContext, loaded.CurrentConfig())
+			req.Equal([]string{"db_password"}, loaded.Versioned().V2.SensitiveConfig)
+		})
+	}
+}
+
+func TestRekey(t *testing.T) {
+	req := require.New(t)
+	fs := afero.Afero{Fs: afero.NewMemMapFs()}
+	v := viper.New()
+	req.NoError(fs.WriteFile("old.key", []byte("0123456789abcdef0123456789abcdef"), 0600))
+	req.NoError(fs.WriteFile("new.key", []byte("fedcba9876543210fedcba9876543210"), 0600))
+	v.Set("state-key-file", "old.key")
+
+	m := &MManager{
+		Logger: log.NewNopLogger(),
+		FS:     fs,
+		V:      v,
+	}
+
+	err := m.Save(VersionedState{V2: &V2{
+		Config:          map[string]interface{}{"db_password": "hunter2hunter2"},
+		SensitiveConfig: []string{"db_password"},
+	}})
+	req.NoError(err)
+
+	req.NoError(m.Rekey("fedcba9876543210fedcba9876543210"))
+
+	// the old key no longer works
+	reloaded := &MManager{Logger: log.NewNopLogger(), FS: fs, V: v}
+	_, err = reloaded.TryLoad()
+	req.Error(err)
+
+	v.Set("state-key-file", "new.key")
+	loaded, err := reloaded.TryLoad()
+	req.NoError(err)
+	req.Equal("hunter2hunter2", loaded.CurrentConfig()["db_password"])
+
+	// no key at all is a loud failure rather than handing back ciphertext
+	v.Set("state-key-file", "")
+	_, err = reloaded.TryLoad()
+	req.Error(err)
+}
+
+func TestRekeyThenRollback(t *testing.T) {
+	req := require.New(t)
+	fs := afero.Afero{Fs: afero.NewMemMapFs()}
+	v := viper.New()
+	oldKey := "0123456789abcdef0123456789abcdef"
+	newKey := "fedcba9876543210fedcba9876543210"
+	req.NoError(fs.WriteFile("old.key", []byte(oldKey), 0600))
+	req.NoError(fs.WriteFile("new.key", []byte(newKey), 0600))
+	v.Set("state-key-file", "old.key")
+
+	// two runs, so the first password is kept in history
+	for _, password := range []string{"hunter2hunter2", "correcthorsebattery"} {
+		m := &MManager{Logger: log.NewNopLogger(), FS: fs, V: v}
+		req.NoError(m.Save(VersionedState{V2: &V2{
+			Config:          map[string]interface{}{"db_password": password},
+			SensitiveConfig: []string{"db_password"},
+		}}))
+	}
+
+	req.NoError((&MManager{Logger: log.NewNopLogger(), FS: fs, V: v}).Rekey(newKey))
+
+	// history no longer opens with the old key
+	m := &MManager{Logger: log.NewNopLogger(), FS: fs, V: v}
+	entries, err := m.History()
+	req.NoError(err)
+	req.Len(entries, 1)
+	err = m.Rollback(1)
+	req.Error(err)
+
+	v.Set("state-key-file", "new.key")
+	m = &MManager{Logger: log.NewNopLogger(), FS: fs, V: v}
+	req.NoError(m.Rollback(1))
+
+	loaded, err := (&MManager{Logger: log.NewNopLogger(), FS: fs, V: v}).TryLoad()
+	req.NoError(err)
+	req.Equal("hunter2hunter2", loaded.CurrentConfig()["db_password"])
+}
+
+func TestUnsaltedDataKeyRejected(t *testing.T) {
+	req := require.New(t)
+	fs := afero.Afero{Fs: afero.NewMemMapFs()}
+	v := viper.New()
+	stateKey := "0123456789abcdef0123456789abcdef"
+	req.NoError(fs.WriteFile("state.key", []byte(stateKey), 0600))
+	v.Set("state-key-file", "state.key")
+
+	m := &MManager{Logger: log.NewNopLogger(), FS: fs, V: v}
+	req.NoError(m.Save(VersionedState{V2: &V2{
+		Config:          map[string]interface{}{"db_password": "hunter2hunter2"},
+		SensitiveConfig: []string{"db_password"},
+	}}))
+
+	// with the salt removed, the data key can't be unwrapped with anything weaker than the salted key
+	serialized, err := fs.ReadFile(constants.StatePath)
+	req.NoError(err)
+	unsalted := regexp.MustCompile(`,?\s*"salt":\s*"[^"]*"`).ReplaceAll(serialized, nil)
+	req.NotEqual(string(serialized), string(unsalted))
+	req.NoError(fs.WriteFile(constants.StatePath, unsalted, 0644))
+
+	_, err = (&MManager{Logger: log.NewNopLogger(), FS: fs, V: v}).TryLoad()
+	req.Error(err)
+	req.Contains(err.Error(), "salt")
+}
@@ -0,0 +1,200 @@
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+)
+
+// DefaultHistoryLimit is how many prior states are kept when --state-history-limit isn't set
+const DefaultHistoryLimit = 10
+
+// HistoryEntry is a snapshot of state as it was before a ship run changed it
+type HistoryEntry struct {
+	Timestamp  time.Time       `json:"timestamp" yaml:"timestamp" hcl:"timestamp"`
+	Reason     string          `json:"reason" yaml:"reason" hcl:"reason"`
+	ContentSHA string          `json:"contentSHA,omitempty" yaml:"contentSHA,omitempty" hcl:"contentSHA,omitempty"`
+	State      json.RawMessage `json:"state" yaml:"state" hcl:"state"`
+}
+
+// History is the list of prior states, most recent first
+type History struct {
+	Entries []HistoryEntry `json:"entries" yaml:"entries" hcl:"entries"`
+}
+
+// History returns the saved prior states, most recent first
+func (m *MManager) History() ([]HistoryEntry, error) {
+	history, err := m.readHistory()
+	if err != nil {
+		return nil, errors.Wrap(err, "read state history")
+	}
+	return history.Entries, nil
+}
+
+// Snapshot returns state as it's stored, with sensitive values still encrypted.
+// Zero is the current state, n is the nth entry in History.
+func (m *MManager) Snapshot(n int) ([]byte, error) {
+	if n == 0 {
+		serialized, err := m.readSerializedState()
+		if err != nil {
+			return nil, errors.Wrap(err, "read current state")
+		}
+		return serialized, nil
+	}
+
+	entry, err := m.historyEntry(n)
+	if err != nil {
+		return nil, err
+	}
+	return entry.State, nil
+}
+
+// Rollback restores the nth entry in History as the current state.
+// The state being replaced is itself saved to history, so a rollback can be undone.
+func (m *MManager) Rollback(n int) error {
+	debug := level.Debug(log.With(m.Logger, "method", "Rollback"))
+
+	entry, err := m.historyEntry(n)
+	if err != nil {
+		return err
+	}
+
+	// history can hold state written in an older schema
+	restored, _, err := migrate(entry.State)
+	if err != nil {
+		return errors.Wrapf(err, "load state from history entry %d", n)
+	}
+
+	debug.Log("event", "rollback", "entry", n, "timestamp", entry.Timestamp)
+	restored, err = m.decryptSensitive(restored)
+	if err != nil {
+		return errors.Wrapf(err, "decrypt state from history entry %d", n)
+	}
+
+	// always record the state we're replacing, even if we've already snapshotted this run
+	m.snapshotTaken = false
+	return m.serializeAndWriteState(restored, fmt.Sprintf("rollback to %s", entry.Timestamp.Format(time.RFC3339)))
+}
+
+func (m *MManager) historyEntry(n int) (*HistoryEntry, error) {
+	history, err := m.readHistory()
+	if err != nil {
+		return nil, errors.Wrap(err, "read state history")
+	}
+	if n < 1 || n > len(history.Entries) {
+		return nil, errors.Errorf("no history entry %d, there are %d entries", n, len(history.Entries))
+	}
+	return &history.Entries[n-1], nil
+}
+
+// maybeSnapshot saves the currently stored state to history the first time state is written in a run,
+// so each run of ship can be rolled back as a unit
+func (m *MManager) maybeSnapshot(reason string, next []byte) error {
+	debug := level.Debug(log.With(m.Logger, "method", "maybeSnapshot"))
+	if m.snapshotTaken {
+		return nil
+	}
+
+	previous, err := m.readSerializedState()
+	if err != nil {
+		return errors.Wrap(err, "read current state")
+	}
+	if len(strings.TrimSpace(string(previous))) == 0 {
+		// nothing before this run to roll back to
+		m.snapshotTaken = true
+		return nil
+	}
+	if string(previous) == string(next) {
+		return nil
+	}
+
+	previousState, _, err := migrate(previous)
+	if err != nil {
+		// not something we can roll back to, so don't keep it
+		debug.Log("event", "snapshot.skip", "err", err)
+		return nil
+	}
+
+	entry := HistoryEntry{
+		Timestamp: time.Now().UTC(),
+		Reason:    reason,
+		State:     json.RawMessage(previous),
+	}
+	if command := m.V.GetString("command"); command != "" {
+		entry.Reason = fmt.Sprintf("%s (%s)", command, reason)
+	}
+	if previousState.V2 != nil {
+		entry.ContentSHA = previousState.V2.ContentSHA
+	}
+
+	history, err := m.readHistory()
+	if err != nil {
+		return errors.Wrap(err, "read state history")
+	}
+
+	limit := m.V.GetInt("state-history-limit")
+	if limit == 0 {
+		limit = DefaultHistoryLimit
+	}
+	history.Entries = append([]HistoryEntry{entry}, history.Entries...)
+	if limit > 0 && len(history.Entries) > limit {
+		history.Entries = history.Entries[:limit]
+	}
+
+	debug.Log("event", "snapshot", "reason", entry.Reason, "entries", len(history.Entries))
+	if err := m.writeHistory(history); err != nil {
+		return errors.Wrap(err, "write state history")
+	}
+
+	m.snapshotTaken = true
+	return nil
+}
+
+func (m *MManager) readSerializedState() ([]byte, error) {
+	backend, err := m.backend()
+	if err != nil {
+		return nil, err
+	}
+	return backend.Read(stateObject)
+}
+
+func (m *MManager) readHistory() (History, error) {
+	var history History
+
+	backend, err := m.backend()
+	if err != nil {
+		return history, err
+	}
+
+	serialized, err := backend.Read(historyObject)
+	if err != nil {
+		return history, err
+	}
+
+	if len(strings.TrimSpace(string(serialized))) == 0 {
+		return history, nil
+	}
+
+	if err := json.Unmarshal(serialized, &history); err != nil {
+		return history, errors.Wrap(err, "unmarshal state history")
+	}
+	return history, nil
+}
+
+func (m *MManager) writeHistory(history History) error {
+	serialized, err := json.MarshalIndent(history, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "serialize state history")
+	}
+
+	backend, err := m.backend()
+	if err != nil {
+		return err
+	}
+	return backend.Write(historyObject, serialized)
+}
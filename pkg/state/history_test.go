@@ -0,0 +1,103 @@
+package state
+
+import (
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/spf13/afero"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistory(t *testing.T) {
+	tests := []struct {
+		name        string
+		limit       int
+		runs        []string
+		wantHistory []string
+	}{
+		{
+			name:        "first run has no history",
+			runs:        []string{"abc"},
+			wantHistory: []string{},
+		},
+		{
+			name:        "each run keeps the state before it",
+			runs:        []string{"abc", "def", "ghi"},
+			wantHistory: []string{"def", "abc"},
+		},
+		{
+			name:        "unchanged state is not recorded",
+			runs:        []string{"abc", "abc", "def"},
+			wantHistory: []string{"abc"},
+		},
+		{
+			name:        "history is bounded",
+			limit:       2,
+			runs:        []string{"abc", "def", "ghi", "jkl"},
+			wantHistory: []string{"ghi", "def"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := require.New(t)
+			fs := afero.Afero{Fs: afero.NewMemMapFs()}
+			v := viper.New()
+			v.Set("state-history-limit", tt.limit)
+
+			for _, sha := range tt.runs {
+				// a fresh manager for each run, like separate invocations of ship
+				m := &MManager{Logger: log.NewNopLogger(), FS: fs, V: v}
+				req.NoError(m.SerializeContentSHA(sha))
+				// writes later in the same run don't add more history
+				req.NoError(m.SerializeReleaseName("release-" + sha))
+			}
+
+			m := &MManager{Logger: log.NewNopLogger(), FS: fs, V: v}
+			entries, err := m.History()
+			req.NoError(err)
+
+			shas := []string{}
+			for _, entry := range entries {
+				shas = append(shas, entry.ContentSHA)
+			}
+			req.Equal(tt.wantHistory, shas)
+		})
+	}
+}
+
+func TestRollback(t *testing.T) {
+	req := require.New(t)
+	fs := afero.Afero{Fs: afero.NewMemMapFs()}
+	v := viper.New()
+	v.Set("command", "ship update")
+
+	for _, sha := range []string{"abc", "def"} {
+		m := &MManager{Logger: log.NewNopLogger(), FS: fs, V: v}
+		req.NoError(m.SerializeContentSHA(sha))
+	}
+
+	m := &MManager{Logger: log.NewNopLogger(), FS: fs, V: v}
+	entries, err := m.History()
+	req.NoError(err)
+	req.Len(entries, 1)
+	req.Equal("ship update (content sha)", entries[0].Reason)
+
+	current, err := m.Snapshot(0)
+	req.NoError(err)
+	req.Contains(string(current), "def")
+
+	req.NoError(m.Rollback(1))
+
+	loaded, err := m.TryLoad()
+	req.NoError(err)
+	req.Equal("abc", loaded.Versioned().V2.ContentSHA)
+
+	// the state that was rolled back is kept, so the rollback can be undone
+	entries, err = m.History()
+	req.NoError(err)
+	req.Len(entries, 2)
+	req.Equal("def", entries[0].ContentSHA)
+
+	req.Error(m.Rollback(5))
+}
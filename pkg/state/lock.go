@@ -0,0 +1,167 @@
+package state
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+)
+
+// lockPollInterval is how often a held lock is retried while waiting out --lock-timeout
+const lockPollInterval = 1 * time.Second
+
+// LockHolder identifies the ship process holding the state lock
+type LockHolder struct {
+	PID     int       `json:"pid" yaml:"pid" hcl:"pid"`
+	Host    string    `json:"host" yaml:"host" hcl:"host"`
+	Command string    `json:"command,omitempty" yaml:"command,omitempty" hcl:"command,omitempty"`
+	Since   time.Time `json:"since" yaml:"since" hcl:"since"`
+}
+
+func (h LockHolder) String() string {
+	if h.PID == 0 {
+		return "an unknown process"
+	}
+	holder := fmt.Sprintf("pid %d on %s", h.PID, h.Host)
+	if h.Command != "" {
+		holder = fmt.Sprintf("%s (%s)", holder, h.Command)
+	}
+	if !h.Since.IsZero() {
+		holder = fmt.Sprintf("%s since %s", holder, h.Since.Local().Format(time.RFC3339))
+	}
+	return holder
+}
+
+func (h LockHolder) is(other LockHolder) bool {
+	return h.PID == other.PID && h.Host == other.Host
+}
+
+// LockedError is returned when another ship process holds the state lock
+type LockedError struct {
+	Holder LockHolder
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf(`state is locked by %s. If that run is no longer active, remove the lock with "ship state unlock --force"`, e.Holder)
+}
+
+// IsLocked returns true if err was caused by another process holding the state lock
+func IsLocked(err error) bool {
+	_, ok := errors.Cause(err).(*LockedError)
+	return ok
+}
+
+// Locker is implemented by backends that can keep concurrent ship runs from writing the same state
+type Locker interface {
+	// Lock takes the lock for holder, or returns a *LockedError naming the current holder
+	Lock(holder LockHolder) error
+	// Unlock releases the lock if it's still held by holder
+	Unlock(holder LockHolder) error
+	// ForceUnlock releases the lock regardless of who holds it, returning the previous holder if there was one
+	ForceUnlock() (*LockHolder, error)
+	// LockHolder returns the current holder of the lock, or nil if it isn't held
+	LockHolder() (*LockHolder, error)
+}
+
+func currentLockHolder(command string) LockHolder {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return LockHolder{
+		PID:     os.Getpid(),
+		Host:    host,
+		Command: command,
+		Since:   time.Now().UTC(),
+	}
+}
+
+// Lock takes the state lock for the rest of this run, waiting up to --lock-timeout for another run to release it.
+// Backends that don't support locking are left unlocked.
+func (m *MManager) Lock() error {
+	debug := level.Debug(log.With(m.Logger, "method", "Lock"))
+
+	locker, err := m.locker()
+	if err != nil || locker == nil {
+		return err
+	}
+
+	holder := currentLockHolder(m.V.GetString("command"))
+	deadline := time.Now().Add(m.V.GetDuration("lock-timeout"))
+	for {
+		err := locker.Lock(holder)
+		if err == nil {
+			debug.Log("event", "lock.acquired", "holder", holder)
+			m.lockHolder = &holder
+			return nil
+		}
+		if !IsLocked(err) || time.Now().Add(lockPollInterval).After(deadline) {
+			return errors.Wrap(err, "lock state")
+		}
+
+		debug.Log("event", "lock.wait", "err", err)
+		time.Sleep(lockPollInterval)
+	}
+}
+
+// Unlock releases the state lock if this run holds it
+func (m *MManager) Unlock() error {
+	if m.lockHolder == nil {
+		return nil
+	}
+
+	locker, err := m.locker()
+	if err != nil || locker == nil {
+		return err
+	}
+
+	if err := locker.Unlock(*m.lockHolder); err != nil {
+		return errors.Wrap(err, "unlock state")
+	}
+	level.Debug(log.With(m.Logger, "method", "Unlock")).Log("event", "lock.released")
+	m.lockHolder = nil
+	return nil
+}
+
+// ForceUnlock releases the state lock no matter which process holds it, returning the holder it was taken from
+func (m *MManager) ForceUnlock() (*LockHolder, error) {
+	locker, err := m.locker()
+	if err != nil {
+		return nil, err
+	}
+	if locker == nil {
+		return nil, errors.Errorf("state-from %q does not support locking", m.V.GetString("state-from"))
+	}
+
+	previous, err := locker.ForceUnlock()
+	if err != nil {
+		return nil, errors.Wrap(err, "force unlock state")
+	}
+	return previous, nil
+}
+
+// LockHolder returns the process currently holding the state lock, or nil if it isn't locked
+func (m *MManager) LockHolder() (*LockHolder, error) {
+	locker, err := m.locker()
+	if err != nil || locker == nil {
+		return nil, err
+	}
+	return locker.LockHolder()
+}
+
+func (m *MManager) locker() (Locker, error) {
+	backend, err := m.backend()
+	if err != nil {
+		return nil, err
+	}
+
+	locker, ok := backend.(Locker)
+	if !ok {
+		level.Debug(log.With(m.Logger, "method", "locker")).Log("event", "lock.unsupported", "stateFrom", m.V.GetString("state-from"))
+		return nil, nil
+	}
+	return locker, nil
+}
@@ -0,0 +1,104 @@
+package state
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/replicatedhq/ship/pkg/constants"
+	"github.com/spf13/afero"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileLock(t *testing.T) {
+	otherRun := LockHolder{PID: 4242, Host: "ci-runner-2", Command: "ship update", Since: time.Now()}
+	otherRunLock, err := json.Marshal(otherRun)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name        string
+		lockfile    []byte
+		lockTimeout time.Duration
+		releaseIn   time.Duration
+		wantErr     string
+	}{
+		{
+			name: "unlocked",
+		},
+		{
+			name:     "held by another run",
+			lockfile: otherRunLock,
+			wantErr:  "state is locked by pid 4242 on ci-runner-2 (ship update)",
+		},
+		{
+			name:        "released while waiting",
+			lockfile:    otherRunLock,
+			lockTimeout: 5 * time.Second,
+			releaseIn:   500 * time.Millisecond,
+		},
+		{
+			name:        "not released before the timeout",
+			lockfile:    otherRunLock,
+			lockTimeout: 1500 * time.Millisecond,
+			wantErr:     "state is locked by pid 4242",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := require.New(t)
+			fs := afero.Afero{Fs: afero.NewMemMapFs()}
+			v := viper.New()
+			v.Set("lock-timeout", tt.lockTimeout)
+
+			if tt.lockfile != nil {
+				req.NoError(fs.WriteFile(constants.StateLockPath, tt.lockfile, 0644))
+			}
+			if tt.releaseIn != 0 {
+				go func() {
+					time.Sleep(tt.releaseIn)
+					fs.Remove(constants.StateLockPath)
+				}()
+			}
+
+			m := &MManager{Logger: log.NewNopLogger(), FS: fs, V: v}
+			err := m.Lock()
+			if tt.wantErr != "" {
+				req.Error(err)
+				req.True(IsLocked(err))
+				req.Contains(err.Error(), tt.wantErr)
+				return
+			}
+			req.NoError(err)
+
+			holder, err := m.LockHolder()
+			req.NoError(err)
+			req.NotNil(holder)
+			req.Equal(currentLockHolder("").PID, holder.PID)
+
+			req.NoError(m.Unlock())
+			exists, err := fs.Exists(constants.StateLockPath)
+			req.NoError(err)
+			req.False(exists)
+		})
+	}
+}
+
+func TestForceUnlock(t *testing.T) {
+	req := require.New(t)
+	fs := afero.Afero{Fs: afero.NewMemMapFs()}
+	m := &MManager{Logger: log.NewNopLogger(), FS: fs, V: viper.New()}
+
+	backend := &FileBackend{Logger: log.NewNopLogger(), FS: fs}
+	crashed := LockHolder{PID: 4242, Host: "ci-runner-2"}
+	req.NoError(backend.Lock(crashed))
+	req.True(IsLocked(backend.Lock(LockHolder{PID: 1, Host: "ci-runner-1"})))
+
+	previous, err := m.ForceUnlock()
+	req.NoError(err)
+	req.Equal(&crashed, previous)
+
+	req.NoError(m.Lock())
+	req.NoError(m.Unlock())
+}
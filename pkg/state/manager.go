@@ -3,21 +3,19 @@ package state
 import (
 	"encoding/json"
 	"fmt"
-	"os"
-	"path/filepath"
 	"strings"
+	"sync"
 
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
 	"github.com/pkg/errors"
+	"github.com/replicatedhq/libyaml"
 	"github.com/replicatedhq/ship/pkg/api"
 	"github.com/replicatedhq/ship/pkg/constants"
 	"github.com/replicatedhq/ship/pkg/patch"
+	"github.com/replicatedhq/ship/pkg/util"
 	"github.com/spf13/afero"
 	"github.com/spf13/viper"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/rest"
 )
 
 type Manager interface {
@@ -26,17 +24,33 @@ type Manager interface {
 	SerializeConfig(
 		assets []api.Asset,
 		meta api.ReleaseMetadata,
+		configGroups []libyaml.ConfigGroup,
 		templateContext map[string]interface{},
 	) error
 	TryLoad() (State, error)
 	RemoveStateFile() error
 	SaveKustomize(kustomize *Kustomize) error
 	SerializeUpstream(URL string) error
+	SerializeUpstreamVersion(version string) error
+	SerializeUpstreamVerification(verification *Verification) error
+	SerializeNamedUpstreams(upstreams []NamedUpstream) error
+	SerializeNamedUpstreamHelmValues(name string, values string, defaults string) error
 	SerializeContentSHA(contentSHA string) error
 	SerializeShipMetadata(api.ShipAppMetadata, string) error
 	SerializeAppMetadata(api.ReleaseMetadata) error
 	Save(v VersionedState) error
 	ResetLifecycle() error
+	Rekey(newKey string) error
+	History() ([]HistoryEntry, error)
+	Snapshot(n int) ([]byte, error)
+	Rollback(n int) error
+	PlanMigration() (*Migration, error)
+	Migrate() (*Migration, error)
+	Lock() error
+	Unlock() error
+	ForceUnlock() (*LockHolder, error)
+	LockHolder() (*LockHolder, error)
+	UseScratch() error
 }
 
 var _ Manager = &MManager{}
@@ -47,10 +61,21 @@ type MManager struct {
 	FS      afero.Afero
 	V       *viper.Viper
 	Patcher patch.Patcher
+	// Backend overrides the backend selected with --state-from
+	Backend StateBackend
+
+	// key overrides the configured state key, used when rotating it
+	key string
+	// snapshotTaken is set once the state from before this run has been saved to history
+	snapshotTaken bool
+	// lockHolder is set while this run holds the state lock
+	lockHolder *LockHolder
+
+	backendMu sync.Mutex
 }
 
 func (m *MManager) Save(v VersionedState) error {
-	return m.serializeAndWriteState(v)
+	return m.serializeAndWriteState(v, "save")
 }
 
 func NewManager(
@@ -78,15 +103,22 @@ func (m *MManager) SerializeShipMetadata(metadata api.ShipAppMetadata, applicati
 	}
 
 	versionedState := current.Versioned()
-	versionedState.V1.Metadata = &Metadata{
+	var verification *Verification
+	if versionedState.V2.Metadata != nil {
+		// recorded separately, when the upstream is fetched
+		verification = versionedState.V2.Metadata.Verification
+	}
+	versionedState.V2.Metadata = &Metadata{
 		ApplicationType: applicationType,
 		ReleaseNotes:    metadata.ReleaseNotes,
 		Version:         metadata.Version,
+		AppVersion:      metadata.AppVersion,
 		Icon:            metadata.Icon,
 		Name:            metadata.Name,
+		Verification:    verification,
 	}
 
-	return m.serializeAndWriteState(versionedState)
+	return m.serializeAndWriteState(versionedState, "ship metadata")
 }
 
 // SerializeAppMetadata is used by `ship app` to serialize replicated app metadata to state file
@@ -100,7 +132,7 @@ func (m *MManager) SerializeAppMetadata(metadata api.ReleaseMetadata) error {
 	}
 
 	versionedState := current.Versioned()
-	versionedState.V1.Metadata = &Metadata{
+	versionedState.V2.Metadata = &Metadata{
 		ApplicationType: "replicated.app",
 		ReleaseNotes:    metadata.ReleaseNotes,
 		Version:         metadata.Semver,
@@ -108,7 +140,7 @@ func (m *MManager) SerializeAppMetadata(metadata api.ReleaseMetadata) error {
 		InstallationID:  metadata.InstallationID,
 	}
 
-	return m.serializeAndWriteState(versionedState)
+	return m.serializeAndWriteState(versionedState, "app metadata")
 }
 
 // SerializeUpstream is used by `ship init` to serialize a state file with ChartURL to disk
@@ -122,9 +154,92 @@ func (m *MManager) SerializeUpstream(upstream string) error {
 	debug.Log("event", "generateUpstreamURLState")
 
 	toSerialize := current.Versioned()
-	toSerialize.V1.Upstream = upstream
+	// credentials are supplied on each run with flags or environment variables, like --helm-repo-username, they're never stored
+	toSerialize.V2.Upstream = util.StripCredentials(upstream)
+
+	return m.serializeAndWriteState(toSerialize, "upstream")
+}
+
+// SerializeUpstreamVersion records the version the upstream resolved to
+func (m *MManager) SerializeUpstreamVersion(version string) error {
+	debug := level.Debug(log.With(m.Logger, "method", "SerializeUpstreamVersion"))
+
+	debug.Log("event", "tryLoadState")
+	currentState, err := m.TryLoad()
+	if err != nil {
+		return errors.Wrap(err, "try load state")
+	}
+	versionedState := currentState.Versioned()
+	versionedState.V2.UpstreamVersion = version
+
+	return m.serializeAndWriteState(versionedState, "upstream version")
+}
+
+// SerializeUpstreamVerification records how the upstream was verified when it was fetched,
+// clearing any earlier verification if verification is nil
+func (m *MManager) SerializeUpstreamVerification(verification *Verification) error {
+	debug := level.Debug(log.With(m.Logger, "method", "SerializeUpstreamVerification"))
+
+	debug.Log("event", "tryLoadState")
+	currentState, err := m.TryLoad()
+	if err != nil {
+		return errors.Wrap(err, "try load state")
+	}
+	versionedState := currentState.Versioned()
+	if versionedState.V2.Metadata == nil {
+		if verification == nil {
+			return nil
+		}
+		versionedState.V2.Metadata = &Metadata{}
+	}
+	versionedState.V2.Metadata.Verification = verification
+
+	return m.serializeAndWriteState(versionedState, "upstream verification")
+}
+
+// SerializeNamedUpstreams records the named upstreams an application is composed of, replacing any recorded before
+func (m *MManager) SerializeNamedUpstreams(upstreams []NamedUpstream) error {
+	debug := level.Debug(log.With(m.Logger, "method", "SerializeNamedUpstreams"))
+
+	debug.Log("event", "tryLoadState")
+	currentState, err := m.TryLoad()
+	if err != nil {
+		return errors.Wrap(err, "try load state")
+	}
+	versionedState := currentState.Versioned()
+
+	named := make([]NamedUpstream, 0, len(upstreams))
+	for _, upstream := range upstreams {
+		// credentials are supplied on each run with flags or environment variables, like --helm-repo-username, they're never stored
+		upstream.Upstream = util.StripCredentials(upstream.Upstream)
+		named = append(named, upstream)
+	}
+	versionedState.V2.Upstreams = named
+
+	return m.serializeAndWriteState(versionedState, "named upstreams")
+}
+
+// SerializeNamedUpstreamHelmValues saves the helm values of the named upstream called name
+func (m *MManager) SerializeNamedUpstreamHelmValues(name string, values string, defaults string) error {
+	debug := level.Debug(log.With(m.Logger, "method", "SerializeNamedUpstreamHelmValues"))
+
+	debug.Log("event", "tryLoadState")
+	currentState, err := m.TryLoad()
+	if err != nil {
+		return errors.Wrap(err, "try load state")
+	}
+	versionedState := currentState.Versioned()
 
-	return m.serializeAndWriteState(toSerialize)
+	for i, upstream := range versionedState.V2.Upstreams {
+		if upstream.Name != name {
+			continue
+		}
+		versionedState.V2.Upstreams[i].HelmValues = values
+		versionedState.V2.Upstreams[i].HelmValuesDefaults = defaults
+		return m.serializeAndWriteState(versionedState, "helm values for "+name)
+	}
+
+	return errors.Errorf("upstream %q not found in state", name)
 }
 
 // SerializeContentSHA writes the contentSHA to the state file
@@ -137,9 +252,9 @@ func (m *MManager) SerializeContentSHA(contentSHA string) error {
 		return errors.Wrap(err, "try load state")
 	}
 	versionedState := currentState.Versioned()
-	versionedState.V1.ContentSHA = contentSHA
+	versionedState.V2.ContentSHA = contentSHA
 
-	return m.serializeAndWriteState(versionedState)
+	return m.serializeAndWriteState(versionedState, "content sha")
 }
 
 // SerializeHelmValues takes user input helm values and serializes a state file to disk
@@ -152,10 +267,10 @@ func (m *MManager) SerializeHelmValues(values string, defaults string) error {
 		return errors.Wrap(err, "try load state")
 	}
 	versionedState := currentState.Versioned()
-	versionedState.V1.HelmValues = values
-	versionedState.V1.HelmValuesDefaults = defaults
+	versionedState.V2.HelmValues = values
+	versionedState.V2.HelmValuesDefaults = defaults
 
-	return m.serializeAndWriteState(versionedState)
+	return m.serializeAndWriteState(versionedState, "helm values")
 }
 
 // SerializeReleaseName serializes to disk the name to use for helm template
@@ -168,13 +283,14 @@ func (m *MManager) SerializeReleaseName(name string) error {
 		return errors.Wrap(err, "try load state")
 	}
 	versionedState := currentState.Versioned()
-	versionedState.V1.ReleaseName = name
+	versionedState.V2.ReleaseName = name
 
-	return m.serializeAndWriteState(versionedState)
+	return m.serializeAndWriteState(versionedState, "release name")
 }
 
-// SerializeConfig takes the application data and input params and serializes a state file to disk
-func (m *MManager) SerializeConfig(assets []api.Asset, meta api.ReleaseMetadata, templateContext map[string]interface{}) error {
+// SerializeConfig takes the application data and input params and serializes a state file to disk.
+// Values of password items in configGroups are encrypted at rest if a state key is configured.
+func (m *MManager) SerializeConfig(assets []api.Asset, meta api.ReleaseMetadata, configGroups []libyaml.ConfigGroup, templateContext map[string]interface{}) error {
 	debug := level.Debug(log.With(m.Logger, "method", "serializeConfig"))
 
 	debug.Log("event", "tryLoadState")
@@ -183,145 +299,191 @@ func (m *MManager) SerializeConfig(assets []api.Asset, meta api.ReleaseMetadata,
 		return errors.Wrap(err, "try load state")
 	}
 	versionedState := currentState.Versioned()
-	versionedState.V1.Config = templateContext
+	versionedState.V2.Config = templateContext
+	if sensitive := SensitiveConfigKeys(configGroups); len(sensitive) > 0 {
+		versionedState.V2.SensitiveConfig = sensitive
+	}
 
-	return m.serializeAndWriteState(versionedState)
+	return m.serializeAndWriteState(versionedState, "config")
 }
 
-// TryLoad will attempt to load a state file from disk, if present
+// TryLoad will attempt to load state from the backend selected with --state-from, if present
 func (m *MManager) TryLoad() (State, error) {
-	stateFrom := m.V.GetString("state-from")
-	if stateFrom == "" {
-		stateFrom = "file"
+	serialized, err := m.readSerializedState()
+	if err != nil {
+		return nil, errors.Wrap(err, "try load state")
 	}
 
-	// TODO consider an interface
+	loaded, err := m.deserializeState(serialized)
+	if err != nil {
+		return nil, err
+	}
 
-	switch stateFrom {
-	case "file":
-		return m.tryLoadFromFile()
-	case "secret":
-		return m.tryLoadFromSecret()
-	default:
-		err := fmt.Errorf("unsupported state-from value: %q", stateFrom)
-		return nil, errors.Wrap(err, "try load state")
+	if versioned, ok := loaded.(VersionedState); ok {
+		return m.decryptSensitive(versioned)
 	}
+	return loaded, nil
 }
 
-// ResetLifecycle is used by `ship update --headed` to reset the saved stepsCompleted
-// in the state.json
-func (m *MManager) ResetLifecycle() error {
-	debug := level.Debug(log.With(m.Logger, "method", "ResetLifecycle"))
-
-	debug.Log("event", "tryLoadState")
-	currentState, err := m.TryLoad()
+// LoadFile reads the state file at path, migrating it to the current schema as TryLoad does.
+// Sensitive values are left encrypted, so the state key isn't needed to read another app's upstreams.
+func LoadFile(fs afero.Afero, path string) (State, error) {
+	serialized, err := fs.ReadFile(path)
 	if err != nil {
-		return errors.Wrap(err, "try load state")
+		return nil, errors.Wrapf(err, "read state file %s", path)
+	}
+	if len(strings.TrimSpace(string(serialized))) == 0 {
+		return Empty{}, nil
 	}
-	versionedState := currentState.Versioned()
-	versionedState.V1.Lifecycle = nil
 
-	return m.serializeAndWriteState(versionedState)
+	loaded, _, err := migrate(serialized)
+	if err != nil {
+		return nil, errors.Wrapf(err, "load state file %s", path)
+	}
+	return loaded, nil
 }
 
-// tryLoadFromSecret will attempt to load the state from a secret
-// currently only supports in-cluster execution
-func (m *MManager) tryLoadFromSecret() (State, error) {
-	config, err := rest.InClusterConfig()
+// Rekey re-encrypts the sensitive config values in state, and in each history entry, with a new state key.
+// The current key is read from --state-key-file or SHIP_STATE_KEY as usual.
+func (m *MManager) Rekey(newKey string) error {
+	debug := level.Debug(log.With(m.Logger, "method", "Rekey"))
+
+	key, err := checkStateKey(newKey)
 	if err != nil {
-		return nil, errors.Wrap(err, "get in cluster config")
+		return errors.Wrap(err, "read new state key")
+	}
+	if key == "" {
+		return errors.New("new state key is empty")
 	}
 
-	clientset, err := kubernetes.NewForConfig(config)
+	debug.Log("event", "tryLoadState")
+	currentState, err := m.TryLoad()
 	if err != nil {
-		return nil, errors.Wrap(err, "get kubernetes client")
+		return errors.Wrap(err, "try load state")
 	}
+	versionedState := currentState.Versioned()
+	versionedState.V2.Encryption = nil
 
-	ns := m.V.GetString("secret-namespace")
-	if ns == "" {
-		return nil, errors.New("secret-namespace is not set")
+	oldKey, err := m.stateKey()
+	if err != nil {
+		return errors.Wrap(err, "load state key")
 	}
-	secretName := m.V.GetString("secret-name")
-	if secretName == "" {
-		return nil, errors.New("secret-name is not set")
+	history, err := m.readHistory()
+	if err != nil {
+		return errors.Wrap(err, "read state history")
 	}
-	secretKey := m.V.GetString("secret-key")
-	if secretKey == "" {
-		return nil, errors.New("secret-key is not set")
+	for i := range history.Entries {
+		rekeyed, err := rekeyHistoryEntry(history.Entries[i].State, oldKey, key)
+		if err != nil {
+			return errors.Wrapf(err, "rekey history entry %d", i+1)
+		}
+		history.Entries[i].State = rekeyed
 	}
 
-	secret, err := clientset.CoreV1().Secrets(ns).Get(secretName, metav1.GetOptions{})
-	if err != nil {
-		return nil, errors.Wrap(err, "get secret")
+	// the state being replaced only differs in its key, so there's nothing to roll back to
+	m.snapshotTaken = true
+	m.key = key
+	if err := m.serializeAndWriteState(versionedState, "rekey"); err != nil {
+		return err
 	}
 
-	serialized, ok := secret.Data[secretKey]
-	if !ok {
-		err := fmt.Errorf("key %q not found in secret %q", secretKey, secretName)
-		return nil, errors.Wrap(err, "get state from secret")
+	debug.Log("event", "history.rekey", "entries", len(history.Entries))
+	if err := m.writeHistory(history); err != nil {
+		return errors.Wrap(err, "write state history")
 	}
+	return nil
+}
 
-	// An empty secret should be treated as empty state
-	if len(strings.TrimSpace(string(serialized))) == 0 {
-		return Empty{}, nil
+// rekeyHistoryEntry re-encrypts the sensitive config values in serialized state from oldKey to newKey.
+// State without encrypted values is returned as-is.
+func rekeyHistoryEntry(serialized json.RawMessage, oldKey string, newKey string) (json.RawMessage, error) {
+	state, _, err := migrate(serialized)
+	if err != nil {
+		return nil, errors.Wrap(err, "load state")
 	}
-
-	// HACK -- try to deserialize it as VersionedState, otherwise, assume its a raw map of config values
-	var state VersionedState
-	if err := json.Unmarshal(serialized, &state); err != nil {
-		return nil, errors.Wrap(err, "unmarshal state")
+	if state.V2 == nil || state.V2.Encryption == nil {
+		return serialized, nil
+	}
+	if oldKey == "" {
+		return nil, errors.Errorf("state contains encrypted values, but no key was provided with --state-key-file or %s", StateKeyEnv)
 	}
 
-	level.Debug(m.Logger).Log(
-		"event", "state.unmarshal",
-		"type", "versioned",
-		"source", "secret",
-		"value", fmt.Sprintf("%+v", state),
-	)
+	state, err = decryptWith(oldKey, state)
+	if err != nil {
+		return nil, err
+	}
+	state.V2.Encryption = nil
+	state, err = encryptWith(newKey, state)
+	if err != nil {
+		return nil, err
+	}
 
-	if state.V1 != nil {
-		level.Debug(m.Logger).Log("event", "state.resolve", "type", "versioned")
-		return state, nil
+	rekeyed, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return nil, errors.Wrap(err, "serialize state")
 	}
+	return rekeyed, nil
+}
 
-	var mapState map[string]interface{}
-	if err := json.Unmarshal(serialized, &mapState); err != nil {
-		return nil, errors.Wrap(err, "unmarshal state")
+// ResetLifecycle is used by `ship update --headed` to reset the saved stepsCompleted
+// in the state.json
+func (m *MManager) ResetLifecycle() error {
+	debug := level.Debug(log.With(m.Logger, "method", "ResetLifecycle"))
+
+	debug.Log("event", "tryLoadState")
+	currentState, err := m.TryLoad()
+	if err != nil {
+		return errors.Wrap(err, "try load state")
 	}
+	versionedState := currentState.Versioned()
+	versionedState.V2.Lifecycle = nil
 
-	level.Debug(m.Logger).Log("event", "state.resolve", "type", "raw")
-	return V0(mapState), nil
+	return m.serializeAndWriteState(versionedState, "reset lifecycle")
 }
 
-func (m *MManager) tryLoadFromFile() (State, error) {
-	if _, err := m.FS.Stat(constants.StatePath); os.IsNotExist(err) {
-		level.Debug(m.Logger).Log("msg", "no saved state exists", "path", constants.StatePath)
+func (m *MManager) deserializeState(serialized []byte) (State, error) {
+	// An empty secret should be treated as empty state
+	if len(strings.TrimSpace(string(serialized))) == 0 {
 		return Empty{}, nil
 	}
 
-	serialized, err := m.FS.ReadFile(constants.StatePath)
+	state, migration, err := migrate(serialized)
 	if err != nil {
-		return nil, errors.Wrap(err, "read state file")
+		return nil, err
 	}
 
-	// HACK -- try to deserialize it as VersionedState, otherwise, assume its a raw map of config values
-	var state VersionedState
-	if err := json.Unmarshal(serialized, &state); err != nil {
-		return nil, errors.Wrap(err, "unmarshal state")
-	}
+	level.Debug(m.Logger).Log("event", "state.resolve", "from", migration.From, "to", migration.To)
+	return state, nil
+}
 
-	if state.V1 != nil {
-		level.Debug(m.Logger).Log("event", "state.resolve", "type", "versioned")
-		return state, nil
+// PlanMigration returns the migration that will be applied to the stored state, without writing anything.
+// It returns nil if there is no stored state.
+func (m *MManager) PlanMigration() (*Migration, error) {
+	serialized, err := m.readSerializedState()
+	if err != nil {
+		return nil, errors.Wrap(err, "read state")
+	}
+	if len(strings.TrimSpace(string(serialized))) == 0 {
+		return nil, nil
 	}
 
-	var mapState map[string]interface{}
-	if err := json.Unmarshal(serialized, &mapState); err != nil {
-		return nil, errors.Wrap(err, "unmarshal state")
+	_, migration, err := migrate(serialized)
+	return migration, err
+}
+
+// Migrate rewrites the stored state in the current schema. Sensitive values are migrated as stored,
+// so the state key isn't needed.
+func (m *MManager) Migrate() (*Migration, error) {
+	migration, err := m.PlanMigration()
+	if err != nil || migration == nil || !migration.Needed() {
+		return migration, err
 	}
 
-	level.Debug(m.Logger).Log("event", "state.resolve", "type", "raw")
-	return V0(mapState), nil
+	reason := fmt.Sprintf("migrate from v%d to v%d", migration.From, migration.To)
+	if err := m.writeSerializedState(migration.After, reason); err != nil {
+		return nil, err
+	}
+	return migration, nil
 }
 
 func (m *MManager) SaveKustomize(kustomize *Kustomize) error {
@@ -330,9 +492,9 @@ func (m *MManager) SaveKustomize(kustomize *Kustomize) error {
 		return errors.Wrapf(err, "load state")
 	}
 	versionedState := currentState.Versioned()
-	versionedState.V1.Kustomize = kustomize
+	versionedState.V2.Kustomize = kustomize.withEditedAgainst(versionedState.V2.Kustomize, versionedState.V2.ContentSHA)
 
-	if err := m.serializeAndWriteState(versionedState); err != nil {
+	if err := m.serializeAndWriteState(versionedState, "kustomize"); err != nil {
 		return errors.Wrap(err, "write state")
 	}
 
@@ -354,78 +516,81 @@ func (m *MManager) RemoveStateFile() error {
 	return nil
 }
 
-func (m *MManager) serializeAndWriteState(state VersionedState) error {
+// serializeAndWriteState writes state, first saving the state it replaces to history.
+// reason is recorded with the history entry.
+func (m *MManager) serializeAndWriteState(state VersionedState, reason string) error {
 	debug := level.Debug(log.With(m.Logger, "method", "serializeAndWriteState"))
-	state = state.migrateDeprecatedFields()
-
-	stateFrom := m.V.GetString("state-from")
-	if stateFrom == "" {
-		stateFrom = "file"
-	}
-
-	debug.Log("stateFrom", stateFrom)
-
-	switch stateFrom {
-	case "file":
-		return m.serializeAndWriteStateFile(state)
-	case "secret":
-		return m.serializeAndWriteStateSecret(state)
-	default:
-		err := fmt.Errorf("unsupported state-from value: %q", stateFrom)
-		return errors.Wrap(err, "serializeAndWriteState")
+	state, err := m.encryptSensitive(state)
+	if err != nil {
+		return errors.Wrap(err, "encrypt sensitive config")
 	}
-}
-
-func (m *MManager) serializeAndWriteStateFile(state VersionedState) error {
 
 	serialized, err := json.MarshalIndent(state, "", "  ")
 	if err != nil {
 		return errors.Wrap(err, "serialize state")
 	}
 
-	err = m.FS.MkdirAll(filepath.Dir(constants.StatePath), 0700)
-	if err != nil {
-		return errors.Wrap(err, "mkdir state")
-	}
-
-	err = m.FS.WriteFile(constants.StatePath, serialized, 0644)
-	if err != nil {
-		return errors.Wrap(err, "write state file")
-	}
-
-	return nil
+	debug.Log("event", "state.write", "stateFrom", m.V.GetString("state-from"))
+	return m.writeSerializedState(serialized, reason)
 }
 
-func (m *MManager) serializeAndWriteStateSecret(state VersionedState) error {
-	serialized, err := json.MarshalIndent(state, "", "  ")
-	if err != nil {
-		return errors.Wrap(err, "serialize state")
+func (m *MManager) writeSerializedState(serialized []byte, reason string) error {
+	if err := m.maybeSnapshot(reason, serialized); err != nil {
+		return errors.Wrap(err, "snapshot state")
 	}
 
-	config, err := rest.InClusterConfig()
+	backend, err := m.backend()
 	if err != nil {
-		return errors.Wrap(err, "get in cluster config")
+		return err
 	}
 
-	clientset, err := kubernetes.NewForConfig(config)
-	if err != nil {
-		return errors.Wrap(err, "get kubernetes client")
+	if err := backend.Write(stateObject, serialized); err != nil {
+		return errors.Wrap(err, "write state")
 	}
+	return nil
+}
 
-	secret, err := clientset.CoreV1().Secrets(m.V.GetString("secret-namespace")).Get(m.V.GetString("secret-name"), metav1.GetOptions{})
+// UseScratch copies the stored state and its history into memory, and reads and writes that copy from then on,
+// so that a run can save state as usual without changing the state it started from
+func (m *MManager) UseScratch() error {
+	backend, err := m.backend()
 	if err != nil {
-		return errors.Wrap(err, "get secret")
-	}
-
-	secret.Data[m.V.GetString("secret-key")] = serialized
-	debug := level.Debug(log.With(m.Logger, "method", "serializeHelmValues"))
+		return err
+	}
+
+	scratch := &MemoryBackend{}
+	for _, name := range []string{stateObject, historyObject} {
+		data, err := backend.Read(name)
+		if err != nil {
+			return errors.Wrapf(err, "read %s", name)
+		}
+		if data == nil {
+			continue
+		}
+		if err := scratch.Write(name, data); err != nil {
+			return errors.Wrapf(err, "copy %s", name)
+		}
+	}
+
+	m.backendMu.Lock()
+	defer m.backendMu.Unlock()
+	m.Backend = scratch
+	return nil
+}
 
-	debug.Log("event", "serializeAndWriteStateSecret", "name", secret.Name, "key", m.V.GetString("secret-key"))
+// backend returns Backend, creating the backend selected with --state-from the first time it's needed.
+// The same backend is kept for the whole run so it can track what it's locked and read.
+func (m *MManager) backend() (StateBackend, error) {
+	m.backendMu.Lock()
+	defer m.backendMu.Unlock()
 
-	_, err = clientset.CoreV1().Secrets(m.V.GetString("secret-namespace")).Update(secret)
+	if m.Backend != nil {
+		return m.Backend, nil
+	}
+	backend, err := NewBackend(m.Logger, m.FS, m.V)
 	if err != nil {
-		return errors.Wrap(err, "update secret")
+		return nil, errors.Wrap(err, "load state backend")
 	}
-
-	return nil
+	m.Backend = backend
+	return backend, nil
 }
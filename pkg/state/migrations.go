@@ -0,0 +1,187 @@
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// CurrentSchemaVersion is the schema version state is written in
+const CurrentSchemaVersion = 2
+
+// migration upgrades a stored state document from one schema version to the next
+type migration struct {
+	from        int
+	to          int
+	description string
+	migrate     func(document map[string]interface{}) (map[string]interface{}, error)
+}
+
+// migrations are applied in order, each one taking state from its from version to its to version.
+// To change the schema, add a schema for the new version in schema.go, a migration here,
+// and bump CurrentSchemaVersion.
+var migrations = []migration{
+	{
+		from:        0,
+		to:          1,
+		description: "move unversioned config values into v1.config",
+		migrate:     migrateV0ToV1,
+	},
+	{
+		from:        1,
+		to:          2,
+		description: "replace chartURL with upstream, record lifecycle.stepsCompleted as typed step progress and drop unknown top level fields",
+		migrate:     migrateV1ToV2,
+	},
+}
+
+// Migration describes how stored state is brought up to the current schema
+type Migration struct {
+	From int
+	To   int
+	// Applied describes each migration that was applied, in order
+	Applied []string
+	// Before is the state as it's stored, After is the state as it will be written
+	Before []byte
+	After  []byte
+}
+
+// Needed returns true if the stored state isn't already in the current schema
+func (m *Migration) Needed() bool {
+	return m.From != m.To
+}
+
+var versionKey = regexp.MustCompile(`^v([0-9]+)$`)
+
+// schemaVersion returns the version a state document was written in. Versioned state has a single top level
+// key naming its version, anything else is the original flat map of config values.
+func schemaVersion(document map[string]interface{}) (int, error) {
+	latest := 0
+	for key := range document {
+		match := versionKey.FindStringSubmatch(key)
+		if match == nil {
+			continue
+		}
+		version, err := strconv.Atoi(match[1])
+		if err != nil {
+			continue
+		}
+		if version > CurrentSchemaVersion {
+			return 0, errors.Errorf("state was written with schema v%d, but this version of ship only supports up to v%d, please upgrade ship", version, CurrentSchemaVersion)
+		}
+		if version > latest {
+			latest = version
+		}
+	}
+	return latest, nil
+}
+
+// migrate validates serialized state against the schema it was written in and migrates it to the current schema,
+// validating the result of each step
+func migrate(serialized []byte) (VersionedState, *Migration, error) {
+	var document map[string]interface{}
+	if err := json.Unmarshal(serialized, &document); err != nil {
+		return VersionedState{}, nil, errors.Wrap(err, "unmarshal state")
+	}
+	if document == nil {
+		document = map[string]interface{}{}
+	}
+
+	from, err := schemaVersion(document)
+	if err != nil {
+		return VersionedState{}, nil, err
+	}
+	if err := validateSchema(from, document); err != nil {
+		return VersionedState{}, nil, err
+	}
+
+	result := &Migration{From: from, To: from, Before: serialized}
+	for _, step := range migrations {
+		if step.from != result.To {
+			continue
+		}
+		document, err = step.migrate(document)
+		if err != nil {
+			return VersionedState{}, nil, errors.Wrapf(err, "migrate state from v%d to v%d", step.from, step.to)
+		}
+		if err := validateSchema(step.to, document); err != nil {
+			return VersionedState{}, nil, errors.Wrapf(err, "migrate state from v%d to v%d", step.from, step.to)
+		}
+		result.To = step.to
+		result.Applied = append(result.Applied, fmt.Sprintf("v%d to v%d: %s", step.from, step.to, step.description))
+	}
+	if result.To != CurrentSchemaVersion {
+		return VersionedState{}, nil, errors.Errorf("no migration from state v%d to v%d", result.To, CurrentSchemaVersion)
+	}
+
+	migrated, err := json.Marshal(document)
+	if err != nil {
+		return VersionedState{}, nil, errors.Wrap(err, "serialize migrated state")
+	}
+	var state VersionedState
+	if err := json.Unmarshal(migrated, &state); err != nil {
+		return VersionedState{}, nil, errors.Wrap(err, "unmarshal migrated state")
+	}
+
+	result.After, err = json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return VersionedState{}, nil, errors.Wrap(err, "serialize migrated state")
+	}
+	return state, result, nil
+}
+
+func migrateV0ToV1(document map[string]interface{}) (map[string]interface{}, error) {
+	return map[string]interface{}{
+		"v1": map[string]interface{}{
+			"config": document,
+		},
+	}, nil
+}
+
+// v1Fields are the v1 fields that carry over to v2 unchanged
+var v1Fields = []string{
+	"config",
+	"terraform",
+	"helmValues",
+	"releaseName",
+	"helmValuesDefaults",
+	"kustomize",
+	"upstream",
+	"metadata",
+	"sensitiveConfig",
+	"encryption",
+	"contentSHA",
+}
+
+func migrateV1ToV2(document map[string]interface{}) (map[string]interface{}, error) {
+	v1, _ := document["v1"].(map[string]interface{})
+	v2 := map[string]interface{}{}
+	for _, field := range v1Fields {
+		if value, ok := v1[field]; ok {
+			v2[field] = value
+		}
+	}
+
+	// chartURL was deprecated in favor of upstream, ChartRepoURL and ChartVersion were never read
+	if upstream, _ := v2["upstream"].(string); upstream == "" {
+		if chartURL, _ := v1["chartURL"].(string); chartURL != "" {
+			v2["upstream"] = chartURL
+		}
+	}
+
+	if lifecycle, ok := v1["lifecycle"].(map[string]interface{}); ok {
+		steps := map[string]interface{}{}
+		if stepsCompleted, ok := lifecycle["stepsCompleted"].(map[string]interface{}); ok {
+			// any step present in stepsCompleted was complete, whatever its value
+			for stepID := range stepsCompleted {
+				steps[stepID] = map[string]interface{}{"status": string(StepCompleted)}
+			}
+		}
+		v2["lifecycle"] = map[string]interface{}{"steps": steps}
+	}
+
+	return map[string]interface{}{"v2": v2}, nil
+}
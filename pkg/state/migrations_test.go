@@ -0,0 +1,186 @@
+package state
+
+import (
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/replicatedhq/ship/pkg/constants"
+	"github.com/spf13/afero"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrate(t *testing.T) {
+	tests := []struct {
+		name        string
+		stored      string
+		wantFrom    int
+		wantApplied int
+		want        VersionedState
+		wantErr     string
+	}{
+		{
+			name:        "v0 config values",
+			stored:      `{"foo": "bar"}`,
+			wantFrom:    0,
+			wantApplied: 2,
+			want: VersionedState{V2: &V2{
+				Config: map[string]interface{}{"foo": "bar"},
+			}},
+		},
+		{
+			name: "v1 with deprecated fields and completed steps",
+			stored: `{"v1": {
+  "config": {},
+  "chartURL": "github.com/helm/charts/stable/nginx",
+  "ChartRepoURL": "https://kubernetes-charts.storage.googleapis.com",
+  "lifecycle": {"stepsCompleted": {"intro": true, "values": null}},
+  "kustomize": {"overlays": {"ship": {"patches": {"/deployment.yaml": "kind: Deployment"}}}},
+  "somethingUnknown": "dropped"
+}}`,
+			wantFrom:    1,
+			wantApplied: 1,
+			want: VersionedState{V2: &V2{
+				Config:   map[string]interface{}{},
+				Upstream: "github.com/helm/charts/stable/nginx",
+				Lifecycle: &Lifecycle{Steps: map[string]StepProgress{
+					"intro":  {Status: StepCompleted},
+					"values": {Status: StepCompleted},
+				}},
+				Kustomize: &Kustomize{Overlays: map[string]Overlay{
+					"ship": {Patches: map[string]string{"/deployment.yaml": "kind: Deployment"}},
+				}},
+			}},
+		},
+		{
+			name: "v1 upstream wins over chartURL",
+			stored: `{"v1": {
+  "upstream": "github.com/replicatedhq/test-charts/basic",
+  "chartURL": "github.com/helm/charts/stable/nginx"
+}}`,
+			wantFrom:    1,
+			wantApplied: 1,
+			want: VersionedState{V2: &V2{
+				Upstream: "github.com/replicatedhq/test-charts/basic",
+			}},
+		},
+		{
+			name:     "v2",
+			stored:   `{"v2": {"config": {"foo": "bar"}, "lifecycle": {"steps": {"intro": {"status": "completed"}}}}}`,
+			wantFrom: 2,
+			want: VersionedState{V2: &V2{
+				Config:    map[string]interface{}{"foo": "bar"},
+				Lifecycle: &Lifecycle{Steps: map[string]StepProgress{"intro": {Status: StepCompleted}}},
+			}},
+		},
+		{
+			name:     "v2 chart metadata",
+			stored:   `{"v2": {"metadata": {"name": "nginx", "version": "1.2.0", "appVersion": "1.15"}}}`,
+			wantFrom: 2,
+			want: VersionedState{V2: &V2{
+				Metadata: &Metadata{Name: "nginx", Version: "1.2.0", AppVersion: "1.15"},
+			}},
+		},
+		{
+			name: "v1 with unknown nested fields",
+			stored: `{"v1": {
+  "metadata": {"name": "nginx", "sequence": 4},
+  "kustomize": {"overlays": {"ship": {"patches": {"/deployment.yaml": "kind: Deployment"}, "excludedBases": ["/service.yaml"]}}},
+  "terraform": {"rawState": "", "serial": 2}
+}}`,
+			wantFrom:    1,
+			wantApplied: 1,
+			want: VersionedState{V2: &V2{
+				Metadata: &Metadata{Name: "nginx"},
+				Kustomize: &Kustomize{Overlays: map[string]Overlay{
+					"ship": {Patches: map[string]string{"/deployment.yaml": "kind: Deployment"}},
+				}},
+				Terraform: &Terraform{},
+			}},
+		},
+		{
+			name:     "v2 with an unknown field",
+			stored:   `{"v2": {"config": {}, "installedBy": "ship 0.60.0"}}`,
+			wantFrom: 2,
+			want: VersionedState{V2: &V2{
+				Config: map[string]interface{}{},
+			}},
+		},
+		{
+			name:    "v1 with the wrong type",
+			stored:  `{"v1": {"helmValues": {"replicaCount": 2}}}`,
+			wantErr: "v1.helmValues: Invalid type. Expected: string, given: object",
+		},
+		{
+			name:    "v2 with a missing step status",
+			stored:  `{"v2": {"lifecycle": {"steps": {"intro": {}}}}}`,
+			wantErr: "v2.lifecycle.steps.intro: status is required",
+		},
+		{
+			name:    "newer schema",
+			stored:  `{"v3": {}}`,
+			wantErr: "state was written with schema v3",
+		},
+		{
+			name:    "not an object",
+			stored:  `["foo"]`,
+			wantErr: "unmarshal state",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := require.New(t)
+
+			state, migration, err := migrate([]byte(tt.stored))
+			if tt.wantErr != "" {
+				req.Error(err)
+				req.Contains(err.Error(), tt.wantErr)
+				return
+			}
+			req.NoError(err)
+
+			req.Equal(tt.wantFrom, migration.From)
+			req.Equal(CurrentSchemaVersion, migration.To)
+			req.Len(migration.Applied, tt.wantApplied)
+			req.Equal(tt.want, state)
+
+			// migrated state loads as is
+			reloaded, again, err := migrate(migration.After)
+			req.NoError(err)
+			req.False(again.Needed())
+			req.Equal(tt.want, reloaded)
+		})
+	}
+}
+
+func TestMManagerMigrate(t *testing.T) {
+	req := require.New(t)
+	fs := afero.Afero{Fs: afero.NewMemMapFs()}
+	m := &MManager{Logger: log.NewNopLogger(), FS: fs, V: viper.New()}
+
+	stored := `{"v1": {"config": {}, "contentSHA": "abc"}}`
+	req.NoError(fs.WriteFile(constants.StatePath, []byte(stored), 0644))
+
+	planned, err := m.PlanMigration()
+	req.NoError(err)
+	req.True(planned.Needed())
+	unchanged, err := fs.ReadFile(constants.StatePath)
+	req.NoError(err)
+	req.Equal(stored, string(unchanged))
+
+	migrated, err := m.Migrate()
+	req.NoError(err)
+	req.Equal(1, migrated.From)
+	written, err := fs.ReadFile(constants.StatePath)
+	req.NoError(err)
+	req.Equal(string(migrated.After), string(written))
+
+	history, err := m.History()
+	req.NoError(err)
+	req.Len(history, 1)
+	req.JSONEq(stored, string(history[0].State))
+
+	again, err := m.Migrate()
+	req.NoError(err)
+	req.False(again.Needed())
+}
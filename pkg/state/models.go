@@ -1,8 +1,7 @@
 package state
 
 import (
-	"bytes"
-	"fmt"
+	"sort"
 
 	"github.com/hashicorp/terraform/terraform"
 	"github.com/replicatedhq/ship/pkg/api"
@@ -12,7 +11,7 @@ import (
 type State interface {
 	CurrentConfig() map[string]interface{}
 	CurrentKustomize() *Kustomize
-	CurrentKustomizeOverlay(filename string) (string, bool)
+	CurrentKustomizeOverlay(overlay string, filename string) (string, bool)
 	CurrentHelmValues() string
 	CurrentHelmValuesDefaults() string
 	CurrentReleaseName() string
@@ -23,41 +22,30 @@ type State interface {
 
 var _ State = VersionedState{}
 var _ State = Empty{}
-var _ State = V0{}
 
 type Empty struct{}
 
-func (Empty) CurrentKustomize() *Kustomize                  { return nil }
-func (Empty) CurrentKustomizeOverlay(string) (string, bool) { return "", false }
-func (Empty) CurrentConfig() map[string]interface{}         { return make(map[string]interface{}) }
-func (Empty) CurrentHelmValues() string                     { return "" }
-func (Empty) CurrentHelmValuesDefaults() string             { return "" }
-func (Empty) CurrentReleaseName() string                    { return "" }
-func (Empty) Upstream() string                              { return "" }
-func (Empty) Versioned() VersionedState                     { return VersionedState{V1: &V1{}} }
-func (Empty) IsEmpty() bool                                 { return true }
-
-type V0 map[string]interface{}
-
-func (v V0) CurrentConfig() map[string]interface{}         { return v }
-func (v V0) CurrentKustomize() *Kustomize                  { return nil }
-func (v V0) CurrentKustomizeOverlay(string) (string, bool) { return "", false }
-func (v V0) CurrentHelmValues() string                     { return "" }
-func (v V0) CurrentHelmValuesDefaults() string             { return "" }
-func (v V0) CurrentReleaseName() string                    { return "" }
-func (v V0) Upstream() string                              { return "" }
-func (v V0) Versioned() VersionedState                     { return VersionedState{V1: &V1{Config: v}} }
-func (v V0) IsEmpty() bool                                 { return false }
-
+func (Empty) CurrentKustomize() *Kustomize                          { return nil }
+func (Empty) CurrentKustomizeOverlay(string, string) (string, bool) { return "", false }
+func (Empty) CurrentConfig() map[string]interface{}                 { return make(map[string]interface{}) }
+func (Empty) CurrentHelmValues() string                             { return "" }
+func (Empty) CurrentHelmValuesDefaults() string                     { return "" }
+func (Empty) CurrentReleaseName() string                            { return "" }
+func (Empty) Upstream() string                                      { return "" }
+func (Empty) Versioned() VersionedState                             { return VersionedState{V2: &V2{}} }
+func (Empty) IsEmpty() bool                                         { return true }
+
+// VersionedState is the stored state, keyed by the schema version it's written in.
+// State written with an older schema is migrated to the current one when it's loaded, see migrations.go.
 type VersionedState struct {
-	V1 *V1 `json:"v1,omitempty" yaml:"v1,omitempty" hcl:"v1,omitempty"`
+	V2 *V2 `json:"v2,omitempty" yaml:"v2,omitempty" hcl:"v2,omitempty"`
 }
 
 func (v VersionedState) IsEmpty() bool {
 	return false
 }
 
-type V1 struct {
+type V2 struct {
 	Config             map[string]interface{} `json:"config" yaml:"config" hcl:"config"`
 	Terraform          *Terraform             `json:"terraform,omitempty" yaml:"terraform,omitempty" hcl:"terraform,omitempty"`
 	HelmValues         string                 `json:"helmValues,omitempty" yaml:"helmValues,omitempty" hcl:"helmValues,omitempty"`
@@ -66,12 +54,40 @@ type V1 struct {
 	Kustomize          *Kustomize             `json:"kustomize,omitempty" yaml:"kustomize,omitempty" hcl:"kustomize,omitempty"`
 	Upstream           string                 `json:"upstream,omitempty" yaml:"upstream,omitempty" hcl:"upstream,omitempty"`
 	Metadata           *Metadata              `json:"metadata" yaml:"metadata" hcl:"metadata"`
-	//deprecated in favor of upstream
-	ChartURL     string    `json:"chartURL,omitempty" yaml:"chartURL,omitempty" hcl:"chartURL,omitempty"`
-	ChartRepoURL string    `json:"ChartRepoURL,omitempty" yaml:"ChartRepoURL,omitempty" hcl:"ChartRepoURL,omitempty"`
-	ChartVersion string    `json:"ChartVersion,omitempty" yaml:"ChartVersion,omitempty" hcl:"ChartVersion,omitempty"`
-	ContentSHA   string    `json:"contentSHA,omitempty" yaml:"contentSHA,omitempty" hcl:"contentSHA,omitempty"`
-	Lifecycle    *Lifeycle `json:"lifecycle,omitempty" yaml:"lifecycle,omitempty" hcl:"lifecycle,omitempty"`
+	SensitiveConfig    []string               `json:"sensitiveConfig,omitempty" yaml:"sensitiveConfig,omitempty" hcl:"sensitiveConfig,omitempty"`
+	Encryption         *Encryption            `json:"encryption,omitempty" yaml:"encryption,omitempty" hcl:"encryption,omitempty"`
+	ContentSHA         string                 `json:"contentSHA,omitempty" yaml:"contentSHA,omitempty" hcl:"contentSHA,omitempty"`
+	Lifecycle          *Lifecycle             `json:"lifecycle,omitempty" yaml:"lifecycle,omitempty" hcl:"lifecycle,omitempty"`
+	// UpstreamVersion is the version the upstream resolved to when it was last fetched,
+	// for upstreams like helm repository charts that track a version constraint
+	UpstreamVersion string `json:"upstreamVersion,omitempty" yaml:"upstreamVersion,omitempty" hcl:"upstreamVersion,omitempty"`
+	// Upstreams are set instead of Upstream for an application composed of several named upstreams
+	Upstreams []NamedUpstream `json:"upstreams,omitempty" yaml:"upstreams,omitempty" hcl:"upstreams,omitempty"`
+}
+
+// NamedUpstream is one of the upstreams an application is composed of, rendered into base/<name>.
+// Each is fetched and versioned on its own, and keeps its own helm values.
+type NamedUpstream struct {
+	Name               string    `json:"name" yaml:"name" hcl:"name"`
+	Upstream           string    `json:"upstream" yaml:"upstream" hcl:"upstream"`
+	ContentSHA         string    `json:"contentSHA,omitempty" yaml:"contentSHA,omitempty" hcl:"contentSHA,omitempty"`
+	UpstreamVersion    string    `json:"upstreamVersion,omitempty" yaml:"upstreamVersion,omitempty" hcl:"upstreamVersion,omitempty"`
+	HelmValues         string    `json:"helmValues,omitempty" yaml:"helmValues,omitempty" hcl:"helmValues,omitempty"`
+	HelmValuesDefaults string    `json:"helmValuesDefaults,omitempty" yaml:"helmValuesDefaults,omitempty" hcl:"helmValuesDefaults,omitempty"`
+	Metadata           *Metadata `json:"metadata,omitempty" yaml:"metadata,omitempty" hcl:"metadata,omitempty"`
+}
+
+// UpstreamNamed returns the named upstream called name
+func (v *V2) UpstreamNamed(name string) (NamedUpstream, bool) {
+	if v == nil {
+		return NamedUpstream{}, false
+	}
+	for _, upstream := range v.Upstreams {
+		if upstream.Name == name {
+			return upstream, true
+		}
+	}
+	return NamedUpstream{}, false
 }
 
 type Metadata struct {
@@ -80,34 +96,75 @@ type Metadata struct {
 	Name            string `json:"name,omitempty" yaml:"name,omitempty" hcl:"name,omitempty"`
 	ReleaseNotes    string `json:"releaseNotes" yaml:"releaseNotes" hcl:"releaseNotes"`
 	Version         string `json:"version" yaml:"version" hcl:"version"`
+	AppVersion      string `json:"appVersion,omitempty" yaml:"appVersion,omitempty" hcl:"appVersion,omitempty"`
 	CustomerID      string `json:"customerID,omitempty" yaml:"customerID,omitempty" hcl:"customerID,omitempty"`
 	InstallationID  string `json:"installationID,omitempty" yaml:"installationID,omitempty" hcl:"installationID,omitempty"`
+	// Verification is how the upstream was verified when it was last fetched, if verification was asked for
+	Verification *Verification `json:"verification,omitempty" yaml:"verification,omitempty" hcl:"verification,omitempty"`
 }
 
-type StepsCompleted map[string]interface{}
+// Verification records the check an upstream passed, and who signed it for signature checks
+type Verification struct {
+	// Method is the check that was made, like helm-provenance, signed-tag, signed-commit or sha256
+	Method string `json:"method" yaml:"method" hcl:"method"`
+	// Digest identifies the verified contents, like a chart's sha256 or a commit SHA
+	Digest      string `json:"digest,omitempty" yaml:"digest,omitempty" hcl:"digest,omitempty"`
+	Signer      string `json:"signer,omitempty" yaml:"signer,omitempty" hcl:"signer,omitempty"`
+	Fingerprint string `json:"fingerprint,omitempty" yaml:"fingerprint,omitempty" hcl:"fingerprint,omitempty"`
+}
 
-func (s StepsCompleted) String() string {
-	acc := new(bytes.Buffer)
-	for key := range s {
-		fmt.Fprintf(acc, "%s;", key)
-	}
-	return acc.String()
+// StepStatus is how far a lifecycle step has progressed
+type StepStatus string
 
+const (
+	// StepCompleted is the status of a step that has finished successfully
+	StepCompleted StepStatus = "completed"
+)
+
+// StepProgress is the saved progress of a single lifecycle step
+type StepProgress struct {
+	Status StepStatus `json:"status" yaml:"status" hcl:"status"`
 }
 
-type Lifeycle struct {
-	StepsCompleted StepsCompleted `json:"stepsCompleted,omitempty" yaml:"stepsCompleted,omitempty" hcl:"stepsCompleted,omitempty"`
+// Lifecycle is the saved progress through the lifecycle, keyed by step ID
+type Lifecycle struct {
+	Steps map[string]StepProgress `json:"steps,omitempty" yaml:"steps,omitempty" hcl:"steps,omitempty"`
 }
 
-func (l *Lifeycle) WithCompletedStep(step api.Step) *Lifeycle {
-	updated := &Lifeycle{StepsCompleted: map[string]interface{}{}}
-	if l != nil && l.StepsCompleted != nil {
-		updated.StepsCompleted = l.StepsCompleted
+// IsCompleted returns true if the step with stepID has been completed
+func (l *Lifecycle) IsCompleted(stepID string) bool {
+	if l == nil {
+		return false
 	}
+	progress, ok := l.Steps[stepID]
+	return ok && progress.Status == StepCompleted
+}
 
-	updated.StepsCompleted[step.Shared().ID] = true
+// CompletedSteps returns the sorted IDs of all completed steps
+func (l *Lifecycle) CompletedSteps() []string {
+	if l == nil {
+		return nil
+	}
+
+	var completed []string
+	for id, progress := range l.Steps {
+		if progress.Status == StepCompleted {
+			completed = append(completed, id)
+		}
+	}
+	sort.Strings(completed)
+	return completed
+}
+
+func (l *Lifecycle) WithCompletedStep(step api.Step) *Lifecycle {
+	updated := &Lifecycle{Steps: map[string]StepProgress{}}
+	if l != nil && l.Steps != nil {
+		updated.Steps = l.Steps
+	}
+
+	updated.Steps[step.Shared().ID] = StepProgress{Status: StepCompleted}
 	for _, nowInvalid := range step.Shared().Invalidates {
-		delete(updated.StepsCompleted, nowInvalid)
+		delete(updated.Steps, nowInvalid)
 	}
 	return updated
 }
@@ -116,6 +173,15 @@ type Overlay struct {
 	Patches           map[string]string `json:"patches,omitempty" yaml:"patches,omitempty" hcl:"patches,omitempty"`
 	Resources         map[string]string `json:"resources,omitempty" yaml:"resources,omitempty" hcl:"resources,omitempty"`
 	KustomizationYAML string            `json:"kustomization_yaml,omitempty" yaml:"kustomization_yaml,omitempty" hcl:"kustomization_yaml,omitempty"`
+	Metadata          *OverlayMetadata  `json:"metadata,omitempty" yaml:"metadata,omitempty" hcl:"metadata,omitempty"`
+}
+
+// OverlayMetadata records where an overlay came from and what it was last edited against
+type OverlayMetadata struct {
+	// AdoptedFrom is the directory the overlay was adopted from with `ship init --adopt-overlay`
+	AdoptedFrom string `json:"adoptedFrom,omitempty" yaml:"adoptedFrom,omitempty" hcl:"adoptedFrom,omitempty"`
+	// ContentSHA is the upstream content SHA the overlay was last changed against
+	ContentSHA string `json:"contentSHA,omitempty" yaml:"contentSHA,omitempty" hcl:"contentSHA,omitempty"`
 }
 
 func NewOverlay() Overlay {
@@ -125,38 +191,107 @@ func NewOverlay() Overlay {
 	}
 }
 
+// ShipOverlay is the name of the overlay that sits directly on top of the base.
+// Any other named overlay is an environment overlay, layered on top of this one.
+const ShipOverlay = "ship"
+
 type Kustomize struct {
 	Overlays map[string]Overlay `json:"overlays,omitempty" yaml:"overlays,omitempty" hcl:"overlays,omitempty"`
 }
 
 func (k *Kustomize) Ship() Overlay {
+	return k.Overlay(ShipOverlay)
+}
+
+// Overlay returns the named overlay, or an empty one if it has not been saved yet
+func (k *Kustomize) Overlay(name string) Overlay {
 	if k.Overlays == nil {
 		return NewOverlay()
 	}
-	if ship, ok := k.Overlays["ship"]; ok {
-		return ship
+	if overlay, ok := k.Overlays[name]; ok {
+		return overlay
 	}
 
 	return NewOverlay()
 }
 
+// withEditedAgainst returns k with the ContentSHA metadata of each overlay that differs from previous set to contentSHA
+func (k *Kustomize) withEditedAgainst(previous *Kustomize, contentSHA string) *Kustomize {
+	if k == nil {
+		return nil
+	}
+
+	for name, overlay := range k.Overlays {
+		var before Overlay
+		if previous != nil {
+			before = previous.Overlays[name]
+		}
+		if overlay.sameContents(before) {
+			continue
+		}
+
+		metadata := OverlayMetadata{}
+		if overlay.Metadata != nil {
+			metadata = *overlay.Metadata
+		}
+		metadata.ContentSHA = contentSHA
+		overlay.Metadata = &metadata
+		k.Overlays[name] = overlay
+	}
+	return k
+}
+
+func (o Overlay) sameContents(other Overlay) bool {
+	return o.KustomizationYAML == other.KustomizationYAML &&
+		sameFiles(o.Patches, other.Patches) &&
+		sameFiles(o.Resources, other.Resources)
+}
+
+func sameFiles(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name, contents := range a {
+		if other, ok := b[name]; !ok || other != contents {
+			return false
+		}
+	}
+	return true
+}
+
+// EnvironmentOverlays returns the sorted names of all overlays other than the ship overlay
+func (k *Kustomize) EnvironmentOverlays() []string {
+	if k == nil {
+		return nil
+	}
+
+	var names []string
+	for name := range k.Overlays {
+		if name != ShipOverlay {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
 func (v VersionedState) CurrentKustomize() *Kustomize {
-	if v.V1 != nil {
-		return v.V1.Kustomize
+	if v.V2 != nil {
+		return v.V2.Kustomize
 	}
 	return nil
 }
 
-func (v VersionedState) CurrentKustomizeOverlay(filename string) (contents string, isResource bool) {
-	if v.V1.Kustomize == nil {
+func (v VersionedState) CurrentKustomizeOverlay(overlayName string, filename string) (contents string, isResource bool) {
+	if v.V2.Kustomize == nil {
 		return
 	}
 
-	if v.V1.Kustomize.Overlays == nil {
+	if v.V2.Kustomize.Overlays == nil {
 		return
 	}
 
-	overlay, ok := v.V1.Kustomize.Overlays["ship"]
+	overlay, ok := v.V2.Kustomize.Overlays[overlayName]
 	if !ok {
 		return
 	}
@@ -183,39 +318,36 @@ type Terraform struct {
 }
 
 func (v VersionedState) CurrentConfig() map[string]interface{} {
-	if v.V1 != nil && v.V1.Config != nil {
-		return v.V1.Config
+	if v.V2 != nil && v.V2.Config != nil {
+		return v.V2.Config
 	}
 	return make(map[string]interface{})
 }
 
 func (v VersionedState) CurrentHelmValues() string {
-	if v.V1 != nil {
-		return v.V1.HelmValues
+	if v.V2 != nil {
+		return v.V2.HelmValues
 	}
 	return ""
 }
 
 func (v VersionedState) CurrentHelmValuesDefaults() string {
-	if v.V1 != nil {
-		return v.V1.HelmValuesDefaults
+	if v.V2 != nil {
+		return v.V2.HelmValuesDefaults
 	}
 	return ""
 }
 
 func (v VersionedState) CurrentReleaseName() string {
-	if v.V1 != nil {
-		return v.V1.ReleaseName
+	if v.V2 != nil {
+		return v.V2.ReleaseName
 	}
 	return ""
 }
 
 func (v VersionedState) Upstream() string {
-	if v.V1 != nil {
-		if v.V1.Upstream != "" {
-			return v.V1.Upstream
-		}
-		return v.V1.ChartURL
+	if v.V2 != nil {
+		return v.V2.Upstream
 	}
 	return ""
 }
@@ -225,14 +357,6 @@ func (v VersionedState) Versioned() VersionedState {
 }
 
 func (v VersionedState) WithCompletedStep(step api.Step) VersionedState {
-	v.V1.Lifecycle = v.V1.Lifecycle.WithCompletedStep(step)
-	return v
-}
-
-func (v VersionedState) migrateDeprecatedFields() VersionedState {
-	if v.V1 != nil {
-		v.V1.Upstream = v.Upstream()
-		v.V1.ChartURL = ""
-	}
+	v.V2.Lifecycle = v.V2.Lifecycle.WithCompletedStep(step)
 	return v
 }
@@ -0,0 +1,244 @@
+package state
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// schemas are the JSON Schemas for each version of stored state.
+// State is validated against the schema for its version when it's loaded, and again after each migration,
+// so a corrupted or hand-edited state file fails with an error pointing at the bad field
+// instead of being silently half-read. Schemas only check required fields and types: unknown fields are
+// allowed, so that adding a field to state doesn't stop older state, or state written by a newer ship, from loading.
+var schemas = map[int]string{
+	0: schemaV0,
+	1: schemaV1,
+	2: schemaV2,
+}
+
+// schemaV0 is the original unversioned state, a flat map of config values
+const schemaV0 = `{
+  "type": "object"
+}`
+
+const schemaV1 = `{
+  "type": "object",
+  "required": ["v1"],
+  "properties": {
+    "v1": {
+      "type": "object",
+      "properties": {
+        "config": {"type": ["object", "null"]},
+        "terraform": {
+          "type": ["object", "null"],
+          "properties": {
+            "rawState": {"type": "string"},
+            "state": {"type": ["object", "null"]}
+          }
+        },
+        "helmValues": {"type": "string"},
+        "releaseName": {"type": "string"},
+        "helmValuesDefaults": {"type": "string"},
+        "kustomize": {
+          "type": ["object", "null"],
+          "properties": {
+            "overlays": {
+              "type": ["object", "null"],
+              "additionalProperties": {
+                "type": "object",
+                "properties": {
+                  "patches": {"type": ["object", "null"], "additionalProperties": {"type": "string"}},
+                  "resources": {"type": ["object", "null"], "additionalProperties": {"type": "string"}},
+                  "kustomization_yaml": {"type": "string"}
+                }
+              }
+            }
+          }
+        },
+        "upstream": {"type": "string"},
+        "metadata": {"type": ["object", "null"]},
+        "sensitiveConfig": {"type": ["array", "null"], "items": {"type": "string"}},
+        "encryption": {
+          "type": ["object", "null"],
+          "required": ["dataKey"],
+          "properties": {
+            "dataKey": {"type": "string"}
+          }
+        },
+        "chartURL": {"type": "string"},
+        "ChartRepoURL": {"type": "string"},
+        "ChartVersion": {"type": "string"},
+        "contentSHA": {"type": "string"},
+        "lifecycle": {
+          "type": ["object", "null"],
+          "properties": {
+            "stepsCompleted": {"type": ["object", "null"]}
+          }
+        }
+      }
+    }
+  }
+}`
+
+const schemaV2 = `{
+  "type": "object",
+  "required": ["v2"],
+  "properties": {
+    "v2": {
+      "type": "object",
+      "properties": {
+        "config": {"type": ["object", "null"]},
+        "terraform": {
+          "type": ["object", "null"],
+          "properties": {
+            "rawState": {"type": "string"},
+            "state": {"type": ["object", "null"]}
+          }
+        },
+        "helmValues": {"type": "string"},
+        "releaseName": {"type": "string"},
+        "helmValuesDefaults": {"type": "string"},
+        "kustomize": {
+          "type": ["object", "null"],
+          "properties": {
+            "overlays": {
+              "type": ["object", "null"],
+              "additionalProperties": {
+                "type": "object",
+                "properties": {
+                  "patches": {"type": ["object", "null"], "additionalProperties": {"type": "string"}},
+                  "resources": {"type": ["object", "null"], "additionalProperties": {"type": "string"}},
+                  "kustomization_yaml": {"type": "string"},
+                  "metadata": {
+                    "type": ["object", "null"],
+                    "properties": {
+                      "adoptedFrom": {"type": "string"},
+                      "contentSHA": {"type": "string"}
+                    }
+                  }
+                }
+              }
+            }
+          }
+        },
+        "upstream": {"type": "string"},
+        "upstreamVersion": {"type": "string"},
+        "metadata": {
+          "type": ["object", "null"],
+          "properties": {
+            "applicationType": {"type": "string"},
+            "icon": {"type": "string"},
+            "name": {"type": "string"},
+            "releaseNotes": {"type": "string"},
+            "version": {"type": "string"},
+            "appVersion": {"type": "string"},
+            "customerID": {"type": "string"},
+            "installationID": {"type": "string"},
+            "verification": {
+              "type": ["object", "null"],
+              "required": ["method"],
+              "properties": {
+                "method": {"type": "string"},
+                "digest": {"type": "string"},
+                "signer": {"type": "string"},
+                "fingerprint": {"type": "string"}
+              }
+            }
+          }
+        },
+        "upstreams": {
+          "type": ["array", "null"],
+          "items": {
+            "type": "object",
+            "required": ["name", "upstream"],
+            "properties": {
+              "name": {"type": "string"},
+              "upstream": {"type": "string"},
+              "contentSHA": {"type": "string"},
+              "upstreamVersion": {"type": "string"},
+              "helmValues": {"type": "string"},
+              "helmValuesDefaults": {"type": "string"},
+              "metadata": {
+                "type": ["object", "null"],
+                "properties": {
+                  "applicationType": {"type": "string"},
+                  "icon": {"type": "string"},
+                  "name": {"type": "string"},
+                  "releaseNotes": {"type": "string"},
+                  "version": {"type": "string"},
+                  "appVersion": {"type": "string"},
+                  "customerID": {"type": "string"},
+                  "installationID": {"type": "string"},
+                  "verification": {
+                    "type": ["object", "null"],
+                    "required": ["method"],
+                    "properties": {
+                      "method": {"type": "string"},
+                      "digest": {"type": "string"},
+                      "signer": {"type": "string"},
+                      "fingerprint": {"type": "string"}
+                    }
+                  }
+                }
+              }
+            }
+          }
+        },
+        "sensitiveConfig": {"type": ["array", "null"], "items": {"type": "string"}},
+        "encryption": {
+          "type": ["object", "null"],
+          "required": ["dataKey", "salt"],
+          "properties": {
+            "dataKey": {"type": "string"},
+            "salt": {"type": "string"}
+          }
+        },
+        "contentSHA": {"type": "string"},
+        "lifecycle": {
+          "type": ["object", "null"],
+          "properties": {
+            "steps": {
+              "type": ["object", "null"],
+              "additionalProperties": {
+                "type": "object",
+                "required": ["status"],
+                "properties": {
+                  "status": {"type": "string"}
+                }
+              }
+            }
+          }
+        }
+      }
+    }
+  }
+}`
+
+// validateSchema checks document against the schema for version
+func validateSchema(version int, document interface{}) error {
+	raw, ok := schemas[version]
+	if !ok {
+		return errors.Errorf("no schema for state v%d", version)
+	}
+
+	schema, err := gojsonschema.NewSchema(gojsonschema.NewStringLoader(raw))
+	if err != nil {
+		return errors.Wrapf(err, "parse schema for state v%d", version)
+	}
+	result, err := schema.Validate(gojsonschema.NewGoLoader(document))
+	if err != nil {
+		return errors.Wrapf(err, "validate state v%d", version)
+	}
+	if result.Valid() {
+		return nil
+	}
+
+	var problems []string
+	for _, resultError := range result.Errors() {
+		problems = append(problems, fmt.Sprintf("%s: %s", resultError.Field(), resultError.Description()))
+	}
+	return errors.Errorf("state does not match schema v%d: %s", version, strings.Join(problems, "; "))
+}
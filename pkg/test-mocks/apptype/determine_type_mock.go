@@ -47,3 +47,17 @@ func (m *MockInspector) DetermineApplicationType(arg0 context.Context, arg1 stri
 func (mr *MockInspectorMockRecorder) DetermineApplicationType(arg0, arg1 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DetermineApplicationType", reflect.TypeOf((*MockInspector)(nil).DetermineApplicationType), arg0, arg1)
 }
+
+// DetermineApplicationTypeAt mocks base method
+func (m *MockInspector) DetermineApplicationTypeAt(arg0 context.Context, arg1, arg2 string) (string, string, error) {
+	ret := m.ctrl.Call(m, "DetermineApplicationTypeAt", arg0, arg1, arg2)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(string)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// DetermineApplicationTypeAt indicates an expected call of DetermineApplicationTypeAt
+func (mr *MockInspectorMockRecorder) DetermineApplicationTypeAt(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DetermineApplicationTypeAt", reflect.TypeOf((*MockInspector)(nil).DetermineApplicationTypeAt), arg0, arg1, arg2)
+}
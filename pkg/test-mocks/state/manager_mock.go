@@ -8,6 +8,7 @@ import (
 	reflect "reflect"
 
 	gomock "github.com/golang/mock/gomock"
+	libyaml "github.com/replicatedhq/libyaml"
 	api "github.com/replicatedhq/ship/pkg/api"
 	state "github.com/replicatedhq/ship/pkg/state"
 )
@@ -35,6 +36,95 @@ func (m *MockManager) EXPECT() *MockManagerMockRecorder {
 	return m.recorder
 }
 
+// ForceUnlock mocks base method
+func (m *MockManager) ForceUnlock() (*state.LockHolder, error) {
+	ret := m.ctrl.Call(m, "ForceUnlock")
+	ret0, _ := ret[0].(*state.LockHolder)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ForceUnlock indicates an expected call of ForceUnlock
+func (mr *MockManagerMockRecorder) ForceUnlock() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ForceUnlock", reflect.TypeOf((*MockManager)(nil).ForceUnlock))
+}
+
+// History mocks base method
+func (m *MockManager) History() ([]state.HistoryEntry, error) {
+	ret := m.ctrl.Call(m, "History")
+	ret0, _ := ret[0].([]state.HistoryEntry)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// History indicates an expected call of History
+func (mr *MockManagerMockRecorder) History() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "History", reflect.TypeOf((*MockManager)(nil).History))
+}
+
+// Lock mocks base method
+func (m *MockManager) Lock() error {
+	ret := m.ctrl.Call(m, "Lock")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Lock indicates an expected call of Lock
+func (mr *MockManagerMockRecorder) Lock() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Lock", reflect.TypeOf((*MockManager)(nil).Lock))
+}
+
+// LockHolder mocks base method
+func (m *MockManager) LockHolder() (*state.LockHolder, error) {
+	ret := m.ctrl.Call(m, "LockHolder")
+	ret0, _ := ret[0].(*state.LockHolder)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// LockHolder indicates an expected call of LockHolder
+func (mr *MockManagerMockRecorder) LockHolder() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LockHolder", reflect.TypeOf((*MockManager)(nil).LockHolder))
+}
+
+// Migrate mocks base method
+func (m *MockManager) Migrate() (*state.Migration, error) {
+	ret := m.ctrl.Call(m, "Migrate")
+	ret0, _ := ret[0].(*state.Migration)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Migrate indicates an expected call of Migrate
+func (mr *MockManagerMockRecorder) Migrate() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Migrate", reflect.TypeOf((*MockManager)(nil).Migrate))
+}
+
+// PlanMigration mocks base method
+func (m *MockManager) PlanMigration() (*state.Migration, error) {
+	ret := m.ctrl.Call(m, "PlanMigration")
+	ret0, _ := ret[0].(*state.Migration)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PlanMigration indicates an expected call of PlanMigration
+func (mr *MockManagerMockRecorder) PlanMigration() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PlanMigration", reflect.TypeOf((*MockManager)(nil).PlanMigration))
+}
+
+// Rekey mocks base method
+func (m *MockManager) Rekey(arg0 string) error {
+	ret := m.ctrl.Call(m, "Rekey", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Rekey indicates an expected call of Rekey
+func (mr *MockManagerMockRecorder) Rekey(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Rekey", reflect.TypeOf((*MockManager)(nil).Rekey), arg0)
+}
+
 // RemoveStateFile mocks base method
 func (m *MockManager) RemoveStateFile() error {
 	ret := m.ctrl.Call(m, "RemoveStateFile")
@@ -59,6 +149,18 @@ func (mr *MockManagerMockRecorder) ResetLifecycle() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ResetLifecycle", reflect.TypeOf((*MockManager)(nil).ResetLifecycle))
 }
 
+// Rollback mocks base method
+func (m *MockManager) Rollback(arg0 int) error {
+	ret := m.ctrl.Call(m, "Rollback", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Rollback indicates an expected call of Rollback
+func (mr *MockManagerMockRecorder) Rollback(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Rollback", reflect.TypeOf((*MockManager)(nil).Rollback), arg0)
+}
+
 // Save mocks base method
 func (m *MockManager) Save(arg0 state.VersionedState) error {
 	ret := m.ctrl.Call(m, "Save", arg0)
@@ -96,15 +198,15 @@ func (mr *MockManagerMockRecorder) SerializeAppMetadata(arg0 interface{}) *gomoc
 }
 
 // SerializeConfig mocks base method
-func (m *MockManager) SerializeConfig(arg0 []api.Asset, arg1 api.ReleaseMetadata, arg2 map[string]interface{}) error {
-	ret := m.ctrl.Call(m, "SerializeConfig", arg0, arg1, arg2)
+func (m *MockManager) SerializeConfig(arg0 []api.Asset, arg1 api.ReleaseMetadata, arg2 []libyaml.ConfigGroup, arg3 map[string]interface{}) error {
+	ret := m.ctrl.Call(m, "SerializeConfig", arg0, arg1, arg2, arg3)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // SerializeConfig indicates an expected call of SerializeConfig
-func (mr *MockManagerMockRecorder) SerializeConfig(arg0, arg1, arg2 interface{}) *gomock.Call {
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SerializeConfig", reflect.TypeOf((*MockManager)(nil).SerializeConfig), arg0, arg1, arg2)
+func (mr *MockManagerMockRecorder) SerializeConfig(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SerializeConfig", reflect.TypeOf((*MockManager)(nil).SerializeConfig), arg0, arg1, arg2, arg3)
 }
 
 // SerializeContentSHA mocks base method
@@ -131,6 +233,30 @@ func (mr *MockManagerMockRecorder) SerializeHelmValues(arg0, arg1 interface{}) *
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SerializeHelmValues", reflect.TypeOf((*MockManager)(nil).SerializeHelmValues), arg0, arg1)
 }
 
+// SerializeNamedUpstreamHelmValues mocks base method
+func (m *MockManager) SerializeNamedUpstreamHelmValues(arg0, arg1, arg2 string) error {
+	ret := m.ctrl.Call(m, "SerializeNamedUpstreamHelmValues", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SerializeNamedUpstreamHelmValues indicates an expected call of SerializeNamedUpstreamHelmValues
+func (mr *MockManagerMockRecorder) SerializeNamedUpstreamHelmValues(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SerializeNamedUpstreamHelmValues", reflect.TypeOf((*MockManager)(nil).SerializeNamedUpstreamHelmValues), arg0, arg1, arg2)
+}
+
+// SerializeNamedUpstreams mocks base method
+func (m *MockManager) SerializeNamedUpstreams(arg0 []state.NamedUpstream) error {
+	ret := m.ctrl.Call(m, "SerializeNamedUpstreams", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SerializeNamedUpstreams indicates an expected call of SerializeNamedUpstreams
+func (mr *MockManagerMockRecorder) SerializeNamedUpstreams(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SerializeNamedUpstreams", reflect.TypeOf((*MockManager)(nil).SerializeNamedUpstreams), arg0)
+}
+
 // SerializeReleaseName mocks base method
 func (m *MockManager) SerializeReleaseName(arg0 string) error {
 	ret := m.ctrl.Call(m, "SerializeReleaseName", arg0)
@@ -167,6 +293,43 @@ func (mr *MockManagerMockRecorder) SerializeUpstream(arg0 interface{}) *gomock.C
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SerializeUpstream", reflect.TypeOf((*MockManager)(nil).SerializeUpstream), arg0)
 }
 
+// SerializeUpstreamVerification mocks base method
+func (m *MockManager) SerializeUpstreamVerification(arg0 *state.Verification) error {
+	ret := m.ctrl.Call(m, "SerializeUpstreamVerification", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SerializeUpstreamVerification indicates an expected call of SerializeUpstreamVerification
+func (mr *MockManagerMockRecorder) SerializeUpstreamVerification(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SerializeUpstreamVerification", reflect.TypeOf((*MockManager)(nil).SerializeUpstreamVerification), arg0)
+}
+
+// SerializeUpstreamVersion mocks base method
+func (m *MockManager) SerializeUpstreamVersion(arg0 string) error {
+	ret := m.ctrl.Call(m, "SerializeUpstreamVersion", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SerializeUpstreamVersion indicates an expected call of SerializeUpstreamVersion
+func (mr *MockManagerMockRecorder) SerializeUpstreamVersion(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SerializeUpstreamVersion", reflect.TypeOf((*MockManager)(nil).SerializeUpstreamVersion), arg0)
+}
+
+// Snapshot mocks base method
+func (m *MockManager) Snapshot(arg0 int) ([]byte, error) {
+	ret := m.ctrl.Call(m, "Snapshot", arg0)
+	ret0, _ := ret[0].([]byte)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Snapshot indicates an expected call of Snapshot
+func (mr *MockManagerMockRecorder) Snapshot(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Snapshot", reflect.TypeOf((*MockManager)(nil).Snapshot), arg0)
+}
+
 // TryLoad mocks base method
 func (m *MockManager) TryLoad() (state.State, error) {
 	ret := m.ctrl.Call(m, "TryLoad")
@@ -179,3 +342,27 @@ func (m *MockManager) TryLoad() (state.State, error) {
 func (mr *MockManagerMockRecorder) TryLoad() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TryLoad", reflect.TypeOf((*MockManager)(nil).TryLoad))
 }
+
+// Unlock mocks base method
+func (m *MockManager) Unlock() error {
+	ret := m.ctrl.Call(m, "Unlock")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Unlock indicates an expected call of Unlock
+func (mr *MockManagerMockRecorder) Unlock() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Unlock", reflect.TypeOf((*MockManager)(nil).Unlock))
+}
+
+// UseScratch mocks base method
+func (m *MockManager) UseScratch() error {
+	ret := m.ctrl.Call(m, "UseScratch")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UseScratch indicates an expected call of UseScratch
+func (mr *MockManagerMockRecorder) UseScratch() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UseScratch", reflect.TypeOf((*MockManager)(nil).UseScratch))
+}
@@ -13,6 +13,10 @@ func FromViper(v *viper.Viper) cli.Ui {
 		Writer:      os.Stdout,
 		ErrorWriter: os.Stderr,
 	}
+	if v.GetString("output") == "json" {
+		// stdout is kept for the json, so everything else goes to stderr
+		base.Writer = os.Stderr
+	}
 
 	if !isInteractive() && !v.GetBool("force-color") {
 		return base
@@ -0,0 +1,85 @@
+package util
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/afero"
+)
+
+// ExtractRepoArchive extracts the files under basePath in a gzipped tarball of a git repository to dest.
+// Repository hosts put everything in a single top level directory named for the repo and ref, which is dropped.
+// If basePath is a single file, it's extracted to dest/<basePath>. It returns false if nothing was under basePath.
+func ExtractRepoArchive(fs afero.Afero, archive io.Reader, basePath, dest string) (bool, error) {
+	uncompressedStream, err := gzip.NewReader(archive)
+	if err != nil {
+		return false, errors.Wrapf(err, "create uncompressed stream")
+	}
+
+	tarReader := tar.NewReader(uncompressedStream)
+
+	basePathFound := false
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return basePathFound, nil
+		}
+		if err != nil {
+			return basePathFound, errors.Wrapf(err, "extract tar gz, next()")
+		}
+
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		// need this in a func because defer in a loop was leaking handles
+		err = func() error {
+			fileName := path.Clean(strings.Join(strings.Split(header.Name, "/")[1:], "/"))
+			if fileName == ".." || strings.HasPrefix(fileName, "../") || path.IsAbs(fileName) {
+				return errors.Errorf("extract tar gz, %s is outside of the archive", header.Name)
+			}
+			fileName, ok := underBasePath(fileName, basePath)
+			if !ok {
+				return nil
+			}
+			basePathFound = true
+
+			dirPath, _ := path.Split(fileName)
+			if err := fs.MkdirAll(filepath.Join(dest, dirPath), 0755); err != nil {
+				return errors.Wrapf(err, "extract tar gz, mkdir")
+			}
+			outFile, err := fs.Create(filepath.Join(dest, fileName))
+			if err != nil {
+				return errors.Wrapf(err, "extract tar gz, create")
+			}
+			defer outFile.Close()
+			if _, err := io.Copy(outFile, tarReader); err != nil {
+				return errors.Wrapf(err, "extract tar gz, copy")
+			}
+			return nil
+		}()
+		if err != nil {
+			return basePathFound, err
+		}
+	}
+}
+
+// underBasePath returns where under dest fileName is extracted to, and false if it isn't basePath or under it
+func underBasePath(fileName, basePath string) (string, bool) {
+	if fileName == "." {
+		return "", false
+	}
+	base := strings.Trim(path.Clean("/"+basePath), "/")
+	switch {
+	case base == "" || fileName == base:
+		return fileName, true
+	case strings.HasPrefix(fileName, base+"/"):
+		return strings.TrimPrefix(fileName, base+"/"), true
+	}
+	return "", false
+}
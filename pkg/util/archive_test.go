@@ -0,0 +1,112 @@
+package util
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExtractRepoArchive(t *testing.T) {
+	tests := []struct {
+		name        string
+		entries     []string
+		basePath    string
+		expectFound bool
+		expectFiles []string
+		expectGone  []string
+		expectErr   string
+	}{
+		{
+			name:        "whole repo",
+			entries:     []string{"repo-master/README.md", "repo-master/charts/nginx/Chart.yaml"},
+			expectFound: true,
+			expectFiles: []string{"README.md", "charts/nginx/Chart.yaml"},
+		},
+		{
+			name: "dir matched on a path boundary",
+			entries: []string{
+				"repo-master/charts/nginx/Chart.yaml",
+				"repo-master/charts/nginx-ingress/Chart.yaml",
+				"repo-master/charts/nginx-ingress/values.yaml",
+			},
+			basePath:    "charts/nginx",
+			expectFound: true,
+			expectFiles: []string{"Chart.yaml"},
+			expectGone:  []string{"values.yaml", "-ingress/Chart.yaml"},
+		},
+		{
+			name:        "single file",
+			entries:     []string{"repo-master/charts/nginx/Chart.yaml", "repo-master/charts/nginx/Chart.yaml.orig"},
+			basePath:    "charts/nginx/Chart.yaml",
+			expectFound: true,
+			expectFiles: []string{"charts/nginx/Chart.yaml"},
+			expectGone:  []string{"charts/nginx/Chart.yaml.orig"},
+		},
+		{
+			name:     "nothing under base path",
+			entries:  []string{"repo-master/charts/nginx-ingress/Chart.yaml"},
+			basePath: "charts/nginx",
+		},
+		{
+			name:      "entry outside of the archive",
+			entries:   []string{"repo-master/charts/../../../etc/cron.d/evil"},
+			expectErr: "is outside of the archive",
+		},
+		{
+			name:      "absolute entry",
+			entries:   []string{"repo-master//etc/cron.d/evil"},
+			expectErr: "is outside of the archive",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := require.New(t)
+			fs := afero.Afero{Fs: afero.NewMemMapFs()}
+
+			found, err := ExtractRepoArchive(fs, repoArchive(t, tt.entries), tt.basePath, "/dest")
+			if tt.expectErr != "" {
+				req.Error(err)
+				req.Contains(err.Error(), tt.expectErr)
+				exists, err := fs.Exists("/etc/cron.d/evil")
+				req.NoError(err)
+				req.False(exists)
+				return
+			}
+			req.NoError(err)
+			req.Equal(tt.expectFound, found)
+
+			for _, name := range tt.expectFiles {
+				contents, err := fs.ReadFile(filepath.Join("/dest", name))
+				req.NoError(err, name)
+				req.True(strings.HasSuffix(string(contents), name), name)
+			}
+			for _, name := range tt.expectGone {
+				exists, err := fs.Exists(filepath.Join("/dest", name))
+				req.NoError(err)
+				req.False(exists, name)
+			}
+		})
+	}
+}
+
+// repoArchive builds a gzipped tarball like the ones repository hosts serve, each file containing its own name
+func repoArchive(t *testing.T, names []string) *bytes.Buffer {
+	var archive bytes.Buffer
+	gzipWriter := gzip.NewWriter(&archive)
+	tarWriter := tar.NewWriter(gzipWriter)
+	for _, name := range names {
+		err := tarWriter.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(name)), Typeflag: tar.TypeReg})
+		require.NoError(t, err)
+		_, err = tarWriter.Write([]byte(name))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tarWriter.Close())
+	require.NoError(t, gzipWriter.Close())
+	return &archive
+}
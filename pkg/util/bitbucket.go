@@ -0,0 +1,47 @@
+package util
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/pkg/errors"
+)
+
+type BitbucketURL struct {
+	Owner  string
+	Repo   string
+	Ref    string
+	Subdir string
+}
+
+var bitbucketSrcRegex = regexp.MustCompile(`^[htps:/]*[w.]*bitbucket\.org/([^/?=]+)/([^/?=]+)/src/([^/?=]+)/?([^?=]*)$`)
+var bitbucketRegex = regexp.MustCompile(`^[htps:/]*[w.]*bitbucket\.org/([^/?=]+)/([^/?=]+)(/([^?=]*))?$`)
+
+// ParseBitbucketURL parses a link to a Bitbucket Cloud repo, like bitbucket.org/OWNER/REPO/src/REF/SUBDIR
+// or bitbucket.org/OWNER/REPO/SUBDIR. Bitbucket links to files and directories the same way.
+func ParseBitbucketURL(url string, defaultRef string) (BitbucketURL, error) {
+	var parsed BitbucketURL
+	if matches := bitbucketSrcRegex.FindStringSubmatch(url); matches != nil && len(matches) == 5 {
+		parsed.Owner = matches[1]
+		parsed.Repo = matches[2]
+		parsed.Ref = matches[3]
+		parsed.Subdir = matches[4]
+	} else if matches = bitbucketRegex.FindStringSubmatch(url); matches != nil && len(matches) == 5 {
+		parsed.Owner = matches[1]
+		parsed.Repo = matches[2]
+		parsed.Ref = defaultRef
+		parsed.Subdir = matches[4]
+	}
+
+	if parsed.Owner == "" {
+		return BitbucketURL{}, errors.New(fmt.Sprintf("Unable to parse %q as a bitbucket url", url))
+	}
+
+	return parsed, nil
+}
+
+// IsBitbucketURL returns true if this parses as a link to a Bitbucket Cloud repo
+func IsBitbucketURL(url string) bool {
+	_, err := ParseBitbucketURL(url, "")
+	return err == nil
+}
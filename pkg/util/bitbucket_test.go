@@ -0,0 +1,61 @@
+package util
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseBitbucketURL(t *testing.T) {
+	tests := []struct {
+		name    string
+		url     string
+		want    BitbucketURL
+		wantErr bool
+	}{
+		{
+			name: "repo",
+			url:  "bitbucket.org/replicatedhq/charts",
+			want: BitbucketURL{Owner: "replicatedhq", Repo: "charts", Ref: "master"},
+		},
+		{
+			name: "repo with subdir",
+			url:  "https://bitbucket.org/replicatedhq/charts/stable/nginx",
+			want: BitbucketURL{Owner: "replicatedhq", Repo: "charts", Ref: "master", Subdir: "stable/nginx"},
+		},
+		{
+			name: "src",
+			url:  "https://bitbucket.org/replicatedhq/charts/src/v1.2.0/stable/nginx",
+			want: BitbucketURL{Owner: "replicatedhq", Repo: "charts", Ref: "v1.2.0", Subdir: "stable/nginx"},
+		},
+		{
+			name: "src file",
+			url:  "bitbucket.org/replicatedhq/charts/src/abcdef123456/plain-k8s/deployment.yaml",
+			want: BitbucketURL{Owner: "replicatedhq", Repo: "charts", Ref: "abcdef123456", Subdir: "plain-k8s/deployment.yaml"},
+		},
+		{
+			name:    "go-getter url",
+			url:     "bitbucket.org/replicatedhq/charts?ref=master",
+			wantErr: true,
+		},
+		{
+			name:    "github",
+			url:     "github.com/replicatedhq/ship",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := require.New(t)
+			got, err := ParseBitbucketURL(tt.url, "master")
+			if tt.wantErr {
+				req.Error(err)
+				req.False(IsBitbucketURL(tt.url))
+				return
+			}
+			req.NoError(err)
+			req.Equal(tt.want, got)
+			req.True(IsBitbucketURL(tt.url))
+		})
+	}
+}
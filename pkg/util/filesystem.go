@@ -82,3 +82,40 @@ func BailIfPresent(fs afero.Afero, basePath string, logger log.Logger) error {
 	level.Debug(logger).Log("method", "BailIfPresent", "event", "target.present", "path", basePath)
 	return warnings.WarnShouldMoveDirectory(basePath)
 }
+
+// HelmHookFiles finds the files rendered for a helm hook event under hooksPath, in the order they're applied. Hooks
+// are in hooksPath/<event>, or hooksPath/<chart>/<event> for each chart of an application composed of several.
+func HelmHookFiles(fs afero.Afero, hooksPath string, event string) ([]string, error) {
+	eventDirs := []string{filepath.Join(hooksPath, event)}
+	if exists, err := fs.DirExists(hooksPath); err != nil || !exists {
+		return nil, errors.Wrapf(err, "check for %s", hooksPath)
+	}
+	entries, err := fs.ReadDir(hooksPath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "read %s", hooksPath)
+	}
+	for _, entry := range entries {
+		if entry.IsDir() && entry.Name() != event {
+			eventDirs = append(eventDirs, filepath.Join(hooksPath, entry.Name(), event))
+		}
+	}
+
+	var hookFiles []string
+	for _, eventDir := range eventDirs {
+		if exists, err := fs.DirExists(eventDir); err != nil {
+			return nil, errors.Wrapf(err, "check for %s", eventDir)
+		} else if !exists {
+			continue
+		}
+		files, err := fs.ReadDir(eventDir)
+		if err != nil {
+			return nil, errors.Wrapf(err, "read %s", eventDir)
+		}
+		for _, file := range files {
+			if ext := filepath.Ext(file.Name()); !file.IsDir() && (ext == ".yaml" || ext == ".yml") {
+				hookFiles = append(hookFiles, filepath.Join(eventDir, file.Name()))
+			}
+		}
+	}
+	return hookFiles, nil
+}
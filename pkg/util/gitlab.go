@@ -0,0 +1,78 @@
+package util
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// GitlabHost is the host of gitlab.com, self-hosted instances are passed to ParseGitlabURL
+const GitlabHost = "gitlab.com"
+
+type GitlabURL struct {
+	Host string
+	// Project is the full path of the project, including any groups and subgroups
+	Project string
+	Ref     string
+	Subdir  string
+	IsBlob  bool
+}
+
+// ParseGitlabURL parses a link to a project on gitlab.com, or on the self-hosted instance at host if that isn't empty.
+// The project's files are linked to like gitlab.com/GROUP/PROJECT/-/tree/REF/SUBDIR or gitlab.com/GROUP/PROJECT/SUBDIR,
+// and projects in subgroups have to be linked with tree or blob, since their path can't be told apart from a SUBDIR.
+func ParseGitlabURL(url string, host string, defaultRef string) (GitlabURL, error) {
+	trimmed := strings.TrimPrefix(strings.TrimPrefix(url, "https://"), "http://")
+	trimmed = strings.TrimPrefix(trimmed, "www.")
+
+	matchedHost := ""
+	for _, candidate := range []string{GitlabHost, host} {
+		if candidate != "" && strings.HasPrefix(trimmed, candidate+"/") {
+			matchedHost = candidate
+		}
+	}
+	if matchedHost == "" || strings.ContainsAny(trimmed, "?=") {
+		return GitlabURL{}, errors.New(fmt.Sprintf("Unable to parse %q as a gitlab url", url))
+	}
+
+	segments := strings.Split(strings.Trim(strings.TrimPrefix(trimmed, matchedHost+"/"), "/"), "/")
+	parsed := GitlabURL{Host: matchedHost, Ref: defaultRef}
+
+	// the project is at least GROUP/PROJECT, and ends where its tree or blob starts
+	for i := 2; i+1 < len(segments); i++ {
+		kindIndex := i
+		if segments[i] == "-" {
+			kindIndex = i + 1
+		}
+		if kindIndex+1 >= len(segments) {
+			break
+		}
+		kind := segments[kindIndex]
+		if kind != "tree" && kind != "blob" {
+			continue
+		}
+		parsed.Project = strings.Join(segments[:i], "/")
+		parsed.Ref = segments[kindIndex+1]
+		parsed.Subdir = strings.Join(segments[kindIndex+2:], "/")
+		parsed.IsBlob = kind == "blob"
+		break
+	}
+
+	if parsed.Project == "" {
+		if len(segments) < 2 || segments[0] == "" || segments[1] == "" {
+			return GitlabURL{}, errors.New(fmt.Sprintf("Unable to parse %q as a gitlab url", url))
+		}
+		parsed.Project = strings.Join(segments[:2], "/")
+		parsed.Subdir = strings.Join(segments[2:], "/")
+	}
+	parsed.Project = strings.TrimSuffix(parsed.Project, ".git")
+
+	return parsed, nil
+}
+
+// IsGitlabURL returns true if this parses as a link to a project on gitlab.com, or on the self-hosted instance at host
+func IsGitlabURL(url string, host string) bool {
+	_, err := ParseGitlabURL(url, host, "")
+	return err == nil
+}
@@ -0,0 +1,88 @@
+package util
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseGitlabURL(t *testing.T) {
+	tests := []struct {
+		name    string
+		url     string
+		host    string
+		want    GitlabURL
+		wantErr bool
+	}{
+		{
+			name: "project",
+			url:  "gitlab.com/replicatedhq/charts",
+			want: GitlabURL{Host: "gitlab.com", Project: "replicatedhq/charts", Ref: "master"},
+		},
+		{
+			name: "project with subdir",
+			url:  "https://gitlab.com/replicatedhq/charts/stable/nginx",
+			want: GitlabURL{Host: "gitlab.com", Project: "replicatedhq/charts", Ref: "master", Subdir: "stable/nginx"},
+		},
+		{
+			name: "tree",
+			url:  "https://gitlab.com/replicatedhq/charts/-/tree/v1.2.0/stable/nginx",
+			want: GitlabURL{Host: "gitlab.com", Project: "replicatedhq/charts", Ref: "v1.2.0", Subdir: "stable/nginx"},
+		},
+		{
+			name: "tree in a subgroup",
+			url:  "gitlab.com/replicatedhq/platform/charts/-/tree/master/stable/nginx",
+			want: GitlabURL{Host: "gitlab.com", Project: "replicatedhq/platform/charts", Ref: "master", Subdir: "stable/nginx"},
+		},
+		{
+			name: "old style tree",
+			url:  "gitlab.com/replicatedhq/charts/tree/abcdef123456/stable/nginx",
+			want: GitlabURL{Host: "gitlab.com", Project: "replicatedhq/charts", Ref: "abcdef123456", Subdir: "stable/nginx"},
+		},
+		{
+			name: "blob",
+			url:  "https://www.gitlab.com/replicatedhq/charts/-/blob/master/plain-k8s/deployment.yaml",
+			want: GitlabURL{Host: "gitlab.com", Project: "replicatedhq/charts", Ref: "master", Subdir: "plain-k8s/deployment.yaml", IsBlob: true},
+		},
+		{
+			name: "self-hosted",
+			url:  "https://gitlab.example.com/platform/charts.git",
+			host: "gitlab.example.com",
+			want: GitlabURL{Host: "gitlab.example.com", Project: "platform/charts", Ref: "master"},
+		},
+		{
+			name:    "self-hosted without its host",
+			url:     "https://gitlab.example.com/platform/charts",
+			wantErr: true,
+		},
+		{
+			name:    "go-getter url",
+			url:     "gitlab.com/replicatedhq/charts?ref=master//stable/nginx",
+			wantErr: true,
+		},
+		{
+			name:    "no project",
+			url:     "gitlab.com/replicatedhq",
+			wantErr: true,
+		},
+		{
+			name:    "github",
+			url:     "github.com/replicatedhq/ship",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := require.New(t)
+			got, err := ParseGitlabURL(tt.url, tt.host, "master")
+			if tt.wantErr {
+				req.Error(err)
+				req.False(IsGitlabURL(tt.url, tt.host))
+				return
+			}
+			req.NoError(err)
+			req.Equal(tt.want, got)
+			req.True(IsGitlabURL(tt.url, tt.host))
+		})
+	}
+}